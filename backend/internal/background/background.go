@@ -0,0 +1,43 @@
+// Package background runs work that outlives the request that started it,
+// such as sending email, so that shutdown can wait for it to finish.
+package background
+
+import (
+	"context"
+	"sync"
+)
+
+// Runner tracks the functions started with Go
+type Runner struct {
+	wg sync.WaitGroup
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// Go runs fn in a new goroutine
+func (r *Runner) Go(fn func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until every function started with Go has returned, or until
+// ctx is done
+func (r *Runner) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
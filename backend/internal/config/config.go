@@ -1,40 +1,337 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
 )
 
+// Config is loaded from defaults, then the YAML file named by CONFIG_FILE,
+// then environment variables. Each field's env tag names its variable, default
+// holds its value when neither source sets it, and secret redacts it when the
+// configuration is logged.
 type Config struct {
-	DBHost                string
-	DBPort               string
-	DBUser               string
-	DBPassword           string
-	DBName               string
-	JWTSecret            string
-	CSRFSecret           string
-	CORSOrigin           string
+	Env        string `yaml:"env" env:"APP_ENV" default:"development"`
+	ConfigFile string `yaml:"-" env:"CONFIG_FILE"`
+
+	Port              int           `yaml:"port" env:"PORT" default:"8000"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" default:"15s"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT" default:"5s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" default:"60s"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+	Timezone          string        `yaml:"timezone" env:"TIMEZONE" default:"Asia/Jakarta"`
+	LogLevel          string        `yaml:"log_level" env:"LOG_LEVEL" default:"info"`
+
+	DBHost            string        `yaml:"db_host" env:"DB_HOST" default:"localhost"`
+	DBPort            int           `yaml:"db_port" env:"DB_PORT" default:"5432"`
+	DBUser            string        `yaml:"db_user" env:"DB_USER" default:"agrione"`
+	DBPassword        string        `yaml:"db_password" env:"DB_PASSWORD" default:"agrione123" secret:"true"`
+	DBName            string        `yaml:"db_name" env:"DB_NAME" default:"agrione_db"`
+	DBMaxOpenConns    int           `yaml:"db_max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	DBMaxIdleConns    int           `yaml:"db_max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"5"`
+	DBConnMaxLifetime time.Duration `yaml:"db_conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+
+	JWTSecret  string `yaml:"jwt_secret" env:"JWT_SECRET" default:"your-super-secret-jwt-key-change-in-production" secret:"true"`
+	CSRFSecret string `yaml:"csrf_secret" env:"CSRF_SECRET" default:"your-csrf-secret-key-change-in-production" secret:"true"`
+	CSRFSecure bool   `yaml:"csrf_secure" env:"CSRF_SECURE" default:"false"`
+	CORSOrigin string `yaml:"cors_origin" env:"CORS_ORIGIN" default:"http://localhost:3000"`
+
+	// TrustedProxies is a comma-separated list of IPs and CIDRs whose
+	// X-Real-IP and X-Forwarded-For headers are believed
+	TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" default:"127.0.0.1,::1"`
+
+	LotExpiryAlertDays int `yaml:"lot_expiry_alert_days" env:"LOT_EXPIRY_ALERT_DAYS" default:"30"`
+
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"720h"`
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" default:"1h"`
+	FrontendURL      string        `yaml:"frontend_url" env:"FRONTEND_URL" default:"http://localhost:3000"`
+
+	MailDriver   string `yaml:"mail_driver" env:"MAIL_DRIVER" default:"log"`
+	MailFrom     string `yaml:"mail_from" env:"MAIL_FROM" default:"AgriOne <no-reply@agrione.local>"`
+	MailLogFile  string `yaml:"mail_log_file" env:"MAIL_LOG_FILE"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT" default:"587"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+
+	LoginMaxFailures     int           `yaml:"login_max_failures" env:"LOGIN_MAX_FAILURES" default:"5"`
+	LoginIPMaxFailures   int           `yaml:"login_ip_max_failures" env:"LOGIN_IP_MAX_FAILURES" default:"20"`
+	LoginLockoutDuration time.Duration `yaml:"login_lockout_duration" env:"LOGIN_LOCKOUT_DURATION" default:"15m"`
+	LoginBackoffBase     time.Duration `yaml:"login_backoff_base" env:"LOGIN_BACKOFF_BASE" default:"1s"`
+	LoginBackoffMax      time.Duration `yaml:"login_backoff_max" env:"LOGIN_BACKOFF_MAX" default:"5m"`
+
+	MFAIssuer     string        `yaml:"mfa_issuer" env:"MFA_ISSUER" default:"AgriOne"`
+	MFAPendingTTL time.Duration `yaml:"mfa_pending_ttl" env:"MFA_PENDING_TTL" default:"5m"`
+
+	// MetricsToken, when set, is the bearer token /metrics requires
+	MetricsToken string `yaml:"metrics_token" env:"METRICS_TOKEN" secret:"true"`
+
+	// Location is Timezone, loaded by Validate. database.Init sets the same
+	// zone on every database session, so timestamps are formatted and dates
+	// compared in it.
+	Location *time.Location `yaml:"-"`
+	// TrustedProxyNets is TrustedProxies, parsed by Validate
+	TrustedProxyNets []*net.IPNet `yaml:"-"`
 }
 
-func Load() *Config {
-	return &Config{
-		DBHost:                getEnv("DB_HOST", "localhost"),
-		DBPort:                getEnv("DB_PORT", "5432"),
-		DBUser:                getEnv("DB_USER", "agrione"),
-		DBPassword:            getEnv("DB_PASSWORD", "agrione123"),
-		DBName:                getEnv("DB_NAME", "agrione_db"),
-		JWTSecret:             getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
-		CSRFSecret:            getEnv("CSRF_SECRET", "your-csrf-secret-key-change-in-production"),
-		CORSOrigin:            getEnv("CORS_ORIGIN", "http://localhost:3000"),
+// Load builds the configuration and validates it. It fails rather than fall
+// back to a default when a value cannot be parsed.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	fields := cfg.fields()
+
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := setValue(f.value, def); err != nil {
+				return nil, fmt.Errorf("invalid default for %s: %w", f.env, err)
+			}
+		}
 	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+		cfg.ConfigFile = path
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if value := os.Getenv(f.env); value != "" {
+			if err := setValue(f.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (c *Config) loadFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("config file %s: only YAML files are supported", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
-	return defaultValue
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
 }
 
+// IsProduction reports whether APP_ENV is production
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
 
+// Validate checks every value and, in production, refuses the built-in
+// default secrets
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
 
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		fail("APP_ENV must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env)
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		fail("PORT must be between 1 and 65535, got %d", c.Port)
+	}
+	if c.DBPort < 1 || c.DBPort > 65535 {
+		fail("DB_PORT must be between 1 and 65535, got %d", c.DBPort)
+	}
+	if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+		fail("SMTP_PORT must be between 1 and 65535, got %d", c.SMTPPort)
+	}
+
+	for _, f := range c.fields() {
+		switch v := f.value.Interface().(type) {
+		case time.Duration:
+			if v <= 0 {
+				fail("%s must be positive, got %s", f.env, v)
+			}
+		case int:
+			if v <= 0 {
+				fail("%s must be positive, got %d", f.env, v)
+			}
+		}
+	}
+	if c.DBMaxIdleConns > c.DBMaxOpenConns {
+		fail("DB_MAX_IDLE_CONNS (%d) cannot exceed DB_MAX_OPEN_CONNS (%d)", c.DBMaxIdleConns, c.DBMaxOpenConns)
+	}
+	if c.LoginBackoffBase > c.LoginBackoffMax {
+		fail("LOGIN_BACKOFF_BASE (%s) cannot exceed LOGIN_BACKOFF_MAX (%s)", c.LoginBackoffBase, c.LoginBackoffMax)
+	}
+
+	required := []struct{ env, value string }{
+		{"DB_HOST", c.DBHost},
+		{"DB_USER", c.DBUser},
+		{"DB_NAME", c.DBName},
+		{"JWT_SECRET", c.JWTSecret},
+		{"CSRF_SECRET", c.CSRFSecret},
+		{"FRONTEND_URL", c.FrontendURL},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			fail("%s must be set", r.env)
+		}
+	}
+
+	switch c.MailDriver {
+	case "log":
+	case "smtp":
+		if c.SMTPHost == "" {
+			fail("SMTP_HOST must be set when MAIL_DRIVER is smtp")
+		}
+	default:
+		fail("MAIL_DRIVER must be \"log\" or \"smtp\", got %q", c.MailDriver)
+	}
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		fail("LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		fail("TIMEZONE %q is not a known time zone", c.Timezone)
+	}
+	c.Location = loc
+
+	c.TrustedProxyNets = nil
+	for _, entry := range strings.Split(c.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			fail("TRUSTED_PROXIES: %q is not an IP address or CIDR", entry)
+			continue
+		}
+		c.TrustedProxyNets = append(c.TrustedProxyNets, network)
+	}
+
+	if c.IsProduction() {
+		for _, f := range c.fields() {
+			if f.tag.Get("secret") != "true" {
+				continue
+			}
+			if def, ok := f.tag.Lookup("default"); ok && f.value.String() == def {
+				fail("%s still has its default value; set it before running in production", f.env)
+			}
+		}
+		if len(c.JWTSecret) < 32 {
+			fail("JWT_SECRET must be at least 32 characters in production")
+		}
+		if len(c.CSRFSecret) < 32 {
+			fail("CSRF_SECRET must be at least 32 characters in production")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LogValue logs the effective configuration as a group, keyed by environment
+// variable and with secrets redacted
+func (c *Config) LogValue() slog.Value {
+	fields := c.fields()
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		value := fmt.Sprint(f.value.Interface())
+		if f.tag.Get("secret") == "true" && value != "" {
+			value = "[redacted]"
+		}
+		attrs = append(attrs, slog.String(f.env, value))
+	}
+	return slog.GroupValue(attrs...)
+}
 
+type field struct {
+	env   string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+// fields lists the settable fields, those with an env tag
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		env, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		fields = append(fields, field{env: env, tag: t.Field(i).Tag, value: v.Field(i)})
+	}
+	return fields
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(raw)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql.
+// They are applied in version order and recorded with a checksum of their up
+// SQL in schema_migrations; an applied migration must never be edited, add a
+// new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the advisory lock held while a migration runs, so that
+// replicas starting together apply each migration once
+const migrationLockKey = 0x6d696772
+
+// baselineVersion captures the schema built by the boot-time migrations of the
+// last release before versioned migrations. It has no down migration and is
+// never rolled back.
+const baselineVersion = 1
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// LoadMigrations reads the embedded migrations in version order
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and rolls back migrations. With DryRun set it only writes
+// the SQL it would run to Out.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	DryRun     bool
+	Out        io.Writer
+}
+
+func NewMigrator(db *sql.DB, out io.Writer) (*Migrator, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != baselineVersion {
+		return nil, fmt.Errorf("migrations must start with the baseline, version %d", baselineVersion)
+	}
+	return &Migrator{db: db, migrations: migrations, Out: out}, nil
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt string
+}
+
+// RunMigrations brings the schema up to date; it runs on every boot
+func RunMigrations(db *sql.DB) error {
+	m, err := NewMigrator(db, io.Discard)
+	if err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil {
+		return err
+	}
+	slog.Info("Database migrations completed")
+	return nil
+}
+
+// Up applies every pending migration in version order
+func (m *Migrator) Up() error {
+	applied, err := m.prepare()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if m.DryRun {
+			fmt.Fprintf(m.Out, "-- %04d_%s.up.sql\n%s\n", migration.Version, migration.Name, migration.Up)
+			continue
+		}
+		if err := m.apply(migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down rolls back the latest steps applied migrations, newest first
+func (m *Migrator) Down(steps int) error {
+	applied, err := m.prepare()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		steps--
+		if migration.Version == baselineVersion {
+			return fmt.Errorf("migration %04d_%s is the baseline and cannot be rolled back", migration.Version, migration.Name)
+		}
+		if migration.Down == "" {
+			return fmt.Errorf("migration %04d_%s has no down file", migration.Version, migration.Name)
+		}
+		if m.DryRun {
+			fmt.Fprintf(m.Out, "-- %04d_%s.down.sql\n%s\n", migration.Version, migration.Name, migration.Down)
+			continue
+		}
+		if err := m.revert(migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status writes every migration with when it was applied, or pending
+func (m *Migrator) Status() error {
+	applied, err := m.prepare()
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		state := "pending"
+		if a, ok := applied[migration.Version]; ok {
+			state = "applied " + a.AppliedAt
+		}
+		fmt.Fprintf(m.Out, "%04d_%s\t%s\n", migration.Version, migration.Name, state)
+	}
+	return nil
+}
+
+// prepare creates schema_migrations, records the baseline for databases built
+// before versioned migrations and checks that applied migrations are unchanged.
+// In a dry run nothing is written.
+func (m *Migrator) prepare() (map[int]appliedMigration, error) {
+	var exists, hasRows bool
+	if err := m.db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check schema_migrations: %w", err)
+	}
+	if exists {
+		if err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations)").Scan(&hasRows); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+	}
+
+	legacy := false
+	if !hasRows {
+		var err error
+		if legacy, err = m.legacySchema(); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.DryRun && (!exists || legacy) {
+		applied := map[int]appliedMigration{}
+		if legacy {
+			baseline := m.migrations[0]
+			fmt.Fprintf(m.Out, "-- existing schema would be recorded as %04d_%s\n", baseline.Version, baseline.Name)
+			applied[baseline.Version] = appliedMigration{Name: baseline.Name, Checksum: baseline.Checksum}
+		}
+		return applied, nil
+	}
+	if !m.DryRun && (!exists || legacy) {
+		if err := m.createTable(legacy); err != nil {
+			return nil, err
+		}
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	known := map[int]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, a := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %04d_%s is missing from this build", version, a.Name)
+		}
+		if migration.Checksum != a.Checksum {
+			return nil, fmt.Errorf("migration %04d_%s was changed after it was applied", version, migration.Name)
+		}
+	}
+	return applied, nil
+}
+
+// legacySchema reports whether the database was built by the boot-time
+// migrations that came before versioned migrations, which always created users
+func (m *Migrator) legacySchema() (bool, error) {
+	var hasUsers bool
+	if err := m.db.QueryRow("SELECT to_regclass('users') IS NOT NULL").Scan(&hasUsers); err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return hasUsers, nil
+}
+
+func (m *Migrator) createTable(legacy bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	if legacy {
+		baseline := m.migrations[0]
+		result, err := tx.Exec(`
+			INSERT INTO schema_migrations (version, name, checksum)
+			SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM schema_migrations)
+		`, baseline.Version, baseline.Name, baseline.Checksum)
+		if err != nil {
+			return fmt.Errorf("failed to record baseline migration: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			slog.Info("Existing schema recorded as baseline migration", "version", baseline.Version, "name", baseline.Name)
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) applied() (map[int]appliedMigration, error) {
+	rows, err := m.db.Query(`
+		SELECT version, name, checksum,
+		       TO_CHAR(applied_at, 'YYYY-MM-DD"T"HH24:MI:SS') as applied_at
+		FROM schema_migrations
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		var appliedAt sql.NullString
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		if appliedAt.Valid {
+			a.AppliedAt = appliedAt.String
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// apply runs one migration and records it in the same transaction. Another
+// replica may have applied it while this one waited for the lock.
+func (m *Migrator) apply(migration Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	var done bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version).Scan(&done); err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration.Up); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	_, err = tx.Exec(
+		"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+		migration.Version, migration.Name, migration.Checksum,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	return nil
+}
+
+// revert runs one migration's down SQL and forgets it in the same transaction
+func (m *Migrator) revert(migration Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration.Down); err != nil {
+		return fmt.Errorf("rolling back migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Rolled back migration", "version", migration.Version, "name", migration.Name)
+	return nil
+}
+
+// MigrateCommand runs "migrate up|down|status [-dry-run] [-steps n]"
+func MigrateCommand(db *sql.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status [-dry-run] [-steps n]")
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the SQL that would run without running it")
+	steps := flags.Int("steps", 1, "number of migrations to roll back (down only)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	m, err := NewMigrator(db, out)
+	if err != nil {
+		return err
+	}
+	m.DryRun = *dryRun
+
+	switch args[0] {
+	case "up":
+		return m.Up()
+	case "down":
+		if *steps < 1 {
+			return errors.New("-steps must be at least 1")
+		}
+		return m.Down(*steps)
+	case "status":
+		return m.Status()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,293 @@
+-- Baseline: the schema as built by the boot-time migrations of the last
+-- release before versioned migrations. Databases created by that release are
+-- recorded as being at this version without running it.
+
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	username VARCHAR(100) UNIQUE NOT NULL,
+	first_name VARCHAR(100) NOT NULL,
+	last_name VARCHAR(100) NOT NULL,
+	password_hash VARCHAR(255) NOT NULL,
+	role VARCHAR(50) DEFAULT 'user' NOT NULL,
+	status VARCHAR(20) DEFAULT 'pending' NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_users_email ON users(email);
+CREATE INDEX idx_users_username ON users(username);
+CREATE INDEX idx_users_status ON users(status);
+
+CREATE TABLE plant_types (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_plant_types_name ON plant_types(name);
+
+CREATE TABLE fields (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	area DOUBLE PRECISION,
+	coordinates JSONB NOT NULL,
+	draw_type VARCHAR(50) NOT NULL,
+	plant_type_id INTEGER REFERENCES plant_types(id) ON DELETE SET NULL,
+	soil_type_id INTEGER,
+	user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_fields_plant_type ON fields(plant_type_id);
+CREATE INDEX idx_fields_name ON fields(name);
+CREATE INDEX idx_fields_user_id ON fields(user_id);
+
+CREATE TABLE plots (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	type VARCHAR(50) NOT NULL,
+	apikey VARCHAR(255) UNIQUE NOT NULL,
+	coordinates JSONB NOT NULL,
+	field_ref INTEGER REFERENCES fields(id) ON DELETE CASCADE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_plots_field_ref ON plots(field_ref);
+CREATE INDEX idx_plots_apikey ON plots(apikey);
+CREATE INDEX idx_plots_name ON plots(name);
+
+CREATE TABLE field_reports (
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	condition VARCHAR(50) NOT NULL,
+	coordinates JSONB NOT NULL,
+	notes TEXT,
+	submitted_by VARCHAR(255) NOT NULL,
+	work_order_id INTEGER,
+	media JSONB DEFAULT '[]'::jsonb,
+	status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+	approved_by VARCHAR(255),
+	approved_at TIMESTAMP,
+	rejection_reason TEXT,
+	harvest_quantity DOUBLE PRECISION,
+	harvest_quality VARCHAR(100),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_field_reports_submitted_by ON field_reports(submitted_by);
+CREATE INDEX idx_field_reports_work_order ON field_reports(work_order_id);
+CREATE INDEX idx_field_reports_created_at ON field_reports(created_at);
+
+CREATE TABLE field_report_comments (
+	id SERIAL PRIMARY KEY,
+	field_report_id INTEGER REFERENCES field_reports(id) ON DELETE CASCADE,
+	comment TEXT NOT NULL,
+	commented_by VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_field_report_comments_field_report_id ON field_report_comments(field_report_id);
+CREATE INDEX idx_field_report_comments_created_at ON field_report_comments(created_at);
+
+CREATE TABLE notifications (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	type VARCHAR(50) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	message TEXT NOT NULL,
+	link VARCHAR(500),
+	read BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id);
+CREATE INDEX idx_notifications_read ON notifications(read);
+CREATE INDEX idx_notifications_created_at ON notifications(created_at);
+
+CREATE TABLE inventory_items (
+	id SERIAL PRIMARY KEY,
+	sku VARCHAR(100) UNIQUE NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	category VARCHAR(100) NOT NULL,
+	unit VARCHAR(50) NOT NULL,
+	reorder_point DOUBLE PRECISION NOT NULL DEFAULT 0,
+	status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'discontinued')),
+	avg_cost DOUBLE PRECISION DEFAULT 0,
+	description TEXT,
+	suppliers JSONB DEFAULT '[]'::jsonb,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_items_sku ON inventory_items(sku);
+CREATE INDEX idx_inventory_items_category ON inventory_items(category);
+CREATE INDEX idx_inventory_items_status ON inventory_items(status);
+CREATE INDEX idx_inventory_items_name ON inventory_items(name);
+
+CREATE TABLE stock_lots (
+	id SERIAL PRIMARY KEY,
+	lot_id VARCHAR(100) UNIQUE NOT NULL,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	batch_no VARCHAR(100) NOT NULL,
+	quantity DOUBLE PRECISION NOT NULL,
+	unit_cost DOUBLE PRECISION NOT NULL,
+	total_cost DOUBLE PRECISION NOT NULL,
+	expiry_date TIMESTAMP,
+	supplier VARCHAR(255) NOT NULL,
+	status VARCHAR(20) DEFAULT 'available' CHECK (status IN ('available', 'reserved', 'expired', 'depleted')),
+	notes TEXT,
+	received_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_lots_item_id ON stock_lots(item_id);
+CREATE INDEX idx_stock_lots_warehouse_id ON stock_lots(warehouse_id);
+CREATE INDEX idx_stock_lots_lot_id ON stock_lots(lot_id);
+CREATE INDEX idx_stock_lots_status ON stock_lots(status);
+CREATE INDEX idx_stock_lots_expiry_date ON stock_lots(expiry_date);
+
+CREATE TABLE attendance (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	date DATE NOT NULL,
+	session VARCHAR(20) NOT NULL CHECK (session IN ('pagi', 'sore')),
+	selfie_image TEXT NOT NULL,
+	back_camera_image TEXT,
+	has_issue BOOLEAN DEFAULT false,
+	description TEXT,
+	latitude DOUBLE PRECISION,
+	longitude DOUBLE PRECISION,
+	check_in_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	check_out_time TIMESTAMP,
+	status VARCHAR(50) DEFAULT 'hadir' NOT NULL,
+	notes TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, date, session)
+);
+
+CREATE INDEX idx_attendance_user_id ON attendance(user_id);
+CREATE INDEX idx_attendance_date ON attendance(date);
+CREATE INDEX idx_attendance_user_date ON attendance(user_id, date);
+
+CREATE TABLE cultivation_seasons (
+	id SERIAL PRIMARY KEY,
+	field_id INTEGER REFERENCES fields(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	planting_date DATE NOT NULL,
+	status VARCHAR(50) DEFAULT 'active' CHECK (status IN ('active', 'completed')),
+	completed_date TIMESTAMP,
+	notes TEXT,
+	created_by VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_cultivation_seasons_field_id ON cultivation_seasons(field_id);
+CREATE INDEX idx_cultivation_seasons_status ON cultivation_seasons(status);
+CREATE INDEX idx_cultivation_seasons_planting_date ON cultivation_seasons(planting_date);
+
+CREATE TABLE work_orders (
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	category VARCHAR(100) NOT NULL,
+	activity VARCHAR(100) NOT NULL,
+	status VARCHAR(50) DEFAULT 'pending' NOT NULL,
+	priority VARCHAR(50) DEFAULT 'medium' NOT NULL,
+	assignee VARCHAR(255) NOT NULL,
+	field_id INTEGER REFERENCES fields(id) ON DELETE CASCADE,
+	cultivation_season_id INTEGER REFERENCES cultivation_seasons(id) ON DELETE SET NULL,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	progress INTEGER DEFAULT 0 CHECK (progress >= 0 AND progress <= 100),
+	description TEXT,
+	requirements JSONB DEFAULT '[]'::jsonb,
+	material_requirements JSONB DEFAULT '[]'::jsonb,
+	actual_hours INTEGER DEFAULT 0,
+	notes TEXT,
+	created_by VARCHAR(255) NOT NULL,
+	last_updated_by VARCHAR(255),
+	completed_date TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_work_orders_field_id ON work_orders(field_id);
+CREATE INDEX idx_work_orders_status ON work_orders(status);
+CREATE INDEX idx_work_orders_category ON work_orders(category);
+CREATE INDEX idx_work_orders_start_date ON work_orders(start_date);
+CREATE INDEX idx_work_orders_end_date ON work_orders(end_date);
+CREATE INDEX idx_work_orders_assignee ON work_orders(assignee);
+CREATE INDEX idx_work_orders_cultivation_season_id ON work_orders(cultivation_season_id);
+CREATE INDEX idx_work_orders_material_requirements ON work_orders USING GIN(material_requirements);
+
+CREATE TABLE stock_requests (
+	id SERIAL PRIMARY KEY,
+	request_id VARCHAR(100) UNIQUE NOT NULL,
+	work_order_id INTEGER NOT NULL REFERENCES work_orders(id) ON DELETE CASCADE,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	quantity DOUBLE PRECISION NOT NULL,
+	warehouse_id INTEGER REFERENCES plots(id) ON DELETE RESTRICT,
+	status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'fulfilled', 'cancelled')),
+	requested_by VARCHAR(255) NOT NULL,
+	approved_by VARCHAR(255),
+	approved_at TIMESTAMP,
+	rejection_reason TEXT,
+	fulfilled_at TIMESTAMP,
+	notes TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_requests_work_order_id ON stock_requests(work_order_id);
+CREATE INDEX idx_stock_requests_item_id ON stock_requests(item_id);
+CREATE INDEX idx_stock_requests_warehouse_id ON stock_requests(warehouse_id);
+CREATE INDEX idx_stock_requests_status ON stock_requests(status);
+CREATE INDEX idx_stock_requests_request_id ON stock_requests(request_id);
+CREATE INDEX idx_stock_requests_created_at ON stock_requests(created_at);
+
+CREATE TABLE stock_movements (
+	id SERIAL PRIMARY KEY,
+	movement_id VARCHAR(100) UNIQUE NOT NULL,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	lot_id INTEGER REFERENCES stock_lots(id) ON DELETE SET NULL,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	type VARCHAR(20) NOT NULL CHECK (type IN ('in', 'out', 'transfer', 'adjustment')),
+	quantity DOUBLE PRECISION NOT NULL,
+	unit_cost DOUBLE PRECISION NOT NULL,
+	total_cost DOUBLE PRECISION NOT NULL,
+	reason VARCHAR(255) NOT NULL,
+	reference VARCHAR(255),
+	performed_by VARCHAR(255) NOT NULL,
+	stock_request_id INTEGER REFERENCES stock_requests(id) ON DELETE SET NULL,
+	notes TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_movements_item_id ON stock_movements(item_id);
+CREATE INDEX idx_stock_movements_lot_id ON stock_movements(lot_id);
+CREATE INDEX idx_stock_movements_warehouse_id ON stock_movements(warehouse_id);
+CREATE INDEX idx_stock_movements_type ON stock_movements(type);
+CREATE INDEX idx_stock_movements_movement_id ON stock_movements(movement_id);
+CREATE INDEX idx_stock_movements_created_at ON stock_movements(created_at);
+CREATE INDEX idx_stock_movements_stock_request_id ON stock_movements(stock_request_id);
+
+-- A fresh database starts with the default plant types
+INSERT INTO plant_types (name)
+SELECT p.name
+FROM UNNEST(ARRAY['Padi', 'Jagung', 'Kedelai', 'Kacang Tanah', 'Ubi Kayu', 'Ubi Jalar',
+                  'Tebu', 'Karet', 'Kelapa Sawit', 'Kopi', 'Teh', 'Cokelat']) WITH ORDINALITY AS p(name, n)
+ORDER BY p.n;
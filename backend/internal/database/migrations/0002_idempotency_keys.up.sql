@@ -0,0 +1,11 @@
+-- Replay protection for stock-mutating requests
+CREATE TABLE idempotency_keys (
+	id SERIAL PRIMARY KEY,
+	idempotency_key VARCHAR(255) NOT NULL,
+	endpoint VARCHAR(100) NOT NULL,
+	resource_id INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(idempotency_key, endpoint)
+);
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys(created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE stock_movements DROP COLUMN direction;
+ALTER TABLE stock_movements DROP COLUMN transfer_id;
+DROP TABLE stock_transfer_lines;
+DROP TABLE stock_transfers;
@@ -0,0 +1,37 @@
+-- Warehouse-to-warehouse transfers
+CREATE TABLE stock_transfers (
+	id SERIAL PRIMARY KEY,
+	transfer_id VARCHAR(100) UNIQUE NOT NULL,
+	source_warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	destination_warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	status VARCHAR(20) DEFAULT 'in_transit' CHECK (status IN ('in_transit', 'received')),
+	performed_by VARCHAR(255) NOT NULL,
+	received_by VARCHAR(255),
+	notes TEXT,
+	shipped_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	received_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_transfers_source ON stock_transfers(source_warehouse_id);
+CREATE INDEX idx_stock_transfers_destination ON stock_transfers(destination_warehouse_id);
+CREATE INDEX idx_stock_transfers_status ON stock_transfers(status);
+
+CREATE TABLE stock_transfer_lines (
+	id SERIAL PRIMARY KEY,
+	transfer_id INTEGER NOT NULL REFERENCES stock_transfers(id) ON DELETE CASCADE,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	source_lot_id INTEGER NOT NULL REFERENCES stock_lots(id) ON DELETE RESTRICT,
+	destination_lot_id INTEGER REFERENCES stock_lots(id) ON DELETE SET NULL,
+	quantity DOUBLE PRECISION NOT NULL CHECK (quantity > 0),
+	unit_cost DOUBLE PRECISION NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_transfer_lines_transfer_id ON stock_transfer_lines(transfer_id);
+
+ALTER TABLE stock_movements ADD COLUMN transfer_id INTEGER REFERENCES stock_transfers(id) ON DELETE SET NULL;
+ALTER TABLE stock_movements ADD COLUMN direction VARCHAR(3) CHECK (direction IN ('in', 'out'));
+
+CREATE INDEX idx_stock_movements_transfer_id ON stock_movements(transfer_id);
@@ -0,0 +1,3 @@
+ALTER TABLE stock_movements DROP COLUMN stock_count_id;
+DROP TABLE stock_count_lines;
+DROP TABLE stock_counts;
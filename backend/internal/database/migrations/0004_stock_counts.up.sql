@@ -0,0 +1,40 @@
+-- Cycle counting / physical stock counts
+CREATE TABLE stock_counts (
+	id SERIAL PRIMARY KEY,
+	count_id VARCHAR(100) UNIQUE NOT NULL,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	status VARCHAR(20) DEFAULT 'open' CHECK (status IN ('open', 'submitted', 'approved', 'rejected')),
+	created_by VARCHAR(255) NOT NULL,
+	submitted_by VARCHAR(255),
+	submitted_at TIMESTAMP,
+	approved_by VARCHAR(255),
+	approved_at TIMESTAMP,
+	rejection_reason TEXT,
+	notes TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_counts_warehouse_id ON stock_counts(warehouse_id);
+CREATE INDEX idx_stock_counts_status ON stock_counts(status);
+
+CREATE TABLE stock_count_lines (
+	id SERIAL PRIMARY KEY,
+	count_id INTEGER NOT NULL REFERENCES stock_counts(id) ON DELETE CASCADE,
+	lot_id INTEGER NOT NULL REFERENCES stock_lots(id) ON DELETE CASCADE,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	expected_quantity DOUBLE PRECISION NOT NULL,
+	counted_quantity DOUBLE PRECISION CHECK (counted_quantity >= 0),
+	unit_cost DOUBLE PRECISION NOT NULL,
+	reason_code VARCHAR(50),
+	notes TEXT,
+	counted_by VARCHAR(255),
+	counted_at TIMESTAMP,
+	UNIQUE(count_id, lot_id)
+);
+
+CREATE INDEX idx_stock_count_lines_count_id ON stock_count_lines(count_id);
+
+ALTER TABLE stock_movements ADD COLUMN stock_count_id INTEGER REFERENCES stock_counts(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_stock_movements_stock_count_id ON stock_movements(stock_count_id);
@@ -0,0 +1,4 @@
+DROP TABLE inventory_cost_layers;
+DROP TABLE inventory_costs;
+ALTER TABLE stock_movements DROP COLUMN effective_date;
+ALTER TABLE inventory_items DROP COLUMN costing_method;
@@ -0,0 +1,48 @@
+-- Costing engine: per item/warehouse cost state and FIFO cost layers
+ALTER TABLE inventory_items ADD COLUMN costing_method VARCHAR(20) NOT NULL DEFAULT 'weighted_average' CHECK (costing_method IN ('weighted_average', 'fifo'));
+
+ALTER TABLE stock_movements ADD COLUMN effective_date TIMESTAMP;
+UPDATE stock_movements SET effective_date = created_at;
+ALTER TABLE stock_movements ALTER COLUMN effective_date SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE stock_movements ALTER COLUMN effective_date SET NOT NULL;
+
+CREATE INDEX idx_stock_movements_item_effective_date ON stock_movements(item_id, effective_date);
+
+CREATE TABLE inventory_costs (
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+	total_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+	avg_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (item_id, warehouse_id)
+);
+
+CREATE TABLE inventory_cost_layers (
+	id SERIAL PRIMARY KEY,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	movement_id INTEGER REFERENCES stock_movements(id) ON DELETE SET NULL,
+	layer_date TIMESTAMP NOT NULL,
+	quantity DOUBLE PRECISION NOT NULL,
+	remaining_quantity DOUBLE PRECISION NOT NULL,
+	unit_cost DOUBLE PRECISION NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_inventory_cost_layers_item_warehouse ON inventory_cost_layers(item_id, warehouse_id, layer_date);
+
+-- Lot values were not maintained on removal before the costing engine
+UPDATE stock_lots SET total_cost = quantity * unit_cost WHERE total_cost <> quantity * unit_cost;
+
+-- Seed the cost state from the lots on hand
+INSERT INTO inventory_cost_layers (item_id, warehouse_id, layer_date, quantity, remaining_quantity, unit_cost)
+SELECT item_id, warehouse_id, received_date, quantity, quantity, unit_cost
+FROM stock_lots
+WHERE status IN ('available', 'reserved') AND quantity > 0;
+
+INSERT INTO inventory_costs (item_id, warehouse_id, quantity, total_value, avg_cost)
+SELECT item_id, warehouse_id, SUM(quantity), SUM(quantity * unit_cost), SUM(quantity * unit_cost) / SUM(quantity)
+FROM stock_lots
+WHERE status IN ('available', 'reserved') AND quantity > 0
+GROUP BY item_id, warehouse_id;
@@ -0,0 +1,19 @@
+-- Soft holds placed on approval of a stock request
+CREATE TABLE stock_reservations (
+	id SERIAL PRIMARY KEY,
+	stock_request_id INTEGER NOT NULL REFERENCES stock_requests(id) ON DELETE CASCADE,
+	lot_id INTEGER NOT NULL REFERENCES stock_lots(id) ON DELETE CASCADE,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	quantity DOUBLE PRECISION NOT NULL CHECK (quantity > 0),
+	status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'consumed', 'released', 'expired')),
+	expires_at TIMESTAMP NOT NULL,
+	released_at TIMESTAMP,
+	release_reason VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_reservations_stock_request_id ON stock_reservations(stock_request_id);
+CREATE INDEX idx_stock_reservations_lot_id ON stock_reservations(lot_id) WHERE status = 'active';
+CREATE INDEX idx_stock_reservations_item_warehouse ON stock_reservations(item_id, warehouse_id) WHERE status = 'active';
@@ -0,0 +1 @@
+ALTER TABLE stock_lots DROP COLUMN expiry_alerted_at;
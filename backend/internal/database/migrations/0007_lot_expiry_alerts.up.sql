@@ -0,0 +1,2 @@
+-- Expiry alerts are sent once per lot
+ALTER TABLE stock_lots ADD COLUMN expiry_alerted_at TIMESTAMP;
@@ -0,0 +1,3 @@
+DROP TABLE purchase_suggestion_lines;
+DROP TABLE purchase_suggestions;
+ALTER TABLE inventory_items DROP COLUMN reorder_alerted_at;
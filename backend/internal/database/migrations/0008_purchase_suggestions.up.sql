@@ -0,0 +1,31 @@
+-- Draft replenishment orders per supplier
+ALTER TABLE inventory_items ADD COLUMN reorder_alerted_at TIMESTAMP;
+
+CREATE TABLE purchase_suggestions (
+	id SERIAL PRIMARY KEY,
+	suggestion_id VARCHAR(100) UNIQUE NOT NULL,
+	supplier VARCHAR(255) NOT NULL,
+	status VARCHAR(20) DEFAULT 'draft' CHECK (status IN ('draft', 'dismissed', 'ordered')),
+	dismissed_by VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_purchase_suggestions_status ON purchase_suggestions(status);
+CREATE INDEX idx_purchase_suggestions_supplier ON purchase_suggestions(supplier);
+
+CREATE TABLE purchase_suggestion_lines (
+	id SERIAL PRIMARY KEY,
+	suggestion_id INTEGER NOT NULL REFERENCES purchase_suggestions(id) ON DELETE CASCADE,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE CASCADE,
+	on_hand DOUBLE PRECISION NOT NULL,
+	reserved DOUBLE PRECISION NOT NULL,
+	open_demand DOUBLE PRECISION NOT NULL,
+	reorder_point DOUBLE PRECISION NOT NULL,
+	avg_daily_consumption DOUBLE PRECISION NOT NULL,
+	suggested_quantity DOUBLE PRECISION NOT NULL,
+	estimated_unit_cost DOUBLE PRECISION NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_purchase_suggestion_lines_suggestion_id ON purchase_suggestion_lines(suggestion_id);
@@ -0,0 +1,6 @@
+ALTER TABLE stock_lots DROP COLUMN purchase_order_line_id;
+DROP TABLE goods_receipt_lines;
+DROP TABLE goods_receipts;
+DROP TABLE purchase_order_lines;
+DROP TABLE purchase_orders;
+DROP TABLE suppliers;
@@ -0,0 +1,88 @@
+-- Supplier master, purchase orders and goods receipts
+CREATE TABLE suppliers (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) UNIQUE NOT NULL,
+	contact_name VARCHAR(255),
+	phone VARCHAR(50),
+	email VARCHAR(255),
+	address TEXT,
+	notes TEXT,
+	status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'inactive')),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_suppliers_status ON suppliers(status);
+
+-- Seed the supplier master from the free-text supplier names already in use
+INSERT INTO suppliers (name)
+SELECT DISTINCT TRIM(name) FROM (
+	SELECT supplier AS name FROM stock_lots
+	UNION
+	SELECT jsonb_array_elements_text(suppliers) AS name FROM inventory_items WHERE jsonb_typeof(suppliers) = 'array'
+) names
+WHERE TRIM(name) != ''
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE purchase_orders (
+	id SERIAL PRIMARY KEY,
+	po_number VARCHAR(100) UNIQUE NOT NULL,
+	supplier_id INTEGER NOT NULL REFERENCES suppliers(id) ON DELETE RESTRICT,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	status VARCHAR(20) DEFAULT 'draft' CHECK (status IN ('draft', 'submitted', 'partially_received', 'received', 'cancelled')),
+	expected_date DATE,
+	purchase_suggestion_id INTEGER REFERENCES purchase_suggestions(id) ON DELETE SET NULL,
+	notes TEXT,
+	created_by VARCHAR(255) NOT NULL,
+	submitted_by VARCHAR(255),
+	submitted_at TIMESTAMP,
+	cancelled_by VARCHAR(255),
+	cancelled_at TIMESTAMP,
+	cancellation_reason TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_purchase_orders_supplier_id ON purchase_orders(supplier_id);
+CREATE INDEX idx_purchase_orders_status ON purchase_orders(status);
+
+CREATE TABLE purchase_order_lines (
+	id SERIAL PRIMARY KEY,
+	purchase_order_id INTEGER NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+	item_id INTEGER NOT NULL REFERENCES inventory_items(id) ON DELETE RESTRICT,
+	quantity_ordered DOUBLE PRECISION NOT NULL CHECK (quantity_ordered > 0),
+	quantity_received DOUBLE PRECISION NOT NULL DEFAULT 0,
+	unit_cost DOUBLE PRECISION NOT NULL,
+	notes TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_purchase_order_lines_purchase_order_id ON purchase_order_lines(purchase_order_id);
+
+CREATE TABLE goods_receipts (
+	id SERIAL PRIMARY KEY,
+	receipt_number VARCHAR(100) UNIQUE NOT NULL,
+	purchase_order_id INTEGER NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+	warehouse_id INTEGER NOT NULL REFERENCES plots(id) ON DELETE RESTRICT,
+	received_by VARCHAR(255) NOT NULL,
+	received_date DATE NOT NULL DEFAULT CURRENT_DATE,
+	notes TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_goods_receipts_purchase_order_id ON goods_receipts(purchase_order_id);
+
+CREATE TABLE goods_receipt_lines (
+	id SERIAL PRIMARY KEY,
+	goods_receipt_id INTEGER NOT NULL REFERENCES goods_receipts(id) ON DELETE CASCADE,
+	purchase_order_line_id INTEGER NOT NULL REFERENCES purchase_order_lines(id) ON DELETE CASCADE,
+	lot_id INTEGER REFERENCES stock_lots(id) ON DELETE SET NULL,
+	quantity DOUBLE PRECISION NOT NULL CHECK (quantity > 0),
+	unit_cost DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX idx_goods_receipt_lines_goods_receipt_id ON goods_receipt_lines(goods_receipt_id);
+
+ALTER TABLE stock_lots ADD COLUMN purchase_order_line_id INTEGER REFERENCES purchase_order_lines(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_stock_lots_purchase_order_line_id ON stock_lots(purchase_order_line_id);
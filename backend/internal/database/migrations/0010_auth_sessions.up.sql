@@ -0,0 +1,26 @@
+-- One session per login, rotating refresh tokens
+CREATE TABLE auth_sessions (
+	id SERIAL PRIMARY KEY,
+	session_id VARCHAR(64) UNIQUE NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_agent TEXT,
+	ip_address VARCHAR(100),
+	expires_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	revoke_reason VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_auth_sessions_user_id ON auth_sessions(user_id);
+
+CREATE TABLE refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	session_id INTEGER NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
@@ -0,0 +1,6 @@
+DROP TABLE login_ip_throttle;
+DROP TABLE login_attempts;
+ALTER TABLE users DROP COLUMN locked_until;
+ALTER TABLE users DROP COLUMN login_next_attempt_at;
+ALTER TABLE users DROP COLUMN last_failed_login_at;
+ALTER TABLE users DROP COLUMN failed_login_attempts;
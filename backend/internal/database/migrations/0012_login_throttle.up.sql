@@ -0,0 +1,27 @@
+-- Login throttling and per-account lockout
+ALTER TABLE users ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN last_failed_login_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN login_next_attempt_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMP;
+
+CREATE TABLE login_attempts (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	ip_address VARCHAR(100) NOT NULL,
+	user_agent TEXT,
+	failure_reason VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_login_attempts_user_id ON login_attempts(user_id);
+CREATE INDEX idx_login_attempts_ip_address ON login_attempts(ip_address);
+CREATE INDEX idx_login_attempts_created_at ON login_attempts(created_at);
+
+CREATE TABLE login_ip_throttle (
+	ip_address VARCHAR(100) PRIMARY KEY,
+	failed_attempts INTEGER NOT NULL DEFAULT 0,
+	last_failed_at TIMESTAMP,
+	next_attempt_at TIMESTAMP,
+	blocked_until TIMESTAMP
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN reviewed_at;
+ALTER TABLE users DROP COLUMN reviewed_by;
+ALTER TABLE users DROP COLUMN review_reason;
@@ -0,0 +1,4 @@
+-- Signup review by Level 1 users
+ALTER TABLE users ADD COLUMN review_reason TEXT;
+ALTER TABLE users ADD COLUMN reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN reviewed_at TIMESTAMP;
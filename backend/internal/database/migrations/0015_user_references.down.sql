@@ -0,0 +1,10 @@
+DROP TABLE user_reference_issues;
+ALTER TABLE stock_movements DROP COLUMN performed_by_user_id;
+ALTER TABLE stock_requests DROP COLUMN approved_by_user_id;
+ALTER TABLE stock_requests DROP COLUMN requested_by_user_id;
+ALTER TABLE field_report_comments DROP COLUMN commented_by_user_id;
+ALTER TABLE field_reports DROP COLUMN approved_by_user_id;
+ALTER TABLE field_reports DROP COLUMN submitted_by_user_id;
+ALTER TABLE work_orders DROP COLUMN last_updated_by_user_id;
+ALTER TABLE work_orders DROP COLUMN created_by_user_id;
+ALTER TABLE work_orders DROP COLUMN assignee_user_id;
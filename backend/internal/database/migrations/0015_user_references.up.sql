@@ -0,0 +1,224 @@
+-- users.id references next to the free-text person columns
+ALTER TABLE work_orders ADD COLUMN assignee_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE work_orders ADD COLUMN created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE work_orders ADD COLUMN last_updated_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE field_reports ADD COLUMN submitted_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE field_reports ADD COLUMN approved_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE field_report_comments ADD COLUMN commented_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE stock_requests ADD COLUMN requested_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE stock_requests ADD COLUMN approved_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE stock_movements ADD COLUMN performed_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_work_orders_assignee_user_id ON work_orders(assignee_user_id);
+CREATE INDEX idx_field_reports_submitted_by_user_id ON field_reports(submitted_by_user_id);
+CREATE INDEX idx_stock_requests_requested_by_user_id ON stock_requests(requested_by_user_id);
+CREATE INDEX idx_stock_movements_performed_by_user_id ON stock_movements(performed_by_user_id);
+
+-- Rows whose name could not be matched to exactly one user
+CREATE TABLE user_reference_issues (
+	id SERIAL PRIMARY KEY,
+	table_name VARCHAR(64) NOT NULL,
+	column_name VARCHAR(64) NOT NULL,
+	row_id INTEGER NOT NULL,
+	value TEXT NOT NULL,
+	reason VARCHAR(20) NOT NULL,
+	candidate_user_ids INTEGER[] NOT NULL DEFAULT '{}',
+	resolved_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	resolved_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (table_name, column_name, row_id)
+);
+
+-- Backfill the references: a name counts as a match when it equals exactly
+-- one user's full name, username or email (case-insensitive). Anything else
+-- is written to user_reference_issues for an admin to resolve.
+
+-- work_orders.assignee
+UPDATE work_orders SET assignee_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM work_orders t
+	JOIN users u ON LOWER(TRIM(t.assignee)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE work_orders.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'work_orders', 'assignee', t.id, t.assignee,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM work_orders t
+LEFT JOIN users u ON LOWER(TRIM(t.assignee)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.assignee_user_id IS NULL
+  AND t.assignee IS NOT NULL AND TRIM(t.assignee) NOT IN ('', 'System')
+GROUP BY t.id, t.assignee;
+
+-- work_orders.created_by
+UPDATE work_orders SET created_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM work_orders t
+	JOIN users u ON LOWER(TRIM(t.created_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE work_orders.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'work_orders', 'created_by', t.id, t.created_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM work_orders t
+LEFT JOIN users u ON LOWER(TRIM(t.created_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.created_by_user_id IS NULL
+  AND t.created_by IS NOT NULL AND TRIM(t.created_by) NOT IN ('', 'System')
+GROUP BY t.id, t.created_by;
+
+-- work_orders.last_updated_by
+UPDATE work_orders SET last_updated_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM work_orders t
+	JOIN users u ON LOWER(TRIM(t.last_updated_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE work_orders.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'work_orders', 'last_updated_by', t.id, t.last_updated_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM work_orders t
+LEFT JOIN users u ON LOWER(TRIM(t.last_updated_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.last_updated_by_user_id IS NULL
+  AND t.last_updated_by IS NOT NULL AND TRIM(t.last_updated_by) NOT IN ('', 'System')
+GROUP BY t.id, t.last_updated_by;
+
+-- field_reports.submitted_by
+UPDATE field_reports SET submitted_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM field_reports t
+	JOIN users u ON LOWER(TRIM(t.submitted_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE field_reports.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'field_reports', 'submitted_by', t.id, t.submitted_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM field_reports t
+LEFT JOIN users u ON LOWER(TRIM(t.submitted_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.submitted_by_user_id IS NULL
+  AND t.submitted_by IS NOT NULL AND TRIM(t.submitted_by) NOT IN ('', 'System')
+GROUP BY t.id, t.submitted_by;
+
+-- field_reports.approved_by
+UPDATE field_reports SET approved_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM field_reports t
+	JOIN users u ON LOWER(TRIM(t.approved_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE field_reports.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'field_reports', 'approved_by', t.id, t.approved_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM field_reports t
+LEFT JOIN users u ON LOWER(TRIM(t.approved_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.approved_by_user_id IS NULL
+  AND t.approved_by IS NOT NULL AND TRIM(t.approved_by) NOT IN ('', 'System')
+GROUP BY t.id, t.approved_by;
+
+-- field_report_comments.commented_by
+UPDATE field_report_comments SET commented_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM field_report_comments t
+	JOIN users u ON LOWER(TRIM(t.commented_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE field_report_comments.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'field_report_comments', 'commented_by', t.id, t.commented_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM field_report_comments t
+LEFT JOIN users u ON LOWER(TRIM(t.commented_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.commented_by_user_id IS NULL
+  AND t.commented_by IS NOT NULL AND TRIM(t.commented_by) NOT IN ('', 'System')
+GROUP BY t.id, t.commented_by;
+
+-- stock_requests.requested_by
+UPDATE stock_requests SET requested_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM stock_requests t
+	JOIN users u ON LOWER(TRIM(t.requested_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE stock_requests.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'stock_requests', 'requested_by', t.id, t.requested_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM stock_requests t
+LEFT JOIN users u ON LOWER(TRIM(t.requested_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.requested_by_user_id IS NULL
+  AND t.requested_by IS NOT NULL AND TRIM(t.requested_by) NOT IN ('', 'System')
+GROUP BY t.id, t.requested_by;
+
+-- stock_requests.approved_by
+UPDATE stock_requests SET approved_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM stock_requests t
+	JOIN users u ON LOWER(TRIM(t.approved_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE stock_requests.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'stock_requests', 'approved_by', t.id, t.approved_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM stock_requests t
+LEFT JOIN users u ON LOWER(TRIM(t.approved_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.approved_by_user_id IS NULL
+  AND t.approved_by IS NOT NULL AND TRIM(t.approved_by) NOT IN ('', 'System')
+GROUP BY t.id, t.approved_by;
+
+-- stock_movements.performed_by
+UPDATE stock_movements SET performed_by_user_id = m.user_id
+FROM (
+	SELECT t.id, MIN(u.id) AS user_id
+	FROM stock_movements t
+	JOIN users u ON LOWER(TRIM(t.performed_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+	GROUP BY t.id
+	HAVING COUNT(DISTINCT u.id) = 1
+) m
+WHERE stock_movements.id = m.id;
+
+INSERT INTO user_reference_issues (table_name, column_name, row_id, value, reason, candidate_user_ids)
+SELECT 'stock_movements', 'performed_by', t.id, t.performed_by,
+       CASE WHEN COUNT(u.id) = 0 THEN 'unmatched' ELSE 'ambiguous' END,
+       ARRAY_REMOVE(ARRAY_AGG(DISTINCT u.id), NULL)
+FROM stock_movements t
+LEFT JOIN users u ON LOWER(TRIM(t.performed_by)) IN (LOWER(TRIM(u.first_name || ' ' || u.last_name)), LOWER(u.username), LOWER(u.email))
+WHERE t.performed_by_user_id IS NULL
+  AND t.performed_by IS NOT NULL AND TRIM(t.performed_by) NOT IN ('', 'System')
+GROUP BY t.id, t.performed_by;
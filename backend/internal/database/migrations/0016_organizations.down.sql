@@ -0,0 +1,32 @@
+-- Fails if two organizations now share an SKU, supplier name or attendance
+-- slot, since those become globally unique again
+ALTER TABLE users DROP COLUMN last_organization_id;
+ALTER TABLE auth_sessions DROP COLUMN organization_id;
+
+ALTER TABLE attendance DROP CONSTRAINT attendance_organization_user_date_session_key;
+ALTER TABLE attendance ADD CONSTRAINT attendance_user_id_date_session_key UNIQUE (user_id, date, session);
+ALTER TABLE suppliers DROP CONSTRAINT suppliers_organization_name_key;
+ALTER TABLE suppliers ADD CONSTRAINT suppliers_name_key UNIQUE (name);
+ALTER TABLE inventory_items DROP CONSTRAINT inventory_items_organization_sku_key;
+ALTER TABLE inventory_items ADD CONSTRAINT inventory_items_sku_key UNIQUE (sku);
+
+ALTER TABLE goods_receipts DROP COLUMN organization_id;
+ALTER TABLE purchase_suggestions DROP COLUMN organization_id;
+ALTER TABLE purchase_orders DROP COLUMN organization_id;
+ALTER TABLE suppliers DROP COLUMN organization_id;
+ALTER TABLE stock_counts DROP COLUMN organization_id;
+ALTER TABLE stock_transfers DROP COLUMN organization_id;
+ALTER TABLE stock_requests DROP COLUMN organization_id;
+ALTER TABLE stock_movements DROP COLUMN organization_id;
+ALTER TABLE stock_lots DROP COLUMN organization_id;
+ALTER TABLE inventory_items DROP COLUMN organization_id;
+ALTER TABLE attendance DROP COLUMN organization_id;
+ALTER TABLE field_reports DROP COLUMN organization_id;
+ALTER TABLE work_orders DROP COLUMN organization_id;
+ALTER TABLE cultivation_seasons DROP COLUMN organization_id;
+ALTER TABLE plant_types DROP COLUMN organization_id;
+ALTER TABLE plots DROP COLUMN organization_id;
+ALTER TABLE fields DROP COLUMN organization_id;
+
+DROP TABLE organization_members;
+DROP TABLE organizations;
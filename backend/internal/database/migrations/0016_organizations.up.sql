@@ -0,0 +1,129 @@
+-- Organizations (estates/companies). Every existing row and every user but
+-- superadmins moves into a default organization.
+CREATE TABLE organizations (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	slug VARCHAR(100) UNIQUE NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-organization role; users.role stays the account's default role
+-- and is the only place 'superadmin' is granted
+CREATE TABLE organization_members (
+	organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+
+INSERT INTO organizations (name, slug) VALUES ('Default Organization', 'default');
+
+INSERT INTO organization_members (organization_id, user_id, role)
+SELECT o.id, u.id, u.role FROM users u, organizations o
+WHERE o.slug = 'default' AND u.role != 'superadmin';
+
+-- Top-level domain tables carry an organization_id. Child tables (lines,
+-- comments, cost layers, reservations) inherit it from their parent.
+
+ALTER TABLE fields ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE fields SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE fields ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_fields_organization_id ON fields(organization_id);
+
+ALTER TABLE plots ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE plots SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE plots ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_plots_organization_id ON plots(organization_id);
+
+ALTER TABLE plant_types ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE plant_types SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE plant_types ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_plant_types_organization_id ON plant_types(organization_id);
+
+ALTER TABLE cultivation_seasons ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE cultivation_seasons SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE cultivation_seasons ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_cultivation_seasons_organization_id ON cultivation_seasons(organization_id);
+
+ALTER TABLE work_orders ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE work_orders SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE work_orders ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_work_orders_organization_id ON work_orders(organization_id);
+
+ALTER TABLE field_reports ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE field_reports SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE field_reports ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_field_reports_organization_id ON field_reports(organization_id);
+
+ALTER TABLE attendance ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE attendance SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE attendance ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_attendance_organization_id ON attendance(organization_id);
+
+ALTER TABLE inventory_items ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE inventory_items SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE inventory_items ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_inventory_items_organization_id ON inventory_items(organization_id);
+
+ALTER TABLE stock_lots ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE stock_lots SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE stock_lots ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_stock_lots_organization_id ON stock_lots(organization_id);
+
+ALTER TABLE stock_movements ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE stock_movements SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE stock_movements ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_stock_movements_organization_id ON stock_movements(organization_id);
+
+ALTER TABLE stock_requests ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE stock_requests SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE stock_requests ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_stock_requests_organization_id ON stock_requests(organization_id);
+
+ALTER TABLE stock_transfers ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE stock_transfers SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE stock_transfers ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_stock_transfers_organization_id ON stock_transfers(organization_id);
+
+ALTER TABLE stock_counts ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE stock_counts SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE stock_counts ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_stock_counts_organization_id ON stock_counts(organization_id);
+
+ALTER TABLE suppliers ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE suppliers SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE suppliers ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_suppliers_organization_id ON suppliers(organization_id);
+
+ALTER TABLE purchase_orders ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE purchase_orders SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE purchase_orders ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_purchase_orders_organization_id ON purchase_orders(organization_id);
+
+ALTER TABLE purchase_suggestions ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE purchase_suggestions SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE purchase_suggestions ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_purchase_suggestions_organization_id ON purchase_suggestions(organization_id);
+
+ALTER TABLE goods_receipts ADD COLUMN organization_id INTEGER REFERENCES organizations(id);
+UPDATE goods_receipts SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE goods_receipts ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_goods_receipts_organization_id ON goods_receipts(organization_id);
+
+-- Names and codes that were globally unique are now unique per organization
+ALTER TABLE inventory_items DROP CONSTRAINT inventory_items_sku_key;
+ALTER TABLE inventory_items ADD CONSTRAINT inventory_items_organization_sku_key UNIQUE (organization_id, sku);
+ALTER TABLE suppliers DROP CONSTRAINT suppliers_name_key;
+ALTER TABLE suppliers ADD CONSTRAINT suppliers_organization_name_key UNIQUE (organization_id, name);
+ALTER TABLE attendance DROP CONSTRAINT attendance_user_id_date_session_key;
+ALTER TABLE attendance ADD CONSTRAINT attendance_organization_user_date_session_key UNIQUE (organization_id, user_id, date, session);
+
+-- The organization a session is working in (carried in its access tokens)
+-- and the one a user last switched to
+ALTER TABLE auth_sessions ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN last_organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+DROP TABLE api_keys;
+DELETE FROM users WHERE account_type = 'service';
+ALTER TABLE users DROP COLUMN account_type;
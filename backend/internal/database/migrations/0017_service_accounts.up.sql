@@ -0,0 +1,20 @@
+-- Service accounts are users rows that cannot log in; integrations call the
+-- API with their hashed, scoped API keys
+ALTER TABLE users ADD COLUMN account_type VARCHAR(20) DEFAULT 'user' NOT NULL;
+
+CREATE TABLE api_keys (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	prefix VARCHAR(32) UNIQUE NOT NULL,
+	key_hash VARCHAR(64) NOT NULL,
+	scopes TEXT[] DEFAULT '{}' NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	revoked_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
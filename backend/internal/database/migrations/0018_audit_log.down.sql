@@ -0,0 +1,5 @@
+-- Destroys the audit trail; export it first if it has to be kept
+DROP TRIGGER audit_log_no_truncate ON audit_log;
+DROP TRIGGER audit_log_append_only ON audit_log;
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
@@ -0,0 +1,36 @@
+-- Audit log of mutating API calls. Entries are hash chained per organization
+-- and the table only accepts inserts. There is no down migration: dropping the
+-- table would destroy the trail it exists to keep.
+CREATE TABLE audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	organization_id INTEGER,
+	actor_user_id INTEGER,
+	api_key_id INTEGER,
+	action VARCHAR(255) NOT NULL,
+	entity_type VARCHAR(100) NOT NULL,
+	entity_id VARCHAR(100),
+	before_data JSON,
+	after_data JSON,
+	ip_address VARCHAR(45) NOT NULL,
+	user_agent TEXT NOT NULL,
+	status_code INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	prev_hash VARCHAR(64) NOT NULL,
+	hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_audit_log_organization_id ON audit_log(organization_id, id);
+CREATE INDEX idx_audit_log_entity ON audit_log(entity_type, entity_id);
+CREATE INDEX idx_audit_log_actor_user_id ON audit_log(actor_user_id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,8 @@
+-- Keys of different users may share a value, so they cannot all be kept
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_user_key_endpoint_key;
+ALTER TABLE idempotency_keys ADD CONSTRAINT idempotency_keys_idempotency_key_endpoint_key UNIQUE (idempotency_key, endpoint);
+
+ALTER TABLE idempotency_keys DROP COLUMN request_hash;
+ALTER TABLE idempotency_keys DROP COLUMN user_id;
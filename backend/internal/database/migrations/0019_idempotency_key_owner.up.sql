@@ -0,0 +1,10 @@
+-- Idempotency keys belong to the user who sent them and remember a hash of
+-- the request they were first used with. Existing keys cannot be attributed
+-- to a user, so they are dropped; they only guard against retries anyway.
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys ADD COLUMN user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE idempotency_keys ADD COLUMN request_hash CHAR(64) NOT NULL;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_idempotency_key_endpoint_key;
+ALTER TABLE idempotency_keys ADD CONSTRAINT idempotency_keys_user_key_endpoint_key UNIQUE (user_id, idempotency_key, endpoint);
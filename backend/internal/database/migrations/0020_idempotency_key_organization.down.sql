@@ -0,0 +1,8 @@
+-- A user's keys in different organizations may share a value, so they cannot
+-- all be kept
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_scope_key;
+ALTER TABLE idempotency_keys ADD CONSTRAINT idempotency_keys_user_key_endpoint_key UNIQUE (user_id, idempotency_key, endpoint);
+
+ALTER TABLE idempotency_keys DROP COLUMN organization_id;
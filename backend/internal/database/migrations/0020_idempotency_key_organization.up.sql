@@ -0,0 +1,9 @@
+-- A user who belongs to several organizations gets a separate key space in
+-- each. Existing keys do not record the organization they were used in, so
+-- they are dropped; they only guard against retries anyway.
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys ADD COLUMN organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_user_key_endpoint_key;
+ALTER TABLE idempotency_keys ADD CONSTRAINT idempotency_keys_scope_key UNIQUE (organization_id, user_id, idempotency_key, endpoint);
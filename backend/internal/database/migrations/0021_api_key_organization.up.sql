@@ -0,0 +1,15 @@
+-- API keys act in the organization they were created in. Existing keys take
+-- their service account's membership; keys of accounts without one could not
+-- be used anyway and are dropped.
+ALTER TABLE api_keys ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+
+UPDATE api_keys k SET organization_id = (
+	SELECT om.organization_id FROM organization_members om
+	WHERE om.user_id = k.user_id
+	ORDER BY om.created_at ASC, om.organization_id ASC
+	LIMIT 1
+);
+DELETE FROM api_keys WHERE organization_id IS NULL;
+
+ALTER TABLE api_keys ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_api_keys_organization_id ON api_keys(organization_id);
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"agrione/backend/internal/middleware"
+)
+
+// actor is the user a record is attributed to. Name is stored next to the
+// users.id reference as a display snapshot.
+type actor struct {
+	ID   int
+	Name string
+}
+
+var (
+	errUnknownUser   = errors.New("user not found")
+	errAmbiguousUser = errors.New("name matches more than one user")
+)
+
+// userFullNameSQL is how a user's display name is built everywhere
+const userFullNameSQL = "TRIM(first_name || ' ' || last_name)"
+
+// requestActor returns the authenticated user making the request. Actor
+// columns (created_by, submitted_by, approved_by, ...) are always taken from
+// here and never from request bodies.
+func requestActor(db *sql.DB, r *http.Request) (actor, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		return actor{}, errUnknownUser
+	}
+	return loadActor(db, userID)
+}
+
+func loadActor(db *sql.DB, userID int) (actor, error) {
+	a := actor{ID: userID}
+	err := db.QueryRow("SELECT "+userFullNameSQL+" FROM users WHERE id = $1", userID).Scan(&a.Name)
+	if err == sql.ErrNoRows {
+		return a, errUnknownUser
+	}
+	return a, err
+}
+
+// resolveUser finds the user for a target field such as a work order
+// assignee, preferring the ID and falling back to an exact, unique match on
+// full name, username or email for older clients that send a name.
+func resolveUser(db *sql.DB, userID *int, name string) (actor, error) {
+	if userID != nil && *userID > 0 {
+		return loadActor(db, *userID)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return actor{}, errUnknownUser
+	}
+
+	rows, err := db.Query(`
+		SELECT id, `+userFullNameSQL+` FROM users
+		WHERE LOWER($1) IN (LOWER(`+userFullNameSQL+`), LOWER(username), LOWER(email))
+		LIMIT 2
+	`, name)
+	if err != nil {
+		return actor{}, err
+	}
+	defer rows.Close()
+
+	var matches []actor
+	for rows.Next() {
+		var a actor
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			return actor{}, err
+		}
+		matches = append(matches, a)
+	}
+	switch len(matches) {
+	case 0:
+		return actor{}, errUnknownUser
+	case 1:
+		return matches[0], nil
+	default:
+		return actor{}, errAmbiguousUser
+	}
+}
+
+// userID is the actor as a nullable users.id reference; system actors have none
+func (a actor) userID() sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(a.ID), Valid: a.ID > 0}
+}
+
+// systemActor is used for records written by the server itself
+var systemActor = actor{Name: "System"}
+
+// writeActorError answers a failed requestActor lookup
+func writeActorError(w http.ResponseWriter, err error) {
+	if err == errUnknownUser {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, "Database error", http.StatusInternalServerError)
+}
+
+// nullableUserID scans a nullable users.id reference
+func nullableUserID(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	id := int(v.Int64)
+	return &id
+}
@@ -3,22 +3,24 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"agrione/backend/internal/config"
+	"agrione/backend/internal/logging"
 	"agrione/backend/internal/middleware"
 
 	"github.com/gorilla/mux"
 )
 
 type AttendanceHandler struct {
-	db *sql.DB
+	db  *sql.DB
+	cfg *config.Config
 }
 
-func NewAttendanceHandler(db *sql.DB) *AttendanceHandler {
-	return &AttendanceHandler{db: db}
+func NewAttendanceHandler(db *sql.DB, cfg *config.Config) *AttendanceHandler {
+	return &AttendanceHandler{db: db, cfg: cfg}
 }
 
 type Attendance struct {
@@ -81,16 +83,16 @@ func (h *AttendanceHandler) CreateAttendance(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Get today's date in GMT+7 (Asia/Jakarta timezone) - must match GetTodayAttendance
-	loc, _ := time.LoadLocation("Asia/Jakarta")
-	today := time.Now().In(loc).Format("2006-01-02")
+	// Get today's date in the configured timezone - must match GetTodayAttendance
+	today := time.Now().In(h.cfg.Location).Format("2006-01-02")
 
 	// Check if attendance already exists for this user, date, and session
+	orgID := organizationID(r)
 	var existingID int
 	err := h.db.QueryRow(`
 		SELECT id FROM attendance 
-		WHERE user_id = $1 AND date = $2 AND session = $3
-	`, userID, today, req.Session).Scan(&existingID)
+		WHERE user_id = $1 AND date = $2 AND session = $3 AND organization_id = $4
+	`, userID, today, req.Session, orgID).Scan(&existingID)
 
 	if err == nil {
 		// Update existing attendance
@@ -154,10 +156,10 @@ func (h *AttendanceHandler) CreateAttendance(w http.ResponseWriter, r *http.Requ
 	// Create new attendance
 	var attendanceID int
 	err = h.db.QueryRow(`
-		INSERT INTO attendance (user_id, date, session, selfie_image, back_camera_image, has_issue, description, latitude, longitude, notes)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO attendance (user_id, date, session, selfie_image, back_camera_image, has_issue, description, latitude, longitude, notes, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id
-	`, userID, today, req.Session, req.SelfieImage, req.BackCameraImage, req.HasIssue, req.Description, req.Latitude, req.Longitude, req.Notes).Scan(&attendanceID)
+	`, userID, today, req.Session, req.SelfieImage, req.BackCameraImage, req.HasIssue, req.Description, req.Latitude, req.Longitude, req.Notes, orgID).Scan(&attendanceID)
 
 	if err != nil {
 		http.Error(w, "Failed to create attendance", http.StatusInternalServerError)
@@ -173,11 +175,11 @@ func (h *AttendanceHandler) CreateAttendance(w http.ResponseWriter, r *http.Requ
 	err = h.db.QueryRow(`
 		SELECT id, user_id, date, session, selfie_image, back_camera_image, 
 		       has_issue, description, latitude, longitude,
-		       TO_CHAR(check_in_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
-		       TO_CHAR(check_out_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
+		       TO_CHAR(check_in_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
+		       TO_CHAR(check_out_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
 		       status, notes, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM attendance WHERE id = $1
 	`, attendanceID).Scan(
 		&att.ID, &att.UserID, &att.Date, &att.Session, &att.SelfieImage,
@@ -228,26 +230,25 @@ func (h *AttendanceHandler) GetTodayAttendance(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Get today's date in GMT+7 (Asia/Jakarta timezone)
-	loc, _ := time.LoadLocation("Asia/Jakarta")
+	// Get today's date in the configured timezone
+	loc := h.cfg.Location
 	today := time.Now().In(loc).Format("2006-01-02")
 	
-	// Debug logging
-	log.Printf("[DEBUG Attendance] GetTodayAttendance - UserID: %d, Today (GMT+7): %s, Server Time: %s", 
-		userID, today, time.Now().In(loc).Format("2006-01-02 15:04:05 MST"))
+	logging.FromContext(r.Context()).Debug("Today's attendance lookup", "today", today,
+		"server_time", time.Now().In(loc).Format("2006-01-02 15:04:05 MST"))
 
 	rows, err := h.db.Query(`
 		SELECT id, user_id, date, session, selfie_image, back_camera_image, 
 		       has_issue, description, latitude, longitude,
-		       TO_CHAR(check_in_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
-		       TO_CHAR(check_out_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
+		       TO_CHAR(check_in_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
+		       TO_CHAR(check_out_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
 		       status, notes, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM attendance 
-		WHERE user_id = $1 AND date = $2
+		WHERE user_id = $1 AND date = $2 AND organization_id = $3
 		ORDER BY session
-	`, userID, today)
+	`, userID, today, organizationID(r))
 
 	if err != nil {
 		http.Error(w, "Failed to fetch attendance", http.StatusInternalServerError)
@@ -320,16 +321,16 @@ func (h *AttendanceHandler) ListAttendance(w http.ResponseWriter, r *http.Reques
 	query := `
 		SELECT id, user_id, date, session, selfie_image, back_camera_image, 
 		       has_issue, description, latitude, longitude,
-		       TO_CHAR(check_in_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
-		       TO_CHAR(check_out_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
+		       TO_CHAR(check_in_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
+		       TO_CHAR(check_out_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
 		       status, notes, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM attendance 
-		WHERE user_id = $1
+		WHERE user_id = $1 AND organization_id = $2
 	`
-	args := []interface{}{userID}
-	argIndex := 2
+	args := []interface{}{userID, organizationID(r)}
+	argIndex := 3
 
 	if startDate != "" {
 		query += ` AND date >= $` + strconv.Itoa(argIndex)
@@ -418,13 +419,13 @@ func (h *AttendanceHandler) GetAttendance(w http.ResponseWriter, r *http.Request
 	err = h.db.QueryRow(`
 		SELECT id, user_id, date, session, selfie_image, back_camera_image, 
 		       has_issue, description, 
-		       TO_CHAR(check_in_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
-		       TO_CHAR(check_out_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
+		       TO_CHAR(check_in_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
+		       TO_CHAR(check_out_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
 		       status, notes, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-		FROM attendance WHERE id = $1
-	`, id).Scan(
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM attendance WHERE id = $1 AND organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&att.ID, &att.UserID, &att.Date, &att.Session, &att.SelfieImage,
 		&backCameraImage, &att.HasIssue, &description,
 		&checkInTime, &checkOutTime, &att.Status, &notes, &createdAt, &updatedAt,
@@ -474,9 +475,9 @@ func (h *AttendanceHandler) ListAllAttendances(w http.ResponseWriter, r *http.Re
 	}
 
 	// Get user role - only Level 1 and Level 2 can access this
-	// We need to check user role from database
-	var userRole string
-	err := h.db.QueryRow(`SELECT role FROM users WHERE id = $1`, userID).Scan(&userRole)
+	// We need to check the user's role in the active organization
+	orgID := organizationID(r)
+	userRole, err := organizationRole(h.db, userID, orgID)
 	if err != nil {
 		http.Error(w, "Failed to verify user", http.StatusInternalServerError)
 		return
@@ -495,16 +496,16 @@ func (h *AttendanceHandler) ListAllAttendances(w http.ResponseWriter, r *http.Re
 	query := `
 		SELECT a.id, a.user_id, a.date, a.session, a.selfie_image, a.back_camera_image, 
 		       a.has_issue, a.description, a.latitude, a.longitude,
-		       TO_CHAR(a.check_in_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
-		       TO_CHAR(a.check_out_time AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
+		       TO_CHAR(a.check_in_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_in_time,
+		       TO_CHAR(a.check_out_time, 'YYYY-MM-DD"T"HH24:MI:SS') as check_out_time,
 		       a.status, a.notes, 
-		       TO_CHAR(a.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(a.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		       TO_CHAR(a.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(a.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM attendance a
-		WHERE 1=1
+		WHERE a.organization_id = $1
 	`
-	args := []interface{}{}
-	argIndex := 1
+	args := []interface{}{orgID}
+	argIndex := 2
 
 	// Filter by user_id if provided
 	if requestedUserId != "" {
@@ -517,7 +518,8 @@ func (h *AttendanceHandler) ListAllAttendances(w http.ResponseWriter, r *http.Re
 	} else {
 		// Only show Level 3 and Level 4 users' attendance
 		query += ` AND EXISTS (
-			SELECT 1 FROM users u WHERE u.id = a.user_id AND u.role IN ('Level 3', 'Level 4')
+			SELECT 1 FROM organization_members om
+			WHERE om.user_id = a.user_id AND om.organization_id = a.organization_id AND om.role IN ('Level 3', 'Level 4')
 		)`
 	}
 
@@ -2,9 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
+
+	"agrione/backend/internal/logging"
 )
 
 // AttendanceStats represents attendance statistics
@@ -35,22 +36,25 @@ type FieldInfo struct {
 }
 
 func (h *AttendanceHandler) GetAttendanceStats(w http.ResponseWriter, r *http.Request) {
-	// Get today's date in GMT+7
-	loc, _ := time.LoadLocation("Asia/Jakarta")
+	// Get today's date in the configured timezone
+	loc := h.cfg.Location
 	now := time.Now().In(loc)
 	today := now.Format("2006-01-02")
 	weekStart := now.AddDate(0, 0, -int(now.Weekday())).Format("2006-01-02")
 	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc).Format("2006-01-02")
 	
-	log.Printf("[DEBUG Attendance Stats] Today: %s, Week Start: %s, Month Start: %s", today, weekStart, monthStart)
+	logger := logging.FromContext(r.Context())
+	logger.Debug("Attendance stats period", "today", today, "week_start", weekStart, "month_start", monthStart)
 	
-	// Get Level 3 and 4 users
+	// Get Level 3 and 4 members of the organization
+	orgID := organizationID(r)
 	rows, err := h.db.Query(`
-		SELECT id, email, first_name, last_name, role
-		FROM users
-		WHERE role IN ('Level 3', 'Level 4') AND status = 'approved'
-		ORDER BY first_name, last_name
-	`)
+		SELECT u.id, u.email, u.first_name, u.last_name, om.role
+		FROM users u
+		JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $1
+		WHERE om.role IN ('Level 3', 'Level 4') AND u.status = 'approved'
+		ORDER BY u.first_name, u.last_name
+	`, orgID)
 	if err != nil {
 		http.Error(w, "Failed to get users", http.StatusInternalServerError)
 		return
@@ -94,42 +98,42 @@ func (h *AttendanceHandler) GetAttendanceStats(w http.ResponseWriter, r *http.Re
 		
 		// Get total attendance
 		err := h.db.QueryRow(`
-			SELECT COUNT(*) FROM attendance WHERE user_id = $1
-		`, user.ID).Scan(&userStats.TotalAttendance)
+			SELECT COUNT(*) FROM attendance WHERE user_id = $1 AND organization_id = $2
+		`, user.ID, orgID).Scan(&userStats.TotalAttendance)
 		if err != nil {
-			log.Printf("Error getting total attendance for user %d: %v", user.ID, err)
+			logger.Error("Failed to get total attendance", "member_user_id", user.ID, "error", err)
 		}
 		
 		// Get today's attendance
 		err = h.db.QueryRow(`
-			SELECT COUNT(*) FROM attendance WHERE user_id = $1 AND date = $2
-		`, user.ID, today).Scan(&userStats.TodayAttendance)
+			SELECT COUNT(*) FROM attendance WHERE user_id = $1 AND date = $2 AND organization_id = $3
+		`, user.ID, today, orgID).Scan(&userStats.TodayAttendance)
 		if err != nil {
-			log.Printf("Error getting today attendance for user %d: %v", user.ID, err)
+			logger.Error("Failed to get today attendance", "member_user_id", user.ID, "error", err)
 		}
 		
 		// Get this week's attendance
 		err = h.db.QueryRow(`
 			SELECT COUNT(*) FROM attendance 
-			WHERE user_id = $1 AND date >= $2 AND date <= $3
-		`, user.ID, weekStart, today).Scan(&userStats.ThisWeekAttendance)
+			WHERE user_id = $1 AND date >= $2 AND date <= $3 AND organization_id = $4
+		`, user.ID, weekStart, today, orgID).Scan(&userStats.ThisWeekAttendance)
 		if err != nil {
-			log.Printf("Error getting week attendance for user %d: %v", user.ID, err)
+			logger.Error("Failed to get week attendance", "member_user_id", user.ID, "error", err)
 		}
 		
 		// Get this month's attendance
 		err = h.db.QueryRow(`
 			SELECT COUNT(*) FROM attendance 
-			WHERE user_id = $1 AND date >= $2 AND date <= $3
-		`, user.ID, monthStart, today).Scan(&userStats.ThisMonthAttendance)
+			WHERE user_id = $1 AND date >= $2 AND date <= $3 AND organization_id = $4
+		`, user.ID, monthStart, today, orgID).Scan(&userStats.ThisMonthAttendance)
 		if err != nil {
-			log.Printf("Error getting month attendance for user %d: %v", user.ID, err)
+			logger.Error("Failed to get month attendance", "member_user_id", user.ID, "error", err)
 		}
 		
 		// Get assigned fields
 		fieldRows, err := h.db.Query(`
-			SELECT id, name FROM fields WHERE user_id = $1
-		`, user.ID)
+			SELECT id, name FROM fields WHERE user_id = $1 AND organization_id = $2
+		`, user.ID, orgID)
 		if err == nil {
 			defer fieldRows.Close()
 			for fieldRows.Next() {
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"agrione/backend/internal/middleware"
+)
+
+type AuditHandler struct {
+	db *sql.DB
+}
+
+func NewAuditHandler(db *sql.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+type AuditEntry struct {
+	ID          int64           `json:"id"`
+	ActorUserID *int            `json:"actor_user_id,omitempty"`
+	ActorName   *string         `json:"actor_name,omitempty"`
+	APIKeyID    *int            `json:"api_key_id,omitempty"`
+	Action      string          `json:"action"`
+	EntityType  string          `json:"entity_type"`
+	EntityID    *string         `json:"entity_id,omitempty"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	IPAddress   string          `json:"ip_address"`
+	UserAgent   string          `json:"user_agent"`
+	StatusCode  int             `json:"status_code"`
+	CreatedAt   string          `json:"created_at"`
+	Hash        string          `json:"hash"`
+}
+
+type AuditListResponse struct {
+	Entries    []AuditEntry `json:"entries"`
+	Total      int          `json:"total"`
+	Page       int          `json:"page"`
+	PageSize   int          `json:"page_size"`
+	TotalPages int          `json:"total_pages"`
+}
+
+type AuditVerifyResponse struct {
+	Valid      bool   `json:"valid"`
+	Checked    int    `json:"checked"`
+	BrokenAtID *int64 `json:"broken_at_id,omitempty"`
+	LastHash   string `json:"last_hash,omitempty"`
+}
+
+// List Audit Log entries of the active organization, newest first
+func (h *AuditHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 50
+	}
+
+	where := " WHERE a.organization_id = $1"
+	args := []interface{}{organizationID(r)}
+	argIndex := 2
+
+	if actor := q.Get("actor_user_id"); actor != "" {
+		id, err := strconv.Atoi(actor)
+		if err != nil {
+			http.Error(w, "Invalid actor_user_id", http.StatusBadRequest)
+			return
+		}
+		where += fmt.Sprintf(" AND a.actor_user_id = $%d", argIndex)
+		args = append(args, id)
+		argIndex++
+	}
+	if action := q.Get("action"); action != "" {
+		where += fmt.Sprintf(" AND a.action = $%d", argIndex)
+		args = append(args, action)
+		argIndex++
+	}
+	if entityType := q.Get("entity_type"); entityType != "" {
+		where += fmt.Sprintf(" AND a.entity_type = $%d", argIndex)
+		args = append(args, entityType)
+		argIndex++
+	}
+	if entityID := q.Get("entity_id"); entityID != "" {
+		where += fmt.Sprintf(" AND a.entity_id = $%d", argIndex)
+		args = append(args, entityID)
+		argIndex++
+	}
+	if from := q.Get("from"); from != "" {
+		where += fmt.Sprintf(" AND a.created_at::date >= $%d::date", argIndex)
+		args = append(args, from)
+		argIndex++
+	}
+	if to := q.Get("to"); to != "" {
+		where += fmt.Sprintf(" AND a.created_at::date <= $%d::date", argIndex)
+		args = append(args, to)
+		argIndex++
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM audit_log a"+where, args...).Scan(&total); err != nil {
+		http.Error(w, "Failed to get audit log", http.StatusInternalServerError)
+		return
+	}
+
+	query := `
+		SELECT a.id, a.actor_user_id, u.first_name || ' ' || u.last_name, a.api_key_id,
+		       a.action, a.entity_type, a.entity_id, a.before_data, a.after_data,
+		       a.ip_address, a.user_agent, a.status_code,
+		       TO_CHAR(a.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       a.hash
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_user_id
+	` + where + fmt.Sprintf(" ORDER BY a.id DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var actorUserID, apiKeyID sql.NullInt64
+		var actorName, entityID, before, after sql.NullString
+		if err := rows.Scan(&e.ID, &actorUserID, &actorName, &apiKeyID, &e.Action, &e.EntityType, &entityID,
+			&before, &after, &e.IPAddress, &e.UserAgent, &e.StatusCode, &e.CreatedAt, &e.Hash); err != nil {
+			http.Error(w, "Failed to scan audit entry", http.StatusInternalServerError)
+			return
+		}
+		e.ActorUserID = nullableInt(actorUserID)
+		if actorUserID.Valid && actorName.Valid {
+			e.ActorName = &actorName.String
+		}
+		e.APIKeyID = nullableInt(apiKeyID)
+		if entityID.Valid {
+			e.EntityID = &entityID.String
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditListResponse{
+		Entries:    entries,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	})
+}
+
+// Verify Audit Log walks the active organization's hash chain from the first
+// entry and reports the first entry whose hash or link does not match
+func (h *AuditHandler) VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+		SELECT id, organization_id, actor_user_id, api_key_id, action, entity_type, entity_id,
+		       before_data, after_data, ip_address, user_agent, status_code, created_at, prev_hash, hash
+		FROM audit_log
+		WHERE organization_id = $1
+		ORDER BY id ASC
+	`, organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to verify audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp := AuditVerifyResponse{Valid: true}
+	for rows.Next() {
+		var id int64
+		var record middleware.AuditRecord
+		var orgID, actorUserID, apiKeyID sql.NullInt64
+		var entityID, before, after sql.NullString
+		var hash string
+		if err := rows.Scan(&id, &orgID, &actorUserID, &apiKeyID, &record.Action, &record.EntityType, &entityID,
+			&before, &after, &record.IPAddress, &record.UserAgent, &record.StatusCode, &record.CreatedAt,
+			&record.PrevHash, &hash); err != nil {
+			http.Error(w, "Failed to scan audit entry", http.StatusInternalServerError)
+			return
+		}
+		record.OrganizationID = nullableInt(orgID)
+		record.ActorUserID = nullableInt(actorUserID)
+		record.APIKeyID = nullableInt(apiKeyID)
+		if entityID.Valid {
+			record.EntityID = &entityID.String
+		}
+		if before.Valid {
+			record.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			record.After = json.RawMessage(after.String)
+		}
+
+		if record.PrevHash != resp.LastHash || record.Hash() != hash {
+			resp.Valid = false
+			resp.BrokenAtID = &id
+			break
+		}
+		resp.Checked++
+		resp.LastHash = hash
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to verify audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func nullableInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	id := int(v.Int64)
+	return &id
+}
@@ -4,22 +4,35 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
-	"time"
+	"sync"
 
+	"agrione/backend/internal/background"
 	"agrione/backend/internal/config"
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/mailer"
 	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/websocket"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// loginDummyHash is checked instead of a real hash for unknown and locked
+// accounts, so those answers take as long as a wrong password
+var loginDummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("agrione-login-dummy"), bcrypt.DefaultCost)
+	return hash
+})
+
 type AuthHandler struct {
-	db  *sql.DB
-	cfg *config.Config
+	db     *sql.DB
+	cfg    *config.Config
+	hub    *websocket.Hub
+	mailer mailer.Mailer
+	tasks  *background.Runner
 }
 
-func NewAuthHandler(db *sql.DB, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{db: db, cfg: cfg}
+func NewAuthHandler(db *sql.DB, cfg *config.Config, hub *websocket.Hub, mailer mailer.Mailer, tasks *background.Runner) *AuthHandler {
+	return &AuthHandler{db: db, cfg: cfg, hub: hub, mailer: mailer, tasks: tasks}
 }
 
 type SignupRequest struct {
@@ -36,9 +49,16 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Message string `json:"message,omitempty"`
-	Token   string `json:"token,omitempty"`
-	User    *User  `json:"user,omitempty"`
+	Message      string `json:"message,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	User         *User  `json:"user,omitempty"`
+	// Set instead of tokens when a second factor is needed (see LoginMFA)
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+	// The role requires two-factor authentication but it is not enabled yet
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
 }
 
 type User struct {
@@ -49,6 +69,8 @@ type User struct {
 	LastName  string `json:"last_name"`
 	Role      string `json:"role"`
 	Status    string `json:"status"`
+	// Active organization (Role is the role held in it)
+	Organization *Organization `json:"organization,omitempty"`
 }
 
 func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
@@ -64,8 +86,8 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Password) < 8 {
-		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+	if err := validatePassword(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -74,7 +96,7 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	status := "pending"
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
@@ -84,7 +106,7 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	var userID int
 	err = h.db.QueryRow(
 		"INSERT INTO users (email, username, first_name, last_name, password_hash, role, status) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
-		req.Email, req.Username, req.FirstName, req.LastName, string(hashedPassword), role, status,
+		req.Email, req.Username, req.FirstName, req.LastName, hashedPassword, role, status,
 	).Scan(&userID)
 
 	if err != nil {
@@ -112,6 +134,10 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Let the superadmins know there is a signup to review
+	logger := logging.FromContext(r.Context())
+	h.tasks.Go(func() { notifySignupPending(logger, h.db, h.hub, user) })
+
 	// Don't generate token for pending users - they need approval first
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(AuthResponse{
@@ -133,15 +159,38 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := middleware.ClientIP(r)
+
+	// Refuse early while this IP is backing off or blocked
+	ipWait, err := h.ipRetryAfter(ip)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if ipWait > 0 {
+		writeLoginThrottled(w, http.StatusTooManyRequests, "Too many login attempts. Please try again later.", ipWait)
+		return
+	}
+
 	// Get user from database
 	var user User
 	var passwordHash string
-	err := h.db.QueryRow(
-		"SELECT id, email, username, first_name, last_name, role, status, password_hash FROM users WHERE email = $1",
+	var lockedFor, backoffFor float64
+	err = h.db.QueryRow(`
+		SELECT id, email, username, first_name, last_name, role, status, password_hash,
+		       GREATEST(COALESCE(EXTRACT(EPOCH FROM (locked_until - CURRENT_TIMESTAMP)), 0), 0),
+		       GREATEST(COALESCE(EXTRACT(EPOCH FROM (login_next_attempt_at - CURRENT_TIMESTAMP)), 0), 0)
+		FROM users WHERE email = $1 AND account_type = 'user'
+	`,
 		req.Email,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status, &passwordHash)
+	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status, &passwordHash, &lockedFor, &backoffFor)
 
 	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(loginDummyHash(), []byte(req.Password))
+		h.recordLoginAttempt(r, req.Email, nil, loginFailureUnknownEmail)
+		if err := h.registerIPFailure(r.Context(), ip); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to register login failure", "ip", ip, "error", err)
+		}
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
@@ -150,42 +199,100 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is approved
-	if user.Status != "approved" {
-		http.Error(w, "Your account is pending approval. Please wait for admin approval.", http.StatusForbidden)
+	// A locked or backing-off account is answered exactly like an unknown
+	// email, so the response does not tell whether the account exists
+	if lockedFor > 0 || backoffFor > 0 {
+		bcrypt.CompareHashAndPassword(loginDummyHash(), []byte(req.Password))
+		if lockedFor > 0 {
+			h.recordLoginAttempt(r, req.Email, &user.ID, loginFailureAccountLocked)
+		}
+		if err := h.registerIPFailure(r.Context(), ip); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to register login failure", "ip", ip, "error", err)
+		}
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		h.recordLoginAttempt(r, req.Email, &user.ID, loginFailureInvalidPassword)
+		if err := h.registerAccountFailure(r.Context(), user); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to register login failure", "account_user_id", user.ID, "error", err)
+		}
+		if err := h.registerIPFailure(r.Context(), ip); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to register login failure", "ip", ip, "error", err)
+		}
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.generateToken(user.ID)
+	// Check if user is approved
+	if user.Status != "approved" {
+		h.recordLoginAttempt(r, req.Email, &user.ID, loginFailureNotApproved)
+		http.Error(w, "Your account is pending approval. Please wait for admin approval.", http.StatusForbidden)
+		return
+	}
+
+	// Users with two-factor enabled finish logging in through LoginMFA
+	enabled, err := mfaEnabled(h.db, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		mfaToken, err := h.generateMFAPendingToken(user.ID)
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AuthResponse{
+			Message:     "Two-factor authentication required",
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin clears the account's failed attempts and starts a session
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user User) {
+	if err := resetAccountFailures(h.db, user.ID); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to reset login failures", "account_user_id", user.ID, "error", err)
+	}
+
+	// Start a session: short-lived access token plus rotating refresh token
+	resp, orgID, err := h.createSession(r, user.ID)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	if user, err = loadUser(h.db, user.ID, orgID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	resp.Message = "Login successful"
+	resp.User = &user
+
+	if middleware.MFARequired(user.Role) {
+		enabled, err := mfaEnabled(h.db, user.ID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		resp.MFAEnrollmentRequired = !enabled
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AuthResponse{
-		Message: "Login successful",
-		Token:   token,
-		User:    &user,
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(int)
 
-	var user User
-	err := h.db.QueryRow(
-		"SELECT id, email, username, first_name, last_name, role, status FROM users WHERE id = $1",
-		userID,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status)
-
+	user, err := loadUser(h.db, userID, organizationID(r))
 	if err == sql.ErrNoRows {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
@@ -200,23 +307,14 @@ func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+	if err := revokeSession(h.db, sessionID, "Logged out"); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(AuthResponse{
 		Message: "Logout successful",
 	})
 }
-
-func (h *AuthHandler) generateToken(userID int) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-		"iat":     time.Now().Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(h.cfg.JWTSecret))
-}
-
-
-
-
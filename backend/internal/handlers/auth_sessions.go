@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthSession is a logged-in device as shown to its user
+type AuthSession struct {
+	SessionID  string  `json:"session_id"`
+	UserAgent  *string `json:"user_agent,omitempty"`
+	IPAddress  *string `json:"ip_address,omitempty"`
+	Current    bool    `json:"current"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt string  `json:"last_used_at"`
+	ExpiresAt  string  `json:"expires_at"`
+}
+
+func (h *AuthHandler) accessTokenTTL() time.Duration {
+	return h.cfg.AccessTokenTTL
+}
+
+func (h *AuthHandler) refreshTokenTTL() time.Duration {
+	return h.cfg.RefreshTokenTTL
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 hex digest stored instead of the raw token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRefreshTokenTx stores a new refresh token for a session and slides the
+// session expiry forward
+func (h *AuthHandler) issueRefreshTokenTx(tx *sql.Tx, sessionPK int) (string, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(h.refreshTokenTTL())
+
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)
+	`, sessionPK, hashToken(refreshToken), expiresAt)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		UPDATE auth_sessions SET expires_at = $1, last_used_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, expiresAt, sessionPK)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// createSession starts a session for a user that just authenticated and
+// returns its access and refresh tokens and the organization it starts in
+func (h *AuthHandler) createSession(r *http.Request, userID int) (AuthResponse, int, error) {
+	var resp AuthResponse
+
+	sessionID, err := randomToken(24)
+	if err != nil {
+		return resp, 0, err
+	}
+
+	orgID, err := defaultOrganization(h.db, userID)
+	if err != nil {
+		return resp, 0, err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return resp, 0, err
+	}
+	defer tx.Rollback()
+
+	// Drop this user's sessions that ended long enough ago to be of no interest
+	_, err = tx.Exec(`
+		DELETE FROM auth_sessions
+		WHERE user_id = $1 AND COALESCE(revoked_at, expires_at) < CURRENT_TIMESTAMP - INTERVAL '30 days'
+	`, userID)
+	if err != nil {
+		return resp, 0, err
+	}
+
+	var sessionPK int
+	err = tx.QueryRow(`
+		INSERT INTO auth_sessions (session_id, user_id, organization_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, sessionID, userID, sql.NullInt64{Int64: int64(orgID), Valid: orgID > 0}, r.UserAgent(), middleware.ClientIP(r),
+		time.Now().Add(h.refreshTokenTTL())).Scan(&sessionPK)
+	if err != nil {
+		return resp, 0, err
+	}
+
+	refreshToken, err := h.issueRefreshTokenTx(tx, sessionPK)
+	if err != nil {
+		return resp, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return resp, 0, err
+	}
+
+	accessToken, err := h.generateToken(userID, sessionID, orgID)
+	if err != nil {
+		return resp, 0, err
+	}
+
+	resp.Token = accessToken
+	resp.RefreshToken = refreshToken
+	resp.ExpiresIn = int(h.accessTokenTTL().Seconds())
+	return resp, orgID, nil
+}
+
+// generateToken issues an access token; org_id is the session's active
+// organization (0 when the user belongs to none)
+func (h *AuthHandler) generateToken(userID int, sessionID string, orgID int) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"sid":     sessionID,
+		"org_id":  orgID,
+		"typ":     middleware.AccessTokenType,
+		"exp":     now.Add(h.accessTokenTTL()).Unix(),
+		"iat":     now.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(h.cfg.JWTSecret))
+}
+
+// revokeSession revokes a single session by its public ID
+func revokeSession(db *sql.DB, sessionID, reason string) error {
+	_, err := db.Exec(`
+		UPDATE auth_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $1
+		WHERE session_id = $2 AND revoked_at IS NULL
+	`, reason, sessionID)
+	return err
+}
+
+// revokeUserSessions revokes every active session of a user. Access tokens
+// stop working on their next request since AuthMiddleware checks the session.
+func revokeUserSessions(db *sql.DB, userID int, reason string) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE auth_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $1
+		WHERE user_id = $2 AND revoked_at IS NULL
+	`, reason, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Refresh Token (exchange a refresh token for a new access and refresh token)
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenPK, sessionPK, userID, orgID int
+	var sessionID, userStatus string
+	var usedAt, revokedAt sql.NullTime
+	var expired bool
+	err = tx.QueryRow(`
+		SELECT rt.id, s.id, s.session_id, s.user_id, COALESCE(s.organization_id, 0), u.status, rt.used_at, s.revoked_at,
+		       rt.expires_at <= CURRENT_TIMESTAMP OR s.expires_at <= CURRENT_TIMESTAMP
+		FROM refresh_tokens rt
+		JOIN auth_sessions s ON rt.session_id = s.id
+		JOIN users u ON s.user_id = u.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`, hashToken(req.RefreshToken)).Scan(&tokenPK, &sessionPK, &sessionID, &userID, &orgID, &userStatus, &usedAt, &revokedAt, &expired)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if revokedAt.Valid || expired {
+		http.Error(w, "Session has expired or been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	// A refresh token that was already rotated is being replayed: assume it
+	// was stolen and end the session for both holders
+	if usedAt.Valid {
+		_, err := tx.Exec(`
+			UPDATE auth_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = 'Refresh token reuse detected' WHERE id = $1
+		`, sessionPK)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		logging.FromContext(r.Context()).Warn("Refresh token reuse detected, session revoked", "account_user_id", userID)
+		http.Error(w, "Refresh token has already been used; session revoked", http.StatusUnauthorized)
+		return
+	}
+
+	if userStatus != "approved" {
+		http.Error(w, "Your account is not approved", http.StatusForbidden)
+		return
+	}
+
+	// Move the session elsewhere if it lost access to its organization
+	if role, err := organizationRole(h.db, userID, orgID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	} else if role == "" {
+		if orgID, err = defaultOrganization(h.db, userID); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.Exec("UPDATE auth_sessions SET organization_id = $1 WHERE id = $2", sql.NullInt64{Int64: int64(orgID), Valid: orgID > 0}, sessionPK)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", tokenPK); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := h.issueRefreshTokenTx(tx, sessionPK)
+	if err != nil {
+		http.Error(w, "Failed to issue refresh token", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := h.generateToken(userID, sessionID, orgID)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.accessTokenTTL().Seconds()),
+	})
+}
+
+// Logout All Devices (revoke every session of the current user)
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	count, err := revokeUserSessions(h.db, userID, "Logged out from all devices")
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	h.hub.DisconnectUser(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Logged out from all devices",
+		"revoked_sessions": count,
+	})
+}
+
+// List Sessions (active sessions of the current user)
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	currentSessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	rows, err := h.db.Query(`
+		SELECT session_id, user_agent, ip_address,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(last_used_at, 'YYYY-MM-DD"T"HH24:MI:SS') as last_used_at,
+		       TO_CHAR(expires_at, 'YYYY-MM-DD"T"HH24:MI:SS') as expires_at
+		FROM auth_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		http.Error(w, "Failed to get sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []AuthSession{}
+	for rows.Next() {
+		var s AuthSession
+		var userAgent, ipAddress sql.NullString
+		if err := rows.Scan(&s.SessionID, &userAgent, &ipAddress, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			continue
+		}
+		if userAgent.Valid {
+			s.UserAgent = &userAgent.String
+		}
+		if ipAddress.Valid {
+			s.IPAddress = &ipAddress.String
+		}
+		s.Current = s.SessionID == currentSessionID
+		sessions = append(sessions, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
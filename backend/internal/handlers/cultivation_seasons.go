@@ -60,13 +60,14 @@ func (h *CultivationSeasonsHandler) ListCultivationSeasons(w http.ResponseWriter
 		SELECT 
 			cs.id, cs.field_id, cs.name, cs.planting_date, cs.status, cs.completed_date,
 			cs.notes, cs.created_by,
-			TO_CHAR(cs.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(cs.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			TO_CHAR(cs.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(cs.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			f.name as field_name
 		FROM cultivation_seasons cs
 		LEFT JOIN fields f ON cs.field_id = f.id
-		WHERE 1=1
+		WHERE cs.organization_id = $1
 	`
+	args = append(args, organizationID(r))
 	
 	if fieldIDStr != "" {
 		fieldID, _ := strconv.Atoi(fieldIDStr)
@@ -78,6 +79,12 @@ func (h *CultivationSeasonsHandler) ListCultivationSeasons(w http.ResponseWriter
 		args = append(args, status)
 		query += fmt.Sprintf(" AND cs.status = $%d", len(args))
 	}
+
+	// Field workers only see seasons of their assigned fields
+	if userID, ok := fieldScopedUser(r); ok {
+		args = append(args, userID)
+		query += " AND cs.field_id IN (" + assignedFieldsSQL(len(args)) + ")"
+	}
 	
 	query += " ORDER BY cs.created_at DESC"
 	
@@ -134,6 +141,9 @@ func (h *CultivationSeasonsHandler) GetCultivationSeason(w http.ResponseWriter,
 		http.Error(w, "Invalid cultivation season ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, "SELECT id FROM cultivation_seasons WHERE field_id IN ("+assignedFieldsSQL(2)+")", id, "Cultivation season not found") {
+		return
+	}
 
 	var cs CultivationSeason
 	var notes, completedDate, createdAt, updatedAt, fieldName sql.NullString
@@ -142,13 +152,13 @@ func (h *CultivationSeasonsHandler) GetCultivationSeason(w http.ResponseWriter,
 		SELECT 
 			cs.id, cs.field_id, cs.name, cs.planting_date, cs.status, cs.completed_date,
 			cs.notes, cs.created_by,
-			TO_CHAR(cs.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(cs.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			TO_CHAR(cs.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(cs.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			f.name as field_name
 		FROM cultivation_seasons cs
 		LEFT JOIN fields f ON cs.field_id = f.id
-		WHERE cs.id = $1
-	`, id).Scan(
+		WHERE cs.id = $1 AND cs.organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&cs.ID, &cs.FieldID, &cs.Name, &cs.PlantingDate, &cs.Status,
 		&completedDate, &notes, &cs.CreatedBy,
 		&createdAt, &updatedAt, &fieldName,
@@ -203,6 +213,17 @@ func (h *CultivationSeasonsHandler) CreateCultivationSeason(w http.ResponseWrite
 		return
 	}
 
+	orgID := organizationID(r)
+	fieldExists, err := inOrganization(h.db, "fields", req.FieldID, orgID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !fieldExists {
+		http.Error(w, "Field not found", http.StatusBadRequest)
+		return
+	}
+
 	// Check if field has active cultivation season
 	var existingID int
 	err = h.db.QueryRow(`
@@ -223,15 +244,15 @@ func (h *CultivationSeasonsHandler) CreateCultivationSeason(w http.ResponseWrite
 	var csID int
 	query := `
 		INSERT INTO cultivation_seasons (
-			field_id, name, planting_date, status, notes, created_by
-		) VALUES ($1, $2, $3, 'active', $4, $5)
+			field_id, name, planting_date, status, notes, created_by, organization_id
+		) VALUES ($1, $2, $3, 'active', $4, $5, $6)
 		RETURNING id
 	`
 	
 	if req.Notes != nil {
-		err = h.db.QueryRow(query, req.FieldID, req.Name, plantingDate, *req.Notes, req.CreatedBy).Scan(&csID)
+		err = h.db.QueryRow(query, req.FieldID, req.Name, plantingDate, *req.Notes, req.CreatedBy, orgID).Scan(&csID)
 	} else {
-		err = h.db.QueryRow(query, req.FieldID, req.Name, plantingDate, nil, req.CreatedBy).Scan(&csID)
+		err = h.db.QueryRow(query, req.FieldID, req.Name, plantingDate, nil, req.CreatedBy, orgID).Scan(&csID)
 	}
 	
 	if err != nil {
@@ -247,8 +268,8 @@ func (h *CultivationSeasonsHandler) CreateCultivationSeason(w http.ResponseWrite
 		SELECT 
 			cs.id, cs.field_id, cs.name, cs.planting_date, cs.status, cs.completed_date,
 			cs.notes, cs.created_by,
-			TO_CHAR(cs.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(cs.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			TO_CHAR(cs.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(cs.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			f.name as field_name
 		FROM cultivation_seasons cs
 		LEFT JOIN fields f ON cs.field_id = f.id
@@ -351,8 +372,8 @@ func (h *CultivationSeasonsHandler) UpdateCultivationSeason(w http.ResponseWrite
 	args = append(args, time.Now())
 	argIndex++
 
-	// Add id to args
-	args = append(args, id)
+	// Add id and organization to args
+	args = append(args, id, organizationID(r))
 
 	// Build SET clause
 	setClause := ""
@@ -366,14 +387,18 @@ func (h *CultivationSeasonsHandler) UpdateCultivationSeason(w http.ResponseWrite
 	query := fmt.Sprintf(`
 		UPDATE cultivation_seasons 
 		SET %s
-		WHERE id = $%d
-	`, setClause, argIndex)
+		WHERE id = $%d AND organization_id = $%d
+	`, setClause, argIndex, argIndex+1)
 
-	_, err = h.db.Exec(query, args...)
+	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update cultivation season", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Cultivation season not found", http.StatusNotFound)
+		return
+	}
 
 	// Get and return updated cultivation season
 	var cs CultivationSeason
@@ -383,8 +408,8 @@ func (h *CultivationSeasonsHandler) UpdateCultivationSeason(w http.ResponseWrite
 		SELECT 
 			cs.id, cs.field_id, cs.name, cs.planting_date, cs.status, cs.completed_date,
 			cs.notes, cs.created_by,
-			TO_CHAR(cs.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(cs.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			TO_CHAR(cs.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(cs.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			f.name as field_name
 		FROM cultivation_seasons cs
 		LEFT JOIN fields f ON cs.field_id = f.id
@@ -445,11 +470,15 @@ func (h *CultivationSeasonsHandler) DeleteCultivationSeason(w http.ResponseWrite
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM cultivation_seasons WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM cultivation_seasons WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete cultivation season", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Cultivation season not found", http.StatusNotFound)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
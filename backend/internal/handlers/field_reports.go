@@ -29,10 +29,12 @@ type FieldReport struct {
 	Coordinates    map[string]interface{} `json:"coordinates"`
 	Notes          *string                `json:"notes,omitempty"`
 	SubmittedBy    string                 `json:"submitted_by"`
+	SubmittedByID  *int                   `json:"submitted_by_id,omitempty"`
 	WorkOrderID    *int                    `json:"work_order_id,omitempty"`
 	Media          []interface{}           `json:"media"`
 	Status         string                 `json:"status"` // pending, approved, rejected
 	ApprovedBy     *string                `json:"approved_by,omitempty"`
+	ApprovedByID   *int                   `json:"approved_by_id,omitempty"`
 	ApprovedAt     *string                `json:"approved_at,omitempty"`
 	RejectionReason *string               `json:"rejection_reason,omitempty"`
 	HarvestQuantity *float64              `json:"harvest_quantity,omitempty"` // For Panen activity (in ton/kg)
@@ -47,6 +49,7 @@ type FieldReportComment struct {
 	FieldReportID int    `json:"field_report_id"`
 	Comment       string `json:"comment"`
 	CommentedBy   string `json:"commented_by"`
+	CommentedByID *int   `json:"commented_by_id,omitempty"`
 	CreatedAt     string `json:"created_at"`
 	UpdatedAt     string `json:"updated_at"`
 }
@@ -57,7 +60,6 @@ type CreateFieldReportRequest struct {
 	Condition      string                 `json:"condition"`
 	Coordinates    map[string]interface{} `json:"coordinates"`
 	Notes          *string                `json:"notes,omitempty"`
-	SubmittedBy    string                 `json:"submitted_by"`
 	WorkOrderID    *int                    `json:"work_order_id,omitempty"`
 	Media          []interface{}           `json:"media,omitempty"`
 	Progress       *int                    `json:"progress,omitempty"` // Progress percentage for work order (0-100)
@@ -75,16 +77,10 @@ type UpdateFieldReportRequest struct {
 }
 
 type CreateCommentRequest struct {
-	Comment     string `json:"comment"`
-	CommentedBy string `json:"commented_by"`
-}
-
-type ApproveFieldReportRequest struct {
-	ApprovedBy string `json:"approved_by"`
+	Comment string `json:"comment"`
 }
 
 type RejectFieldReportRequest struct {
-	RejectedBy      string `json:"rejected_by"`
 	RejectionReason string `json:"rejection_reason"`
 }
 
@@ -93,8 +89,18 @@ func (h *FieldReportsHandler) ListFieldReports(w http.ResponseWriter, r *http.Re
 	workOrderIDStr := query.Get("work_order_id")
 	includeComments := query.Get("include_comments") == "true"
 
-	var rows *sql.Rows
-	var err error
+	sqlQuery := `
+		SELECT id, title, description, condition, coordinates, notes, 
+		       submitted_by, work_order_id, media, status, approved_by, 
+		       TO_CHAR(approved_at, 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
+		       rejection_reason, harvest_quantity, harvest_quality,
+		       submitted_by_user_id, approved_by_user_id,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM field_reports
+		WHERE organization_id = $1
+	`
+	args := []interface{}{organizationID(r)}
 
 	if workOrderIDStr != "" {
 		workOrderID, err := strconv.Atoi(workOrderIDStr)
@@ -102,30 +108,19 @@ func (h *FieldReportsHandler) ListFieldReports(w http.ResponseWriter, r *http.Re
 			http.Error(w, "Invalid work_order_id", http.StatusBadRequest)
 			return
 		}
-		rows, err = h.db.Query(`
-			SELECT id, title, description, condition, coordinates, notes, 
-			       submitted_by, work_order_id, media, status, approved_by, 
-			       TO_CHAR(approved_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
-			       rejection_reason, harvest_quantity, harvest_quality,
-			       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-			       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-			FROM field_reports
-			WHERE work_order_id = $1
-			ORDER BY created_at DESC
-		`, workOrderID)
-	} else {
-		rows, err = h.db.Query(`
-			SELECT id, title, description, condition, coordinates, notes, 
-			       submitted_by, work_order_id, media, status, approved_by, 
-			       TO_CHAR(approved_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
-			       rejection_reason, harvest_quantity, harvest_quality,
-			       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-			       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-			FROM field_reports
-			ORDER BY created_at DESC
-		`)
+		args = append(args, workOrderID)
+		sqlQuery += " AND work_order_id = $" + strconv.Itoa(len(args))
 	}
 
+	// Field workers only see reports under their assigned fields
+	if userID, ok := fieldScopedUser(r); ok {
+		args = append(args, userID)
+		sqlQuery += " AND id IN (" + visibleFieldReportsSQL(len(args)) + ")"
+	}
+
+	sqlQuery += " ORDER BY created_at DESC"
+
+	rows, err := h.db.Query(sqlQuery, args...)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -137,7 +132,7 @@ func (h *FieldReportsHandler) ListFieldReports(w http.ResponseWriter, r *http.Re
 		var fr FieldReport
 		var coordinatesJSON, mediaJSON []byte
 		var description, notes, createdAt, updatedAt, status, approvedBy, approvedAt, rejectionReason, harvestQuality sql.NullString
-		var workOrderID sql.NullInt64
+		var workOrderID, submittedByUserID, approvedByUserID sql.NullInt64
 		var harvestQuantity sql.NullFloat64
 
 		err := rows.Scan(
@@ -145,6 +140,7 @@ func (h *FieldReportsHandler) ListFieldReports(w http.ResponseWriter, r *http.Re
 			&notes, &fr.SubmittedBy, &workOrderID, &mediaJSON,
 			&status, &approvedBy, &approvedAt, &rejectionReason,
 			&harvestQuantity, &harvestQuality,
+		&submittedByUserID, &approvedByUserID,
 			&createdAt, &updatedAt,
 		)
 		if err != nil {
@@ -173,6 +169,8 @@ func (h *FieldReportsHandler) ListFieldReports(w http.ResponseWriter, r *http.Re
 		} else {
 			fr.Status = "pending"
 		}
+		fr.SubmittedByID = nullableUserID(submittedByUserID)
+		fr.ApprovedByID = nullableUserID(approvedByUserID)
 		if approvedBy.Valid {
 			fr.ApprovedBy = &approvedBy.String
 		}
@@ -221,27 +219,32 @@ func (h *FieldReportsHandler) GetFieldReport(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "Invalid field report ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, visibleFieldReportsSQL(2), id, "Field report not found") {
+		return
+	}
 
 	var fr FieldReport
 	var coordinatesJSON, mediaJSON []byte
 	var description, notes, createdAt, updatedAt, status, approvedBy, approvedAt, rejectionReason, harvestQuality sql.NullString
-	var workOrderID sql.NullInt64
+	var workOrderID, submittedByUserID, approvedByUserID sql.NullInt64
 	var harvestQuantity sql.NullFloat64
 
 	err = h.db.QueryRow(`
 		SELECT id, title, description, condition, coordinates, notes, 
 		       submitted_by, work_order_id, media, status, approved_by, 
-		       TO_CHAR(approved_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
+		       TO_CHAR(approved_at, 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
 		       rejection_reason, harvest_quantity, harvest_quality,
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+			       submitted_by_user_id, approved_by_user_id,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM field_reports
-		WHERE id = $1
-	`, id).Scan(
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&fr.ID, &fr.Title, &description, &fr.Condition, &coordinatesJSON,
 		&notes, &fr.SubmittedBy, &workOrderID, &mediaJSON,
 		&status, &approvedBy, &approvedAt, &rejectionReason,
 		&harvestQuantity, &harvestQuality,
+		&submittedByUserID, &approvedByUserID,
 		&createdAt, &updatedAt,
 	)
 
@@ -275,6 +278,8 @@ func (h *FieldReportsHandler) GetFieldReport(w http.ResponseWriter, r *http.Requ
 	} else {
 		fr.Status = "pending"
 	}
+	fr.SubmittedByID = nullableUserID(submittedByUserID)
+	fr.ApprovedByID = nullableUserID(approvedByUserID)
 	if approvedBy.Valid {
 		fr.ApprovedBy = &approvedBy.String
 	}
@@ -317,8 +322,14 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if req.Title == "" || req.Condition == "" || req.SubmittedBy == "" {
-		http.Error(w, "Title, condition, and submitted_by are required", http.StatusBadRequest)
+	if req.Title == "" || req.Condition == "" {
+		http.Error(w, "Title and condition are required", http.StatusBadRequest)
+		return
+	}
+
+	submitter, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
 		return
 	}
 
@@ -334,12 +345,29 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	orgID := organizationID(r)
+	if req.WorkOrderID != nil {
+		ok, err := inOrganization(h.db, "work_orders", *req.WorkOrderID, orgID)
+		if err == nil && ok {
+			// Field workers only report on work orders they can see
+			ok, err = visibleTo(h.db, r, visibleWorkOrdersSQL(2), *req.WorkOrderID)
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Work order not found", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var reportID int
 	err = h.db.QueryRow(`
-		INSERT INTO field_reports (title, description, condition, coordinates, notes, submitted_by, work_order_id, media, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'pending')
+		INSERT INTO field_reports (title, description, condition, coordinates, notes, submitted_by, submitted_by_user_id, work_order_id, media, status, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'pending', $10)
 		RETURNING id
-	`, req.Title, req.Description, req.Condition, string(coordinatesJSON), req.Notes, req.SubmittedBy, req.WorkOrderID, string(mediaJSON)).Scan(&reportID)
+	`, req.Title, req.Description, req.Condition, string(coordinatesJSON), req.Notes, submitter.Name, submitter.ID, req.WorkOrderID, string(mediaJSON), orgID).Scan(&reportID)
 
 	if err != nil {
 		http.Error(w, "Failed to create field report", http.StatusInternalServerError)
@@ -369,13 +397,13 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 			}
 		}
 
-		updateQuery := "UPDATE work_orders SET progress = $1, updated_at = CURRENT_TIMESTAMP"
+		updateQuery := "UPDATE work_orders SET progress = $1, last_updated_by = $2, last_updated_by_user_id = $3, updated_at = CURRENT_TIMESTAMP"
 		if statusUpdate != "" {
 			updateQuery += ", " + statusUpdate
 		}
-		updateQuery += " WHERE id = $2"
+		updateQuery += " WHERE id = $4"
 
-		_, err = h.db.Exec(updateQuery, progress, *req.WorkOrderID)
+		_, err = h.db.Exec(updateQuery, progress, submitter.Name, submitter.ID, *req.WorkOrderID)
 		if err != nil {
 			// Log error but don't fail the report creation
 			// In production, you might want to log this to a logging service
@@ -385,9 +413,9 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 
 	// Create notifications for Level 1/2 users
 	go func() {
-		level12UserIDs, err := websocket.GetUserIDsByRole(h.db, "Level 1")
+		level12UserIDs, err := websocket.GetOrganizationUserIDsByRole(h.db, orgID, "Level 1")
 		if err == nil {
-			level12UserIDs2, err2 := websocket.GetUserIDsByRole(h.db, "Level 2")
+			level12UserIDs2, err2 := websocket.GetOrganizationUserIDsByRole(h.db, orgID, "Level 2")
 			if err2 == nil {
 				level12UserIDs = append(level12UserIDs, level12UserIDs2...)
 			}
@@ -400,7 +428,7 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 					userID,
 					"field_report_pending",
 					"Laporan Baru Menunggu Persetujuan",
-					fmt.Sprintf("Laporan '%s' dari %s menunggu persetujuan", req.Title, req.SubmittedBy),
+					fmt.Sprintf("Laporan '%s' dari %s menunggu persetujuan", req.Title, submitter.Name),
 					fmt.Sprintf("/dashboard/field-reports-approval?filter=pending&report_id=%d", reportID),
 				)
 			}
@@ -411,16 +439,17 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 	var fr FieldReport
 	var coordinatesJSONBytes, mediaJSONBytes []byte
 	var description, notes, createdAt, updatedAt, status, approvedBy, approvedAt, rejectionReason, harvestQuality sql.NullString
-	var workOrderID sql.NullInt64
+	var workOrderID, submittedByUserID, approvedByUserID sql.NullInt64
 	var harvestQuantity sql.NullFloat64
 
 	err = h.db.QueryRow(`
 		SELECT id, title, description, condition, coordinates, notes, 
 		       submitted_by, work_order_id, media, status, approved_by, 
-		       TO_CHAR(approved_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
+		       TO_CHAR(approved_at, 'YYYY-MM-DD"T"HH24:MI:SS') as approved_at, 
 		       rejection_reason, harvest_quantity, harvest_quality,
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+			       submitted_by_user_id, approved_by_user_id,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM field_reports
 		WHERE id = $1
 	`, reportID).Scan(
@@ -428,6 +457,7 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 		&notes, &fr.SubmittedBy, &workOrderID, &mediaJSONBytes,
 		&status, &approvedBy, &approvedAt, &rejectionReason,
 		&harvestQuantity, &harvestQuality,
+		&submittedByUserID, &approvedByUserID,
 		&createdAt, &updatedAt,
 	)
 
@@ -457,6 +487,8 @@ func (h *FieldReportsHandler) CreateFieldReport(w http.ResponseWriter, r *http.R
 	} else {
 		fr.Status = "pending"
 	}
+	fr.SubmittedByID = nullableUserID(submittedByUserID)
+	fr.ApprovedByID = nullableUserID(approvedByUserID)
 	if approvedBy.Valid {
 		fr.ApprovedBy = &approvedBy.String
 	}
@@ -494,6 +526,9 @@ func (h *FieldReportsHandler) UpdateFieldReport(w http.ResponseWriter, r *http.R
 		http.Error(w, "Invalid field report ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, visibleFieldReportsSQL(2), id, "Field report not found") {
+		return
+	}
 
 	var req UpdateFieldReportRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -553,19 +588,23 @@ func (h *FieldReportsHandler) UpdateFieldReport(w http.ResponseWriter, r *http.R
 	}
 
 	updates = append(updates, "updated_at = CURRENT_TIMESTAMP")
-	args = append(args, id)
+	args = append(args, id, organizationID(r))
 
 	query := "UPDATE field_reports SET " + updates[0]
 	for i := 1; i < len(updates); i++ {
 		query += ", " + updates[i]
 	}
-	query += " WHERE id = $" + strconv.Itoa(argIndex)
+	query += " WHERE id = $" + strconv.Itoa(argIndex) + " AND organization_id = $" + strconv.Itoa(argIndex+1)
 
-	_, err = h.db.Exec(query, args...)
+	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update field report", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Field report not found", http.StatusNotFound)
+		return
+	}
 
 	// Fetch the updated report
 	h.GetFieldReport(w, r)
@@ -580,11 +619,15 @@ func (h *FieldReportsHandler) DeleteFieldReport(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM field_reports WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM field_reports WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete field report", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Field report not found", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
@@ -598,6 +641,9 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid field report ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, visibleFieldReportsSQL(2), fieldReportID, "Field report not found") {
+		return
+	}
 
 	var req CreateCommentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -605,15 +651,26 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if req.Comment == "" || req.CommentedBy == "" {
-		http.Error(w, "Comment and commented_by are required", http.StatusBadRequest)
+	if req.Comment == "" {
+		http.Error(w, "Comment is required", http.StatusBadRequest)
+		return
+	}
+
+	commenter, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
 		return
 	}
 
-	// Get submitted_by and status before inserting comment
-	var submittedBy string
+	// Get submitter and status before inserting comment
+	orgID := organizationID(r)
+	var submittedByUserID sql.NullInt64
 	var status string
-	err = h.db.QueryRow("SELECT submitted_by, status FROM field_reports WHERE id = $1", fieldReportID).Scan(&submittedBy, &status)
+	err = h.db.QueryRow("SELECT submitted_by_user_id, status FROM field_reports WHERE id = $1 AND organization_id = $2", fieldReportID, orgID).Scan(&submittedByUserID, &status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Field report not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get field report", http.StatusInternalServerError)
 		return
@@ -621,10 +678,10 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 
 	var commentID int
 	err = h.db.QueryRow(`
-		INSERT INTO field_report_comments (field_report_id, comment, commented_by)
-		VALUES ($1, $2, $3)
+		INSERT INTO field_report_comments (field_report_id, comment, commented_by, commented_by_user_id)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id
-	`, fieldReportID, req.Comment, req.CommentedBy).Scan(&commentID)
+	`, fieldReportID, req.Comment, commenter.Name, commenter.ID).Scan(&commentID)
 
 	if err != nil {
 		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
@@ -632,31 +689,28 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Create notification for the submitter (if comment is from someone else)
-	if req.CommentedBy != submittedBy {
+	if submittedByUserID.Valid && int(submittedByUserID.Int64) != commenter.ID {
 		go func() {
-			submitterUserID, err := websocket.GetUserIDFromSubmittedBy(h.db, submittedBy)
-			if err == nil && submitterUserID > 0 {
-				var reportTitle string
-				h.db.QueryRow("SELECT title FROM field_reports WHERE id = $1", fieldReportID).Scan(&reportTitle)
-				websocket.CreateNotification(
-					h.db,
-					h.hub,
-					submitterUserID,
-					"field_report_comment",
-					"Komentar Baru di Laporan Anda",
-					fmt.Sprintf("%s memberikan komentar pada laporan '%s'", req.CommentedBy, reportTitle),
-					fmt.Sprintf("/lapangan/work-orders/%d/report", fieldReportID),
-				)
-			}
+			var reportTitle string
+			h.db.QueryRow("SELECT title FROM field_reports WHERE id = $1", fieldReportID).Scan(&reportTitle)
+			websocket.CreateNotification(
+				h.db,
+				h.hub,
+				int(submittedByUserID.Int64),
+				"field_report_comment",
+				"Komentar Baru di Laporan Anda",
+				fmt.Sprintf("%s memberikan komentar pada laporan '%s'", commenter.Name, reportTitle),
+				fmt.Sprintf("/lapangan/work-orders/%d/report", fieldReportID),
+			)
 		}()
 	}
 
 	// Also notify Level 1/2 if report is pending
 	if status == "pending" {
 		go func() {
-			level12UserIDs, err := websocket.GetUserIDsByRole(h.db, "Level 1")
+			level12UserIDs, err := websocket.GetOrganizationUserIDsByRole(h.db, orgID, "Level 1")
 			if err == nil {
-				level12UserIDs2, err2 := websocket.GetUserIDsByRole(h.db, "Level 2")
+				level12UserIDs2, err2 := websocket.GetOrganizationUserIDsByRole(h.db, orgID, "Level 2")
 				if err2 == nil {
 					level12UserIDs = append(level12UserIDs, level12UserIDs2...)
 				}
@@ -671,7 +725,7 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 						userID,
 						"field_report_comment",
 						"Komentar Baru di Laporan",
-						fmt.Sprintf("%s memberikan komentar pada laporan '%s'", req.CommentedBy, reportTitle),
+						fmt.Sprintf("%s memberikan komentar pada laporan '%s'", commenter.Name, reportTitle),
 						fmt.Sprintf("/dashboard/field-reports-approval?filter=pending&report_id=%d", fieldReportID),
 					)
 				}
@@ -682,15 +736,16 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 	// Fetch the created comment
 	var comment FieldReportComment
 	var createdAt, updatedAt sql.NullString
+	var commentedByUserID sql.NullInt64
 	err = h.db.QueryRow(`
-		SELECT id, field_report_id, comment, commented_by, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		SELECT id, field_report_id, comment, commented_by, commented_by_user_id,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM field_report_comments
 		WHERE id = $1
 	`, commentID).Scan(
 		&comment.ID, &comment.FieldReportID, &comment.Comment,
-		&comment.CommentedBy, &createdAt, &updatedAt,
+		&comment.CommentedBy, &commentedByUserID, &createdAt, &updatedAt,
 	)
 
 	if err != nil {
@@ -698,6 +753,7 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	comment.CommentedByID = nullableUserID(commentedByUserID)
 	if createdAt.Valid {
 		comment.CreatedAt = createdAt.String
 	}
@@ -711,7 +767,7 @@ func (h *FieldReportsHandler) AddComment(w http.ResponseWriter, r *http.Request)
 
 func (h *FieldReportsHandler) getComments(fieldReportID int) ([]FieldReportComment, error) {
 	rows, err := h.db.Query(`
-		SELECT id, field_report_id, comment, commented_by, created_at, updated_at
+		SELECT id, field_report_id, comment, commented_by, commented_by_user_id, created_at, updated_at
 		FROM field_report_comments
 		WHERE field_report_id = $1
 		ORDER BY created_at ASC
@@ -725,13 +781,15 @@ func (h *FieldReportsHandler) getComments(fieldReportID int) ([]FieldReportComme
 	for rows.Next() {
 		var comment FieldReportComment
 		var createdAt, updatedAt sql.NullString
+		var commentedByUserID sql.NullInt64
 		err := rows.Scan(
 			&comment.ID, &comment.FieldReportID, &comment.Comment,
-			&comment.CommentedBy, &createdAt, &updatedAt,
+			&comment.CommentedBy, &commentedByUserID, &createdAt, &updatedAt,
 		)
 		if err != nil {
 			continue
 		}
+		comment.CommentedByID = nullableUserID(commentedByUserID)
 		if createdAt.Valid {
 			comment.CreatedAt = createdAt.String
 		}
@@ -753,20 +811,19 @@ func (h *FieldReportsHandler) ApproveFieldReport(w http.ResponseWriter, r *http.
 		return
 	}
 
-	var req ApproveFieldReportRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	approver, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
 		return
 	}
 
-	if req.ApprovedBy == "" {
-		http.Error(w, "approved_by is required", http.StatusBadRequest)
+	// Get submitter before updating
+	var submittedByUserID sql.NullInt64
+	err = h.db.QueryRow("SELECT submitted_by_user_id FROM field_reports WHERE id = $1 AND organization_id = $2", id, organizationID(r)).Scan(&submittedByUserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Field report not found", http.StatusNotFound)
 		return
 	}
-
-	// Get submitted_by before updating
-	var submittedBy string
-	err = h.db.QueryRow("SELECT submitted_by FROM field_reports WHERE id = $1", id).Scan(&submittedBy)
 	if err != nil {
 		http.Error(w, "Failed to get field report", http.StatusInternalServerError)
 		return
@@ -775,31 +832,30 @@ func (h *FieldReportsHandler) ApproveFieldReport(w http.ResponseWriter, r *http.
 	// Update field report status to approved
 	_, err = h.db.Exec(`
 		UPDATE field_reports 
-		SET status = 'approved', approved_by = $1, approved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2
-	`, req.ApprovedBy, id)
+		SET status = 'approved', approved_by = $1, approved_by_user_id = $2, approved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, approver.Name, approver.ID, id)
 	if err != nil {
 		http.Error(w, "Failed to approve field report", http.StatusInternalServerError)
 		return
 	}
 
 	// Create notification for the submitter
-	go func() {
-		submitterUserID, err := websocket.GetUserIDFromSubmittedBy(h.db, submittedBy)
-		if err == nil && submitterUserID > 0 {
+	if submittedByUserID.Valid {
+		go func() {
 			var reportTitle string
 			h.db.QueryRow("SELECT title FROM field_reports WHERE id = $1", id).Scan(&reportTitle)
 			websocket.CreateNotification(
 				h.db,
 				h.hub,
-				submitterUserID,
+				int(submittedByUserID.Int64),
 				"field_report_approved",
 				"Laporan Anda Disetujui",
-				fmt.Sprintf("Laporan '%s' telah disetujui oleh %s", reportTitle, req.ApprovedBy),
+				fmt.Sprintf("Laporan '%s' telah disetujui oleh %s", reportTitle, approver.Name),
 				fmt.Sprintf("/lapangan/work-orders/%d/report", id),
 			)
-		}
-	}()
+		}()
+	}
 
 	// Fetch and return the updated report
 	h.GetFieldReport(w, r)
@@ -820,14 +876,19 @@ func (h *FieldReportsHandler) RejectFieldReport(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if req.RejectedBy == "" {
-		http.Error(w, "rejected_by is required", http.StatusBadRequest)
+	rejecter, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
 		return
 	}
 
-	// Get submitted_by before updating
-	var submittedBy string
-	err = h.db.QueryRow("SELECT submitted_by FROM field_reports WHERE id = $1", id).Scan(&submittedBy)
+	// Get submitter before updating
+	var submittedByUserID sql.NullInt64
+	err = h.db.QueryRow("SELECT submitted_by_user_id FROM field_reports WHERE id = $1 AND organization_id = $2", id, organizationID(r)).Scan(&submittedByUserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Field report not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to get field report", http.StatusInternalServerError)
 		return
@@ -836,34 +897,32 @@ func (h *FieldReportsHandler) RejectFieldReport(w http.ResponseWriter, r *http.R
 	// Update field report status to rejected
 	_, err = h.db.Exec(`
 		UPDATE field_reports 
-		SET status = 'rejected', approved_by = $1, approved_at = CURRENT_TIMESTAMP, 
-		    rejection_reason = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3
-	`, req.RejectedBy, req.RejectionReason, id)
+		SET status = 'rejected', approved_by = $1, approved_by_user_id = $2, approved_at = CURRENT_TIMESTAMP, 
+		    rejection_reason = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, rejecter.Name, rejecter.ID, req.RejectionReason, id)
 	if err != nil {
 		http.Error(w, "Failed to reject field report", http.StatusInternalServerError)
 		return
 	}
 
 	// Create notification for the submitter
-	go func() {
-		submitterUserID, err := websocket.GetUserIDFromSubmittedBy(h.db, submittedBy)
-		if err == nil && submitterUserID > 0 {
+	if submittedByUserID.Valid {
+		go func() {
 			var reportTitle string
 			h.db.QueryRow("SELECT title FROM field_reports WHERE id = $1", id).Scan(&reportTitle)
 			websocket.CreateNotification(
 				h.db,
 				h.hub,
-				submitterUserID,
+				int(submittedByUserID.Int64),
 				"field_report_rejected",
 				"Laporan Anda Ditolak",
-				fmt.Sprintf("Laporan '%s' ditolak oleh %s. Alasan: %s", reportTitle, req.RejectedBy, req.RejectionReason),
+				fmt.Sprintf("Laporan '%s' ditolak oleh %s. Alasan: %s", reportTitle, rejecter.Name, req.RejectionReason),
 				fmt.Sprintf("/lapangan/work-orders/%d/report", id),
 			)
-		}
-	}()
+		}()
+	}
 
 	// Fetch and return the updated report
 	h.GetFieldReport(w, r)
 }
-
@@ -57,6 +57,12 @@ type UpdateFieldRequest struct {
 func (h *FieldsHandler) ListFields(w http.ResponseWriter, r *http.Request) {
 	// Get user_id from query if provided (for filtering by user)
 	userIDStr := r.URL.Query().Get("user_id")
+	orgID := organizationID(r)
+
+	// Field workers only see the fields assigned to them
+	if userID, ok := fieldScopedUser(r); ok {
+		userIDStr = strconv.Itoa(userID)
+	}
 	
 	var rows *sql.Rows
 	var err error
@@ -66,25 +72,26 @@ func (h *FieldsHandler) ListFields(w http.ResponseWriter, r *http.Request) {
 		rows, err = h.db.Query(`
 			SELECT f.id, f.name, f.description, f.area, f.coordinates, f.draw_type, 
 			       f.plant_type_id, f.soil_type_id, f.user_id, 
-			       TO_CHAR(f.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-			       TO_CHAR(f.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			       TO_CHAR(f.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+			       TO_CHAR(f.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			       CASE WHEN u.id IS NOT NULL THEN u.first_name || ' ' || u.last_name ELSE NULL END as user_name
 			FROM fields f
 			LEFT JOIN users u ON f.user_id = u.id
-			WHERE f.user_id = $1 
+			WHERE f.user_id = $1 AND f.organization_id = $2
 			ORDER BY f.created_at DESC
-		`, userID)
+		`, userID, orgID)
 	} else {
 		rows, err = h.db.Query(`
 			SELECT f.id, f.name, f.description, f.area, f.coordinates, f.draw_type, 
 			       f.plant_type_id, f.soil_type_id, f.user_id, 
-			       TO_CHAR(f.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-			       TO_CHAR(f.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			       TO_CHAR(f.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+			       TO_CHAR(f.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			       CASE WHEN u.id IS NOT NULL THEN u.first_name || ' ' || u.last_name ELSE NULL END as user_name
 			FROM fields f
 			LEFT JOIN users u ON f.user_id = u.id
+			WHERE f.organization_id = $1
 			ORDER BY f.created_at DESC
-		`)
+		`, orgID)
 	}
 	
 	if err != nil {
@@ -160,6 +167,9 @@ func (h *FieldsHandler) GetField(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid field ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, assignedFieldsSQL(2), id, "Field not found") {
+		return
+	}
 
 	var f Field
 	var coordinatesJSON []byte
@@ -170,13 +180,13 @@ func (h *FieldsHandler) GetField(w http.ResponseWriter, r *http.Request) {
 	err = h.db.QueryRow(`
 		SELECT f.id, f.name, f.description, f.area, f.coordinates, f.draw_type, 
 		       f.plant_type_id, f.soil_type_id, f.user_id, 
-		       TO_CHAR(f.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(f.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+		       TO_CHAR(f.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(f.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 		       CASE WHEN u.id IS NOT NULL THEN u.first_name || ' ' || u.last_name ELSE NULL END as user_name
 		FROM fields f
 		LEFT JOIN users u ON f.user_id = u.id
-		WHERE f.id = $1
-	`, id).Scan(
+		WHERE f.id = $1 AND f.organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&f.ID, &f.Name, &description, &area, &coordinatesJSON,
 		&f.DrawType, &plantTypeID, &soilTypeID, &userID,
 		&createdAt, &updatedAt, &userName,
@@ -247,6 +257,19 @@ func (h *FieldsHandler) CreateField(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	orgID := organizationID(r)
+	if req.PlantTypeID != nil {
+		ok, err := inOrganization(h.db, "plant_types", *req.PlantTypeID, orgID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Plant type not found", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var f Field
 	var coordinatesJSONOut []byte
 	var description, createdAt, updatedAt sql.NullString
@@ -255,10 +278,10 @@ func (h *FieldsHandler) CreateField(w http.ResponseWriter, r *http.Request) {
 
 	var fieldID int
 	err = h.db.QueryRow(`
-		INSERT INTO fields (name, description, area, coordinates, draw_type, plant_type_id, soil_type_id, user_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO fields (name, description, area, coordinates, draw_type, plant_type_id, soil_type_id, user_id, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
-	`, req.Name, req.Description, req.Area, string(coordinatesJSON), req.DrawType, req.PlantTypeID, req.SoilTypeID, req.UserID).Scan(&fieldID)
+	`, req.Name, req.Description, req.Area, string(coordinatesJSON), req.DrawType, req.PlantTypeID, req.SoilTypeID, req.UserID, orgID).Scan(&fieldID)
 
 	if err != nil {
 		http.Error(w, "Failed to create field", http.StatusInternalServerError)
@@ -375,6 +398,15 @@ func (h *FieldsHandler) UpdateField(w http.ResponseWriter, r *http.Request) {
 		argPos++
 	}
 	if req.PlantTypeID != nil {
+		ok, err := inOrganization(h.db, "plant_types", *req.PlantTypeID, organizationID(r))
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Plant type not found", http.StatusBadRequest)
+			return
+		}
 		updates = append(updates, "plant_type_id = $"+strconv.Itoa(argPos))
 		args = append(args, *req.PlantTypeID)
 		argPos++
@@ -403,13 +435,18 @@ func (h *FieldsHandler) UpdateField(w http.ResponseWriter, r *http.Request) {
 	for i := 1; i < len(updates)-1; i++ {
 		query += ", " + updates[i]
 	}
-	query += " WHERE " + updates[len(updates)-1]
+	query += " WHERE " + updates[len(updates)-1] + " AND organization_id = $" + strconv.Itoa(argPos+1)
+	args = append(args, organizationID(r))
 
-	_, err = h.db.Exec(query, args...)
+	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update field", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Field not found", http.StatusNotFound)
+		return
+	}
 
 	// Return updated field by querying directly
 	var f Field
@@ -421,8 +458,8 @@ func (h *FieldsHandler) UpdateField(w http.ResponseWriter, r *http.Request) {
 	err = h.db.QueryRow(`
 		SELECT f.id, f.name, f.description, f.area, f.coordinates, f.draw_type, 
 		       f.plant_type_id, f.soil_type_id, f.user_id, 
-		       TO_CHAR(f.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(f.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+		       TO_CHAR(f.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(f.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 		       CASE WHEN u.id IS NOT NULL THEN u.first_name || ' ' || u.last_name ELSE NULL END as user_name
 		FROM fields f
 		LEFT JOIN users u ON f.user_id = u.id
@@ -484,11 +521,15 @@ func (h *FieldsHandler) DeleteField(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM fields WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM fields WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete field", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Field not found", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
@@ -511,29 +552,34 @@ func (h *FieldsHandler) AssignFieldToUser(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Verify user exists and has Level 3 or 4 role
+	orgID := organizationID(r)
+
+	// Verify user is a member of the organization with Level 3 or 4 role
 	if req.UserID != nil {
-		var role string
-		err = h.db.QueryRow("SELECT role FROM users WHERE id = $1", *req.UserID).Scan(&role)
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
+		role, err := organizationRole(h.db, *req.UserID, orgID)
 		if err != nil {
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		if role == "" {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
 		if role != "Level 3" && role != "Level 4" {
 			http.Error(w, "User must have Level 3 or Level 4 role", http.StatusBadRequest)
 			return
 		}
 	}
 
-	_, err = h.db.Exec("UPDATE fields SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.UserID, fieldID)
+	result, err := h.db.Exec("UPDATE fields SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND organization_id = $3", req.UserID, fieldID, orgID)
 	if err != nil {
 		http.Error(w, "Failed to assign field to user", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Field not found", http.StatusNotFound)
+		return
+	}
 
 	// Return updated field by querying directly
 	var f Field
@@ -4,9 +4,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
+
+	"agrione/backend/internal/logging"
 )
 
 // ImportKMZ handles KMZ file upload and returns parsed polygons
@@ -32,14 +33,15 @@ func (h *FieldsHandler) ImportKMZ(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse KMZ file
-	polygons, err := ParseKMZ(file, header.Size)
+	logger := logging.FromContext(r.Context())
+	polygons, err := ParseKMZ(r.Context(), file, header.Size)
 	if err != nil {
-		log.Printf("[ImportKMZ] Error parsing KMZ: %v", err)
+		logger.Warn("Failed to parse KMZ", "error", err)
 		http.Error(w, "Failed to parse KMZ file: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("[ImportKMZ] Successfully parsed %d polygons from KMZ file", len(polygons))
+	logger.Info("Parsed KMZ file", "polygons", len(polygons))
 
 	// Return parsed polygons
 	w.Header().Set("Content-Type", "application/json")
@@ -79,6 +81,7 @@ func (h *FieldsHandler) BatchCreateFields(w http.ResponseWriter, r *http.Request
 
 	var createdFields []Field
 	var errors []string
+	orgID := organizationID(r)
 
 	for i, fieldData := range req.Fields {
 		if fieldData.Name == "" {
@@ -101,13 +104,21 @@ func (h *FieldsHandler) BatchCreateFields(w http.ResponseWriter, r *http.Request
 			continue
 		}
 
+		if fieldData.PlantTypeID != nil {
+			ok, err := inOrganization(h.db, "plant_types", *fieldData.PlantTypeID, orgID)
+			if err != nil || !ok {
+				errors = append(errors, fmt.Sprintf("Field %d (%s): plant type not found", i+1, fieldData.Name))
+				continue
+			}
+		}
+
 		// Create field in database
 		var fieldID int
 		err = h.db.QueryRow(`
-			INSERT INTO fields (name, description, area, coordinates, draw_type, plant_type_id, soil_type_id, user_id)
-			VALUES ($1, $2, $3, $4, 'polygon', $5, $6, $7)
+			INSERT INTO fields (name, description, area, coordinates, draw_type, plant_type_id, soil_type_id, user_id, organization_id)
+			VALUES ($1, $2, $3, $4, 'polygon', $5, $6, $7, $8)
 			RETURNING id
-		`, fieldData.Name, fieldData.Description, area, string(coordinatesJSON), fieldData.PlantTypeID, fieldData.SoilTypeID, fieldData.UserID).Scan(&fieldID)
+		`, fieldData.Name, fieldData.Description, area, string(coordinatesJSON), fieldData.PlantTypeID, fieldData.SoilTypeID, fieldData.UserID, orgID).Scan(&fieldID)
 
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Field %d (%s): failed to create: %v", i+1, fieldData.Name, err))
@@ -124,8 +135,8 @@ func (h *FieldsHandler) BatchCreateFields(w http.ResponseWriter, r *http.Request
 		err = h.db.QueryRow(`
 			SELECT f.id, f.name, f.description, f.area, f.coordinates, f.draw_type, 
 			       f.plant_type_id, f.soil_type_id, f.user_id, 
-			       TO_CHAR(f.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-			       TO_CHAR(f.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+			       TO_CHAR(f.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+			       TO_CHAR(f.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 			FROM fields f
 			WHERE f.id = $1
 		`, fieldID).Scan(&f.ID, &f.Name, &description, &areaVal, &coordinatesJSONOut, &f.DrawType,
@@ -10,15 +10,18 @@ import (
 	"strings"
 	"time"
 
+	"agrione/backend/internal/websocket"
+
 	"github.com/gorilla/mux"
 )
 
 type InventoryHandler struct {
-	db *sql.DB
+	db  *sql.DB
+	hub *websocket.Hub
 }
 
-func NewInventoryHandler(db *sql.DB) *InventoryHandler {
-	return &InventoryHandler{db: db}
+func NewInventoryHandler(db *sql.DB, hub *websocket.Hub) *InventoryHandler {
+	return &InventoryHandler{db: db, hub: hub}
 }
 
 // Inventory Item types
@@ -31,6 +34,7 @@ type InventoryItem struct {
 	ReorderPoint float64  `json:"reorder_point"`
 	Status      string    `json:"status"`
 	AvgCost     float64   `json:"avg_cost"`
+	CostingMethod string  `json:"costing_method,omitempty"`
 	Description *string   `json:"description,omitempty"`
 	Suppliers   []string  `json:"suppliers"`
 	CreatedAt   string    `json:"created_at"`
@@ -45,6 +49,7 @@ type CreateInventoryItemRequest struct {
 	ReorderPoint float64  `json:"reorder_point"`
 	Status      string    `json:"status"`
 	AvgCost     float64   `json:"avg_cost"`
+	CostingMethod string  `json:"costing_method"`
 	Description *string   `json:"description,omitempty"`
 	Suppliers   []string  `json:"suppliers"`
 }
@@ -56,7 +61,7 @@ type UpdateInventoryItemRequest struct {
 	Unit        *string   `json:"unit,omitempty"`
 	ReorderPoint *float64 `json:"reorder_point,omitempty"`
 	Status      *string   `json:"status,omitempty"`
-	AvgCost     *float64  `json:"avg_cost,omitempty"`
+	CostingMethod *string `json:"costing_method,omitempty"`
 	Description *string   `json:"description,omitempty"`
 	Suppliers   *[]string `json:"suppliers,omitempty"`
 }
@@ -82,11 +87,16 @@ type StockLot struct {
 	Quantity    float64   `json:"quantity"`
 	UnitCost    float64   `json:"unit_cost"`
 	TotalCost   float64   `json:"total_cost"`
+	ReservedQuantity  float64 `json:"reserved_quantity"`
+	AvailableQuantity float64 `json:"available_quantity"`
 	ExpiryDate  *string   `json:"expiry_date,omitempty"`
 	Supplier    string    `json:"supplier"`
 	Status      string    `json:"status"`
 	Notes       *string   `json:"notes,omitempty"`
 	ReceivedDate string   `json:"received_date"`
+	PurchaseOrderLineID *int    `json:"purchase_order_line_id,omitempty"`
+	PurchaseOrderID     *int    `json:"purchase_order_id,omitempty"`
+	PurchaseOrderNumber *string `json:"purchase_order_number,omitempty"`
 	CreatedAt   string    `json:"created_at"`
 	UpdatedAt   string    `json:"updated_at"`
 }
@@ -98,8 +108,14 @@ type CreateStockLotRequest struct {
 	Quantity    float64   `json:"quantity"`
 	UnitCost    float64   `json:"unit_cost"`
 	ExpiryDate  *string   `json:"expiry_date,omitempty"`
+	ReceivedDate *string  `json:"received_date,omitempty"`
 	Supplier    string    `json:"supplier"`
 	Notes       *string   `json:"notes,omitempty"`
+
+	// Set by the server, not accepted from clients
+	PurchaseOrderLineID *int `json:"-"`
+	PerformedBy         actor `json:"-"`
+	OrganizationID      int   `json:"-"`
 }
 
 type RemoveStockRequest struct {
@@ -107,7 +123,6 @@ type RemoveStockRequest struct {
 	Quantity       float64   `json:"quantity"`
 	Reason         string    `json:"reason"`
 	Reference      *string   `json:"reference,omitempty"`
-	PerformedBy    string    `json:"performed_by"`
 	Notes          *string   `json:"notes,omitempty"`
 	StockRequestID *int      `json:"stock_request_id,omitempty"`
 }
@@ -136,6 +151,7 @@ type StockMovement struct {
 	Reason      string         `json:"reason"`
 	Reference   *string        `json:"reference,omitempty"`
 	PerformedBy string         `json:"performed_by"`
+	PerformedByID *int         `json:"performed_by_id,omitempty"`
 	Notes       *string        `json:"notes,omitempty"`
 	CreatedAt   string         `json:"created_at"`
 	UpdatedAt   string         `json:"updated_at"`
@@ -151,9 +167,11 @@ type InventoryStats struct {
 }
 
 // Helper function to generate unique ID
+// Uses a 6-digit random suffix because a single transaction (e.g. a stock count
+// approval) may generate many IDs within the same second.
 func generateID(prefix string) string {
 	return fmt.Sprintf("%s-%d-%s", prefix, time.Now().Unix(), 
-		fmt.Sprintf("%04d", rand.Intn(10000)))
+		fmt.Sprintf("%06d", rand.Intn(1000000)))
 }
 
 // List Inventory Items
@@ -170,12 +188,11 @@ func (h *InventoryHandler) ListInventoryItems(w http.ResponseWriter, r *http.Req
 	}
 	offset := (page - 1) * limit
 
-	var query string
-	var args []interface{}
-	argIndex := 1
+	query := "WHERE organization_id = $1 "
+	args := []interface{}{organizationID(r)}
+	argIndex := 2
 
 	if search != "" || category != "" {
-		query = "WHERE 1=1 "
 		if search != "" {
 			query += fmt.Sprintf("AND (name ILIKE $%d OR sku ILIKE $%d) ", argIndex, argIndex)
 			args = append(args, "%"+search+"%")
@@ -189,9 +206,9 @@ func (h *InventoryHandler) ListInventoryItems(w http.ResponseWriter, r *http.Req
 	}
 
 	rows, err := h.db.Query(fmt.Sprintf(`
-		SELECT id, sku, name, category, unit, reorder_point, status, avg_cost, description, suppliers,
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		SELECT id, sku, name, category, unit, reorder_point, status, avg_cost, costing_method, description, suppliers,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM inventory_items %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d
 	`, query, argIndex, argIndex+1), append(args, limit, offset)...)
 	
@@ -208,7 +225,7 @@ func (h *InventoryHandler) ListInventoryItems(w http.ResponseWriter, r *http.Req
 		var description, createdAt, updatedAt sql.NullString
 
 		err := rows.Scan(&item.ID, &item.SKU, &item.Name, &item.Category, &item.Unit, 
-			&item.ReorderPoint, &item.Status, &item.AvgCost, &description, &suppliersJSON,
+			&item.ReorderPoint, &item.Status, &item.AvgCost, &item.CostingMethod, &description, &suppliersJSON,
 			&createdAt, &updatedAt)
 		if err != nil {
 			continue
@@ -251,12 +268,12 @@ func (h *InventoryHandler) GetInventoryItem(w http.ResponseWriter, r *http.Reque
 	var description, createdAt, updatedAt sql.NullString
 
 	err = h.db.QueryRow(`
-		SELECT id, sku, name, category, unit, reorder_point, status, avg_cost, description, suppliers,
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-		FROM inventory_items WHERE id = $1
-	`, id).Scan(&item.ID, &item.SKU, &item.Name, &item.Category, &item.Unit, 
-		&item.ReorderPoint, &item.Status, &item.AvgCost, &description, &suppliersJSON,
+		SELECT id, sku, name, category, unit, reorder_point, status, avg_cost, costing_method, description, suppliers,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM inventory_items WHERE id = $1 AND organization_id = $2
+	`, id, organizationID(r)).Scan(&item.ID, &item.SKU, &item.Name, &item.Category, &item.Unit, 
+		&item.ReorderPoint, &item.Status, &item.AvgCost, &item.CostingMethod, &description, &suppliersJSON,
 		&createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
@@ -300,9 +317,18 @@ func (h *InventoryHandler) CreateInventoryItem(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if req.CostingMethod == "" {
+		req.CostingMethod = CostingWeightedAverage
+	}
+	if !isValidCostingMethod(req.CostingMethod) {
+		http.Error(w, "costing_method must be 'weighted_average' or 'fifo'", http.StatusBadRequest)
+		return
+	}
+
 	// Check if SKU already exists
 	var exists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE sku = $1)", req.SKU).Scan(&exists)
+	orgID := organizationID(r)
+	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE sku = $1 AND organization_id = $2)", req.SKU, orgID).Scan(&exists)
 	if err == nil && exists {
 		http.Error(w, "SKU already exists", http.StatusBadRequest)
 		return
@@ -318,15 +344,15 @@ func (h *InventoryHandler) CreateInventoryItem(w http.ResponseWriter, r *http.Re
 	var description, createdAt, updatedAt sql.NullString
 
 	err = h.db.QueryRow(`
-		INSERT INTO inventory_items (sku, name, category, unit, reorder_point, status, avg_cost, description, suppliers)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id, sku, name, category, unit, reorder_point, status, avg_cost, description, suppliers,
-		          TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		          TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		INSERT INTO inventory_items (sku, name, category, unit, reorder_point, status, avg_cost, costing_method, description, suppliers, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, sku, name, category, unit, reorder_point, status, avg_cost, costing_method, description, suppliers,
+		          TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		          TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 	`, req.SKU, req.Name, req.Category, req.Unit, req.ReorderPoint, 
-		req.Status, req.AvgCost, req.Description, string(suppliersJSON)).Scan(
+		req.Status, req.AvgCost, req.CostingMethod, req.Description, string(suppliersJSON), orgID).Scan(
 		&item.ID, &item.SKU, &item.Name, &item.Category, &item.Unit, 
-		&item.ReorderPoint, &item.Status, &item.AvgCost, &description, &suppliersJSONOut,
+		&item.ReorderPoint, &item.Status, &item.AvgCost, &item.CostingMethod, &description, &suppliersJSONOut,
 		&createdAt, &updatedAt)
 
 	if err != nil {
@@ -372,7 +398,8 @@ func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Re
 
 	// Check if item exists
 	var exists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE id = $1)", id).Scan(&exists)
+	orgID := organizationID(r)
+	exists, err = inOrganization(h.db, "inventory_items", id, orgID)
 	if err != nil || !exists {
 		http.Error(w, "Inventory item not found", http.StatusNotFound)
 		return
@@ -381,7 +408,7 @@ func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Re
 	// Check SKU uniqueness if updating SKU
 	if req.SKU != nil && *req.SKU != "" {
 		var skuExists bool
-		err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE sku = $1 AND id != $2)", *req.SKU, id).Scan(&skuExists)
+		err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE sku = $1 AND id != $2 AND organization_id = $3)", *req.SKU, id, orgID).Scan(&skuExists)
 		if err == nil && skuExists {
 			http.Error(w, "SKU already exists", http.StatusBadRequest)
 			return
@@ -423,9 +450,13 @@ func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Re
 		args = append(args, *req.Status)
 		argIndex++
 	}
-	if req.AvgCost != nil {
-		updates = append(updates, fmt.Sprintf("avg_cost = $%d", argIndex))
-		args = append(args, *req.AvgCost)
+	if req.CostingMethod != nil {
+		if !isValidCostingMethod(*req.CostingMethod) {
+			http.Error(w, "costing_method must be 'weighted_average' or 'fifo'", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, fmt.Sprintf("costing_method = $%d", argIndex))
+		args = append(args, *req.CostingMethod)
 		argIndex++
 	}
 	if req.Description != nil {
@@ -450,9 +481,24 @@ func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Re
 
 	query := "UPDATE inventory_items SET " + strings.Join(updates, ", ") + " WHERE id = $" + strconv.Itoa(argIndex)
 
-	_, err = h.db.Exec(query, args...)
+	// avg_cost is maintained by the costing engine. Switching the costing
+	// method revalues the item's history in the same transaction.
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		var previousMethod string
+		err := tx.QueryRow("SELECT costing_method FROM inventory_items WHERE id = $1 FOR UPDATE", id).Scan(&previousMethod)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		if req.CostingMethod != nil && *req.CostingMethod != previousMethod {
+			_, err = revalueItemCostsTx(tx, id)
+		}
+		return err
+	})
 	if err != nil {
-		http.Error(w, "Failed to update inventory item", http.StatusInternalServerError)
+		writeStockTxError(w, err, "Failed to update inventory item")
 		return
 	}
 
@@ -470,11 +516,15 @@ func (h *InventoryHandler) DeleteInventoryItem(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM inventory_items WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM inventory_items WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete inventory item", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Inventory item not found", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
@@ -3,12 +3,14 @@ package handlers
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"strings"
+
+	"agrione/backend/internal/logging"
 )
 
 // KML structures for parsing
@@ -58,7 +60,9 @@ type ParsedPolygon struct {
 }
 
 // ParseKMZ parses a KMZ file and extracts polygons
-func ParseKMZ(file multipart.File, size int64) ([]ParsedPolygon, error) {
+func ParseKMZ(ctx context.Context, file multipart.File, size int64) ([]ParsedPolygon, error) {
+	logger := logging.FromContext(ctx).With("component", "kmz_parser")
+
 	// Read the entire file into memory
 	data := make([]byte, size)
 	_, err := io.ReadFull(file, data)
@@ -97,12 +101,12 @@ func ParseKMZ(file multipart.File, size int64) ([]ParsedPolygon, error) {
 	// Parse KML XML
 	var kml KML
 	if err := xml.Unmarshal(kmlData, &kml); err != nil {
-		log.Printf("[KMZ Parser] Failed to parse KML XML: %v", err)
+		logger.Warn("Failed to parse KML XML", "error", err)
 		return nil, fmt.Errorf("failed to parse KML XML: %w", err)
 	}
 
-	log.Printf("[KMZ Parser] Parsed KML - Root Placemarks: %d, Document Placemarks: %d, Document Folders: %d",
-		len(kml.Placemark), len(kml.Document.Placemark), len(kml.Document.Folder))
+	logger.Debug("Parsed KML", "root_placemarks", len(kml.Placemark),
+		"document_placemarks", len(kml.Document.Placemark), "document_folders", len(kml.Document.Folder))
 
 	// Collect all placemarks from various sources
 	var allPlacemarks []Placemark
@@ -118,7 +122,7 @@ func ParseKMZ(file multipart.File, size int64) ([]ParsedPolygon, error) {
 		allPlacemarks = append(allPlacemarks, extractPlacemarksFromFolder(folder)...)
 	}
 
-	log.Printf("[KMZ Parser] Total placemarks found: %d", len(allPlacemarks))
+	logger.Debug("Placemarks found", "count", len(allPlacemarks))
 
 	// Extract polygons
 	var polygons []ParsedPolygon
@@ -133,7 +137,7 @@ func ParseKMZ(file multipart.File, size int64) ([]ParsedPolygon, error) {
 
 		// Check for MultiGeometry first (takes precedence if both exist)
 		if len(placemark.MultiGeometry.Polygon) > 0 {
-			log.Printf("[KMZ Parser] Placemark %d (%s) has MultiGeometry with %d polygons", i+1, name, len(placemark.MultiGeometry.Polygon))
+			logger.Debug("Placemark has MultiGeometry", "placemark", i+1, "name", name, "polygons", len(placemark.MultiGeometry.Polygon))
 			
 			// Extract the first polygon from MultiGeometry (typically the main one)
 			polygon := placemark.MultiGeometry.Polygon[0]
@@ -142,7 +146,7 @@ func ParseKMZ(file multipart.File, size int64) ([]ParsedPolygon, error) {
 				foundPolygon = true
 				
 				if len(placemark.MultiGeometry.Polygon) > 1 {
-					log.Printf("[KMZ Parser] Placemark %d (%s) has %d polygons in MultiGeometry, using the first one", i+1, name, len(placemark.MultiGeometry.Polygon))
+					logger.Debug("Placemark has several polygons in MultiGeometry, using the first one", "placemark", i+1, "name", name, "polygons", len(placemark.MultiGeometry.Polygon))
 				}
 			}
 		} else if placemark.Polygon.OuterBoundaryIs.LinearRing.Coordinates != "" {
@@ -152,23 +156,23 @@ func ParseKMZ(file multipart.File, size int64) ([]ParsedPolygon, error) {
 		}
 
 		if !foundPolygon {
-			log.Printf("[KMZ Parser] Placemark %d (%s) has no polygon coordinates", i+1, name)
+			logger.Debug("Placemark has no polygon coordinates", "placemark", i+1, "name", name)
 			continue
 		}
 
 		if len(coords) < 3 {
-			log.Printf("[KMZ Parser] Placemark %d (%s) has less than 3 coordinates: %d", i+1, name, len(coords))
+			logger.Debug("Placemark has less than 3 coordinates", "placemark", i+1, "name", name, "coordinates", len(coords))
 			continue // Need at least 3 points for a polygon
 		}
 
-		log.Printf("[KMZ Parser] Extracted polygon: %s with %d coordinates", name, len(coords))
+		logger.Debug("Extracted polygon", "name", name, "coordinates", len(coords))
 		polygons = append(polygons, ParsedPolygon{
 			Name:        name,
 			Coordinates: coords,
 		})
 	}
 
-	log.Printf("[KMZ Parser] Total polygons extracted: %d", len(polygons))
+	logger.Debug("Polygons extracted", "count", len(polygons))
 	return polygons, nil
 }
 
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agrione/backend/internal/logging"
+)
+
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+type SetLogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// Get Log Level of the running server
+func GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LogLevelResponse{Level: logging.Level()})
+}
+
+// Set Log Level of the running server until it restarts; LOG_LEVEL sets the
+// level it starts with
+func SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req SetLogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	previous := logging.Level()
+	if err := logging.SetLevel(req.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logging.FromContext(r.Context()).Warn("Log level changed", "from", previous, "to", logging.Level())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LogLevelResponse{Level: logging.Level()})
+}
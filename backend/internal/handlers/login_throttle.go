@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Failures allowed before backoff starts
+	loginFreeAttempts = 2
+	// Per-IP failures older than this no longer count
+	loginIPWindow = time.Hour
+)
+
+// Reasons stored in login_attempts.failure_reason
+const (
+	loginFailureUnknownEmail    = "unknown_email"
+	loginFailureInvalidPassword = "invalid_password"
+	loginFailureNotApproved     = "not_approved"
+	loginFailureAccountLocked   = "account_locked"
+)
+
+type loginPolicy struct {
+	maxFailures   int
+	ipMaxFailures int
+	lockout       time.Duration
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+}
+
+type LoginAttempt struct {
+	ID            int     `json:"id"`
+	Email         string  `json:"email"`
+	UserID        *int    `json:"user_id,omitempty"`
+	IPAddress     string  `json:"ip_address"`
+	UserAgent     *string `json:"user_agent,omitempty"`
+	FailureReason string  `json:"failure_reason"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+func (h *AuthHandler) loginPolicy() loginPolicy {
+	return loginPolicy{
+		maxFailures:   h.cfg.LoginMaxFailures,
+		ipMaxFailures: h.cfg.LoginIPMaxFailures,
+		lockout:       h.cfg.LoginLockoutDuration,
+		backoffBase:   h.cfg.LoginBackoffBase,
+		backoffMax:    h.cfg.LoginBackoffMax,
+	}
+}
+
+// backoff is how long to wait before the next attempt after failures
+// consecutive failures: nothing for the first few, then doubling
+func (p loginPolicy) backoff(failures int) time.Duration {
+	if failures <= loginFreeAttempts {
+		return 0
+	}
+	delay := float64(p.backoffBase) * math.Pow(2, float64(failures-loginFreeAttempts-1))
+	if delay > float64(p.backoffMax) {
+		return p.backoffMax
+	}
+	return time.Duration(delay)
+}
+
+// writeLoginThrottled answers a login that is not allowed yet
+func writeLoginThrottled(w http.ResponseWriter, status int, message string, retryAfterSeconds float64) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfterSeconds))))
+	http.Error(w, message, status)
+}
+
+// ipRetryAfter returns the seconds an IP must wait before its next attempt
+func (h *AuthHandler) ipRetryAfter(ip string) (float64, error) {
+	var wait float64
+	err := h.db.QueryRow(`
+		SELECT GREATEST(
+			COALESCE(EXTRACT(EPOCH FROM (blocked_until - CURRENT_TIMESTAMP)), 0),
+			COALESCE(EXTRACT(EPOCH FROM (next_attempt_at - CURRENT_TIMESTAMP)), 0),
+			0)
+		FROM login_ip_throttle WHERE ip_address = $1
+	`, ip).Scan(&wait)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return wait, err
+}
+
+// recordLoginAttempt stores a rejected login for review
+func (h *AuthHandler) recordLoginAttempt(r *http.Request, email string, userID *int, reason string) {
+	_, err := h.db.Exec(`
+		INSERT INTO login_attempts (email, user_id, ip_address, user_agent, failure_reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`, email, userID, middleware.ClientIP(r), r.UserAgent(), reason)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record login attempt", "error", err)
+	}
+}
+
+// registerIPFailure counts a failed login from an IP, applies backoff and
+// blocks the IP once it reaches the configured number of failures
+func (h *AuthHandler) registerIPFailure(ctx context.Context, ip string) error {
+	policy := h.loginPolicy()
+
+	var failures int
+	err := h.db.QueryRow(`
+		INSERT INTO login_ip_throttle (ip_address, failed_attempts, last_failed_at)
+		VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (ip_address) DO UPDATE SET
+			failed_attempts = CASE
+				WHEN login_ip_throttle.last_failed_at < CURRENT_TIMESTAMP - make_interval(secs => $2) THEN 1
+				ELSE login_ip_throttle.failed_attempts + 1
+			END,
+			last_failed_at = CURRENT_TIMESTAMP
+		RETURNING failed_attempts
+	`, ip, loginIPWindow.Seconds()).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	var blockSeconds interface{}
+	if failures >= policy.ipMaxFailures {
+		blockSeconds = policy.lockout.Seconds()
+		logging.FromContext(ctx).Warn("Login blocked for IP", "ip", ip, "failed_attempts", failures)
+	}
+	_, err = h.db.Exec(`
+		UPDATE login_ip_throttle
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1),
+		    blocked_until = CASE WHEN $2::float8 IS NULL THEN blocked_until ELSE CURRENT_TIMESTAMP + make_interval(secs => $2::float8) END
+		WHERE ip_address = $3
+	`, policy.backoff(failures).Seconds(), blockSeconds, ip)
+	return err
+}
+
+// registerAccountFailure counts a failed password for an account, applies
+// backoff and locks the account once it reaches the configured number of
+// failures. Level 1 users are notified when an account gets locked.
+func (h *AuthHandler) registerAccountFailure(ctx context.Context, user User) error {
+	policy := h.loginPolicy()
+
+	var failures int
+	err := h.db.QueryRow(`
+		UPDATE users
+		SET failed_login_attempts = failed_login_attempts + 1, last_failed_login_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING failed_login_attempts
+	`, user.ID).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE users SET login_next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1) WHERE id = $2
+	`, policy.backoff(failures).Seconds(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if failures < policy.maxFailures {
+		return nil
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE users SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $1) WHERE id = $2
+	`, policy.lockout.Seconds(), user.ID)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Warn("Account locked", "account_user_id", user.ID, "failed_attempts", failures)
+
+	// Only the Level 1 members of the organizations the account belongs to
+	rows, err := h.db.Query(`
+		SELECT DISTINCT admin.user_id FROM organization_members admin
+		JOIN organization_members locked ON locked.organization_id = admin.organization_id
+		JOIN users u ON u.id = admin.user_id
+		WHERE locked.user_id = $1 AND admin.role = 'Level 1' AND u.status = 'approved'
+	`, user.ID)
+	if err != nil {
+		return err
+	}
+	var adminIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			adminIDs = append(adminIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, adminID := range adminIDs {
+		websocket.CreateNotification(
+			h.db,
+			h.hub,
+			adminID,
+			"account_locked",
+			"Akun Terkunci",
+			fmt.Sprintf("Akun %s %s (%s) terkunci setelah %d kali gagal login", user.FirstName, user.LastName, user.Email, failures),
+			fmt.Sprintf("/login-attempts?user_id=%d", user.ID),
+		)
+	}
+	return nil
+}
+
+// resetAccountFailures clears the failure counter and any lock of an account
+func resetAccountFailures(db *sql.DB, userID int) error {
+	_, err := db.Exec(`
+		UPDATE users
+		SET failed_login_attempts = 0, login_next_attempt_at = NULL, locked_until = NULL
+		WHERE id = $1
+	`, userID)
+	return err
+}
+
+// Unlock User (admin clears a login lockout)
+func (h *UsersHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := managedUserExists(h.db, r, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := resetAccountFailures(h.db, userID); err != nil {
+		http.Error(w, "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User unlocked",
+	})
+}
+
+// List Login Attempts (rejected logins, newest first)
+func (h *UsersHandler) ListLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	email := r.URL.Query().Get("email")
+	ip := r.URL.Query().Get("ip")
+	userID := r.URL.Query().Get("user_id")
+
+	query := `
+		SELECT id, email, user_id, ip_address, user_agent, failure_reason,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+		FROM login_attempts
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	argIndex := 1
+
+	if email != "" {
+		query += fmt.Sprintf(" AND email = $%d", argIndex)
+		args = append(args, email)
+		argIndex++
+	}
+	if ip != "" {
+		query += fmt.Sprintf(" AND ip_address = $%d", argIndex)
+		args = append(args, ip)
+		argIndex++
+	}
+	if userID != "" {
+		query += fmt.Sprintf(" AND user_id = $%d", argIndex)
+		id, _ := strconv.Atoi(userID)
+		args = append(args, id)
+		argIndex++
+	}
+	// Outside superadmin, only attempts against members of the active organization
+	if !isSuperadmin(r) {
+		query += fmt.Sprintf(" AND user_id IN (SELECT user_id FROM organization_members WHERE organization_id = $%d)", argIndex)
+		args = append(args, organizationID(r))
+		argIndex++
+	}
+	query += " ORDER BY created_at DESC LIMIT 200"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get login attempts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	attempts := []LoginAttempt{}
+	for rows.Next() {
+		var a LoginAttempt
+		var attemptUserID sql.NullInt64
+		var userAgent sql.NullString
+		if err := rows.Scan(&a.ID, &a.Email, &attemptUserID, &a.IPAddress, &userAgent, &a.FailureReason, &a.CreatedAt); err != nil {
+			continue
+		}
+		if attemptUserID.Valid {
+			id := int(attemptUserID.Int64)
+			a.UserID = &id
+		}
+		if userAgent.Valid {
+			a.UserAgent = &userAgent.String
+		}
+		attempts = append(attempts, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attempts)
+}
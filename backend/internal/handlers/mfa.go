@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// mfaPendingTokenType is the "typ" claim of the token handed out between
+	// the password and the second factor
+	mfaPendingTokenType = "mfa_pending"
+	// Accepted clock drift in TOTP steps either way
+	mfaSkew            = 1
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+
+	loginFailureInvalidMFACode = "invalid_mfa_code"
+)
+
+var errInvalidMFAToken = errors.New("invalid or expired mfa token")
+
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type DisableMFARequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAStatus struct {
+	Enabled                bool    `json:"enabled"`
+	Required               bool    `json:"required"`
+	EnrollmentPending      bool    `json:"enrollment_pending"`
+	EnabledAt              *string `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int     `json:"recovery_codes_remaining"`
+}
+
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFARecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *AuthHandler) mfaPendingTTL() time.Duration {
+	return h.cfg.MFAPendingTTL
+}
+
+func (h *AuthHandler) generateMFAPendingToken(userID int) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"typ":     mfaPendingTokenType,
+		"exp":     now.Add(h.mfaPendingTTL()).Unix(),
+		"iat":     now.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(h.cfg.JWTSecret))
+}
+
+func (h *AuthHandler) parseMFAPendingToken(tokenString string) (int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(h.cfg.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, errInvalidMFAToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errInvalidMFAToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	tokenType, _ := claims["typ"].(string)
+	if !ok || userID == 0 || tokenType != mfaPendingTokenType {
+		return 0, errInvalidMFAToken
+	}
+	return int(userID), nil
+}
+
+// mfaEnabled reports whether the user has completed TOTP enrolment
+func mfaEnabled(db *sql.DB, userID int) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL)",
+		userID,
+	).Scan(&enabled)
+	return enabled, err
+}
+
+// checkTOTPTx validates a TOTP code against the user's secret (enabled or
+// still pending enrolment) and records the step so it cannot be reused
+func checkTOTPTx(tx *sql.Tx, userID int, code string, enabled bool) (bool, error) {
+	var secret string
+	var lastStep int64
+	err := tx.QueryRow(`
+		SELECT totp_secret, last_used_step FROM user_mfa
+		WHERE user_id = $1 AND (enabled_at IS NOT NULL) = $2
+		FOR UPDATE
+	`, userID, enabled).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), mfaSkew, lastStep)
+	if !ok {
+		return false, nil
+	}
+	_, err = tx.Exec("UPDATE user_mfa SET last_used_step = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2", step, userID)
+	return err == nil, err
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// useRecoveryCodeTx consumes one of the user's unused recovery codes
+func useRecoveryCodeTx(tx *sql.Tx, userID int, code string) (bool, error) {
+	var id int
+	err := tx.QueryRow(`
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM mfa_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+		RETURNING id
+	`, userID, hashToken(normalizeRecoveryCode(code))).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// verifySecondFactor accepts either a TOTP code or a recovery code
+func verifySecondFactor(db *sql.DB, userID int, code, recoveryCode string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var ok bool
+	if code != "" {
+		ok, err = checkTOTPTx(tx, userID, code, true)
+	} else {
+		ok, err = useRecoveryCodeTx(tx, userID, recoveryCode)
+	}
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// replaceRecoveryCodesTx discards the user's recovery codes and stores the
+// hashes of a fresh set. The plain codes are only ever returned here.
+func replaceRecoveryCodesTx(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))[:recoveryCodeLength]
+		if _, err := tx.Exec(
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hashToken(code),
+		); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+	}
+	return codes, nil
+}
+
+// Get MFA Status (current user's two-factor state)
+func (h *AuthHandler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	role, _ := r.Context().Value(middleware.UserRoleKey).(string)
+
+	status := MFAStatus{Required: middleware.MFARequired(role)}
+
+	var enabledAt sql.NullString
+	err := h.db.QueryRow(`
+		SELECT TO_CHAR(enabled_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+		FROM user_mfa WHERE user_id = $1
+	`, userID).Scan(&enabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		status.Enabled = enabledAt.Valid
+		status.EnrollmentPending = !enabledAt.Valid
+		if enabledAt.Valid {
+			status.EnabledAt = &enabledAt.String
+		}
+	}
+
+	if status.Enabled {
+		err = h.db.QueryRow(
+			"SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+			userID,
+		).Scan(&status.RecoveryCodesRemaining)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Enroll MFA (create a TOTP secret to be confirmed with VerifyMFA)
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	enabled, err := mfaEnabled(h.db, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	var email string
+	if err := h.db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO user_mfa (user_id, totp_secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			totp_secret = EXCLUDED.totp_secret, last_used_step = 0, updated_at = CURRENT_TIMESTAMP
+	`, userID, secret)
+	if err != nil {
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MFAEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(h.cfg.MFAIssuer, email, secret),
+	})
+}
+
+// Verify MFA (confirm enrollment with a first code). Returns the recovery
+// codes and logs out the user's other sessions.
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	ok, err := checkTOTPTx(tx, userID, req.Code, false)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE user_mfa SET enabled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE user_id = $1", userID); err != nil {
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	codes, err := replaceRecoveryCodesTx(tx, userID)
+	if err != nil {
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions opened with the password alone must log in again
+	_, err = h.db.Exec(`
+		UPDATE auth_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = 'Two-factor authentication enabled'
+		WHERE user_id = $1 AND session_id != $2 AND revoked_at IS NULL
+	`, userID, sessionID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke other sessions after enabling MFA", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MFARecoveryCodesResponse{
+		Message:       "Two-factor authentication enabled. Store these recovery codes somewhere safe.",
+		RecoveryCodes: codes,
+	})
+}
+
+// Regenerate Recovery Codes (requires a current TOTP code)
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	ok, err := checkTOTPTx(tx, userID, req.Code, true)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := replaceRecoveryCodesTx(tx, userID)
+	if err != nil {
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MFARecoveryCodesResponse{
+		Message:       "Recovery codes regenerated. Previous codes no longer work.",
+		RecoveryCodes: codes,
+	})
+}
+
+// Disable MFA (requires password and a second factor; not allowed for roles
+// that must use two-factor authentication)
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	role, _ := r.Context().Value(middleware.UserRoleKey).(string)
+
+	if middleware.MFARequired(role) {
+		http.Error(w, "Your role requires two-factor authentication", http.StatusForbidden)
+		return
+	}
+
+	var req DisableMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "password and code or recovery_code are required", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	if err := h.db.QueryRow("SELECT password_hash FROM users WHERE id = $1", userID).Scan(&passwordHash); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		http.Error(w, "Password is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := verifySecondFactor(h.db, userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+
+	if err := deleteUserMFA(h.db, userID); err != nil {
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func deleteUserMFA(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Login MFA (second login step: exchange the mfa pending token and a TOTP
+// or recovery code for a session)
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "mfa_token and code or recovery_code are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.parseMFAPendingToken(req.MFAToken)
+	if err != nil {
+		http.Error(w, "Login session expired. Please log in again.", http.StatusUnauthorized)
+		return
+	}
+
+	ip := middleware.ClientIP(r)
+	ipWait, err := h.ipRetryAfter(ip)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if ipWait > 0 {
+		writeLoginThrottled(w, http.StatusTooManyRequests, "Too many login attempts. Please try again later.", ipWait)
+		return
+	}
+
+	var user User
+	var lockedFor, backoffFor float64
+	err = h.db.QueryRow(`
+		SELECT id, email, username, first_name, last_name, role, status,
+		       GREATEST(COALESCE(EXTRACT(EPOCH FROM (locked_until - CURRENT_TIMESTAMP)), 0), 0),
+		       GREATEST(COALESCE(EXTRACT(EPOCH FROM (login_next_attempt_at - CURRENT_TIMESTAMP)), 0), 0)
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status, &lockedFor, &backoffFor)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Login session expired. Please log in again.", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if user.Status != "approved" {
+		http.Error(w, "Your account is pending approval. Please wait for admin approval.", http.StatusForbidden)
+		return
+	}
+	if lockedFor > 0 {
+		h.recordLoginAttempt(r, user.Email, &user.ID, loginFailureAccountLocked)
+		writeLoginThrottled(w, http.StatusLocked, "Account is temporarily locked due to too many failed login attempts", lockedFor)
+		return
+	}
+	if backoffFor > 0 {
+		writeLoginThrottled(w, http.StatusTooManyRequests, "Too many login attempts. Please try again later.", backoffFor)
+		return
+	}
+
+	ok, err := verifySecondFactor(h.db, user.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		// Wrong codes count towards the same lockout as wrong passwords
+		h.recordLoginAttempt(r, user.Email, &user.ID, loginFailureInvalidMFACode)
+		if err := h.registerAccountFailure(r.Context(), user); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to register login failure", "account_user_id", user.ID, "error", err)
+		}
+		if err := h.registerIPFailure(r.Context(), ip); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to register login failure", "ip", ip, "error", err)
+		}
+		http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// Reset User MFA (admin removes a user's second factor, e.g. after a lost
+// device; roles that require it must enrol again on next login)
+func (h *UsersHandler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := managedUserExists(h.db, r, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := deleteUserMFA(h.db, userID); err != nil {
+		http.Error(w, "Failed to reset two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication reset",
+	})
+}
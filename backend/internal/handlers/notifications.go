@@ -63,7 +63,7 @@ func (h *NotificationsHandler) GetNotifications(w http.ResponseWriter, r *http.R
 	if unreadOnly {
 		rows, err = h.db.Query(`
 			SELECT id, user_id, type, title, message, link, read, 
-			       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+			       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
 			FROM notifications
 			WHERE user_id = $1 AND read = FALSE
 			ORDER BY created_at DESC
@@ -72,7 +72,7 @@ func (h *NotificationsHandler) GetNotifications(w http.ResponseWriter, r *http.R
 	} else {
 		rows, err = h.db.Query(`
 			SELECT id, user_id, type, title, message, link, read, 
-			       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+			       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
 			FROM notifications
 			WHERE user_id = $1
 			ORDER BY created_at DESC
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"agrione/backend/internal/database"
+	"agrione/backend/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+type OrganizationsHandler struct {
+	db *sql.DB
+}
+
+func NewOrganizationsHandler(db *sql.DB) *OrganizationsHandler {
+	return &OrganizationsHandler{db: db}
+}
+
+// Organization is an estate or company whose data is isolated from the others
+type Organization struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	Role      string `json:"role,omitempty"` // the caller's role in it
+	Active    bool   `json:"active,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+type OrganizationMember struct {
+	User
+	MemberSince string `json:"member_since"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrganizationID int `json:"organization_id"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// organizationID returns the caller's active organization
+func organizationID(r *http.Request) int {
+	id, _ := r.Context().Value(middleware.OrganizationIDKey).(int)
+	return id
+}
+
+// organizationRole returns the role a user holds in an organization: their
+// member role, or superadmin for superadmins. It is empty when the user has
+// no access to the organization.
+func organizationRole(db *sql.DB, userID, orgID int) (string, error) {
+	var role string
+	err := db.QueryRow(`
+		SELECT CASE WHEN u.role = $3 THEN u.role ELSE COALESCE(om.role, '') END
+		FROM users u
+		LEFT JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $2
+		WHERE u.id = $1 AND EXISTS(SELECT 1 FROM organizations WHERE id = $2)
+	`, userID, orgID, middleware.RoleSuperadmin).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// defaultOrganization picks the organization a new session starts in: the
+// one the user last switched to if they still have access, otherwise the
+// oldest one they can access. It returns 0 when there is none.
+func defaultOrganization(db *sql.DB, userID int) (int, error) {
+	var orgID int
+	err := db.QueryRow(`
+		SELECT o.id
+		FROM organizations o
+		JOIN users u ON u.id = $1
+		LEFT JOIN organization_members om ON om.organization_id = o.id AND om.user_id = u.id
+		WHERE om.user_id IS NOT NULL OR u.role = $2
+		ORDER BY o.id = COALESCE(u.last_organization_id, 0) DESC, o.id ASC
+		LIMIT 1
+	`, userID, middleware.RoleSuperadmin).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return orgID, err
+}
+
+// loadOrganization returns an organization with the user's role in it
+func loadOrganization(db *sql.DB, userID, orgID int) (*Organization, error) {
+	if orgID == 0 {
+		return nil, nil
+	}
+	org := Organization{ID: orgID, Active: true}
+	err := db.QueryRow("SELECT name, slug FROM organizations WHERE id = $1", orgID).Scan(&org.Name, &org.Slug)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	org.Role, err = organizationRole(db, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// loadUser returns a user with their role and details for an organization.
+// Users without access to it keep their account role.
+func loadUser(db *sql.DB, userID, orgID int) (User, error) {
+	var user User
+	err := db.QueryRow(
+		"SELECT id, email, username, first_name, last_name, role, status FROM users WHERE id = $1",
+		userID,
+	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status)
+	if err != nil {
+		return user, err
+	}
+
+	user.Organization, err = loadOrganization(db, userID, orgID)
+	if err != nil {
+		return user, err
+	}
+	if user.Organization != nil && user.Organization.Role != "" {
+		user.Role = user.Organization.Role
+	}
+	return user, nil
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// inOrganization reports whether a row of an organization-scoped table
+// belongs to the organization. table is always a constant, never input.
+func inOrganization(q rowQuerier, table string, id interface{}, orgID int) (bool, error) {
+	var exists bool
+	err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = $1 AND organization_id = $2)", id, orgID).Scan(&exists)
+	return exists, err
+}
+
+// isSuperadmin reports whether the caller is a superadmin
+func isSuperadmin(r *http.Request) bool {
+	role, _ := r.Context().Value(middleware.UserRoleKey).(string)
+	return role == middleware.RoleSuperadmin
+}
+
+// managedUserExists reports whether a user exists that the caller may manage:
+// a member of the caller's active organization, or anyone for a superadmin.
+// Service accounts are managed through their own endpoints.
+func managedUserExists(db *sql.DB, r *http.Request, userID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM users u
+			WHERE u.id = $1 AND u.account_type = 'user'
+			  AND ($3 OR EXISTS(SELECT 1 FROM organization_members om WHERE om.user_id = u.id AND om.organization_id = $2))
+		)
+	`, userID, organizationID(r), isSuperadmin(r)).Scan(&exists)
+	return exists, err
+}
+
+// List Organizations (the caller's memberships; every organization for a superadmin)
+func (h *OrganizationsHandler) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	activeID := organizationID(r)
+
+	rows, err := h.db.Query(`
+		SELECT o.id, o.name, o.slug,
+		       CASE WHEN u.role = $2 THEN u.role ELSE om.role END,
+		       TO_CHAR(o.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+		FROM organizations o
+		JOIN users u ON u.id = $1
+		LEFT JOIN organization_members om ON om.organization_id = o.id AND om.user_id = u.id
+		WHERE om.user_id IS NOT NULL OR u.role = $2
+		ORDER BY o.name ASC
+	`, userID, middleware.RoleSuperadmin)
+	if err != nil {
+		http.Error(w, "Failed to get organizations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	organizations := []Organization{}
+	for rows.Next() {
+		var org Organization
+		var createdAt sql.NullString
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.Role, &createdAt); err != nil {
+			http.Error(w, "Failed to scan organization", http.StatusInternalServerError)
+			return
+		}
+		if createdAt.Valid {
+			org.CreatedAt = createdAt.String
+		}
+		org.Active = org.ID == activeID
+		organizations = append(organizations, org)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(organizations)
+}
+
+// Create Organization (superadmin). New organizations get the default plant types.
+func (h *OrganizationsHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if req.Name == "" || req.Slug == "" {
+		http.Error(w, "name and slug are required", http.StatusBadRequest)
+		return
+	}
+	if !organizationSlugPattern.MatchString(req.Slug) {
+		http.Error(w, "slug may only contain lowercase letters, digits and dashes", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM organizations WHERE slug = $1)", req.Slug).Scan(&exists); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "An organization with this slug already exists", http.StatusConflict)
+		return
+	}
+
+	var org Organization
+	var createdAt sql.NullString
+	err = tx.QueryRow(`
+		INSERT INTO organizations (name, slug) VALUES ($1, $2)
+		RETURNING id, name, slug, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+	`, req.Name, req.Slug).Scan(&org.ID, &org.Name, &org.Slug, &createdAt)
+	if err != nil {
+		http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+		return
+	}
+	if createdAt.Valid {
+		org.CreatedAt = createdAt.String
+	}
+
+	for _, name := range database.DefaultPlantTypes {
+		if _, err := tx.Exec("INSERT INTO plant_types (organization_id, name) VALUES ($1, $2)", org.ID, name); err != nil {
+			http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// List Members of the active organization
+func (h *OrganizationsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+		SELECT u.id, u.email, u.username, u.first_name, u.last_name, om.role, u.status,
+		       TO_CHAR(om.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as member_since
+		FROM organization_members om
+		JOIN users u ON om.user_id = u.id
+		WHERE om.organization_id = $1
+		ORDER BY u.first_name, u.last_name, u.id
+	`, organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to get members", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	members := []OrganizationMember{}
+	for rows.Next() {
+		var m OrganizationMember
+		var memberSince sql.NullString
+		if err := rows.Scan(&m.ID, &m.Email, &m.Username, &m.FirstName, &m.LastName, &m.Role, &m.Status, &memberSince); err != nil {
+			http.Error(w, "Failed to scan member", http.StatusInternalServerError)
+			return
+		}
+		if memberSince.Valid {
+			m.MemberSince = memberSince.String
+		}
+		members = append(members, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// Put Member (change a member's role in the active organization; a superadmin
+// may also add any user to it)
+func (h *OrganizationsHandler) PutMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if userID == r.Context().Value(middleware.UserIDKey).(int) {
+		http.Error(w, "Cannot change your own membership", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validRoles[req.Role] || req.Role == middleware.RoleSuperadmin {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// Anyone else is reported as missing, so user ids of other organizations
+	// cannot be probed
+	exists, err := managedUserExists(h.db, r, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var status string
+	err = h.db.QueryRow("SELECT status FROM users WHERE id = $1", userID).Scan(&status)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if status != "approved" {
+		http.Error(w, "Only approved users can be added to an organization", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = CURRENT_TIMESTAMP
+	`, organizationID(r), userID, req.Role)
+	if err != nil {
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Member updated",
+		"user_id": userID,
+		"role":    req.Role,
+	})
+}
+
+// Remove Member from the active organization
+func (h *OrganizationsHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if userID == r.Context().Value(middleware.UserIDKey).(int) {
+		http.Error(w, "Cannot remove yourself", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2", organizationID(r), userID)
+	if err != nil {
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Switch Organization (move the current session to another organization and
+// return an access token for it; the refresh token keeps working)
+func (h *AuthHandler) SwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	var req SwitchOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := organizationRole(h.db, userID, req.OrganizationID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if role == "" {
+		http.Error(w, "You are not a member of this organization", http.StatusForbidden)
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE auth_sessions SET organization_id = $1 WHERE session_id = $2", req.OrganizationID, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to switch organization", http.StatusInternalServerError)
+		return
+	}
+	_, err = h.db.Exec("UPDATE users SET last_organization_id = $1 WHERE id = $2", req.OrganizationID, userID)
+	if err != nil {
+		http.Error(w, "Failed to switch organization", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := h.generateToken(userID, sessionID, req.OrganizationID)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := loadUser(h.db, userID, req.OrganizationID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Message:   "Organization switched",
+		Token:     accessToken,
+		ExpiresIn: int(h.accessTokenTTL().Seconds()),
+		User:      &user,
+	})
+}
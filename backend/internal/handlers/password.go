@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/mailer"
+	"agrione/backend/internal/middleware"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes
+	maxPasswordLength = 72
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// validatePassword is the password policy shared by signup, reset and change
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("Password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("Password must be at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *AuthHandler) passwordResetTTL() time.Duration {
+	return h.cfg.PasswordResetTTL
+}
+
+// Forgot Password (email a single-use reset link). Always answers the same
+// way so the endpoint cannot be used to discover registered emails.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	// The lookup, token and email all happen after the response, so its
+	// timing is the same whether or not the account exists
+	logger := logging.FromContext(r.Context())
+	ip := middleware.ClientIP(r)
+	h.tasks.Go(func() { h.sendPasswordReset(logger, req.Email, ip) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Message: "If an account exists for this email, a password reset link has been sent.",
+	})
+}
+
+// sendPasswordReset emails a reset link to the account registered with address,
+// if there is one
+func (h *AuthHandler) sendPasswordReset(logger *slog.Logger, address, ip string) {
+	var userID int
+	var email, firstName string
+	err := h.db.QueryRow(
+		"SELECT id, email, first_name FROM users WHERE email = $1 AND status != 'rejected'",
+		address,
+	).Scan(&userID, &email, &firstName)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to look up user for password reset", "error", err)
+		}
+		return
+	}
+
+	token, err := h.createPasswordResetToken(userID, ip)
+	if err != nil {
+		logger.Error("Failed to create password reset token", "account_user_id", userID, "error", err)
+		return
+	}
+
+	ttl := h.passwordResetTTL()
+	link := fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(h.cfg.FrontendURL, "/"), url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Reset your AgriOne password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your AgriOne password. "+
+			"Open the link below to choose a new password. The link can be used once and expires in %s.\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n",
+			firstName, ttl, link),
+	}
+	if err := h.mailer.Send(msg); err != nil {
+		logger.Error("Failed to send password reset email", "account_user_id", userID, "error", err)
+	}
+}
+
+// createPasswordResetToken invalidates the user's outstanding reset tokens
+// and stores the hash of a new one
+func (h *AuthHandler) createPasswordResetToken(userID int, ip string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, requested_ip)
+		VALUES ($1, $2, $3, $4)
+	`, userID, hashToken(token), time.Now().Add(h.passwordResetTTL()), ip)
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// Reset Password (set a new password with a token from ForgotPassword)
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		http.Error(w, "token and new_password are required", http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	var usable bool
+	err = tx.QueryRow(`
+		SELECT id, user_id, used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(req.Token)).Scan(&tokenID, &userID, &usable)
+	if err == sql.ErrNoRows || (err == nil && !usable) {
+		http.Error(w, "Reset link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", tokenID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", hashedPassword, userID); err != nil {
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// A reset also lifts any login lockout on the account
+	if err := resetAccountFailures(h.db, userID); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to clear login lockout after password reset", "account_user_id", userID, "error", err)
+	}
+
+	// Whoever knew the old password must not stay logged in
+	if _, err := revokeUserSessions(h.db, userID, "Password reset"); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke sessions after password reset", "account_user_id", userID, "error", err)
+	}
+	h.hub.DisconnectUser(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Message: "Password has been reset. Please log in with your new password.",
+	})
+}
+
+// Change Password (authenticated user changes their own password). Other
+// sessions are logged out; the current one stays valid.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		http.Error(w, "New password must be different from the current password", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	err := h.db.QueryRow("SELECT password_hash FROM users WHERE id = $1", userID).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			http.Error(w, "Current password is incorrect", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to verify password", http.StatusInternalServerError)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Exec("UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", hashedPassword, userID); err != nil {
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE auth_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = 'Password changed'
+		WHERE user_id = $1 AND session_id != $2 AND revoked_at IS NULL
+	`, userID, sessionID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke other sessions after password change", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{
+		Message: "Password changed successfully",
+	})
+}
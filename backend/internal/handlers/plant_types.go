@@ -31,11 +31,12 @@ type CreatePlantTypeRequest struct {
 func (h *PlantTypesHandler) ListPlantTypes(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.db.Query(`
 		SELECT id, name, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
 		FROM plant_types 
+		WHERE organization_id = $1
 		ORDER BY name ASC
-	`)
+	`, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to get plant types", http.StatusInternalServerError)
 		return
@@ -81,11 +82,11 @@ func (h *PlantTypesHandler) GetPlantType(w http.ResponseWriter, r *http.Request)
 
 	err = h.db.QueryRow(`
 		SELECT id, name, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
 		FROM plant_types 
-		WHERE id = $1
-	`, id).Scan(&pt.ID, &pt.Name, &createdAt, &updatedAt)
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID(r)).Scan(&pt.ID, &pt.Name, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, "Plant type not found", http.StatusNotFound)
@@ -123,12 +124,12 @@ func (h *PlantTypesHandler) CreatePlantType(w http.ResponseWriter, r *http.Reque
 	var createdAt, updatedAt sql.NullString
 
 	err := h.db.QueryRow(`
-		INSERT INTO plant_types (name)
-		VALUES ($1)
+		INSERT INTO plant_types (name, organization_id)
+		VALUES ($1, $2)
 		RETURNING id, name, 
-		          TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		          TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-	`, req.Name).Scan(&pt.ID, &pt.Name, &createdAt, &updatedAt)
+		          TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		          TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+	`, req.Name, organizationID(r)).Scan(&pt.ID, &pt.Name, &createdAt, &updatedAt)
 
 	if err != nil {
 		http.Error(w, "Failed to create plant type", http.StatusInternalServerError)
@@ -173,12 +174,16 @@ func (h *PlantTypesHandler) UpdatePlantType(w http.ResponseWriter, r *http.Reque
 	err = h.db.QueryRow(`
 		UPDATE plant_types 
 		SET name = $1, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = $2
+		WHERE id = $2 AND organization_id = $3
 		RETURNING id, name, 
-		          TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		          TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-	`, req.Name, id).Scan(&pt.ID, &pt.Name, &createdAt, &updatedAt)
+		          TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		          TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+	`, req.Name, id, organizationID(r)).Scan(&pt.ID, &pt.Name, &createdAt, &updatedAt)
 
+	if err == sql.ErrNoRows {
+		http.Error(w, "Plant type not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update plant type", http.StatusInternalServerError)
 		return
@@ -204,11 +209,15 @@ func (h *PlantTypesHandler) DeletePlantType(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM plant_types WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM plant_types WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete plant type", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Plant type not found", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
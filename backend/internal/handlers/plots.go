@@ -48,13 +48,23 @@ type UpdatePlotRequest struct {
 }
 
 func (h *PlotsHandler) ListPlots(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query(`
+	query := `
 		SELECT id, name, description, type, apikey, coordinates, field_ref, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
 		FROM plots 
-		ORDER BY created_at DESC
-	`)
+		WHERE organization_id = $1`
+	args := []interface{}{organizationID(r)}
+
+	// Field workers only see the plots of their assigned fields
+	if userID, ok := fieldScopedUser(r); ok {
+		args = append(args, userID)
+		query += " AND field_ref IN (" + assignedFieldsSQL(len(args)) + ")"
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to get plots", http.StatusInternalServerError)
 		return
@@ -111,6 +121,9 @@ func (h *PlotsHandler) GetPlot(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid plot ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, visiblePlotsSQL(2), id, "Plot not found") {
+		return
+	}
 
 	var p Plot
 	var coordinatesJSON []byte
@@ -119,11 +132,11 @@ func (h *PlotsHandler) GetPlot(w http.ResponseWriter, r *http.Request) {
 
 	err = h.db.QueryRow(`
 		SELECT id, name, description, type, apikey, coordinates, field_ref, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
 		FROM plots 
-		WHERE id = $1
-	`, id).Scan(
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&p.ID, &p.Name, &description, &p.Type, &p.APIKey, &coordinatesJSON,
 		&fieldRef, &createdAt, &updatedAt,
 	)
@@ -179,18 +192,31 @@ func (h *PlotsHandler) CreatePlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	orgID := organizationID(r)
+	if req.FieldRef != nil {
+		ok, err := inOrganization(h.db, "fields", *req.FieldRef, orgID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Field not found", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var p Plot
 	var coordinatesJSONOut []byte
 	var description, createdAt, updatedAt sql.NullString
 	var fieldRef sql.NullInt64
 
 	err = h.db.QueryRow(`
-		INSERT INTO plots (name, description, type, apikey, coordinates, field_ref)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO plots (name, description, type, apikey, coordinates, field_ref, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, name, description, type, apikey, coordinates, field_ref, 
-		          TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		          TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-	`, req.Name, req.Description, req.Type, req.APIKey, string(coordinatesJSON), req.FieldRef).Scan(
+		          TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		          TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+	`, req.Name, req.Description, req.Type, req.APIKey, string(coordinatesJSON), req.FieldRef, orgID).Scan(
 		&p.ID, &p.Name, &description, &p.Type, &p.APIKey, &coordinatesJSONOut,
 		&fieldRef, &createdAt, &updatedAt,
 	)
@@ -275,6 +301,15 @@ func (h *PlotsHandler) UpdatePlot(w http.ResponseWriter, r *http.Request) {
 		argPos++
 	}
 	if req.FieldRef != nil {
+		ok, err := inOrganization(h.db, "fields", *req.FieldRef, organizationID(r))
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Field not found", http.StatusBadRequest)
+			return
+		}
 		updates = append(updates, "field_ref = $"+strconv.Itoa(argPos))
 		args = append(args, *req.FieldRef)
 		argPos++
@@ -293,13 +328,18 @@ func (h *PlotsHandler) UpdatePlot(w http.ResponseWriter, r *http.Request) {
 	for i := 1; i < len(updates)-1; i++ {
 		query += ", " + updates[i]
 	}
-	query += " WHERE " + updates[len(updates)-1]
+	query += " WHERE " + updates[len(updates)-1] + " AND organization_id = $" + strconv.Itoa(argPos+1)
+	args = append(args, organizationID(r))
 
-	_, err = h.db.Exec(query, args...)
+	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update plot", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Plot not found", http.StatusNotFound)
+		return
+	}
 
 	// Return updated plot by querying directly
 	var p Plot
@@ -309,11 +349,11 @@ func (h *PlotsHandler) UpdatePlot(w http.ResponseWriter, r *http.Request) {
 
 	err = h.db.QueryRow(`
 		SELECT id, name, description, type, apikey, coordinates, field_ref, 
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at 
 		FROM plots 
-		WHERE id = $1
-	`, id).Scan(
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&p.ID, &p.Name, &description, &p.Type, &p.APIKey, &coordinatesJSON,
 		&fieldRef, &createdAt, &updatedAt,
 	)
@@ -355,11 +395,15 @@ func (h *PlotsHandler) DeletePlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM plots WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM plots WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete plot", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Plot not found", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
@@ -0,0 +1,1061 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Supplier types
+type Supplier struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	ContactName *string `json:"contact_name,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Address     *string `json:"address,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+	Status      string  `json:"status"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+type CreateSupplierRequest struct {
+	Name        string  `json:"name"`
+	ContactName *string `json:"contact_name,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Address     *string `json:"address,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+}
+
+type UpdateSupplierRequest struct {
+	Name        *string `json:"name,omitempty"`
+	ContactName *string `json:"contact_name,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Address     *string `json:"address,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+	Status      *string `json:"status,omitempty"`
+}
+
+// Purchase Order types
+type PurchaseOrder struct {
+	ID                   int                 `json:"id"`
+	PONumber             string              `json:"po_number"`
+	SupplierID           int                 `json:"supplier_id"`
+	SupplierName         string              `json:"supplier_name"`
+	WarehouseID          int                 `json:"warehouse_id"`
+	WarehouseName        string              `json:"warehouse_name"`
+	Status               string              `json:"status"`
+	ExpectedDate         *string             `json:"expected_date,omitempty"`
+	PurchaseSuggestionID *int                `json:"purchase_suggestion_id,omitempty"`
+	Notes                *string             `json:"notes,omitempty"`
+	CreatedBy            string              `json:"created_by"`
+	SubmittedBy          *string             `json:"submitted_by,omitempty"`
+	SubmittedAt          *string             `json:"submitted_at,omitempty"`
+	CancelledBy          *string             `json:"cancelled_by,omitempty"`
+	CancelledAt          *string             `json:"cancelled_at,omitempty"`
+	CancellationReason   *string             `json:"cancellation_reason,omitempty"`
+	TotalCost            float64             `json:"total_cost"`
+	ReceivedCost         float64             `json:"received_cost"`
+	Lines                []PurchaseOrderLine `json:"lines"`
+	Receipts             []GoodsReceipt      `json:"receipts"`
+	CreatedAt            string              `json:"created_at"`
+	UpdatedAt            string              `json:"updated_at"`
+}
+
+type PurchaseOrderLine struct {
+	ID                  int     `json:"id"`
+	ItemID              int     `json:"item_id"`
+	ItemName            string  `json:"item_name"`
+	ItemSKU             string  `json:"item_sku"`
+	Unit                string  `json:"unit"`
+	QuantityOrdered     float64 `json:"quantity_ordered"`
+	QuantityReceived    float64 `json:"quantity_received"`
+	QuantityOutstanding float64 `json:"quantity_outstanding"`
+	UnitCost            float64 `json:"unit_cost"`
+	Notes               *string `json:"notes,omitempty"`
+}
+
+type GoodsReceipt struct {
+	ID            int                `json:"id"`
+	ReceiptNumber string             `json:"receipt_number"`
+	ReceivedBy    string             `json:"received_by"`
+	ReceivedDate  string             `json:"received_date"`
+	Notes         *string            `json:"notes,omitempty"`
+	Lines         []GoodsReceiptLine `json:"lines"`
+	CreatedAt     string             `json:"created_at"`
+}
+
+type GoodsReceiptLine struct {
+	ID                  int     `json:"id"`
+	PurchaseOrderLineID int     `json:"purchase_order_line_id"`
+	ItemID              int     `json:"item_id"`
+	ItemName            string  `json:"item_name"`
+	LotID               *int    `json:"lot_id,omitempty"`
+	LotCode             *string `json:"lot_code,omitempty"`
+	Quantity            float64 `json:"quantity"`
+	UnitCost            float64 `json:"unit_cost"`
+}
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID   int     `json:"supplier_id"`
+	WarehouseID  int     `json:"warehouse_id"`
+	ExpectedDate *string `json:"expected_date,omitempty"`
+	// PurchaseSuggestionID converts a draft purchase suggestion into this
+	// order. Its lines are used when no lines are given.
+	PurchaseSuggestionID *int `json:"purchase_suggestion_id,omitempty"`
+	Lines                []struct {
+		ItemID   int     `json:"item_id"`
+		Quantity float64 `json:"quantity"`
+		UnitCost float64 `json:"unit_cost"`
+		Notes    *string `json:"notes,omitempty"`
+	} `json:"lines"`
+	Notes *string `json:"notes,omitempty"`
+}
+
+type CancelPurchaseOrderRequest struct {
+	Reason *string `json:"reason,omitempty"`
+}
+
+type ReceivePurchaseOrderRequest struct {
+	Lines []struct {
+		PurchaseOrderLineID int     `json:"purchase_order_line_id"`
+		Quantity            float64 `json:"quantity"`
+		// UnitCost defaults to the ordered unit cost
+		UnitCost *float64 `json:"unit_cost,omitempty"`
+		// BatchNo defaults to the PO number
+		BatchNo    string  `json:"batch_no"`
+		ExpiryDate *string `json:"expiry_date,omitempty"`
+		Notes      *string `json:"notes,omitempty"`
+	} `json:"lines"`
+	ReceivedDate *string `json:"received_date,omitempty"`
+	Notes        *string `json:"notes,omitempty"`
+}
+
+// List Suppliers
+func (h *InventoryHandler) ListSuppliers(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	search := r.URL.Query().Get("search")
+
+	query := `
+		SELECT id, name, contact_name, phone, email, address, notes, status,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM suppliers
+		WHERE organization_id = $1
+	`
+	args := []interface{}{organizationID(r)}
+	argIndex := 2
+
+	if status != "" && status != "all" {
+		query += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+	if search != "" {
+		query += fmt.Sprintf(" AND (name ILIKE $%d OR contact_name ILIKE $%d)", argIndex, argIndex)
+		args = append(args, "%"+search+"%")
+		argIndex++
+	}
+	query += " ORDER BY name ASC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get suppliers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suppliers := []Supplier{}
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			continue
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+func scanSupplier(row rowScanner) (Supplier, error) {
+	var s Supplier
+	var contactName, phone, email, address, notes sql.NullString
+	err := row.Scan(&s.ID, &s.Name, &contactName, &phone, &email, &address, &notes, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	if contactName.Valid {
+		s.ContactName = &contactName.String
+	}
+	if phone.Valid {
+		s.Phone = &phone.String
+	}
+	if email.Valid {
+		s.Email = &email.String
+	}
+	if address.Valid {
+		s.Address = &address.String
+	}
+	if notes.Valid {
+		s.Notes = &notes.String
+	}
+	return s, nil
+}
+
+func (h *InventoryHandler) getSupplier(id, orgID int) (Supplier, error) {
+	return scanSupplier(h.db.QueryRow(`
+		SELECT id, name, contact_name, phone, email, address, notes, status,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM suppliers WHERE id = $1 AND organization_id = $2
+	`, id, orgID))
+}
+
+func (h *InventoryHandler) writeSupplier(w http.ResponseWriter, id, orgID int, status int) {
+	supplier, err := h.getSupplier(id, orgID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// Get Supplier
+func (h *InventoryHandler) GetSupplier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writeSupplier(w, id, organizationID(r), http.StatusOK)
+}
+
+// Create Supplier
+func (h *InventoryHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var req CreateSupplierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	var id int
+	err := h.db.QueryRow(`
+		INSERT INTO suppliers (name, contact_name, phone, email, address, notes, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, req.Name, req.ContactName, req.Phone, req.Email, req.Address, req.Notes, organizationID(r)).Scan(&id)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			http.Error(w, "Supplier with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create supplier", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeSupplier(w, id, organizationID(r), http.StatusCreated)
+}
+
+// Update Supplier
+func (h *InventoryHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateSupplierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	argIndex := 1
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, fmt.Sprintf("name = $%d", argIndex))
+		args = append(args, name)
+		argIndex++
+	}
+	if req.Status != nil {
+		if *req.Status != "active" && *req.Status != "inactive" {
+			http.Error(w, "status must be 'active' or 'inactive'", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, fmt.Sprintf("status = $%d", argIndex))
+		args = append(args, *req.Status)
+		argIndex++
+	}
+	optional := []struct {
+		column string
+		value  *string
+	}{
+		{"contact_name", req.ContactName},
+		{"phone", req.Phone},
+		{"email", req.Email},
+		{"address", req.Address},
+		{"notes", req.Notes},
+	}
+	for _, field := range optional {
+		if field.value != nil {
+			updates = append(updates, fmt.Sprintf("%s = $%d", field.column, argIndex))
+			args = append(args, *field.value)
+			argIndex++
+		}
+	}
+
+	if len(updates) == 0 {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	updates = append(updates, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id, organizationID(r))
+	query := fmt.Sprintf("UPDATE suppliers SET %s WHERE id = $%d AND organization_id = $%d", strings.Join(updates, ", "), argIndex, argIndex+1)
+
+	result, err := h.db.Exec(query, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			http.Error(w, "Supplier with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to update supplier", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+
+	h.writeSupplier(w, id, organizationID(r), http.StatusOK)
+}
+
+// List Purchase Orders
+func (h *InventoryHandler) ListPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	supplierID := r.URL.Query().Get("supplier_id")
+	warehouseID := r.URL.Query().Get("warehouse_id")
+
+	orgID := organizationID(r)
+	query := `SELECT id FROM purchase_orders WHERE organization_id = $1`
+	args := []interface{}{orgID}
+	argIndex := 2
+
+	if status != "" && status != "all" {
+		query += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+	if supplierID != "" && supplierID != "all" {
+		query += fmt.Sprintf(" AND supplier_id = $%d", argIndex)
+		id, _ := strconv.Atoi(supplierID)
+		args = append(args, id)
+		argIndex++
+	}
+	if warehouseID != "" && warehouseID != "all" {
+		query += fmt.Sprintf(" AND warehouse_id = $%d", argIndex)
+		id, _ := strconv.Atoi(warehouseID)
+		args = append(args, id)
+		argIndex++
+	}
+	query += " ORDER BY created_at DESC LIMIT 100"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get purchase orders", http.StatusInternalServerError)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	orders := []PurchaseOrder{}
+	for _, id := range ids {
+		order, err := h.getPurchaseOrder(id, orgID)
+		if err != nil {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// Get Purchase Order (with lines and goods receipts)
+func (h *InventoryHandler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writePurchaseOrder(w, id, organizationID(r), http.StatusOK)
+}
+
+func (h *InventoryHandler) writePurchaseOrder(w http.ResponseWriter, id, orgID int, status int) {
+	order, err := h.getPurchaseOrder(id, orgID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *InventoryHandler) getPurchaseOrder(id, orgID int) (PurchaseOrder, error) {
+	var po PurchaseOrder
+	var expectedDate, notes, submittedBy, submittedAt, cancelledBy, cancelledAt, cancellationReason sql.NullString
+	var suggestionID sql.NullInt64
+
+	err := h.db.QueryRow(`
+		SELECT po.id, po.po_number, po.supplier_id, s.name, po.warehouse_id, p.name, po.status,
+		       TO_CHAR(po.expected_date, 'YYYY-MM-DD'), po.purchase_suggestion_id, po.notes, po.created_by,
+		       po.submitted_by, TO_CHAR(po.submitted_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       po.cancelled_by, TO_CHAR(po.cancelled_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       po.cancellation_reason,
+		       TO_CHAR(po.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(po.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM purchase_orders po
+		JOIN suppliers s ON po.supplier_id = s.id
+		JOIN plots p ON po.warehouse_id = p.id
+		WHERE po.id = $1 AND po.organization_id = $2
+	`, id, orgID).Scan(
+		&po.ID, &po.PONumber, &po.SupplierID, &po.SupplierName, &po.WarehouseID, &po.WarehouseName, &po.Status,
+		&expectedDate, &suggestionID, &notes, &po.CreatedBy,
+		&submittedBy, &submittedAt, &cancelledBy, &cancelledAt, &cancellationReason,
+		&po.CreatedAt, &po.UpdatedAt,
+	)
+	if err != nil {
+		return po, err
+	}
+
+	if expectedDate.Valid {
+		po.ExpectedDate = &expectedDate.String
+	}
+	if suggestionID.Valid {
+		id := int(suggestionID.Int64)
+		po.PurchaseSuggestionID = &id
+	}
+	if notes.Valid {
+		po.Notes = &notes.String
+	}
+	if submittedBy.Valid {
+		po.SubmittedBy = &submittedBy.String
+	}
+	if submittedAt.Valid {
+		po.SubmittedAt = &submittedAt.String
+	}
+	if cancelledBy.Valid {
+		po.CancelledBy = &cancelledBy.String
+	}
+	if cancelledAt.Valid {
+		po.CancelledAt = &cancelledAt.String
+	}
+	if cancellationReason.Valid {
+		po.CancellationReason = &cancellationReason.String
+	}
+
+	lineRows, err := h.db.Query(`
+		SELECT pol.id, pol.item_id, i.name, i.sku, i.unit, pol.quantity_ordered, pol.quantity_received,
+		       pol.unit_cost, pol.notes
+		FROM purchase_order_lines pol
+		JOIN inventory_items i ON pol.item_id = i.id
+		WHERE pol.purchase_order_id = $1
+		ORDER BY pol.id ASC
+	`, id)
+	if err != nil {
+		return po, err
+	}
+	po.Lines = []PurchaseOrderLine{}
+	for lineRows.Next() {
+		var line PurchaseOrderLine
+		var lineNotes sql.NullString
+		err := lineRows.Scan(&line.ID, &line.ItemID, &line.ItemName, &line.ItemSKU, &line.Unit,
+			&line.QuantityOrdered, &line.QuantityReceived, &line.UnitCost, &lineNotes)
+		if err != nil {
+			continue
+		}
+		if lineNotes.Valid {
+			line.Notes = &lineNotes.String
+		}
+		line.QuantityOutstanding = line.QuantityOrdered - line.QuantityReceived
+		if line.QuantityOutstanding < 0 {
+			line.QuantityOutstanding = 0
+		}
+		po.TotalCost += line.QuantityOrdered * line.UnitCost
+		po.Lines = append(po.Lines, line)
+	}
+	lineRows.Close()
+
+	receiptRows, err := h.db.Query(`
+		SELECT gr.id, gr.receipt_number, gr.received_by, TO_CHAR(gr.received_date, 'YYYY-MM-DD'), gr.notes,
+		       TO_CHAR(gr.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+		FROM goods_receipts gr
+		WHERE gr.purchase_order_id = $1
+		ORDER BY gr.id ASC
+	`, id)
+	if err != nil {
+		return po, err
+	}
+	po.Receipts = []GoodsReceipt{}
+	receiptIndex := map[int]int{}
+	for receiptRows.Next() {
+		var receipt GoodsReceipt
+		var receiptNotes sql.NullString
+		err := receiptRows.Scan(&receipt.ID, &receipt.ReceiptNumber, &receipt.ReceivedBy, &receipt.ReceivedDate,
+			&receiptNotes, &receipt.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if receiptNotes.Valid {
+			receipt.Notes = &receiptNotes.String
+		}
+		receipt.Lines = []GoodsReceiptLine{}
+		receiptIndex[receipt.ID] = len(po.Receipts)
+		po.Receipts = append(po.Receipts, receipt)
+	}
+	receiptRows.Close()
+
+	rows, err := h.db.Query(`
+		SELECT grl.id, grl.goods_receipt_id, grl.purchase_order_line_id, pol.item_id, i.name,
+		       grl.lot_id, sl.lot_id, grl.quantity, grl.unit_cost
+		FROM goods_receipt_lines grl
+		JOIN goods_receipts gr ON grl.goods_receipt_id = gr.id
+		JOIN purchase_order_lines pol ON grl.purchase_order_line_id = pol.id
+		JOIN inventory_items i ON pol.item_id = i.id
+		LEFT JOIN stock_lots sl ON grl.lot_id = sl.id
+		WHERE gr.purchase_order_id = $1
+		ORDER BY grl.id ASC
+	`, id)
+	if err != nil {
+		return po, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line GoodsReceiptLine
+		var receiptID int
+		var lotID sql.NullInt64
+		var lotCode sql.NullString
+		err := rows.Scan(&line.ID, &receiptID, &line.PurchaseOrderLineID, &line.ItemID, &line.ItemName,
+			&lotID, &lotCode, &line.Quantity, &line.UnitCost)
+		if err != nil {
+			continue
+		}
+		if lotID.Valid {
+			id := int(lotID.Int64)
+			line.LotID = &id
+		}
+		if lotCode.Valid {
+			line.LotCode = &lotCode.String
+		}
+		po.ReceivedCost += line.Quantity * line.UnitCost
+		if i, ok := receiptIndex[receiptID]; ok {
+			po.Receipts[i].Lines = append(po.Receipts[i].Lines, line)
+		}
+	}
+
+	return po, nil
+}
+
+// Create Purchase Order (draft)
+func (h *InventoryHandler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	var req CreatePurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.WarehouseID == 0 {
+		http.Error(w, "warehouse_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.SupplierID == 0 && req.PurchaseSuggestionID == nil {
+		http.Error(w, "supplier_id is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Lines) == 0 && req.PurchaseSuggestionID == nil {
+		http.Error(w, "lines are required", http.StatusBadRequest)
+		return
+	}
+	for _, line := range req.Lines {
+		if line.ItemID == 0 || line.Quantity <= 0 || line.UnitCost < 0 {
+			http.Error(w, "Each line requires item_id, a positive quantity and a non-negative unit_cost", http.StatusBadRequest)
+			return
+		}
+	}
+	var expectedDate sql.NullString
+	if req.ExpectedDate != nil && *req.ExpectedDate != "" {
+		if _, err := time.Parse("2006-01-02", *req.ExpectedDate); err != nil {
+			http.Error(w, "Invalid expected_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		expectedDate.String = *req.ExpectedDate
+		expectedDate.Valid = true
+	}
+
+	createdBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	orgID := organizationID(r)
+	idempotency := newIdempotentRequest(r, "purchase_orders.create", req)
+	var orderID int
+	replayed := false
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		existingID, found, err := idempotency.lookup(tx)
+		if err != nil {
+			return err
+		}
+		if found {
+			orderID, replayed = existingID, true
+			return nil
+		}
+
+		if err := checkWarehouse(tx, req.WarehouseID, orgID); err != nil {
+			return err
+		}
+
+		type orderLine struct {
+			itemID   int
+			quantity float64
+			unitCost float64
+			notes    *string
+		}
+		var lines []orderLine
+		for _, line := range req.Lines {
+			lines = append(lines, orderLine{line.ItemID, line.Quantity, line.UnitCost, line.Notes})
+		}
+
+		supplierID := req.SupplierID
+		if req.PurchaseSuggestionID != nil {
+			var suggestionStatus, suggestionSupplier string
+			err := tx.QueryRow(`
+				SELECT status, supplier FROM purchase_suggestions WHERE id = $1 AND organization_id = $2 FOR UPDATE
+			`, *req.PurchaseSuggestionID, orgID).Scan(&suggestionStatus, &suggestionSupplier)
+			if err == sql.ErrNoRows {
+				return newStockError(http.StatusNotFound, "Purchase suggestion not found")
+			}
+			if err != nil {
+				return err
+			}
+			if suggestionStatus != "draft" {
+				return newStockError(http.StatusBadRequest, "Only draft purchase suggestions can be ordered")
+			}
+
+			if supplierID == 0 {
+				err := tx.QueryRow("SELECT id FROM suppliers WHERE name = $1 AND organization_id = $2", suggestionSupplier, orgID).Scan(&supplierID)
+				if err == sql.ErrNoRows {
+					return newStockError(http.StatusBadRequest, fmt.Sprintf("Supplier '%s' is not in the supplier master; supplier_id is required", suggestionSupplier))
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(lines) == 0 {
+				rows, err := tx.Query(`
+					SELECT item_id, suggested_quantity, estimated_unit_cost
+					FROM purchase_suggestion_lines
+					WHERE suggestion_id = $1 AND suggested_quantity > 0
+					ORDER BY id ASC
+				`, *req.PurchaseSuggestionID)
+				if err != nil {
+					return err
+				}
+				for rows.Next() {
+					var line orderLine
+					if err := rows.Scan(&line.itemID, &line.quantity, &line.unitCost); err != nil {
+						rows.Close()
+						return err
+					}
+					lines = append(lines, line)
+				}
+				rows.Close()
+				if err := rows.Err(); err != nil {
+					return err
+				}
+				if len(lines) == 0 {
+					return newStockError(http.StatusBadRequest, "Purchase suggestion has no lines to order")
+				}
+			}
+
+			_, err = tx.Exec(`
+				UPDATE purchase_suggestions SET status = 'ordered', updated_at = CURRENT_TIMESTAMP WHERE id = $1
+			`, *req.PurchaseSuggestionID)
+			if err != nil {
+				return err
+			}
+		}
+
+		var supplierStatus string
+		err = tx.QueryRow("SELECT status FROM suppliers WHERE id = $1 AND organization_id = $2", supplierID, orgID).Scan(&supplierStatus)
+		if err == sql.ErrNoRows {
+			return newStockError(http.StatusNotFound, "Supplier not found")
+		}
+		if err != nil {
+			return err
+		}
+		if supplierStatus != "active" {
+			return newStockError(http.StatusBadRequest, "Supplier is inactive")
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO purchase_orders (po_number, supplier_id, warehouse_id, status, expected_date, purchase_suggestion_id, notes, created_by, organization_id)
+			VALUES ($1, $2, $3, 'draft', $4, $5, $6, $7, $8)
+			RETURNING id
+		`, generateID("PO"), supplierID, req.WarehouseID, expectedDate, req.PurchaseSuggestionID, req.Notes, createdBy.Name, orgID).Scan(&orderID)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range lines {
+			exists, err := inOrganization(tx, "inventory_items", line.itemID, orgID)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return newStockError(http.StatusNotFound, fmt.Sprintf("Inventory item %d not found", line.itemID))
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO purchase_order_lines (purchase_order_id, item_id, quantity_ordered, unit_cost, notes)
+				VALUES ($1, $2, $3, $4, $5)
+			`, orderID, line.itemID, line.quantity, line.unitCost, line.notes)
+			if err != nil {
+				return err
+			}
+		}
+
+		return idempotency.save(tx, orderID)
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to create purchase order")
+		return
+	}
+
+	status := http.StatusCreated
+	if replayed {
+		status = http.StatusOK
+	}
+	h.writePurchaseOrder(w, orderID, orgID, status)
+}
+
+// Submit Purchase Order (draft -> submitted to the supplier)
+func (h *InventoryHandler) SubmitPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	submittedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE purchase_orders
+		SET status = 'submitted', submitted_by = $1, submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND organization_id = $3 AND status = 'draft'
+	`, submittedBy.Name, id, organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to submit purchase order", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Only draft purchase orders can be submitted", http.StatusBadRequest)
+		return
+	}
+
+	h.writePurchaseOrder(w, id, organizationID(r), http.StatusOK)
+}
+
+// Cancel Purchase Order. A partially received order keeps its receipts;
+// cancelling it closes the outstanding quantities.
+func (h *InventoryHandler) CancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CancelPurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	cancelledBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE purchase_orders
+		SET status = 'cancelled', cancelled_by = $1, cancelled_at = CURRENT_TIMESTAMP,
+		    cancellation_reason = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND organization_id = $4 AND status IN ('draft', 'submitted', 'partially_received')
+	`, cancelledBy.Name, req.Reason, id, organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to cancel purchase order", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Only open purchase orders can be cancelled", http.StatusBadRequest)
+		return
+	}
+
+	h.writePurchaseOrder(w, id, organizationID(r), http.StatusOK)
+}
+
+// Receive Purchase Order (goods receipt). Each received line creates a stock
+// lot linked to its PO line; the order becomes partially_received or received.
+func (h *InventoryHandler) ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReceivePurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Lines) == 0 {
+		http.Error(w, "lines are required", http.StatusBadRequest)
+		return
+	}
+	for _, line := range req.Lines {
+		if line.PurchaseOrderLineID == 0 || line.Quantity <= 0 {
+			http.Error(w, "Each line requires purchase_order_line_id and a positive quantity", http.StatusBadRequest)
+			return
+		}
+		if line.UnitCost != nil && *line.UnitCost <= 0 {
+			http.Error(w, "unit_cost must be positive", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ReceivedDate != nil && *req.ReceivedDate != "" {
+		if _, err := time.Parse("2006-01-02", *req.ReceivedDate); err != nil {
+			http.Error(w, "Invalid received_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	receivedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	orgID := organizationID(r)
+	idempotency := newIdempotentRequest(r, "purchase_orders.receive", req)
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		_, found, err := idempotency.lookup(tx)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+
+		var poNumber, status, supplierName string
+		var warehouseID int
+		err = tx.QueryRow(`
+			SELECT po.po_number, po.status, po.warehouse_id, s.name
+			FROM purchase_orders po
+			JOIN suppliers s ON po.supplier_id = s.id
+			WHERE po.id = $1 AND po.organization_id = $2
+			FOR UPDATE OF po
+		`, id, orgID).Scan(&poNumber, &status, &warehouseID, &supplierName)
+		if err == sql.ErrNoRows {
+			return newStockError(http.StatusNotFound, "Purchase order not found")
+		}
+		if err != nil {
+			return err
+		}
+		if status != "submitted" && status != "partially_received" {
+			return newStockError(http.StatusBadRequest, "Only submitted purchase orders can be received")
+		}
+
+		var receivedDate sql.NullString
+		if req.ReceivedDate != nil && *req.ReceivedDate != "" {
+			receivedDate.String = *req.ReceivedDate
+			receivedDate.Valid = true
+		}
+
+		var receiptID int
+		err = tx.QueryRow(`
+			INSERT INTO goods_receipts (receipt_number, purchase_order_id, warehouse_id, received_by, received_date, notes, organization_id)
+			VALUES ($1, $2, $3, $4, COALESCE($5::date, CURRENT_DATE), $6, $7)
+			RETURNING id
+		`, generateID("GRN"), id, warehouseID, receivedBy.Name, receivedDate, req.Notes, orgID).Scan(&receiptID)
+		if err != nil {
+			return err
+		}
+
+		// Lock PO lines in id order so concurrent receipts serialize
+		lines := req.Lines
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].PurchaseOrderLineID < lines[j].PurchaseOrderLineID
+		})
+
+		for _, line := range lines {
+			var itemID int
+			var ordered, received, orderedCost float64
+			err := tx.QueryRow(`
+				SELECT item_id, quantity_ordered, quantity_received, unit_cost
+				FROM purchase_order_lines
+				WHERE id = $1 AND purchase_order_id = $2
+				FOR UPDATE
+			`, line.PurchaseOrderLineID, id).Scan(&itemID, &ordered, &received, &orderedCost)
+			if err == sql.ErrNoRows {
+				return newStockError(http.StatusBadRequest, fmt.Sprintf("Line %d does not belong to purchase order %s", line.PurchaseOrderLineID, poNumber))
+			}
+			if err != nil {
+				return err
+			}
+
+			outstanding := ordered - received
+			if line.Quantity > outstanding+costEpsilon {
+				return newStockError(http.StatusBadRequest, fmt.Sprintf("Quantity received for line %d exceeds outstanding quantity %.2f", line.PurchaseOrderLineID, outstanding))
+			}
+
+			unitCost := orderedCost
+			if line.UnitCost != nil {
+				unitCost = *line.UnitCost
+			}
+			if unitCost <= 0 {
+				return newStockError(http.StatusBadRequest, fmt.Sprintf("unit_cost is required for line %d", line.PurchaseOrderLineID))
+			}
+			batchNo := line.BatchNo
+			if batchNo == "" {
+				batchNo = poNumber
+			}
+			notes := line.Notes
+			if notes == nil {
+				reference := "Received against " + poNumber
+				notes = &reference
+			}
+
+			poLineID := line.PurchaseOrderLineID
+			lotID, err := createStockLotTx(tx, CreateStockLotRequest{
+				ItemID:              itemID,
+				WarehouseID:         warehouseID,
+				BatchNo:             batchNo,
+				Quantity:            line.Quantity,
+				UnitCost:            unitCost,
+				ExpiryDate:          line.ExpiryDate,
+				ReceivedDate:        req.ReceivedDate,
+				Supplier:            supplierName,
+				Notes:               notes,
+				PurchaseOrderLineID: &poLineID,
+				PerformedBy:         receivedBy,
+				OrganizationID:      orgID,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO goods_receipt_lines (goods_receipt_id, purchase_order_line_id, lot_id, quantity, unit_cost)
+				VALUES ($1, $2, $3, $4, $5)
+			`, receiptID, line.PurchaseOrderLineID, lotID, line.Quantity, unitCost)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				UPDATE purchase_order_lines SET quantity_received = quantity_received + $1 WHERE id = $2
+			`, line.Quantity, line.PurchaseOrderLineID)
+			if err != nil {
+				return err
+			}
+		}
+
+		var openLines int
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM purchase_order_lines
+			WHERE purchase_order_id = $1 AND quantity_received < quantity_ordered - $2
+		`, id, costEpsilon).Scan(&openLines)
+		if err != nil {
+			return err
+		}
+		newStatus := "received"
+		if openLines > 0 {
+			newStatus = "partially_received"
+		}
+		_, err = tx.Exec(`
+			UPDATE purchase_orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+		`, newStatus, id)
+		if err != nil {
+			return err
+		}
+
+		return idempotency.save(tx, receiptID)
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to receive purchase order")
+		return
+	}
+
+	h.writePurchaseOrder(w, id, organizationID(r), http.StatusOK)
+}
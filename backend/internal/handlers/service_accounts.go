@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agrione/backend/internal/config"
+	"agrione/backend/internal/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Service accounts are users rows with account_type 'service' that belong to
+// a single organization with the service role. They cannot log in; they
+// authenticate with API keys, each limited to its own scopes.
+type ServiceAccountsHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewServiceAccountsHandler(db *sql.DB, cfg *config.Config) *ServiceAccountsHandler {
+	return &ServiceAccountsHandler{db: db, cfg: cfg}
+}
+
+type ServiceAccount struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Username  string   `json:"username"`
+	CreatedAt string   `json:"created_at"`
+	Keys      []APIKey `json:"keys"`
+}
+
+// APIKey never carries the key itself, which is only returned once on creation
+type APIKey struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  *string  `json:"expires_at,omitempty"`
+	LastUsedAt *string  `json:"last_used_at,omitempty"`
+	CreatedBy  *int     `json:"created_by,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	RevokedAt  *string  `json:"revoked_at,omitempty"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"` // RFC 3339 or YYYY-MM-DD, empty for no expiry
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// serviceAccountExists reports whether id is a service account of the organization
+func serviceAccountExists(db *sql.DB, id, orgID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM users u
+			JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $2
+			WHERE u.id = $1 AND u.account_type = 'service'
+		)
+	`, id, orgID).Scan(&exists)
+	return exists, err
+}
+
+// List Service Accounts of the active organization with their keys
+func (h *ServiceAccountsHandler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	orgID := organizationID(r)
+
+	rows, err := h.db.Query(`
+		SELECT u.id, u.first_name, u.username,
+		       TO_CHAR(u.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+		FROM users u
+		JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $1
+		WHERE u.account_type = 'service'
+		ORDER BY u.first_name, u.id
+	`, orgID)
+	if err != nil {
+		http.Error(w, "Failed to fetch service accounts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	accounts := []ServiceAccount{}
+	index := map[int]int{}
+	for rows.Next() {
+		var account ServiceAccount
+		var createdAt sql.NullString
+		if err := rows.Scan(&account.ID, &account.Name, &account.Username, &createdAt); err != nil {
+			http.Error(w, "Failed to scan service account", http.StatusInternalServerError)
+			return
+		}
+		if createdAt.Valid {
+			account.CreatedAt = createdAt.String
+		}
+		account.Keys = []APIKey{}
+		index[account.ID] = len(accounts)
+		accounts = append(accounts, account)
+	}
+
+	keyRows, err := h.db.Query(`
+		SELECT k.id, k.user_id, k.name, k.prefix, k.scopes, k.created_by,
+		       TO_CHAR(k.expires_at, 'YYYY-MM-DD"T"HH24:MI:SS') as expires_at,
+		       TO_CHAR(k.last_used_at, 'YYYY-MM-DD"T"HH24:MI:SS') as last_used_at,
+		       TO_CHAR(k.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(k.revoked_at, 'YYYY-MM-DD"T"HH24:MI:SS') as revoked_at
+		FROM api_keys k
+		WHERE k.organization_id = $1
+		ORDER BY k.created_at DESC, k.id DESC
+	`, orgID)
+	if err != nil {
+		http.Error(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+	defer keyRows.Close()
+
+	for keyRows.Next() {
+		var key APIKey
+		var userID int
+		var scopes pq.StringArray
+		var createdBy sql.NullInt64
+		var expiresAt, lastUsedAt, createdAt, revokedAt sql.NullString
+		if err := keyRows.Scan(&key.ID, &userID, &key.Name, &key.Prefix, &scopes, &createdBy,
+			&expiresAt, &lastUsedAt, &createdAt, &revokedAt); err != nil {
+			http.Error(w, "Failed to scan API key", http.StatusInternalServerError)
+			return
+		}
+		key.Scopes = []string(scopes)
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			key.CreatedBy = &id
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.String
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.String
+		}
+		if createdAt.Valid {
+			key.CreatedAt = createdAt.String
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.String
+		}
+		if i, ok := index[userID]; ok {
+			accounts[i].Keys = append(accounts[i].Keys, key)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+// Create Service Account in the active organization
+func (h *ServiceAccountsHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	suffix, err := randomHex(6)
+	if err != nil {
+		http.Error(w, "Failed to create service account", http.StatusInternalServerError)
+		return
+	}
+	username := "svc-" + suffix
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// The password hash is not a bcrypt hash, so no password ever matches it
+	account := ServiceAccount{Name: req.Name, Username: username, Keys: []APIKey{}}
+	var createdAt sql.NullString
+	err = tx.QueryRow(`
+		INSERT INTO users (email, username, first_name, last_name, password_hash, role, status, account_type)
+		VALUES ($1, $2, $3, '', '!', 'user', 'approved', 'service')
+		RETURNING id, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+	`, username+"@service-accounts.invalid", username, req.Name).Scan(&account.ID, &createdAt)
+	if err != nil {
+		http.Error(w, "Failed to create service account", http.StatusInternalServerError)
+		return
+	}
+	if createdAt.Valid {
+		account.CreatedAt = createdAt.String
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+	`, organizationID(r), account.ID, middleware.RoleService)
+	if err != nil {
+		http.Error(w, "Failed to create service account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// Create API Key for a service account. The key is only ever returned here.
+func (h *ServiceAccountsHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid service account ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !middleware.APIKeyScopes[middleware.Permission(scope)] {
+			http.Error(w, "Invalid scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02", req.ExpiresAt, h.cfg.Location)
+		}
+		if err != nil {
+			http.Error(w, "Invalid expires_at format", http.StatusBadRequest)
+			return
+		}
+		if !t.After(time.Now()) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		expiresAt = &t
+	}
+
+	exists, err := serviceAccountExists(h.db, accountID, organizationID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	fullKey := middleware.APIKeyPrefix + prefix + "_" + secret
+
+	currentUserID := r.Context().Value(middleware.UserIDKey).(int)
+	resp := CreateAPIKeyResponse{Key: fullKey}
+	resp.Name = req.Name
+	resp.Prefix = prefix
+	resp.Scopes = req.Scopes
+	resp.CreatedBy = &currentUserID
+
+	var expires, createdAt sql.NullString
+	err = h.db.QueryRow(`
+		INSERT INTO api_keys (user_id, organization_id, name, prefix, key_hash, scopes, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id,
+		          TO_CHAR(expires_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		          TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+	`, accountID, organizationID(r), req.Name, prefix, middleware.HashAPIKey(fullKey), pq.Array(req.Scopes), expiresAt, currentUserID,
+	).Scan(&resp.ID, &expires, &createdAt)
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if expires.Valid {
+		resp.ExpiresAt = &expires.String
+	}
+	if createdAt.Valid {
+		resp.CreatedAt = createdAt.String
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Revoke API Key. Requests made with it fail from then on.
+func (h *ServiceAccountsHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid service account ID", http.StatusBadRequest)
+		return
+	}
+	keyID, err := strconv.Atoi(vars["keyId"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := serviceAccountExists(h.db, accountID, organizationID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP), revoked_by = COALESCE(revoked_by, $3)
+		WHERE id = $1 AND user_id = $2 AND organization_id = $4
+	`, keyID, accountID, r.Context().Value(middleware.UserIDKey).(int), organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "API key revoked",
+		"id":      keyID,
+	})
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,583 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Costing methods supported by inventory_items.costing_method
+const (
+	CostingWeightedAverage = "weighted_average"
+	CostingFIFO            = "fifo"
+)
+
+// Quantities below this are treated as zero to absorb floating point drift
+const costEpsilon = 1e-9
+
+func isValidCostingMethod(method string) bool {
+	return method == CostingWeightedAverage || method == CostingFIFO
+}
+
+// Costing types
+type WarehouseCost struct {
+	WarehouseID   int      `json:"warehouse_id"`
+	WarehouseName string   `json:"warehouse_name"`
+	Quantity      float64  `json:"quantity"`
+	Value         float64  `json:"value"`
+	AvgCost       float64  `json:"avg_cost"`
+	PreviousValue *float64 `json:"previous_value,omitempty"`
+}
+
+type CostLayer struct {
+	ID                int     `json:"id"`
+	WarehouseID       int     `json:"warehouse_id"`
+	MovementID        *int    `json:"movement_id,omitempty"`
+	LayerDate         string  `json:"layer_date"`
+	Quantity          float64 `json:"quantity"`
+	RemainingQuantity float64 `json:"remaining_quantity"`
+	UnitCost          float64 `json:"unit_cost"`
+}
+
+type InventoryItemCosts struct {
+	ItemID        int             `json:"item_id"`
+	CostingMethod string          `json:"costing_method"`
+	AvgCost       float64         `json:"avg_cost"`
+	Quantity      float64         `json:"quantity"`
+	Value         float64         `json:"value"`
+	Warehouses    []WarehouseCost `json:"warehouses"`
+	Layers        []CostLayer     `json:"layers"`
+}
+
+type CostRevaluation struct {
+	ItemID            int             `json:"item_id"`
+	CostingMethod     string          `json:"costing_method"`
+	MovementsReplayed int             `json:"movements_replayed"`
+	MovementsRevalued int             `json:"movements_revalued"`
+	Warehouses        []WarehouseCost `json:"warehouses"`
+}
+
+// costLayer is a FIFO layer created by an inbound movement. Layers are kept
+// for both costing methods so an item can switch method and be revalued.
+type costLayer struct {
+	id         int // 0 until stored
+	movementID sql.NullInt64
+	layerDate  time.Time
+	quantity   float64
+	remaining  float64
+	unitCost   float64
+	dirty      bool
+}
+
+// costState is the running cost of one item in one warehouse
+type costState struct {
+	quantity float64
+	value    float64
+	layers   []*costLayer // oldest first
+}
+
+func (s *costState) avgCost(fallback float64) float64 {
+	if s.quantity > costEpsilon {
+		return s.value / s.quantity
+	}
+	return fallback
+}
+
+// receive adds an inbound layer at its own cost
+func (s *costState) receive(layer *costLayer) {
+	s.quantity += layer.quantity
+	s.value += layer.quantity * layer.unitCost
+
+	// Back-dated layers are consumed before newer ones
+	i := sort.Search(len(s.layers), func(i int) bool {
+		return s.layers[i].layerDate.After(layer.layerDate)
+	})
+	s.layers = append(s.layers, nil)
+	copy(s.layers[i+1:], s.layers[i:])
+	s.layers[i] = layer
+}
+
+// issue removes quantity from the state and returns the unit cost it leaves
+// at: the moving average, or the cost of the oldest layers for FIFO.
+// fallback is used when nothing is on record, e.g. history that predates the
+// costing engine.
+func (s *costState) issue(method string, quantity, fallback float64) float64 {
+	if quantity <= 0 {
+		return s.avgCost(fallback)
+	}
+
+	avg := s.avgCost(fallback)
+	fifoValue := 0.0
+	remaining := quantity
+	for _, layer := range s.layers {
+		if remaining <= costEpsilon {
+			break
+		}
+		if layer.remaining <= costEpsilon {
+			continue
+		}
+		take := math.Min(layer.remaining, remaining)
+		layer.remaining -= take
+		layer.dirty = true
+		fifoValue += take * layer.unitCost
+		remaining -= take
+	}
+	if remaining > costEpsilon {
+		fifoValue += remaining * avg
+	}
+
+	issuedValue := quantity * avg
+	if method == CostingFIFO {
+		issuedValue = fifoValue
+	}
+
+	s.quantity -= quantity
+	s.value -= issuedValue
+	if s.quantity <= costEpsilon {
+		s.quantity = 0
+		s.value = 0
+	}
+
+	return issuedValue / quantity
+}
+
+// loadCostState locks and loads the cost state of an item in a warehouse
+func loadCostState(tx *sql.Tx, itemID, warehouseID int) (*costState, string, error) {
+	var method string
+	err := tx.QueryRow("SELECT costing_method FROM inventory_items WHERE id = $1", itemID).Scan(&method)
+	if err != nil {
+		return nil, "", err
+	}
+
+	state := &costState{}
+	err = tx.QueryRow(`
+		SELECT quantity, total_value FROM inventory_costs
+		WHERE item_id = $1 AND warehouse_id = $2
+		FOR UPDATE
+	`, itemID, warehouseID).Scan(&state.quantity, &state.value)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, movement_id, layer_date, quantity, remaining_quantity, unit_cost
+		FROM inventory_cost_layers
+		WHERE item_id = $1 AND warehouse_id = $2 AND remaining_quantity > 0
+		ORDER BY layer_date ASC, id ASC
+		FOR UPDATE
+	`, itemID, warehouseID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		layer := &costLayer{}
+		err := rows.Scan(&layer.id, &layer.movementID, &layer.layerDate, &layer.quantity, &layer.remaining, &layer.unitCost)
+		if err != nil {
+			return nil, "", err
+		}
+		state.layers = append(state.layers, layer)
+	}
+
+	return state, method, rows.Err()
+}
+
+// saveCostState writes new and consumed layers and the warehouse totals
+func saveCostState(tx *sql.Tx, itemID, warehouseID int, state *costState) error {
+	for _, layer := range state.layers {
+		if layer.id == 0 {
+			err := tx.QueryRow(`
+				INSERT INTO inventory_cost_layers (item_id, warehouse_id, movement_id, layer_date, quantity, remaining_quantity, unit_cost)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id
+			`, itemID, warehouseID, layer.movementID, layer.layerDate, layer.quantity, layer.remaining, layer.unitCost).Scan(&layer.id)
+			if err != nil {
+				return err
+			}
+		} else if layer.dirty {
+			_, err := tx.Exec("UPDATE inventory_cost_layers SET remaining_quantity = $1 WHERE id = $2", math.Max(layer.remaining, 0), layer.id)
+			if err != nil {
+				return err
+			}
+		}
+		layer.dirty = false
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO inventory_costs (item_id, warehouse_id, quantity, total_value, avg_cost, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (item_id, warehouse_id) DO UPDATE
+		SET quantity = EXCLUDED.quantity, total_value = EXCLUDED.total_value,
+		    avg_cost = EXCLUDED.avg_cost, updated_at = CURRENT_TIMESTAMP
+	`, itemID, warehouseID, state.quantity, state.value, state.avgCost(0))
+	return err
+}
+
+// isInboundMovement reports whether a movement adds stock to its warehouse
+func isInboundMovement(movementType string, direction sql.NullString) bool {
+	return movementType == "in" || (direction.Valid && direction.String == "in")
+}
+
+// recomputeAvgCost sets inventory_items.avg_cost to the item's value on hand
+// across all warehouses divided by its quantity on hand.
+func recomputeAvgCost(tx *sql.Tx, itemID int) error {
+	_, err := tx.Exec(`
+		UPDATE inventory_items
+		SET avg_cost = COALESCE((
+			SELECT SUM(total_value) / NULLIF(SUM(quantity), 0)
+			FROM inventory_costs
+			WHERE item_id = $1
+		), avg_cost), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, itemID)
+	return err
+}
+
+// revalueItemCostsTx rebuilds the cost state of an item by replaying all of
+// its movements in effective-date order, re-costing every outbound movement.
+// This is needed after a back-dated receipt, or after changing the costing
+// method, because issues that already happened were costed without it.
+func revalueItemCostsTx(tx *sql.Tx, itemID int) (CostRevaluation, error) {
+	result := CostRevaluation{ItemID: itemID, Warehouses: []WarehouseCost{}}
+
+	err := tx.QueryRow("SELECT costing_method FROM inventory_items WHERE id = $1 FOR UPDATE", itemID).Scan(&result.CostingMethod)
+	if err == sql.ErrNoRows {
+		return result, newStockError(http.StatusNotFound, "Inventory item not found")
+	}
+	if err != nil {
+		return result, err
+	}
+
+	previousValues := map[int]float64{}
+	rows, err := tx.Query("SELECT warehouse_id, total_value FROM inventory_costs WHERE item_id = $1 FOR UPDATE", itemID)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var warehouseID int
+		var value float64
+		if err := rows.Scan(&warehouseID, &value); err != nil {
+			rows.Close()
+			return result, err
+		}
+		previousValues[warehouseID] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	// Transfer in-legs take the cost their out-leg left the source warehouse at
+	type transferLeg struct {
+		transferID int64
+		lotID      int64
+	}
+	sourceLots := map[transferLeg]int64{}
+	rows, err = tx.Query(`
+		SELECT transfer_id, source_lot_id, destination_lot_id
+		FROM stock_transfer_lines
+		WHERE item_id = $1 AND destination_lot_id IS NOT NULL
+	`, itemID)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var transferID, sourceLotID, destinationLotID int64
+		if err := rows.Scan(&transferID, &sourceLotID, &destinationLotID); err != nil {
+			rows.Close()
+			return result, err
+		}
+		sourceLots[transferLeg{transferID, destinationLotID}] = sourceLotID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	// The opening layers seeded from the lots on hand when the costing engine
+	// was introduced (migration 0005) have no movement. They stand for every
+	// movement recorded before they were seeded, so the replay starts from
+	// them and skips those movements.
+	states := map[int]*costState{}
+	var seededAt sql.NullTime
+	rows, err = tx.Query(`
+		SELECT id, warehouse_id, layer_date, quantity, unit_cost, created_at
+		FROM inventory_cost_layers
+		WHERE item_id = $1 AND movement_id IS NULL
+		ORDER BY layer_date ASC, id ASC
+		FOR UPDATE
+	`, itemID)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var warehouseID int
+		var createdAt sql.NullTime
+		layer := &costLayer{dirty: true}
+		if err := rows.Scan(&layer.id, &warehouseID, &layer.layerDate, &layer.quantity, &layer.unitCost, &createdAt); err != nil {
+			rows.Close()
+			return result, err
+		}
+		layer.remaining = layer.quantity
+		state, ok := states[warehouseID]
+		if !ok {
+			state = &costState{}
+			states[warehouseID] = state
+		}
+		state.receive(layer)
+		if createdAt.Valid && (!seededAt.Valid || createdAt.Time.After(seededAt.Time)) {
+			seededAt = createdAt
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	type movement struct {
+		id            int
+		warehouseID   int
+		movementType  string
+		direction     sql.NullString
+		quantity      float64
+		unitCost      float64
+		lotID         sql.NullInt64
+		transferID    sql.NullInt64
+		effectiveDate time.Time
+	}
+
+	rows, err = tx.Query(`
+		SELECT id, warehouse_id, type, direction, quantity, unit_cost, lot_id, transfer_id, effective_date
+		FROM stock_movements
+		WHERE item_id = $1 AND ($2::timestamp IS NULL OR created_at > $2)
+		ORDER BY effective_date ASC, id ASC
+		FOR UPDATE
+	`, itemID, seededAt)
+	if err != nil {
+		return result, err
+	}
+	var movements []movement
+	for rows.Next() {
+		var m movement
+		err := rows.Scan(&m.id, &m.warehouseID, &m.movementType, &m.direction, &m.quantity,
+			&m.unitCost, &m.lotID, &m.transferID, &m.effectiveDate)
+		if err != nil {
+			rows.Close()
+			return result, err
+		}
+		movements = append(movements, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	transferCosts := map[transferLeg]float64{}
+
+	for _, m := range movements {
+		state, ok := states[m.warehouseID]
+		if !ok {
+			state = &costState{}
+			states[m.warehouseID] = state
+		}
+
+		cost := m.unitCost
+		isTransfer := m.transferID.Valid && m.lotID.Valid
+		if isInboundMovement(m.movementType, m.direction) {
+			if isTransfer {
+				sourceLotID := sourceLots[transferLeg{m.transferID.Int64, m.lotID.Int64}]
+				if outCost, ok := transferCosts[transferLeg{m.transferID.Int64, sourceLotID}]; ok {
+					cost = outCost
+				}
+			}
+			state.receive(&costLayer{
+				movementID: sql.NullInt64{Int64: int64(m.id), Valid: true},
+				layerDate:  m.effectiveDate,
+				quantity:   m.quantity,
+				remaining:  m.quantity,
+				unitCost:   cost,
+			})
+		} else {
+			cost = state.issue(result.CostingMethod, m.quantity, m.unitCost)
+			if isTransfer {
+				transferCosts[transferLeg{m.transferID.Int64, m.lotID.Int64}] = cost
+			}
+		}
+		result.MovementsReplayed++
+
+		if math.Abs(cost-m.unitCost) <= costEpsilon {
+			continue
+		}
+		result.MovementsRevalued++
+
+		_, err := tx.Exec(`
+			UPDATE stock_movements SET unit_cost = $1, total_cost = quantity * $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+		`, cost, m.id)
+		if err != nil {
+			return result, err
+		}
+
+		if !isTransfer {
+			continue
+		}
+		if isInboundMovement(m.movementType, m.direction) {
+			_, err = tx.Exec(`
+				UPDATE stock_lots SET unit_cost = $1, total_cost = quantity * $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+			`, cost, m.lotID.Int64)
+		} else {
+			// Keeps in-transit lines in step so they are received at the new cost
+			_, err = tx.Exec(`
+				UPDATE stock_transfer_lines SET unit_cost = $1 WHERE transfer_id = $2 AND source_lot_id = $3
+			`, cost, m.transferID.Int64, m.lotID.Int64)
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Opening layers are kept and have their remaining quantity rewritten
+	if _, err := tx.Exec("DELETE FROM inventory_cost_layers WHERE item_id = $1 AND movement_id IS NOT NULL", itemID); err != nil {
+		return result, err
+	}
+	if _, err := tx.Exec("DELETE FROM inventory_costs WHERE item_id = $1", itemID); err != nil {
+		return result, err
+	}
+
+	warehouseIDs := make([]int, 0, len(states))
+	for warehouseID := range states {
+		warehouseIDs = append(warehouseIDs, warehouseID)
+	}
+	sort.Ints(warehouseIDs)
+
+	for _, warehouseID := range warehouseIDs {
+		state := states[warehouseID]
+		if err := saveCostState(tx, itemID, warehouseID, state); err != nil {
+			return result, err
+		}
+
+		wc := WarehouseCost{
+			WarehouseID: warehouseID,
+			Quantity:    state.quantity,
+			Value:       state.value,
+			AvgCost:     state.avgCost(0),
+		}
+		if previous, ok := previousValues[warehouseID]; ok {
+			wc.PreviousValue = &previous
+		}
+		tx.QueryRow("SELECT name FROM plots WHERE id = $1", warehouseID).Scan(&wc.WarehouseName)
+		result.Warehouses = append(result.Warehouses, wc)
+	}
+
+	return result, recomputeAvgCost(tx, itemID)
+}
+
+// Get Inventory Item Costs (per-warehouse cost state and open FIFO layers)
+func (h *InventoryHandler) GetInventoryItemCosts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	costs := InventoryItemCosts{ItemID: itemID, Warehouses: []WarehouseCost{}, Layers: []CostLayer{}}
+	err = h.db.QueryRow("SELECT costing_method, avg_cost FROM inventory_items WHERE id = $1 AND organization_id = $2", itemID, organizationID(r)).Scan(&costs.CostingMethod, &costs.AvgCost)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Inventory item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT ic.warehouse_id, p.name, ic.quantity, ic.total_value, ic.avg_cost
+		FROM inventory_costs ic
+		JOIN plots p ON ic.warehouse_id = p.id
+		WHERE ic.item_id = $1
+		ORDER BY p.name ASC
+	`, itemID)
+	if err != nil {
+		http.Error(w, "Failed to get item costs", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var wc WarehouseCost
+		if err := rows.Scan(&wc.WarehouseID, &wc.WarehouseName, &wc.Quantity, &wc.Value, &wc.AvgCost); err != nil {
+			continue
+		}
+		costs.Quantity += wc.Quantity
+		costs.Value += wc.Value
+		costs.Warehouses = append(costs.Warehouses, wc)
+	}
+	rows.Close()
+
+	rows, err = h.db.Query(`
+		SELECT id, warehouse_id, movement_id,
+		       TO_CHAR(layer_date, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       quantity, remaining_quantity, unit_cost
+		FROM inventory_cost_layers
+		WHERE item_id = $1 AND remaining_quantity > 0
+		ORDER BY warehouse_id ASC, layer_date ASC, id ASC
+	`, itemID)
+	if err != nil {
+		http.Error(w, "Failed to get item costs", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var layer CostLayer
+		var movementID sql.NullInt64
+		err := rows.Scan(&layer.ID, &layer.WarehouseID, &movementID, &layer.LayerDate,
+			&layer.Quantity, &layer.RemainingQuantity, &layer.UnitCost)
+		if err != nil {
+			continue
+		}
+		if movementID.Valid {
+			id := int(movementID.Int64)
+			layer.MovementID = &id
+		}
+		costs.Layers = append(costs.Layers, layer)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(costs)
+}
+
+// Revalue Inventory Item (replay movement history, e.g. after a back-dated receipt)
+func (h *InventoryHandler) RevalueInventoryItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	var result CostRevaluation
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		exists, err := inOrganization(tx, "inventory_items", itemID, organizationID(r))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return newStockError(http.StatusNotFound, "Inventory item not found")
+		}
+		result, err = revalueItemCostsTx(tx, itemID)
+		return err
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to revalue inventory item")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCostStateIssue(t *testing.T) {
+	type receipt struct {
+		day            int
+		quantity, cost float64
+	}
+	tests := []struct {
+		name      string
+		method    string
+		receipts  []receipt // in the order they are entered
+		issue     float64
+		fallback  float64
+		wantCost  float64
+		wantQty   float64
+		wantValue float64
+	}{
+		{"fifo within the oldest layer", CostingFIFO, []receipt{{1, 10, 100}, {2, 10, 200}}, 4, 0, 100, 16, 2600},
+		{"fifo across layers", CostingFIFO, []receipt{{1, 10, 100}, {2, 10, 200}}, 15, 0, 2000.0 / 15, 5, 1000},
+		{"average across layers", CostingWeightedAverage, []receipt{{1, 10, 100}, {2, 10, 200}}, 15, 0, 150, 5, 750},
+		{"fifo issues more than on hand", CostingFIFO, []receipt{{1, 10, 100}, {2, 10, 200}}, 25, 0, 150, 0, 0},
+		{"average issues more than on hand", CostingWeightedAverage, []receipt{{1, 10, 100}, {2, 10, 200}}, 25, 0, 150, 0, 0},
+		{"nothing on record falls back", CostingFIFO, nil, 5, 80, 80, 0, 0},
+		{"fifo consumes a back-dated receipt first", CostingFIFO, []receipt{{2, 10, 200}, {1, 10, 100}}, 10, 0, 100, 10, 2000},
+		{"average ignores receipt dates", CostingWeightedAverage, []receipt{{2, 10, 200}, {1, 10, 100}}, 10, 0, 150, 10, 1500},
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		state := &costState{}
+		for _, rc := range tt.receipts {
+			state.receive(&costLayer{
+				layerDate: start.AddDate(0, 0, rc.day),
+				quantity:  rc.quantity,
+				remaining: rc.quantity,
+				unitCost:  rc.cost,
+			})
+		}
+
+		cost := state.issue(tt.method, tt.issue, tt.fallback)
+		if math.Abs(cost-tt.wantCost) > 1e-6 {
+			t.Errorf("%s: issued at %v, want %v", tt.name, cost, tt.wantCost)
+		}
+		if math.Abs(state.quantity-tt.wantQty) > 1e-6 || math.Abs(state.value-tt.wantValue) > 1e-6 {
+			t.Errorf("%s: left %v worth %v, want %v worth %v", tt.name, state.quantity, state.value, tt.wantQty, tt.wantValue)
+		}
+	}
+}
@@ -0,0 +1,665 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Reason codes accepted for a count variance
+var stockAdjustmentReasons = map[string]string{
+	"damaged":     "Damaged",
+	"expired":     "Expired",
+	"lost":        "Lost / Theft",
+	"found":       "Found Stock",
+	"count_error": "Previous Count Error",
+	"other":       "Other",
+}
+
+// Stock Count types
+type StockCount struct {
+	ID              int               `json:"id"`
+	CountID         string            `json:"count_id"`
+	WarehouseID     int               `json:"warehouse_id"`
+	WarehouseName   string            `json:"warehouse_name"`
+	Status          string            `json:"status"`
+	CreatedBy       string            `json:"created_by"`
+	SubmittedBy     *string           `json:"submitted_by,omitempty"`
+	SubmittedAt     *string           `json:"submitted_at,omitempty"`
+	ApprovedBy      *string           `json:"approved_by,omitempty"`
+	ApprovedAt      *string           `json:"approved_at,omitempty"`
+	RejectionReason *string           `json:"rejection_reason,omitempty"`
+	Notes           *string           `json:"notes,omitempty"`
+	Lines           []StockCountLine  `json:"lines"`
+	Summary         StockCountSummary `json:"summary"`
+	CreatedAt       string            `json:"created_at"`
+	UpdatedAt       string            `json:"updated_at"`
+}
+
+type StockCountLine struct {
+	ID               int      `json:"id"`
+	LotID            int      `json:"lot_id"`
+	LotCode          string   `json:"lot_code"`
+	BatchNo          string   `json:"batch_no"`
+	ItemID           int      `json:"item_id"`
+	ItemName         string   `json:"item_name"`
+	ItemSKU          string   `json:"item_sku"`
+	Unit             string   `json:"unit"`
+	ExpectedQuantity float64  `json:"expected_quantity"`
+	CountedQuantity  *float64 `json:"counted_quantity,omitempty"`
+	Variance         *float64 `json:"variance,omitempty"`
+	VarianceValue    *float64 `json:"variance_value,omitempty"`
+	UnitCost         float64  `json:"unit_cost"`
+	ReasonCode       *string  `json:"reason_code,omitempty"`
+	Notes            *string  `json:"notes,omitempty"`
+	CountedBy        *string  `json:"counted_by,omitempty"`
+	CountedAt        *string  `json:"counted_at,omitempty"`
+}
+
+// StockCountSummary is the variance report for a count session
+type StockCountSummary struct {
+	TotalLines        int     `json:"total_lines"`
+	CountedLines      int     `json:"counted_lines"`
+	LinesWithVariance int     `json:"lines_with_variance"`
+	ExpectedValue     float64 `json:"expected_value"`
+	CountedValue      float64 `json:"counted_value"`
+	VarianceValue     float64 `json:"variance_value"`
+}
+
+type CreateStockCountRequest struct {
+	WarehouseID int     `json:"warehouse_id"`
+	Notes       *string `json:"notes,omitempty"`
+}
+
+type RecordStockCountRequest struct {
+	Lines []struct {
+		LineID          int     `json:"line_id"`
+		CountedQuantity float64 `json:"counted_quantity"`
+		ReasonCode      *string `json:"reason_code,omitempty"`
+		Notes           *string `json:"notes,omitempty"`
+	} `json:"lines"`
+}
+
+type RejectStockCountRequest struct {
+	RejectionReason string `json:"rejection_reason"`
+}
+
+// List Stock Counts
+func (h *InventoryHandler) ListStockCounts(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	warehouseID := r.URL.Query().Get("warehouse_id")
+
+	orgID := organizationID(r)
+	query := `SELECT id FROM stock_counts WHERE organization_id = $1`
+	args := []interface{}{orgID}
+	argIndex := 2
+
+	if status != "" && status != "all" {
+		query += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+	if warehouseID != "" && warehouseID != "all" {
+		query += fmt.Sprintf(" AND warehouse_id = $%d", argIndex)
+		id, _ := strconv.Atoi(warehouseID)
+		args = append(args, id)
+		argIndex++
+	}
+	query += " ORDER BY created_at DESC LIMIT 100"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get stock counts", http.StatusInternalServerError)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	counts := []StockCount{}
+	for _, id := range ids {
+		count, err := h.getStockCount(id, orgID)
+		if err != nil {
+			continue
+		}
+		// Lines are only returned by the detail endpoint
+		count.Lines = nil
+		counts = append(counts, count)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// Get Stock Count (includes the variance report)
+func (h *InventoryHandler) GetStockCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writeStockCount(w, id, organizationID(r), http.StatusOK)
+}
+
+func (h *InventoryHandler) writeStockCount(w http.ResponseWriter, id, orgID int, status int) {
+	count, err := h.getStockCount(id, orgID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Stock count not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(count)
+}
+
+func (h *InventoryHandler) getStockCount(id, orgID int) (StockCount, error) {
+	var c StockCount
+	var submittedBy, submittedAt, approvedBy, approvedAt, rejectionReason, notes sql.NullString
+
+	err := h.db.QueryRow(`
+		SELECT sc.id, sc.count_id, sc.warehouse_id, p.name, sc.status, sc.created_by,
+		       sc.submitted_by, TO_CHAR(sc.submitted_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       sc.approved_by, TO_CHAR(sc.approved_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       sc.rejection_reason, sc.notes,
+		       TO_CHAR(sc.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(sc.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM stock_counts sc
+		JOIN plots p ON sc.warehouse_id = p.id
+		WHERE sc.id = $1 AND sc.organization_id = $2
+	`, id, orgID).Scan(
+		&c.ID, &c.CountID, &c.WarehouseID, &c.WarehouseName, &c.Status, &c.CreatedBy,
+		&submittedBy, &submittedAt, &approvedBy, &approvedAt,
+		&rejectionReason, &notes, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err != nil {
+		return c, err
+	}
+
+	if submittedBy.Valid {
+		c.SubmittedBy = &submittedBy.String
+	}
+	if submittedAt.Valid {
+		c.SubmittedAt = &submittedAt.String
+	}
+	if approvedBy.Valid {
+		c.ApprovedBy = &approvedBy.String
+	}
+	if approvedAt.Valid {
+		c.ApprovedAt = &approvedAt.String
+	}
+	if rejectionReason.Valid {
+		c.RejectionReason = &rejectionReason.String
+	}
+	if notes.Valid {
+		c.Notes = &notes.String
+	}
+
+	rows, err := h.db.Query(`
+		SELECT scl.id, scl.lot_id, sl.lot_id, sl.batch_no, scl.item_id, i.name, i.sku, i.unit,
+		       scl.expected_quantity, scl.counted_quantity, scl.unit_cost, scl.reason_code, scl.notes,
+		       scl.counted_by, TO_CHAR(scl.counted_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+		FROM stock_count_lines scl
+		JOIN stock_lots sl ON scl.lot_id = sl.id
+		JOIN inventory_items i ON scl.item_id = i.id
+		WHERE scl.count_id = $1
+		ORDER BY i.name ASC, sl.lot_id ASC
+	`, id)
+	if err != nil {
+		return c, err
+	}
+	defer rows.Close()
+
+	c.Lines = []StockCountLine{}
+	for rows.Next() {
+		var line StockCountLine
+		var countedQuantity sql.NullFloat64
+		var reasonCode, lineNotes, countedBy, countedAt sql.NullString
+
+		err := rows.Scan(
+			&line.ID, &line.LotID, &line.LotCode, &line.BatchNo, &line.ItemID, &line.ItemName, &line.ItemSKU, &line.Unit,
+			&line.ExpectedQuantity, &countedQuantity, &line.UnitCost, &reasonCode, &lineNotes,
+			&countedBy, &countedAt,
+		)
+		if err != nil {
+			continue
+		}
+
+		c.Summary.TotalLines++
+		c.Summary.ExpectedValue += line.ExpectedQuantity * line.UnitCost
+
+		if countedQuantity.Valid {
+			variance := countedQuantity.Float64 - line.ExpectedQuantity
+			varianceValue := variance * line.UnitCost
+			line.CountedQuantity = &countedQuantity.Float64
+			line.Variance = &variance
+			line.VarianceValue = &varianceValue
+
+			c.Summary.CountedLines++
+			c.Summary.CountedValue += countedQuantity.Float64 * line.UnitCost
+			c.Summary.VarianceValue += varianceValue
+			if variance != 0 {
+				c.Summary.LinesWithVariance++
+			}
+		}
+		if reasonCode.Valid {
+			line.ReasonCode = &reasonCode.String
+		}
+		if lineNotes.Valid {
+			line.Notes = &lineNotes.String
+		}
+		if countedBy.Valid {
+			line.CountedBy = &countedBy.String
+		}
+		if countedAt.Valid {
+			line.CountedAt = &countedAt.String
+		}
+
+		c.Lines = append(c.Lines, line)
+	}
+
+	return c, nil
+}
+
+// Create Stock Count (snapshot expected quantities for every lot in a warehouse)
+func (h *InventoryHandler) CreateStockCount(w http.ResponseWriter, r *http.Request) {
+	var req CreateStockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.WarehouseID == 0 {
+		http.Error(w, "warehouse_id is required", http.StatusBadRequest)
+		return
+	}
+
+	createdBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	orgID := organizationID(r)
+	var countID int
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		if err := checkWarehouse(tx, req.WarehouseID, orgID); err != nil {
+			return err
+		}
+
+		var openCounts int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM stock_counts WHERE warehouse_id = $1 AND status IN ('open', 'submitted')
+		`, req.WarehouseID).Scan(&openCounts)
+		if err != nil {
+			return err
+		}
+		if openCounts > 0 {
+			return newStockError(http.StatusConflict, "This warehouse already has a stock count in progress")
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO stock_counts (count_id, warehouse_id, status, created_by, notes, organization_id)
+			VALUES ($1, $2, 'open', $3, $4, $5)
+			RETURNING id
+		`, generateID("CNT"), req.WarehouseID, createdBy.Name, req.Notes, orgID).Scan(&countID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO stock_count_lines (count_id, lot_id, item_id, expected_quantity, unit_cost)
+			SELECT $1, id, item_id, quantity, unit_cost
+			FROM stock_lots
+			WHERE warehouse_id = $2 AND status IN ('available', 'reserved') AND quantity > 0
+		`, countID, req.WarehouseID)
+		return err
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to create stock count")
+		return
+	}
+
+	h.writeStockCount(w, countID, orgID, http.StatusCreated)
+}
+
+// Record Stock Count (enter counted quantities for one or more lines)
+func (h *InventoryHandler) RecordStockCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RecordStockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Lines) == 0 {
+		http.Error(w, "lines are required", http.StatusBadRequest)
+		return
+	}
+
+	countedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+	for _, line := range req.Lines {
+		if line.LineID == 0 || line.CountedQuantity < 0 {
+			http.Error(w, "Each line requires line_id and a non-negative counted_quantity", http.StatusBadRequest)
+			return
+		}
+		if line.ReasonCode != nil && *line.ReasonCode != "" {
+			if _, ok := stockAdjustmentReasons[*line.ReasonCode]; !ok {
+				http.Error(w, fmt.Sprintf("Invalid reason_code '%s'", *line.ReasonCode), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		if err := lockStockCount(tx, id, organizationID(r), "open"); err != nil {
+			return err
+		}
+
+		for _, line := range req.Lines {
+			result, err := tx.Exec(`
+				UPDATE stock_count_lines
+				SET counted_quantity = $1, reason_code = NULLIF($2, ''), notes = $3, counted_by = $4, counted_at = CURRENT_TIMESTAMP
+				WHERE id = $5 AND count_id = $6
+			`, line.CountedQuantity, line.ReasonCode, line.Notes, countedBy.Name, line.LineID, id)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				return newStockError(http.StatusNotFound, fmt.Sprintf("Count line %d not found", line.LineID))
+			}
+		}
+
+		_, err := tx.Exec("UPDATE stock_counts SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+		return err
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to record stock count")
+		return
+	}
+
+	h.writeStockCount(w, id, organizationID(r), http.StatusOK)
+}
+
+// Submit Stock Count (send the variance report for supervisor approval)
+func (h *InventoryHandler) SubmitStockCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	submittedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		if err := lockStockCount(tx, id, organizationID(r), "open"); err != nil {
+			return err
+		}
+
+		var uncounted, missingReason int
+		err := tx.QueryRow(`
+			SELECT
+				COUNT(*) FILTER (WHERE counted_quantity IS NULL),
+				COUNT(*) FILTER (WHERE counted_quantity IS NOT NULL AND counted_quantity <> expected_quantity AND reason_code IS NULL)
+			FROM stock_count_lines WHERE count_id = $1
+		`, id).Scan(&uncounted, &missingReason)
+		if err != nil {
+			return err
+		}
+		if uncounted > 0 {
+			return newStockError(http.StatusBadRequest, fmt.Sprintf("%d lines have not been counted yet", uncounted))
+		}
+		if missingReason > 0 {
+			return newStockError(http.StatusBadRequest, fmt.Sprintf("%d lines with a variance are missing a reason_code", missingReason))
+		}
+
+		_, err = tx.Exec(`
+			UPDATE stock_counts
+			SET status = 'submitted', submitted_by = $1, submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, submittedBy.Name, id)
+		return err
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to submit stock count")
+		return
+	}
+
+	h.writeStockCount(w, id, organizationID(r), http.StatusOK)
+}
+
+// Approve Stock Count (post adjustment movements for every variance)
+func (h *InventoryHandler) ApproveStockCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	approvedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		if err := lockStockCount(tx, id, organizationID(r), "submitted"); err != nil {
+			return err
+		}
+		if err := postStockCountAdjustments(tx, id, approvedBy); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`
+			UPDATE stock_counts
+			SET status = 'approved', approved_by = $1, approved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, approvedBy.Name, id)
+		return err
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to approve stock count")
+		return
+	}
+
+	h.writeStockCount(w, id, organizationID(r), http.StatusOK)
+}
+
+// Reject Stock Count
+func (h *InventoryHandler) RejectStockCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RejectStockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RejectionReason == "" {
+		http.Error(w, "rejection_reason is required", http.StatusBadRequest)
+		return
+	}
+
+	rejectedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		if err := lockStockCount(tx, id, organizationID(r), "submitted"); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`
+			UPDATE stock_counts
+			SET status = 'rejected', approved_by = $1, approved_at = CURRENT_TIMESTAMP,
+			    rejection_reason = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, rejectedBy.Name, req.RejectionReason, id)
+		return err
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to reject stock count")
+		return
+	}
+
+	h.writeStockCount(w, id, organizationID(r), http.StatusOK)
+}
+
+// lockStockCount locks a count session of the organization and checks it is
+// in the expected status
+func lockStockCount(tx *sql.Tx, id, orgID int, expectedStatus string) error {
+	var status string
+	err := tx.QueryRow("SELECT status FROM stock_counts WHERE id = $1 AND organization_id = $2 FOR UPDATE", id, orgID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return newStockError(http.StatusNotFound, "Stock count not found")
+	}
+	if err != nil {
+		return err
+	}
+	if status != expectedStatus {
+		return newStockError(http.StatusBadRequest, fmt.Sprintf("Stock count must be '%s' (current status: %s)", expectedStatus, status))
+	}
+	return nil
+}
+
+// postStockCountAdjustments applies counted-minus-expected to each lot, writes
+// an 'adjustment' movement per variance (which the costing engine values).
+// The variance is applied as a delta so movements booked after the snapshot
+// are preserved.
+func postStockCountAdjustments(tx *sql.Tx, countID int, approvedBy actor) error {
+	var countCode string
+	if err := tx.QueryRow("SELECT count_id FROM stock_counts WHERE id = $1", countID).Scan(&countCode); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT lot_id, item_id, counted_quantity - expected_quantity, COALESCE(reason_code, 'other'), notes
+		FROM stock_count_lines
+		WHERE count_id = $1 AND counted_quantity IS NOT NULL AND counted_quantity <> expected_quantity
+		ORDER BY lot_id ASC
+	`, countID)
+	if err != nil {
+		return err
+	}
+
+	type variance struct {
+		lotID      int
+		itemID     int
+		delta      float64
+		reasonCode string
+		notes      *string
+	}
+
+	var variances []variance
+	for rows.Next() {
+		var v variance
+		var notes sql.NullString
+		if err := rows.Scan(&v.lotID, &v.itemID, &v.delta, &v.reasonCode, &notes); err != nil {
+			rows.Close()
+			return err
+		}
+		if notes.Valid {
+			v.notes = &notes.String
+		}
+		variances = append(variances, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, v := range variances {
+		var quantity, unitCost float64
+		var warehouseID int
+		var lotCode, status string
+		err := tx.QueryRow(`
+			SELECT lot_id, warehouse_id, quantity, unit_cost, status FROM stock_lots WHERE id = $1 FOR UPDATE
+		`, v.lotID).Scan(&lotCode, &warehouseID, &quantity, &unitCost, &status)
+		if err != nil {
+			return err
+		}
+
+		newQuantity := math.Max(quantity+v.delta, 0)
+		applied := newQuantity - quantity
+		if applied == 0 {
+			continue
+		}
+
+		newStatus := status
+		if newQuantity <= 0 {
+			newStatus = "depleted"
+		} else if status == "depleted" {
+			newStatus = "available"
+		}
+
+		_, err = tx.Exec(`
+			UPDATE stock_lots SET quantity = $1, total_cost = $1 * unit_cost, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+		`, newQuantity, newStatus, v.lotID)
+		if err != nil {
+			return err
+		}
+
+		direction := "in"
+		if applied < 0 {
+			direction = "out"
+		}
+
+		_, err = insertStockMovement(tx, &stockMovementInput{
+			ItemID:       v.itemID,
+			LotID:        sql.NullInt64{Int64: int64(v.lotID), Valid: true},
+			WarehouseID:  warehouseID,
+			Type:         "adjustment",
+			Quantity:     math.Abs(applied),
+			UnitCost:     unitCost,
+			Reason:       fmt.Sprintf("Stock Count: %s", stockAdjustmentReasons[v.reasonCode]),
+			Reference:    sql.NullString{String: countCode, Valid: true},
+			PerformedBy:  approvedBy,
+			Notes:        v.notes,
+			StockCountID: sql.NullInt64{Int64: int64(countID), Valid: true},
+			Direction:    sql.NullString{String: direction, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/websocket"
+)
+
+// Default look-ahead for expiry alerts and the expiring report
+const defaultLotExpiryAlertDays = 30
+
+// Expiring report types
+type ExpiringLot struct {
+	ID              int     `json:"id"`
+	LotID           string  `json:"lot_id"`
+	BatchNo         string  `json:"batch_no"`
+	Quantity        float64 `json:"quantity"`
+	UnitCost        float64 `json:"unit_cost"`
+	Supplier        string  `json:"supplier"`
+	Status          string  `json:"status"`
+	ExpiryDate      string  `json:"expiry_date"`
+	DaysUntilExpiry int     `json:"days_until_expiry"`
+}
+
+type ExpiringItem struct {
+	ItemID        int           `json:"item_id"`
+	SKU           string        `json:"sku"`
+	Name          string        `json:"name"`
+	Category      string        `json:"category"`
+	Unit          string        `json:"unit"`
+	TotalQuantity float64       `json:"total_quantity"`
+	TotalValue    float64       `json:"total_value"`
+	Lots          []ExpiringLot `json:"lots"`
+}
+
+type ExpiringWarehouse struct {
+	WarehouseID   int            `json:"warehouse_id"`
+	WarehouseName string         `json:"warehouse_name"`
+	ExpiredLots   int            `json:"expired_lots"`
+	ExpiringLots  int            `json:"expiring_lots"`
+	TotalValue    float64        `json:"total_value"`
+	Items         []ExpiringItem `json:"items"`
+}
+
+// RunInventoryScheduler runs the periodic inventory jobs: expiring stale
+// reservations, moving lots past their expiry date to 'expired', alerting
+// warehouse roles about lots that expire within alertDays and evaluating
+// reorder points. It returns once ctx is cancelled and no job is running.
+func (h *InventoryHandler) RunInventoryScheduler(ctx context.Context, interval time.Duration, alertDays int) {
+	if alertDays <= 0 {
+		alertDays = defaultLotExpiryAlertDays
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.runInventoryJobs(ctx, alertDays)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *InventoryHandler) runInventoryJobs(ctx context.Context, alertDays int) {
+	logger := logging.FromContext(ctx).With("job", "inventory")
+
+	if count, err := expireStockReservations(h.db); err != nil {
+		logger.Error("Failed to expire stock reservations", "error", err)
+	} else if count > 0 {
+		logger.Info("Expired stock reservations", "count", count)
+	}
+
+	if count, err := h.expireStockLots(); err != nil {
+		logger.Error("Failed to expire stock lots", "error", err)
+	} else if count > 0 {
+		logger.Info("Marked stock lots as expired", "count", count)
+	}
+
+	if err := h.sendExpiryAlerts(alertDays); err != nil {
+		logger.Error("Failed to send lot expiry alerts", "error", err)
+	}
+
+	orgIDs, err := h.organizationIDs()
+	if err != nil {
+		logger.Error("Failed to list organizations", "error", err)
+		return
+	}
+	for _, orgID := range orgIDs {
+		if _, err := h.runReplenishment(orgID); err != nil {
+			logger.Error("Failed to run replenishment", "organization_id", orgID, "error", err)
+		}
+	}
+}
+
+// organizationIDs lists every organization; replenishment runs per organization
+func (h *InventoryHandler) organizationIDs() ([]int, error) {
+	rows, err := h.db.Query("SELECT id FROM organizations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// expireStockLots moves lots whose expiry date has passed to 'expired' and
+// releases any reservations held on them
+func (h *InventoryHandler) expireStockLots() (int, error) {
+	var expired int
+	err := h.runStockTx(context.Background(), func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE stock_lots
+			SET status = 'expired', updated_at = CURRENT_TIMESTAMP
+			WHERE status IN ('available', 'reserved')
+			  AND expiry_date IS NOT NULL AND expiry_date <= CURRENT_TIMESTAMP
+		`)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		expired = int(affected)
+
+		_, err = tx.Exec(`
+			UPDATE stock_reservations
+			SET status = 'released', released_at = CURRENT_TIMESTAMP, release_reason = 'Lot expired', updated_at = CURRENT_TIMESTAMP
+			WHERE status = 'active' AND lot_id IN (SELECT id FROM stock_lots WHERE status = 'expired')
+		`)
+		return err
+	})
+	return expired, err
+}
+
+// sendExpiryAlerts notifies warehouse roles once per lot about lots expiring
+// within alertDays, with one notification per warehouse sent to the
+// warehouse's organization
+func (h *InventoryHandler) sendExpiryAlerts(alertDays int) error {
+	rows, err := h.db.Query(`
+		SELECT sl.id, sl.warehouse_id, p.name, sl.organization_id
+		FROM stock_lots sl
+		JOIN plots p ON sl.warehouse_id = p.id
+		WHERE sl.status IN ('available', 'reserved') AND sl.quantity > 0
+		  AND sl.expiry_date IS NOT NULL
+		  AND sl.expiry_date <= CURRENT_TIMESTAMP + make_interval(days => $1)
+		  AND sl.expiry_alerted_at IS NULL
+		ORDER BY sl.warehouse_id, sl.expiry_date
+	`, alertDays)
+	if err != nil {
+		return err
+	}
+
+	type warehouseAlert struct {
+		name           string
+		organizationID int
+		lotIDs         []int
+	}
+	alerts := map[int]*warehouseAlert{}
+	var warehouseIDs []int
+	for rows.Next() {
+		var lotID, warehouseID, organizationID int
+		var warehouseName string
+		if err := rows.Scan(&lotID, &warehouseID, &warehouseName, &organizationID); err != nil {
+			rows.Close()
+			return err
+		}
+		alert, ok := alerts[warehouseID]
+		if !ok {
+			alert = &warehouseAlert{name: warehouseName, organizationID: organizationID}
+			alerts[warehouseID] = alert
+			warehouseIDs = append(warehouseIDs, warehouseID)
+		}
+		alert.lotIDs = append(alert.lotIDs, lotID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	recipients := map[int][]int{}
+	for _, warehouseID := range warehouseIDs {
+		alert := alerts[warehouseID]
+		userIDs, ok := recipients[alert.organizationID]
+		if !ok {
+			userIDs, err = h.getWarehouseUserIDs(alert.organizationID)
+			if err != nil {
+				return err
+			}
+			recipients[alert.organizationID] = userIDs
+		}
+		for _, userID := range userIDs {
+			websocket.CreateNotification(
+				h.db,
+				h.hub,
+				userID,
+				"stock_lot_expiring",
+				"Lot Akan Kedaluwarsa",
+				fmt.Sprintf("%d lot di %s akan kedaluwarsa dalam %d hari", len(alert.lotIDs), alert.name, alertDays),
+				fmt.Sprintf("/inventory/expiring?warehouse_id=%d", warehouseID),
+			)
+		}
+
+		for _, lotID := range alert.lotIDs {
+			if _, err := h.db.Exec("UPDATE stock_lots SET expiry_alerted_at = CURRENT_TIMESTAMP WHERE id = $1", lotID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// getWarehouseUserIDs returns the approved users that manage stock in an
+// organization
+func (h *InventoryHandler) getWarehouseUserIDs(orgID int) ([]int, error) {
+	rows, err := h.db.Query(`
+		SELECT om.user_id FROM organization_members om
+		JOIN users u ON u.id = om.user_id
+		WHERE om.organization_id = $1 AND om.role IN ('Level 1', 'Level 2', 'warehouse') AND u.status = 'approved'
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, rows.Err()
+}
+
+// Get Expiring Stock (lots expired or expiring within ?days, grouped by warehouse and item)
+func (h *InventoryHandler) GetExpiringStock(w http.ResponseWriter, r *http.Request) {
+	days := defaultLotExpiryAlertDays
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		parsed, err := strconv.Atoi(daysStr)
+		if err != nil || parsed < 0 {
+			http.Error(w, "days must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+	warehouseID := r.URL.Query().Get("warehouse_id")
+	includeExpired := r.URL.Query().Get("include_expired") != "false"
+
+	query := `
+		SELECT sl.warehouse_id, p.name, sl.item_id, i.sku, i.name, i.category, i.unit,
+		       sl.id, sl.lot_id, sl.batch_no, sl.quantity, sl.unit_cost, sl.supplier, sl.status,
+		       TO_CHAR(sl.expiry_date, 'YYYY-MM-DD'),
+		       (sl.expiry_date::date - CURRENT_DATE) as days_until_expiry
+		FROM stock_lots sl
+		JOIN plots p ON sl.warehouse_id = p.id
+		JOIN inventory_items i ON sl.item_id = i.id
+		WHERE sl.quantity > 0 AND sl.expiry_date IS NOT NULL
+		  AND sl.expiry_date <= CURRENT_TIMESTAMP + make_interval(days => $1)
+		  AND sl.organization_id = $2
+	`
+	args := []interface{}{days, organizationID(r)}
+	argIndex := 3
+
+	if includeExpired {
+		query += " AND sl.status IN ('available', 'reserved', 'expired')"
+	} else {
+		query += " AND sl.status IN ('available', 'reserved')"
+	}
+	if warehouseID != "" && warehouseID != "all" {
+		query += fmt.Sprintf(" AND sl.warehouse_id = $%d", argIndex)
+		id, _ := strconv.Atoi(warehouseID)
+		args = append(args, id)
+		argIndex++
+	}
+	query += " ORDER BY p.name ASC, i.name ASC, sl.expiry_date ASC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get expiring stock", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	warehouses := map[int]*ExpiringWarehouse{}
+	items := map[[2]int]*ExpiringItem{}
+	var warehouseOrder []int
+	itemOrder := map[int][]int{}
+
+	for rows.Next() {
+		var whID, itemID int
+		var whName string
+		var item ExpiringItem
+		var lot ExpiringLot
+		err := rows.Scan(&whID, &whName, &itemID, &item.SKU, &item.Name, &item.Category, &item.Unit,
+			&lot.ID, &lot.LotID, &lot.BatchNo, &lot.Quantity, &lot.UnitCost, &lot.Supplier, &lot.Status,
+			&lot.ExpiryDate, &lot.DaysUntilExpiry)
+		if err != nil {
+			continue
+		}
+
+		wh, ok := warehouses[whID]
+		if !ok {
+			wh = &ExpiringWarehouse{WarehouseID: whID, WarehouseName: whName}
+			warehouses[whID] = wh
+			warehouseOrder = append(warehouseOrder, whID)
+		}
+
+		key := [2]int{whID, itemID}
+		it, ok := items[key]
+		if !ok {
+			item.ItemID = itemID
+			item.Lots = []ExpiringLot{}
+			it = &item
+			items[key] = it
+			itemOrder[whID] = append(itemOrder[whID], itemID)
+		}
+
+		value := lot.Quantity * lot.UnitCost
+		it.Lots = append(it.Lots, lot)
+		it.TotalQuantity += lot.Quantity
+		it.TotalValue += value
+		wh.TotalValue += value
+		if lot.Status == "expired" || lot.DaysUntilExpiry < 0 {
+			wh.ExpiredLots++
+		} else {
+			wh.ExpiringLots++
+		}
+	}
+
+	report := []ExpiringWarehouse{}
+	for _, whID := range warehouseOrder {
+		wh := warehouses[whID]
+		wh.Items = []ExpiringItem{}
+		for _, itemID := range itemOrder[whID] {
+			wh.Items = append(wh.Items, *items[[2]int{whID, itemID}])
+		}
+		report = append(report, *wh)
+	}
+
+	// Warehouses with the most value at risk first
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].TotalValue > report[j].TotalValue
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
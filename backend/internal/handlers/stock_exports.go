@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"agrione/backend/internal/logging"
+)
+
+// Sign of a movement's quantity and value for stock on hand: +1 for receipts
+// and inbound transfer/adjustment legs, -1 for everything else
+const movementSignSQL = "(CASE WHEN sm.type = 'in' OR sm.direction = 'in' THEN 1 ELSE -1 END)"
+
+// appendStockExportFilters restricts a query over stock_movements sm joined
+// to inventory_items i to the active organization and adds the warehouse_id,
+// item_id and category query filters
+func appendStockExportFilters(r *http.Request, query string, args []interface{}) (string, []interface{}, error) {
+	args = append(args, organizationID(r))
+	query += fmt.Sprintf(" AND sm.organization_id = $%d", len(args))
+	if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" && warehouseID != "all" {
+		id, err := strconv.Atoi(warehouseID)
+		if err != nil {
+			return query, args, fmt.Errorf("invalid warehouse_id")
+		}
+		args = append(args, id)
+		query += fmt.Sprintf(" AND sm.warehouse_id = $%d", len(args))
+	}
+	if itemID := r.URL.Query().Get("item_id"); itemID != "" && itemID != "all" {
+		id, err := strconv.Atoi(itemID)
+		if err != nil {
+			return query, args, fmt.Errorf("invalid item_id")
+		}
+		args = append(args, id)
+		query += fmt.Sprintf(" AND sm.item_id = $%d", len(args))
+	}
+	if category := r.URL.Query().Get("category"); category != "" && category != "all" {
+		args = append(args, category)
+		query += fmt.Sprintf(" AND i.category = $%d", len(args))
+	}
+	return query, args, nil
+}
+
+// exportFormat reads ?format=, defaulting to CSV
+func exportFormat(r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	return format, isValidExportFormat(format)
+}
+
+func parseExportDate(value string) (string, error) {
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// Export Stock Valuation (stock on hand and value per warehouse and item at
+// the end of ?as_of, reconstructed from stock_movements)
+func (h *InventoryHandler) ExportStockValuation(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(r)
+	if !ok {
+		http.Error(w, "format must be 'csv' or 'xlsx'", http.StatusBadRequest)
+		return
+	}
+
+	asOf := time.Now().Format("2006-01-02")
+	if value := r.URL.Query().Get("as_of"); value != "" {
+		parsed, err := parseExportDate(value)
+		if err != nil {
+			http.Error(w, "Invalid as_of format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		asOf = parsed
+	}
+
+	query := `
+		SELECT p.name, i.sku, i.name, i.category, i.unit,
+		       SUM(` + movementSignSQL + ` * sm.quantity) as quantity,
+		       SUM(` + movementSignSQL + ` * sm.total_cost) as value
+		FROM stock_movements sm
+		JOIN inventory_items i ON sm.item_id = i.id
+		JOIN plots p ON sm.warehouse_id = p.id
+		WHERE sm.effective_date < $1::date + 1
+	`
+	query, args, err := appendStockExportFilters(r, query, []interface{}{asOf})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query += fmt.Sprintf(`
+		GROUP BY p.id, p.name, i.id, i.sku, i.name, i.category, i.unit
+		HAVING ABS(SUM(%s * sm.quantity)) > %g
+		ORDER BY p.name ASC, i.name ASC
+	`, movementSignSQL, costEpsilon)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to export stock valuation", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out, err := newTableWriter(w, format, "stock-valuation-"+asOf, "Valuation "+asOf)
+	if err != nil {
+		http.Error(w, "Failed to export stock valuation", http.StatusInternalServerError)
+		return
+	}
+	err = writeStockValuation(out, rows, asOf)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Headers are already sent; the client sees a truncated file
+		logging.FromContext(r.Context()).Error("Failed to export stock valuation", "error", err)
+	}
+}
+
+func writeStockValuation(out tableWriter, rows *sql.Rows, asOf string) error {
+	err := out.WriteHeader([]string{
+		"As Of", "Warehouse", "SKU", "Item", "Category", "Unit", "Quantity", "Avg Unit Cost", "Value",
+	})
+	if err != nil {
+		return err
+	}
+
+	var warehouse string
+	var warehouseValue, totalValue float64
+	writeSubtotal := func() error {
+		if warehouse == "" {
+			return nil
+		}
+		return out.WriteRow([]interface{}{asOf, warehouse, nil, "Total " + warehouse, nil, nil, nil, nil, roundCost(warehouseValue)})
+	}
+
+	for rows.Next() {
+		var whName, sku, name, category, unit string
+		var quantity, value float64
+		if err := rows.Scan(&whName, &sku, &name, &category, &unit, &quantity, &value); err != nil {
+			return err
+		}
+
+		if whName != warehouse {
+			if err := writeSubtotal(); err != nil {
+				return err
+			}
+			warehouse = whName
+			warehouseValue = 0
+		}
+
+		avgCost := 0.0
+		if quantity != 0 {
+			avgCost = value / quantity
+		}
+		err := out.WriteRow([]interface{}{asOf, whName, sku, name, category, unit,
+			roundCost(quantity), roundCost(avgCost), roundCost(value)})
+		if err != nil {
+			return err
+		}
+		warehouseValue += value
+		totalValue += value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := writeSubtotal(); err != nil {
+		return err
+	}
+	return out.WriteRow([]interface{}{asOf, "All Warehouses", nil, "Grand Total", nil, nil, nil, nil, roundCost(totalValue)})
+}
+
+// Export Stock Ledger (movements per warehouse and item between ?start_date
+// and ?end_date with opening balances and running item and lot balances)
+func (h *InventoryHandler) ExportStockLedger(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(r)
+	if !ok {
+		http.Error(w, "format must be 'csv' or 'xlsx'", http.StatusBadRequest)
+		return
+	}
+
+	var startDate, endDate sql.NullString
+	if value := r.URL.Query().Get("start_date"); value != "" {
+		parsed, err := parseExportDate(value)
+		if err != nil {
+			http.Error(w, "Invalid start_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		startDate = sql.NullString{String: parsed, Valid: true}
+	}
+	if value := r.URL.Query().Get("end_date"); value != "" {
+		parsed, err := parseExportDate(value)
+		if err != nil {
+			http.Error(w, "Invalid end_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		endDate = sql.NullString{String: parsed, Valid: true}
+	}
+	if startDate.Valid && endDate.Valid && startDate.String > endDate.String {
+		http.Error(w, "start_date must not be after end_date", http.StatusBadRequest)
+		return
+	}
+
+	// Opening balances of every item/warehouse and lot before the range
+	itemOpening := map[[2]int][2]float64{}
+	lotOpening := map[int]float64{}
+	if startDate.Valid {
+		query := `
+			SELECT sm.item_id, sm.warehouse_id, sm.lot_id,
+			       SUM(` + movementSignSQL + ` * sm.quantity), SUM(` + movementSignSQL + ` * sm.total_cost)
+			FROM stock_movements sm
+			JOIN inventory_items i ON sm.item_id = i.id
+			WHERE sm.effective_date < $1::date
+		`
+		query, args, err := appendStockExportFilters(r, query, []interface{}{startDate.String})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query += " GROUP BY sm.item_id, sm.warehouse_id, sm.lot_id"
+
+		rows, err := h.db.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to export stock ledger", http.StatusInternalServerError)
+			return
+		}
+		for rows.Next() {
+			var itemID, warehouseID int
+			var lotID sql.NullInt64
+			var quantity, value float64
+			if err := rows.Scan(&itemID, &warehouseID, &lotID, &quantity, &value); err != nil {
+				rows.Close()
+				http.Error(w, "Failed to export stock ledger", http.StatusInternalServerError)
+				return
+			}
+			key := [2]int{itemID, warehouseID}
+			opening := itemOpening[key]
+			itemOpening[key] = [2]float64{opening[0] + quantity, opening[1] + value}
+			if lotID.Valid {
+				lotOpening[int(lotID.Int64)] += quantity
+			}
+		}
+		rows.Close()
+	}
+
+	query := `
+		SELECT sm.item_id, sm.warehouse_id, sm.lot_id,
+		       TO_CHAR(sm.effective_date, 'YYYY-MM-DD"T"HH24:MI:SS') as effective_date,
+		       sm.movement_id, p.name, i.sku, i.name, i.category, i.unit, sl.lot_id, sl.batch_no,
+		       sm.type, ` + movementSignSQL + `, sm.reason, sm.reference, sm.performed_by,
+		       sm.quantity, sm.unit_cost, sm.total_cost
+		FROM stock_movements sm
+		JOIN inventory_items i ON sm.item_id = i.id
+		JOIN plots p ON sm.warehouse_id = p.id
+		LEFT JOIN stock_lots sl ON sm.lot_id = sl.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	if startDate.Valid {
+		args = append(args, startDate.String)
+		query += fmt.Sprintf(" AND sm.effective_date >= $%d::date", len(args))
+	}
+	if endDate.Valid {
+		args = append(args, endDate.String)
+		query += fmt.Sprintf(" AND sm.effective_date < $%d::date + 1", len(args))
+	}
+	query, args, err := appendStockExportFilters(r, query, args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query += " ORDER BY p.name ASC, i.name ASC, sm.item_id ASC, sm.effective_date ASC, sm.id ASC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to export stock ledger", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	filename := "stock-ledger"
+	if startDate.Valid {
+		filename += "-" + startDate.String
+	}
+	if endDate.Valid {
+		filename += "-to-" + endDate.String
+	}
+	out, err := newTableWriter(w, format, filename, "Ledger")
+	if err != nil {
+		http.Error(w, "Failed to export stock ledger", http.StatusInternalServerError)
+		return
+	}
+	err = writeStockLedger(out, rows, startDate, itemOpening, lotOpening)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to export stock ledger", "error", err)
+	}
+}
+
+func writeStockLedger(out tableWriter, rows *sql.Rows, startDate sql.NullString, itemOpening map[[2]int][2]float64, lotOpening map[int]float64) error {
+	err := out.WriteHeader([]string{
+		"Date", "Movement ID", "Warehouse", "SKU", "Item", "Category", "Unit", "Lot", "Batch No",
+		"Type", "Reason", "Reference", "Performed By",
+		"Qty In", "Qty Out", "Unit Cost", "Value In", "Value Out",
+		"Item Balance Qty", "Item Balance Value", "Lot Balance Qty",
+	})
+	if err != nil {
+		return err
+	}
+
+	var current [2]int
+	var balanceQuantity, balanceValue float64
+	lotBalances := map[int]float64{}
+
+	for rows.Next() {
+		var itemID, warehouseID, sign int
+		var lotID sql.NullInt64
+		var date, movementID, whName, sku, name, category, unit, movementType, reason, performedBy string
+		var lotCode, batchNo, reference sql.NullString
+		var quantity, unitCost, totalCost float64
+		err := rows.Scan(&itemID, &warehouseID, &lotID, &date, &movementID, &whName, &sku, &name, &category, &unit,
+			&lotCode, &batchNo, &movementType, &sign, &reason, &reference, &performedBy,
+			&quantity, &unitCost, &totalCost)
+		if err != nil {
+			return err
+		}
+
+		key := [2]int{itemID, warehouseID}
+		if key != current {
+			current = key
+			opening := itemOpening[key]
+			balanceQuantity, balanceValue = opening[0], opening[1]
+			if startDate.Valid {
+				err := out.WriteRow([]interface{}{startDate.String, nil, whName, sku, name, category, unit, nil, nil,
+					"opening", "Opening balance", nil, nil, nil, nil, nil, nil, nil,
+					roundCost(balanceQuantity), roundCost(balanceValue), nil})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		var qtyIn, qtyOut, valueIn, valueOut interface{}
+		if sign > 0 {
+			qtyIn, valueIn = roundCost(quantity), roundCost(totalCost)
+		} else {
+			qtyOut, valueOut = roundCost(quantity), roundCost(totalCost)
+		}
+		balanceQuantity += float64(sign) * quantity
+		balanceValue += float64(sign) * totalCost
+
+		var lotBalance interface{}
+		if lotID.Valid {
+			id := int(lotID.Int64)
+			balance, ok := lotBalances[id]
+			if !ok {
+				balance = lotOpening[id]
+			}
+			balance += float64(sign) * quantity
+			lotBalances[id] = balance
+			lotBalance = roundCost(balance)
+		}
+
+		err = out.WriteRow([]interface{}{date, movementID, whName, sku, name, category, unit,
+			nullStringCell(lotCode), nullStringCell(batchNo), movementType, reason, nullStringCell(reference), performedBy,
+			qtyIn, qtyOut, roundCost(unitCost), valueIn, valueOut,
+			roundCost(balanceQuantity), roundCost(balanceValue), lotBalance})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func nullStringCell(s sql.NullString) interface{} {
+	if s.Valid {
+		return s.String
+	}
+	return nil
+}
+
+// roundCost rounds quantities and amounts to 4 decimals for export
+func roundCost(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
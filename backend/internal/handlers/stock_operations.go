@@ -9,6 +9,120 @@ import (
 	"time"
 )
 
+// Columns selected for a stock lot together with its item and warehouse, in the order scanStockLot expects
+const stockLotSelect = `
+		SELECT
+			sl.id, sl.lot_id, sl.batch_no, sl.quantity, sl.unit_cost, sl.total_cost,
+			COALESCE((
+				SELECT SUM(r.quantity) FROM stock_reservations r
+				WHERE r.lot_id = sl.id AND r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP
+			), 0) as reserved_quantity,
+			sl.expiry_date, sl.supplier, sl.status, sl.notes, sl.received_date,
+			sl.purchase_order_line_id, po.id as purchase_order_id, po.po_number,
+			TO_CHAR(sl.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(sl.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			sl.item_id, sl.warehouse_id,
+			i.sku, i.name as item_name, i.category, i.unit,
+			p.id as plot_id, p.name as plot_name, p.description as plot_description,
+			p.type as plot_type, p.apikey, p.coordinates as plot_coordinates, p.field_ref,
+			TO_CHAR(p.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as plot_created_at,
+			TO_CHAR(p.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as plot_updated_at
+		FROM stock_lots sl
+		JOIN inventory_items i ON sl.item_id = i.id
+		JOIN plots p ON sl.warehouse_id = p.id
+		LEFT JOIN purchase_order_lines pol ON sl.purchase_order_line_id = pol.id
+		LEFT JOIN purchase_orders po ON pol.purchase_order_id = po.id
+`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanStockLot scans a row selected with stockLotSelect
+func scanStockLot(row rowScanner) (StockLot, error) {
+	var lot StockLot
+	var item InventoryItem
+	var expiryDate, notes, receivedDate, createdAt, updatedAt, plotDescription sql.NullString
+	var plotCoordinatesJSON []byte
+	var plotFieldRef sql.NullInt64
+	var plotCreatedAt, plotUpdatedAt sql.NullString
+	var poLineID, poID sql.NullInt64
+	var poNumber sql.NullString
+
+	var itemID, warehouseID int
+	err := row.Scan(
+		&lot.ID, &lot.LotID, &lot.BatchNo, &lot.Quantity, &lot.UnitCost, &lot.TotalCost,
+		&lot.ReservedQuantity, &expiryDate, &lot.Supplier, &lot.Status, &notes, &receivedDate,
+		&poLineID, &poID, &poNumber,
+		&createdAt, &updatedAt,
+		&itemID, &warehouseID,
+		&item.SKU, &item.Name, &item.Category, &item.Unit,
+		&lot.Warehouse.ID, &lot.Warehouse.Name, &plotDescription, &lot.Warehouse.Type,
+		&lot.Warehouse.APIKey, &plotCoordinatesJSON, &plotFieldRef,
+		&plotCreatedAt, &plotUpdatedAt,
+	)
+	if err != nil {
+		return lot, err
+	}
+
+	item.ID = itemID
+	lot.Item = item
+	lot.AvailableQuantity = lot.Quantity - lot.ReservedQuantity
+	if lot.AvailableQuantity < 0 {
+		lot.AvailableQuantity = 0
+	}
+
+	if expiryDate.Valid {
+		lot.ExpiryDate = &expiryDate.String
+	}
+	if notes.Valid {
+		lot.Notes = &notes.String
+	}
+	if receivedDate.Valid {
+		lot.ReceivedDate = receivedDate.String
+	}
+	if poLineID.Valid {
+		id := int(poLineID.Int64)
+		lot.PurchaseOrderLineID = &id
+	}
+	if poID.Valid {
+		id := int(poID.Int64)
+		lot.PurchaseOrderID = &id
+	}
+	if poNumber.Valid {
+		lot.PurchaseOrderNumber = &poNumber.String
+	}
+	if createdAt.Valid {
+		lot.CreatedAt = createdAt.String
+	}
+	if updatedAt.Valid {
+		lot.UpdatedAt = updatedAt.String
+	}
+
+	if plotDescription.Valid {
+		lot.Warehouse.Description = &plotDescription.String
+	}
+	if plotFieldRef.Valid {
+		id := int(plotFieldRef.Int64)
+		lot.Warehouse.FieldRef = &id
+	}
+	json.Unmarshal(plotCoordinatesJSON, &lot.Warehouse.Coordinates)
+	if plotCreatedAt.Valid {
+		lot.Warehouse.CreatedAt = plotCreatedAt.String
+	}
+	if plotUpdatedAt.Valid {
+		lot.Warehouse.UpdatedAt = plotUpdatedAt.String
+	}
+
+	return lot, nil
+}
+
+// getStockLot loads a single stock lot of an organization with its item and warehouse
+func (h *InventoryHandler) getStockLot(id, orgID int) (StockLot, error) {
+	return scanStockLot(h.db.QueryRow(stockLotSelect+" WHERE sl.id = $1 AND sl.organization_id = $2", id, orgID))
+}
+
 // List Stock Lots
 func (h *InventoryHandler) ListStockLots(w http.ResponseWriter, r *http.Request) {
 	search := r.URL.Query().Get("search")
@@ -24,25 +138,9 @@ func (h *InventoryHandler) ListStockLots(w http.ResponseWriter, r *http.Request)
 	}
 	offset := (page - 1) * limit
 
-	query := `
-		SELECT 
-			sl.id, sl.lot_id, sl.batch_no, sl.quantity, sl.unit_cost, sl.total_cost,
-			sl.expiry_date, sl.supplier, sl.status, sl.notes, sl.received_date,
-			TO_CHAR(sl.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(sl.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
-			sl.item_id, sl.warehouse_id,
-			i.sku, i.name as item_name, i.category, i.unit,
-			p.id as plot_id, p.name as plot_name, p.description as plot_description, 
-			p.type as plot_type, p.apikey, p.coordinates as plot_coordinates, p.field_ref,
-			TO_CHAR(p.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as plot_created_at,
-			TO_CHAR(p.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as plot_updated_at
-		FROM stock_lots sl
-		JOIN inventory_items i ON sl.item_id = i.id
-		JOIN plots p ON sl.warehouse_id = p.id
-		WHERE 1=1
-	`
-	args := []interface{}{}
-	argIndex := 1
+	query := stockLotSelect + " WHERE sl.organization_id = $1 "
+	args := []interface{}{organizationID(r)}
+	argIndex := 2
 
 	if search != "" {
 		query += fmt.Sprintf(" AND (sl.lot_id ILIKE $%d OR sl.batch_no ILIKE $%d OR i.name ILIKE $%d OR sl.supplier ILIKE $%d) ", argIndex, argIndex, argIndex, argIndex)
@@ -73,64 +171,10 @@ func (h *InventoryHandler) ListStockLots(w http.ResponseWriter, r *http.Request)
 
 	var lots []StockLot
 	for rows.Next() {
-		var lot StockLot
-		var item InventoryItem
-		var expiryDate, notes, receivedDate, createdAt, updatedAt, plotDescription sql.NullString
-		var plotCoordinatesJSON []byte
-		var plotFieldRef sql.NullInt64
-		var plotCreatedAt, plotUpdatedAt sql.NullString
-
-		var itemID, warehouseID int
-		err := rows.Scan(
-			&lot.ID, &lot.LotID, &lot.BatchNo, &lot.Quantity, &lot.UnitCost, &lot.TotalCost,
-			&expiryDate, &lot.Supplier, &lot.Status, &notes, &receivedDate,
-			&createdAt, &updatedAt,
-			&itemID, &warehouseID,
-			&item.SKU, &item.Name, &item.Category, &item.Unit,
-			&lot.Warehouse.ID, &lot.Warehouse.Name, &plotDescription, &lot.Warehouse.Type,
-			&lot.Warehouse.APIKey, &plotCoordinatesJSON, &plotFieldRef,
-			&plotCreatedAt, &plotUpdatedAt,
-		)
-		
-		item.ID = itemID
-
+		lot, err := scanStockLot(rows)
 		if err != nil {
 			continue
 		}
-
-		lot.Item = item
-
-		if expiryDate.Valid {
-			lot.ExpiryDate = &expiryDate.String
-		}
-		if notes.Valid {
-			lot.Notes = &notes.String
-		}
-		if receivedDate.Valid {
-			lot.ReceivedDate = receivedDate.String
-		}
-		if createdAt.Valid {
-			lot.CreatedAt = createdAt.String
-		}
-		if updatedAt.Valid {
-			lot.UpdatedAt = updatedAt.String
-		}
-
-		if plotDescription.Valid {
-			lot.Warehouse.Description = &plotDescription.String
-		}
-		if plotFieldRef.Valid {
-			id := int(plotFieldRef.Int64)
-			lot.Warehouse.FieldRef = &id
-		}
-		json.Unmarshal(plotCoordinatesJSON, &lot.Warehouse.Coordinates)
-		if plotCreatedAt.Valid {
-			lot.Warehouse.CreatedAt = plotCreatedAt.String
-		}
-		if plotUpdatedAt.Valid {
-			lot.Warehouse.UpdatedAt = plotUpdatedAt.String
-		}
-
 		lots = append(lots, lot)
 	}
 
@@ -138,45 +182,39 @@ func (h *InventoryHandler) ListStockLots(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(lots)
 }
 
-// Create Stock Lot
-func (h *InventoryHandler) CreateStockLot(w http.ResponseWriter, r *http.Request) {
-	var req CreateStockLotRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+// checkWarehouse verifies that warehouseID is a storage/warehouse plot of the organization
+func checkWarehouse(tx *sql.Tx, warehouseID, orgID int) error {
+	var plotType string
+	err := tx.QueryRow("SELECT type FROM plots WHERE id = $1 AND organization_id = $2", warehouseID, orgID).Scan(&plotType)
+	if err == sql.ErrNoRows {
+		return newStockError(http.StatusNotFound, "Warehouse not found")
 	}
-
-	if req.ItemID == 0 || req.WarehouseID == 0 || req.BatchNo == "" || req.Quantity <= 0 || req.UnitCost <= 0 || req.Supplier == "" {
-		http.Error(w, "item_id, warehouse_id, batch_no, quantity, unit_cost, and supplier are required", http.StatusBadRequest)
-		return
+	if err != nil {
+		return err
 	}
-
-	// Verify item exists
-	var itemExists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE id = $1)", req.ItemID).Scan(&itemExists)
-	if err != nil || !itemExists {
-		http.Error(w, "Inventory item not found", http.StatusNotFound)
-		return
+	if plotType != "storage" && plotType != "warehouse" {
+		return newStockError(http.StatusBadRequest, "Plot must be of type 'storage' or 'warehouse'")
 	}
+	return nil
+}
 
-	// Verify warehouse (plot) exists and is storage/warehouse type
-	var plotType string
-	err = h.db.QueryRow("SELECT type FROM plots WHERE id = $1", req.WarehouseID).Scan(&plotType)
+// createStockLotTx inserts a lot and its 'in' movement, which adds a cost
+// layer for the item. The item row is locked so concurrent receipts serialize.
+// A back-dated receipt revalues the item's history so that issues booked after
+// its received date pick up its cost.
+func createStockLotTx(tx *sql.Tx, req CreateStockLotRequest) (int, error) {
+	var itemID int
+	err := tx.QueryRow("SELECT id FROM inventory_items WHERE id = $1 AND organization_id = $2 FOR UPDATE", req.ItemID, req.OrganizationID).Scan(&itemID)
 	if err == sql.ErrNoRows {
-		http.Error(w, "Warehouse not found", http.StatusNotFound)
-		return
+		return 0, newStockError(http.StatusNotFound, "Inventory item not found")
 	}
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	if plotType != "storage" && plotType != "warehouse" {
-		http.Error(w, "Plot must be of type 'storage' or 'warehouse'", http.StatusBadRequest)
-		return
+		return 0, err
 	}
 
-	lotID := generateID("LOT")
-	totalCost := req.Quantity * req.UnitCost
+	if err := checkWarehouse(tx, req.WarehouseID, req.OrganizationID); err != nil {
+		return 0, err
+	}
 
 	var expiryDate sql.NullString
 	if req.ExpiryDate != nil && *req.ExpiryDate != "" {
@@ -184,82 +222,130 @@ func (h *InventoryHandler) CreateStockLot(w http.ResponseWriter, r *http.Request
 		expiryDate.Valid = true
 	}
 
-	var lot StockLot
-	var notes sql.NullString
-	var expiryDateOut, createdAt, updatedAt, receivedDate sql.NullString
-
-	err = h.db.QueryRow(`
-		INSERT INTO stock_lots (lot_id, item_id, warehouse_id, batch_no, quantity, unit_cost, total_cost, expiry_date, supplier, notes)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, lot_id, batch_no, quantity, unit_cost, total_cost, expiry_date, supplier, status, notes, received_date,
-		          TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		          TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-	`, lotID, req.ItemID, req.WarehouseID, req.BatchNo, req.Quantity, req.UnitCost, totalCost, expiryDate, req.Supplier, req.Notes).Scan(
-		&lot.ID, &lot.LotID, &lot.BatchNo, &lot.Quantity, &lot.UnitCost, &lot.TotalCost,
-		&expiryDateOut, &lot.Supplier, &lot.Status, &notes, &receivedDate,
-		&createdAt, &updatedAt,
-	)
+	var receivedDate sql.NullTime
+	if req.ReceivedDate != nil && *req.ReceivedDate != "" {
+		parsed, err := time.Parse("2006-01-02", *req.ReceivedDate)
+		if err != nil {
+			return 0, newStockError(http.StatusBadRequest, "Invalid received_date format. Use YYYY-MM-DD")
+		}
+		if parsed.After(time.Now()) {
+			return 0, newStockError(http.StatusBadRequest, "received_date cannot be in the future")
+		}
+		receivedDate.Time = parsed
+		receivedDate.Valid = true
+	}
 
+	var lotID int
+	err = tx.QueryRow(`
+		INSERT INTO stock_lots (lot_id, item_id, warehouse_id, batch_no, quantity, unit_cost, total_cost, expiry_date, supplier, notes, received_date, purchase_order_line_id, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, CURRENT_TIMESTAMP), $12, $13)
+		RETURNING id
+	`, generateID("LOT"), req.ItemID, req.WarehouseID, req.BatchNo, req.Quantity, req.UnitCost,
+		req.Quantity*req.UnitCost, expiryDate, req.Supplier, req.Notes, receivedDate, req.PurchaseOrderLineID, req.OrganizationID).Scan(&lotID)
 	if err != nil {
-		http.Error(w, "Failed to create stock lot", http.StatusInternalServerError)
-		return
+		return 0, err
+	}
+
+	performedBy := req.PerformedBy
+	if performedBy.ID == 0 {
+		performedBy = systemActor
+	}
+
+	movementID, err := insertStockMovement(tx, &stockMovementInput{
+		ItemID:        req.ItemID,
+		LotID:         sql.NullInt64{Int64: int64(lotID), Valid: true},
+		WarehouseID:   req.WarehouseID,
+		Type:          "in",
+		Quantity:      req.Quantity,
+		UnitCost:      req.UnitCost,
+		Reason:        "Stock Receipt",
+		Reference:     sql.NullString{String: req.BatchNo, Valid: true},
+		PerformedBy:   performedBy,
+		Notes:         req.Notes,
+		EffectiveDate: receivedDate,
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	// Update item avg_cost
-	h.db.Exec("UPDATE inventory_items SET avg_cost = $1 WHERE id = $2", req.UnitCost, req.ItemID)
-
-	// Create stock movement record
-	movementID := generateID("MOV")
-	h.db.Exec(`
-		INSERT INTO stock_movements (movement_id, item_id, lot_id, warehouse_id, type, quantity, unit_cost, total_cost, reason, reference, performed_by, notes)
-		VALUES ($1, $2, $3, $4, 'in', $5, $6, $7, 'Stock Receipt', $8, 'System', $9)
-	`, movementID, req.ItemID, lot.ID, req.WarehouseID, req.Quantity, req.UnitCost, totalCost, req.BatchNo, req.Notes)
-
-	// Populate item and warehouse
-	h.db.QueryRow("SELECT id, sku, name, category, unit FROM inventory_items WHERE id = $1", req.ItemID).Scan(
-		&lot.Item.ID, &lot.Item.SKU, &lot.Item.Name, &lot.Item.Category, &lot.Item.Unit)
+	if receivedDate.Valid {
+		var backDated bool
+		err = tx.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM stock_movements
+				WHERE item_id = $1 AND id != $2
+				  AND effective_date > (SELECT effective_date FROM stock_movements WHERE id = $2)
+			)
+		`, req.ItemID, movementID).Scan(&backDated)
+		if err != nil {
+			return 0, err
+		}
+		if backDated {
+			if _, err := revalueItemCostsTx(tx, req.ItemID); err != nil {
+				return 0, err
+			}
+		}
+	}
 
-	var plotCoordinatesJSON []byte
-	var plotDescription sql.NullString
-	var plotFieldRef sql.NullInt64
-	h.db.QueryRow(`
-		SELECT id, name, description, type, apikey, coordinates, field_ref,
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-		FROM plots WHERE id = $1
-	`, req.WarehouseID).Scan(
-		&lot.Warehouse.ID, &lot.Warehouse.Name, &plotDescription, &lot.Warehouse.Type,
-		&lot.Warehouse.APIKey, &plotCoordinatesJSON, &plotFieldRef,
-		&lot.Warehouse.CreatedAt, &lot.Warehouse.UpdatedAt,
-	)
+	return lotID, nil
+}
 
-	if plotDescription.Valid {
-		lot.Warehouse.Description = &plotDescription.String
-	}
-	if plotFieldRef.Valid {
-		id := int(plotFieldRef.Int64)
-		lot.Warehouse.FieldRef = &id
+// Create Stock Lot
+func (h *InventoryHandler) CreateStockLot(w http.ResponseWriter, r *http.Request) {
+	var req CreateStockLotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
-	json.Unmarshal(plotCoordinatesJSON, &lot.Warehouse.Coordinates)
 
-	if expiryDateOut.Valid {
-		lot.ExpiryDate = &expiryDateOut.String
-	}
-	if notes.Valid {
-		lot.Notes = &notes.String
+	if req.ItemID == 0 || req.WarehouseID == 0 || req.BatchNo == "" || req.Quantity <= 0 || req.UnitCost <= 0 || req.Supplier == "" {
+		http.Error(w, "item_id, warehouse_id, batch_no, quantity, unit_cost, and supplier are required", http.StatusBadRequest)
+		return
 	}
-	if receivedDate.Valid {
-		lot.ReceivedDate = receivedDate.String
+
+	performedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
 	}
-	if createdAt.Valid {
-		lot.CreatedAt = createdAt.String
+	req.PerformedBy = performedBy
+	req.OrganizationID = organizationID(r)
+
+	idempotency := newIdempotentRequest(r, "stock_lots.create", req)
+	var lotID int
+	replayed := false
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		existingID, found, err := idempotency.lookup(tx)
+		if err != nil {
+			return err
+		}
+		if found {
+			lotID, replayed = existingID, true
+			return nil
+		}
+
+		lotID, err = createStockLotTx(tx, req)
+		if err != nil {
+			return err
+		}
+		return idempotency.save(tx, lotID)
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to create stock lot")
+		return
 	}
-	if updatedAt.Valid {
-		lot.UpdatedAt = updatedAt.String
+
+	lot, err := h.getStockLot(lotID, req.OrganizationID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve stock lot", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	if !replayed {
+		w.WriteHeader(http.StatusCreated)
+	}
 	json.NewEncoder(w).Encode(lot)
 }
 
@@ -271,80 +357,116 @@ func (h *InventoryHandler) RemoveStock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.LotID == 0 || req.Quantity <= 0 || req.Reason == "" || req.PerformedBy == "" {
-		http.Error(w, "lot_id, quantity, reason, and performed_by are required", http.StatusBadRequest)
+	if req.LotID == 0 || req.Quantity <= 0 || req.Reason == "" {
+		http.Error(w, "lot_id, quantity, and reason are required", http.StatusBadRequest)
 		return
 	}
 
-	// Get stock lot
-	var lot StockLot
-	var itemID, warehouseID int
-	var unitCost float64
-	err := h.db.QueryRow(`
-		SELECT id, lot_id, item_id, warehouse_id, quantity, unit_cost, status
-		FROM stock_lots WHERE id = $1
-	`, req.LotID).Scan(&lot.ID, &lot.LotID, &itemID, &warehouseID, &lot.Quantity, &unitCost, &lot.Status)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, "Stock lot not found", http.StatusNotFound)
-		return
-	}
+	performedBy, err := requestActor(h.db, r)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeActorError(w, err)
 		return
 	}
 
-	if lot.Status != "available" {
-		http.Error(w, "Stock lot is not available", http.StatusBadRequest)
-		return
-	}
+	idempotency := newIdempotentRequest(r, "stock_lots.remove", req)
 
-	if req.Quantity > lot.Quantity {
-		http.Error(w, "Quantity to remove exceeds available quantity", http.StatusBadRequest)
-		return
-	}
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		_, found, err := idempotency.lookup(tx)
+		if err != nil || found {
+			return err
+		}
 
-	newQuantity := lot.Quantity - req.Quantity
-	totalCost := req.Quantity * unitCost
+		// Lock the lot so concurrent removals cannot overdraw it
+		var itemID, warehouseID int
+		var quantity, unitCost float64
+		var status string
+		err = tx.QueryRow(`
+			SELECT item_id, warehouse_id, quantity, unit_cost, status
+			FROM stock_lots WHERE id = $1 AND organization_id = $2
+			FOR UPDATE
+		`, req.LotID, organizationID(r)).Scan(&itemID, &warehouseID, &quantity, &unitCost, &status)
+		if err == sql.ErrNoRows {
+			return newStockError(http.StatusNotFound, "Stock lot not found")
+		}
+		if err != nil {
+			return err
+		}
 
-	// Update stock lot
-	var newStatus string
-	if newQuantity <= 0 {
-		newStatus = "depleted"
-		newQuantity = 0
-	} else {
-		newStatus = lot.Status
-	}
+		// Expired lots can still be removed so they can be disposed of
+		if status != "available" && status != "expired" {
+			return newStockError(http.StatusBadRequest, "Stock lot is not available")
+		}
+		if req.Quantity > quantity {
+			return newStockError(http.StatusBadRequest, "Quantity to remove exceeds available quantity")
+		}
 
-	_, err = h.db.Exec(`
-		UPDATE stock_lots SET quantity = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
-	`, newQuantity, newStatus, req.LotID)
+		// Stock reserved for approved requests stays put. A request's own
+		// reservation is only drawn on by FulfillStockRequest, so the
+		// stock_request_id given here merely links the movement to it.
+		reserved, err := lotReservedQuantity(tx, req.LotID, 0)
+		if err != nil {
+			return err
+		}
+		if req.Quantity > quantity-reserved {
+			return newStockError(http.StatusBadRequest, fmt.Sprintf("Quantity to remove exceeds unreserved quantity (%.2f reserved)", reserved))
+		}
 
-	if err != nil {
-		http.Error(w, "Failed to update stock lot", http.StatusInternalServerError)
-		return
-	}
+		newQuantity := quantity - req.Quantity
+		newStatus := status
+		if newQuantity <= 0 {
+			newStatus = "depleted"
+			newQuantity = 0
+		}
 
-	// Create stock movement
-	movementID := generateID("MOV")
-	var reference sql.NullString
-	if req.Reference != nil {
-		reference.String = *req.Reference
-		reference.Valid = true
-	}
-	var stockRequestID sql.NullInt64
-	if req.StockRequestID != nil {
-		stockRequestID.Int64 = int64(*req.StockRequestID)
-		stockRequestID.Valid = true
-	}
+		_, err = tx.Exec(`
+			UPDATE stock_lots SET quantity = $1, total_cost = $1 * unit_cost, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+		`, newQuantity, newStatus, req.LotID)
+		if err != nil {
+			return err
+		}
 
-	_, err = h.db.Exec(`
-		INSERT INTO stock_movements (movement_id, item_id, lot_id, warehouse_id, type, quantity, unit_cost, total_cost, reason, reference, performed_by, notes, stock_request_id)
-		VALUES ($1, $2, $3, $4, 'out', $5, $6, $7, $8, $9, $10, $11, $12)
-	`, movementID, itemID, req.LotID, warehouseID, req.Quantity, unitCost, totalCost, req.Reason, reference, req.PerformedBy, req.Notes, stockRequestID)
+		var reference sql.NullString
+		if req.Reference != nil {
+			reference.String = *req.Reference
+			reference.Valid = true
+		}
+		var stockRequestID sql.NullInt64
+		if req.StockRequestID != nil {
+			var exists bool
+			err = tx.QueryRow(`
+				SELECT EXISTS (SELECT 1 FROM stock_requests WHERE id = $1 AND organization_id = $2)
+			`, *req.StockRequestID, organizationID(r)).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return newStockError(http.StatusNotFound, "Stock request not found")
+			}
+			stockRequestID.Int64 = int64(*req.StockRequestID)
+			stockRequestID.Valid = true
+		}
+
+		movementID, err := insertStockMovement(tx, &stockMovementInput{
+			ItemID:         itemID,
+			LotID:          sql.NullInt64{Int64: int64(req.LotID), Valid: true},
+			WarehouseID:    warehouseID,
+			Type:           "out",
+			Quantity:       req.Quantity,
+			UnitCost:       unitCost,
+			Reason:         req.Reason,
+			Reference:      reference,
+			PerformedBy:    performedBy,
+			Notes:          req.Notes,
+			StockRequestID: stockRequestID,
+		})
+		if err != nil {
+			return err
+		}
 
+		return idempotency.save(tx, movementID)
+	})
 	if err != nil {
-		http.Error(w, "Failed to create stock movement", http.StatusInternalServerError)
+		writeStockTxError(w, err, "Failed to remove stock")
 		return
 	}
 
@@ -371,22 +493,22 @@ func (h *InventoryHandler) ListStockMovements(w http.ResponseWriter, r *http.Req
 	query := `
 		SELECT 
 			sm.id, sm.movement_id, sm.type, sm.quantity, sm.unit_cost, sm.total_cost,
-			sm.reason, sm.reference, sm.performed_by, sm.notes,
-			TO_CHAR(sm.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(sm.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			sm.reason, sm.reference, sm.performed_by, sm.performed_by_user_id, sm.notes,
+			TO_CHAR(sm.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(sm.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			sm.item_id, sm.lot_id, sm.warehouse_id,
 			i.sku, i.name as item_name, i.category, i.unit,
 			p.id as plot_id, p.name as plot_name, p.description as plot_description,
 			p.type as plot_type, p.apikey, p.coordinates as plot_coordinates, p.field_ref,
-			TO_CHAR(p.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as plot_created_at,
-			TO_CHAR(p.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as plot_updated_at
+			TO_CHAR(p.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as plot_created_at,
+			TO_CHAR(p.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as plot_updated_at
 		FROM stock_movements sm
 		JOIN inventory_items i ON sm.item_id = i.id
 		JOIN plots p ON sm.warehouse_id = p.id
-		WHERE 1=1
+		WHERE sm.organization_id = $1
 	`
-	args := []interface{}{}
-	argIndex := 1
+	args := []interface{}{organizationID(r)}
+	argIndex := 2
 
 	if search != "" {
 		query += fmt.Sprintf(" AND (sm.movement_id ILIKE $%d OR sm.reason ILIKE $%d OR sm.reference ILIKE $%d OR i.name ILIKE $%d OR sm.performed_by ILIKE $%d) ", argIndex, argIndex, argIndex, argIndex, argIndex)
@@ -425,7 +547,7 @@ func (h *InventoryHandler) ListStockMovements(w http.ResponseWriter, r *http.Req
 	for rows.Next() {
 		var movement StockMovement
 		var item InventoryItem
-		var lotID sql.NullInt64
+		var lotID, performedByUserID sql.NullInt64
 		var reference, notes, createdAt, updatedAt sql.NullString
 		var plotCoordinatesJSON []byte
 		var plotDescription sql.NullString
@@ -436,7 +558,7 @@ func (h *InventoryHandler) ListStockMovements(w http.ResponseWriter, r *http.Req
 		err := rows.Scan(
 			&movement.ID, &movement.MovementID, &movement.Type, &movement.Quantity,
 			&movement.UnitCost, &movement.TotalCost, &movement.Reason, &reference,
-			&movement.PerformedBy, &notes, &createdAt, &updatedAt,
+			&movement.PerformedBy, &performedByUserID, &notes, &createdAt, &updatedAt,
 			&itemID, &lotID, &warehouseID,
 			&item.SKU, &item.Name, &item.Category, &item.Unit,
 			&movement.Warehouse.ID, &movement.Warehouse.Name, &plotDescription, &movement.Warehouse.Type,
@@ -445,6 +567,7 @@ func (h *InventoryHandler) ListStockMovements(w http.ResponseWriter, r *http.Req
 		)
 		
 		item.ID = itemID
+		movement.PerformedByID = nullableUserID(performedByUserID)
 
 		if err != nil {
 			continue
@@ -499,9 +622,10 @@ func (h *InventoryHandler) ListStockMovements(w http.ResponseWriter, r *http.Req
 // Get Inventory Stats
 func (h *InventoryHandler) GetInventoryStats(w http.ResponseWriter, r *http.Request) {
 	var stats InventoryStats
+	orgID := organizationID(r)
 
 	// Total items
-	err := h.db.QueryRow("SELECT COUNT(*) FROM inventory_items WHERE status = 'active'").Scan(&stats.TotalItems)
+	err := h.db.QueryRow("SELECT COUNT(*) FROM inventory_items WHERE status = 'active' AND organization_id = $1", orgID).Scan(&stats.TotalItems)
 	if err != nil {
 		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
 		return
@@ -509,8 +633,10 @@ func (h *InventoryHandler) GetInventoryStats(w http.ResponseWriter, r *http.Requ
 
 	// Stock value
 	err = h.db.QueryRow(`
-		SELECT COALESCE(SUM(total_cost), 0) FROM stock_lots WHERE status = 'available'
-	`).Scan(&stats.StockValue)
+		SELECT COALESCE(SUM(c.total_value), 0) FROM inventory_costs c
+		JOIN inventory_items i ON i.id = c.item_id
+		WHERE i.organization_id = $1
+	`, orgID).Scan(&stats.StockValue)
 	if err != nil {
 		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
 		return
@@ -518,8 +644,8 @@ func (h *InventoryHandler) GetInventoryStats(w http.ResponseWriter, r *http.Requ
 
 	// Total warehouses (storage/warehouse plots)
 	err = h.db.QueryRow(`
-		SELECT COUNT(*) FROM plots WHERE type IN ('storage', 'warehouse')
-	`).Scan(&stats.TotalWarehouses)
+		SELECT COUNT(*) FROM plots WHERE type IN ('storage', 'warehouse') AND organization_id = $1
+	`, orgID).Scan(&stats.TotalWarehouses)
 	if err != nil {
 		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
 		return
@@ -530,10 +656,10 @@ func (h *InventoryHandler) GetInventoryStats(w http.ResponseWriter, r *http.Requ
 		SELECT COUNT(DISTINCT i.id)
 		FROM inventory_items i
 		LEFT JOIN stock_lots sl ON i.id = sl.item_id AND sl.status = 'available'
-		WHERE i.status = 'active'
+		WHERE i.status = 'active' AND i.organization_id = $1
 		GROUP BY i.id, i.reorder_point
 		HAVING COALESCE(SUM(sl.quantity), 0) <= i.reorder_point
-	`).Scan(&stats.LowStockCount)
+	`, orgID).Scan(&stats.LowStockCount)
 	if err != nil && err != sql.ErrNoRows {
 		stats.LowStockCount = 0
 	}
@@ -541,8 +667,8 @@ func (h *InventoryHandler) GetInventoryStats(w http.ResponseWriter, r *http.Requ
 	// Recent movements (last 7 days)
 	sevenDaysAgo := time.Now().AddDate(0, 0, -7)
 	err = h.db.QueryRow(`
-		SELECT COUNT(*) FROM stock_movements WHERE created_at >= $1
-	`, sevenDaysAgo).Scan(&stats.RecentMovements)
+		SELECT COUNT(*) FROM stock_movements WHERE created_at >= $1 AND organization_id = $2
+	`, sevenDaysAgo, orgID).Scan(&stats.RecentMovements)
 	if err != nil {
 		stats.RecentMovements = 0
 	}
@@ -557,15 +683,15 @@ func (h *InventoryHandler) ListWarehouses(w http.ResponseWriter, r *http.Request
 
 	query := `
 		SELECT id, name, description, type, apikey, coordinates, field_ref,
-		       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 		FROM plots
-		WHERE type IN ('storage', 'warehouse')
+		WHERE type IN ('storage', 'warehouse') AND organization_id = $1
 	`
-	args := []interface{}{}
+	args := []interface{}{organizationID(r)}
 
 	if search != "" {
-		query += " AND (name ILIKE $1 OR description ILIKE $1)"
+		query += " AND (name ILIKE $2 OR description ILIKE $2)"
 		args = append(args, "%"+search+"%")
 	}
 
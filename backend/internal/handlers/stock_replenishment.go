@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Days of outbound movements used to estimate consumption
+	replenishmentConsumptionDays = 90
+	// Days of consumption a suggested purchase should cover on top of the reorder point
+	replenishmentCoverDays = 30
+	// Supplier name used for items without any known supplier
+	unassignedSupplier = "Unassigned"
+)
+
+// ReplenishmentItem is the stock position of an item against its reorder point
+type ReplenishmentItem struct {
+	ItemID              int      `json:"item_id"`
+	SKU                 string   `json:"sku"`
+	Name                string   `json:"name"`
+	Category            string   `json:"category"`
+	Unit                string   `json:"unit"`
+	ReorderPoint        float64  `json:"reorder_point"`
+	OnHand              float64  `json:"on_hand"`
+	Reserved            float64  `json:"reserved"`
+	OpenDemand          float64  `json:"open_demand"`
+	Projected           float64  `json:"projected"`
+	AvgDailyConsumption float64  `json:"avg_daily_consumption"`
+	SuggestedQuantity   float64  `json:"suggested_quantity"`
+	AvgCost             float64  `json:"avg_cost"`
+	PreferredSupplier   string   `json:"preferred_supplier"`
+	Suppliers           []string `json:"suppliers"`
+	BelowReorderPoint   bool     `json:"below_reorder_point"`
+
+	alerted bool
+}
+
+type PurchaseSuggestionLine struct {
+	ID                  int     `json:"id"`
+	ItemID              int     `json:"item_id"`
+	SKU                 string  `json:"sku"`
+	Name                string  `json:"name"`
+	Unit                string  `json:"unit"`
+	OnHand              float64 `json:"on_hand"`
+	Reserved            float64 `json:"reserved"`
+	OpenDemand          float64 `json:"open_demand"`
+	ReorderPoint        float64 `json:"reorder_point"`
+	AvgDailyConsumption float64 `json:"avg_daily_consumption"`
+	SuggestedQuantity   float64 `json:"suggested_quantity"`
+	EstimatedUnitCost   float64 `json:"estimated_unit_cost"`
+}
+
+type PurchaseSuggestion struct {
+	ID            int                      `json:"id"`
+	SuggestionID  string                   `json:"suggestion_id"`
+	Supplier      string                   `json:"supplier"`
+	Status        string                   `json:"status"`
+	DismissedBy   *string                  `json:"dismissed_by,omitempty"`
+	EstimatedCost float64                  `json:"estimated_cost"`
+	Lines         []PurchaseSuggestionLine `json:"lines"`
+	CreatedAt     string                   `json:"created_at"`
+	UpdatedAt     string                   `json:"updated_at"`
+}
+
+type DismissPurchaseSuggestionRequest struct {
+	DismissedBy string `json:"dismissed_by"`
+}
+
+// evaluateReplenishment computes the stock position of every active item of
+// an organization. Projected stock is on-hand (available, unexpired) minus reserved minus the
+// part of open work-order material requirements not yet reserved or issued.
+func (h *InventoryHandler) evaluateReplenishment(orgID int) ([]ReplenishmentItem, error) {
+	rows, err := h.db.Query(`
+		WITH on_hand AS (
+			SELECT item_id, SUM(quantity) AS quantity
+			FROM stock_lots
+			WHERE status = 'available' AND (expiry_date IS NULL OR expiry_date > CURRENT_TIMESTAMP)
+			GROUP BY item_id
+		), reserved AS (
+			SELECT r.item_id, SUM(r.quantity) AS quantity
+			FROM stock_reservations r
+			JOIN stock_lots sl ON r.lot_id = sl.id
+			WHERE r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP AND sl.status = 'available'
+			GROUP BY r.item_id
+		), requirements AS (
+			SELECT wo.id AS work_order_id, (req->>'item_id')::int AS item_id, SUM((req->>'quantity')::double precision) AS quantity
+			FROM work_orders wo
+			CROSS JOIN LATERAL jsonb_array_elements(COALESCE(wo.material_requirements, '[]'::jsonb)) req
+			WHERE wo.status NOT IN ('completed', 'cancelled')
+			  AND jsonb_typeof(req->'item_id') = 'number' AND jsonb_typeof(req->'quantity') = 'number'
+			GROUP BY wo.id, (req->>'item_id')::int
+		), covered AS (
+			SELECT work_order_id, item_id, SUM(quantity) AS quantity
+			FROM stock_requests
+			WHERE status IN ('approved', 'fulfilled')
+			GROUP BY work_order_id, item_id
+		), demand AS (
+			SELECT rq.item_id, SUM(GREATEST(rq.quantity - COALESCE(c.quantity, 0), 0)) AS quantity
+			FROM requirements rq
+			LEFT JOIN covered c ON c.work_order_id = rq.work_order_id AND c.item_id = rq.item_id
+			GROUP BY rq.item_id
+		), consumption AS (
+			SELECT item_id, SUM(quantity) AS quantity
+			FROM stock_movements
+			WHERE type = 'out' AND effective_date >= CURRENT_TIMESTAMP - make_interval(days => $1)
+			GROUP BY item_id
+		)
+		SELECT i.id, i.sku, i.name, i.category, i.unit, i.reorder_point, i.avg_cost, i.suppliers,
+		       i.reorder_alerted_at IS NOT NULL,
+		       COALESCE(oh.quantity, 0), COALESCE(rs.quantity, 0), COALESCE(d.quantity, 0), COALESCE(c.quantity, 0),
+		       (SELECT supplier FROM stock_lots WHERE item_id = i.id ORDER BY received_date DESC LIMIT 1)
+		FROM inventory_items i
+		LEFT JOIN on_hand oh ON oh.item_id = i.id
+		LEFT JOIN reserved rs ON rs.item_id = i.id
+		LEFT JOIN demand d ON d.item_id = i.id
+		LEFT JOIN consumption c ON c.item_id = i.id
+		WHERE i.status = 'active' AND i.organization_id = $2
+		ORDER BY i.name ASC
+	`, replenishmentConsumptionDays, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ReplenishmentItem{}
+	for rows.Next() {
+		var item ReplenishmentItem
+		var suppliersJSON []byte
+		var consumed float64
+		var lastSupplier sql.NullString
+		err := rows.Scan(&item.ItemID, &item.SKU, &item.Name, &item.Category, &item.Unit,
+			&item.ReorderPoint, &item.AvgCost, &suppliersJSON, &item.alerted,
+			&item.OnHand, &item.Reserved, &item.OpenDemand, &consumed, &lastSupplier)
+		if err != nil {
+			return nil, err
+		}
+
+		json.Unmarshal(suppliersJSON, &item.Suppliers)
+		if item.Suppliers == nil {
+			item.Suppliers = []string{}
+		}
+
+		// The first listed supplier is preferred, then whoever supplied the last lot
+		switch {
+		case len(item.Suppliers) > 0 && item.Suppliers[0] != "":
+			item.PreferredSupplier = item.Suppliers[0]
+		case lastSupplier.Valid && lastSupplier.String != "":
+			item.PreferredSupplier = lastSupplier.String
+		default:
+			item.PreferredSupplier = unassignedSupplier
+		}
+
+		item.AvgDailyConsumption = consumed / replenishmentConsumptionDays
+		item.Projected = item.OnHand - item.Reserved - item.OpenDemand
+		item.BelowReorderPoint = item.Projected < 0 || (item.ReorderPoint > 0 && item.Projected <= item.ReorderPoint)
+
+		if item.BelowReorderPoint {
+			need := item.ReorderPoint - item.Projected + item.AvgDailyConsumption*replenishmentCoverDays
+			item.SuggestedQuantity = math.Ceil(need)
+			if item.SuggestedQuantity <= 0 {
+				item.SuggestedQuantity = math.Max(math.Ceil(item.ReorderPoint), 1)
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// runReplenishment evaluates an organization's items, notifies its warehouse
+// roles about items that newly dropped to their reorder point and refreshes
+// its draft purchase suggestions (one per supplier)
+func (h *InventoryHandler) runReplenishment(orgID int) ([]ReplenishmentItem, error) {
+	items, err := h.evaluateReplenishment(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var newlyBelow []ReplenishmentItem
+	for _, item := range items {
+		if item.BelowReorderPoint && !item.alerted {
+			newlyBelow = append(newlyBelow, item)
+			if _, err := h.db.Exec("UPDATE inventory_items SET reorder_alerted_at = CURRENT_TIMESTAMP WHERE id = $1", item.ItemID); err != nil {
+				return nil, err
+			}
+		} else if !item.BelowReorderPoint && item.alerted {
+			// Recovered, so the next drop alerts again
+			if _, err := h.db.Exec("UPDATE inventory_items SET reorder_alerted_at = NULL WHERE id = $1", item.ItemID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(newlyBelow) > 0 {
+		userIDs, err := h.getWarehouseUserIDs(orgID)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range newlyBelow {
+			for _, userID := range userIDs {
+				websocket.CreateNotification(
+					h.db,
+					h.hub,
+					userID,
+					"stock_reorder",
+					"Stok Perlu Dipesan Ulang",
+					fmt.Sprintf("Stok %s tersisa %.2f %s (titik pemesanan ulang %.2f)", item.Name, item.Projected, item.Unit, item.ReorderPoint),
+					"/inventory/replenishment",
+				)
+			}
+		}
+	}
+
+	err = h.runStockTx(context.Background(), func(tx *sql.Tx) error {
+		return savePurchaseSuggestionsTx(tx, orgID, items)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// savePurchaseSuggestionsTx keeps one draft suggestion per supplier whose
+// lines are the items currently below their reorder point
+func savePurchaseSuggestionsTx(tx *sql.Tx, orgID int, items []ReplenishmentItem) error {
+	bySupplier := map[string][]ReplenishmentItem{}
+	for _, item := range items {
+		if item.BelowReorderPoint {
+			bySupplier[item.PreferredSupplier] = append(bySupplier[item.PreferredSupplier], item)
+		}
+	}
+
+	drafts := map[string]int{}
+	rows, err := tx.Query("SELECT id, supplier FROM purchase_suggestions WHERE status = 'draft' AND organization_id = $1 FOR UPDATE", orgID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var supplier string
+		if err := rows.Scan(&id, &supplier); err != nil {
+			rows.Close()
+			return err
+		}
+		drafts[supplier] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for supplier, id := range drafts {
+		if _, ok := bySupplier[supplier]; !ok {
+			if _, err := tx.Exec("DELETE FROM purchase_suggestions WHERE id = $1", id); err != nil {
+				return err
+			}
+		}
+	}
+
+	suppliers := make([]string, 0, len(bySupplier))
+	for supplier := range bySupplier {
+		suppliers = append(suppliers, supplier)
+	}
+	sort.Strings(suppliers)
+
+	for _, supplier := range suppliers {
+		id, ok := drafts[supplier]
+		if ok {
+			if _, err := tx.Exec("DELETE FROM purchase_suggestion_lines WHERE suggestion_id = $1", id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE purchase_suggestions SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+				return err
+			}
+		} else {
+			err := tx.QueryRow(`
+				INSERT INTO purchase_suggestions (suggestion_id, supplier, status, organization_id)
+				VALUES ($1, $2, 'draft', $3)
+				RETURNING id
+			`, generateID("PSG"), supplier, orgID).Scan(&id)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, item := range bySupplier[supplier] {
+			_, err := tx.Exec(`
+				INSERT INTO purchase_suggestion_lines (suggestion_id, item_id, on_hand, reserved, open_demand, reorder_point, avg_daily_consumption, suggested_quantity, estimated_unit_cost)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			`, id, item.ItemID, item.OnHand, item.Reserved, item.OpenDemand, item.ReorderPoint,
+				item.AvgDailyConsumption, item.SuggestedQuantity, item.AvgCost)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Get Replenishment (current stock position of all active items)
+func (h *InventoryHandler) GetReplenishment(w http.ResponseWriter, r *http.Request) {
+	items, err := h.evaluateReplenishment(organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to evaluate replenishment", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("below_reorder_point") == "true" {
+		filtered := []ReplenishmentItem{}
+		for _, item := range items {
+			if item.BelowReorderPoint {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// Run Replenishment (evaluate now, notify and refresh draft purchase suggestions)
+func (h *InventoryHandler) RunReplenishment(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.runReplenishment(organizationID(r)); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to run replenishment", "error", err)
+		http.Error(w, "Failed to run replenishment", http.StatusInternalServerError)
+		return
+	}
+
+	h.ListPurchaseSuggestions(w, r)
+}
+
+// List Purchase Suggestions
+func (h *InventoryHandler) ListPurchaseSuggestions(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "draft"
+	}
+
+	orgID := organizationID(r)
+	query := "SELECT id FROM purchase_suggestions WHERE organization_id = $1"
+	args := []interface{}{orgID}
+	if status != "all" {
+		query += " AND status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY supplier ASC, created_at DESC LIMIT 100"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get purchase suggestions", http.StatusInternalServerError)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	suggestions := []PurchaseSuggestion{}
+	for _, id := range ids {
+		suggestion, err := h.getPurchaseSuggestion(id, orgID)
+		if err != nil {
+			continue
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// Dismiss Purchase Suggestion
+func (h *InventoryHandler) DismissPurchaseSuggestion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase suggestion ID", http.StatusBadRequest)
+		return
+	}
+
+	var req DismissPurchaseSuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.DismissedBy == "" {
+		http.Error(w, "dismissed_by is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE purchase_suggestions
+		SET status = 'dismissed', dismissed_by = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND organization_id = $3 AND status = 'draft'
+	`, req.DismissedBy, id, organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to dismiss purchase suggestion", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Only draft purchase suggestions can be dismissed", http.StatusBadRequest)
+		return
+	}
+
+	suggestion, err := h.getPurchaseSuggestion(id, organizationID(r))
+	if err != nil {
+		http.Error(w, "Failed to retrieve purchase suggestion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestion)
+}
+
+func (h *InventoryHandler) getPurchaseSuggestion(id, orgID int) (PurchaseSuggestion, error) {
+	var s PurchaseSuggestion
+	var dismissedBy sql.NullString
+	err := h.db.QueryRow(`
+		SELECT id, suggestion_id, supplier, status, dismissed_by,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM purchase_suggestions WHERE id = $1 AND organization_id = $2
+	`, id, orgID).Scan(&s.ID, &s.SuggestionID, &s.Supplier, &s.Status, &dismissedBy, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	if dismissedBy.Valid {
+		s.DismissedBy = &dismissedBy.String
+	}
+
+	rows, err := h.db.Query(`
+		SELECT psl.id, psl.item_id, i.sku, i.name, i.unit, psl.on_hand, psl.reserved, psl.open_demand,
+		       psl.reorder_point, psl.avg_daily_consumption, psl.suggested_quantity, psl.estimated_unit_cost
+		FROM purchase_suggestion_lines psl
+		JOIN inventory_items i ON psl.item_id = i.id
+		WHERE psl.suggestion_id = $1
+		ORDER BY i.name ASC
+	`, id)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+
+	s.Lines = []PurchaseSuggestionLine{}
+	for rows.Next() {
+		var line PurchaseSuggestionLine
+		err := rows.Scan(&line.ID, &line.ItemID, &line.SKU, &line.Name, &line.Unit, &line.OnHand,
+			&line.Reserved, &line.OpenDemand, &line.ReorderPoint, &line.AvgDailyConsumption,
+			&line.SuggestedQuantity, &line.EstimatedUnitCost)
+		if err != nil {
+			return s, err
+		}
+		s.EstimatedCost += line.SuggestedQuantity * line.EstimatedUnitCost
+		s.Lines = append(s.Lines, line)
+	}
+
+	return s, rows.Err()
+}
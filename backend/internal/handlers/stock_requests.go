@@ -36,12 +36,16 @@ type StockRequest struct {
 	} `json:"warehouse,omitempty"`
 	Status          string    `json:"status"`
 	RequestedBy     string    `json:"requested_by"`
+	RequestedByID   *int      `json:"requested_by_id,omitempty"`
 	ApprovedBy      *string   `json:"approved_by,omitempty"`
+	ApprovedByID    *int      `json:"approved_by_id,omitempty"`
 	ApprovedAt      *string   `json:"approved_at,omitempty"`
 	RejectionReason *string   `json:"rejection_reason,omitempty"`
 	FulfilledAt     *string   `json:"fulfilled_at,omitempty"`
 	Notes           *string   `json:"notes,omitempty"`
-	AvailableStock  *float64  `json:"available_stock,omitempty"` // Available stock in warehouse
+	AvailableStock  *float64  `json:"available_stock,omitempty"` // Available stock in warehouse, net of reservations
+	ReservedQuantity *float64 `json:"reserved_quantity,omitempty"` // Quantity held for this request
+	Reservations    []StockReservation `json:"reservations,omitempty"`
 	CreatedAt       string    `json:"created_at"`
 	UpdatedAt       string    `json:"updated_at"`
 }
@@ -52,19 +56,16 @@ type CreateStockRequestRequest struct {
 	Quantity    float64 `json:"quantity"`
 	WarehouseID *int    `json:"warehouse_id,omitempty"`
 	Notes       *string `json:"notes,omitempty"`
-	RequestedBy string  `json:"requested_by"`
-}
-
-type ApproveStockRequestRequest struct {
-	ApprovedBy string  `json:"approved_by"`
-	Notes      *string `json:"notes,omitempty"`
 }
 
 type RejectStockRequestRequest struct {
-	RejectedBy       string  `json:"rejected_by"`
 	RejectionReason  string  `json:"rejection_reason"`
 }
 
+type CancelStockRequestRequest struct {
+	Reason      *string `json:"reason,omitempty"`
+}
+
 func generateRequestID() string {
 	return fmt.Sprintf("REQ-%d-%s", time.Now().Unix(), fmt.Sprintf("%04d", rand.Intn(10000)))
 }
@@ -88,19 +89,20 @@ func (h *InventoryHandler) ListStockRequests(w http.ResponseWriter, r *http.Requ
 		SELECT 
 			sr.id, sr.request_id, sr.work_order_id, sr.item_id, sr.quantity, 
 			sr.warehouse_id, sr.status, sr.requested_by, sr.approved_by, 
+			sr.requested_by_user_id, sr.approved_by_user_id,
 			sr.approved_at, sr.rejection_reason, sr.fulfilled_at, sr.notes,
-			TO_CHAR(sr.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(sr.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			TO_CHAR(sr.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(sr.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			wo.title as work_order_title,
 			i.id as item_id_col, i.sku, i.name as item_name, i.category, i.unit,
 			i.reorder_point, i.status as item_status, i.avg_cost, i.description as item_description, i.suppliers
 		FROM stock_requests sr
 		JOIN work_orders wo ON sr.work_order_id = wo.id
 		JOIN inventory_items i ON sr.item_id = i.id
-		WHERE 1=1
+		WHERE sr.organization_id = $1
 	`
-	args := []interface{}{}
-	argIndex := 1
+	args := []interface{}{organizationID(r)}
+	argIndex := 2
 
 	if workOrderID != "" && workOrderID != "all" {
 		query += fmt.Sprintf(" AND sr.work_order_id = $%d ", argIndex)
@@ -120,6 +122,13 @@ func (h *InventoryHandler) ListStockRequests(w http.ResponseWriter, r *http.Requ
 		argIndex++
 	}
 
+	// Field workers only see requests for work orders under their assigned fields
+	if userID, ok := fieldScopedUser(r); ok {
+		query += fmt.Sprintf(" AND sr.work_order_id IN (%s) ", visibleWorkOrdersSQL(argIndex))
+		args = append(args, userID)
+		argIndex++
+	}
+
 	query += fmt.Sprintf(" ORDER BY sr.created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
 	args = append(args, limit, offset)
 
@@ -137,11 +146,13 @@ func (h *InventoryHandler) ListStockRequests(w http.ResponseWriter, r *http.Requ
 		var workOrderTitle sql.NullString
 		var warehouseID sql.NullInt64
 		var approvedBy, approvedAt, rejectionReason, fulfilledAt, notes, itemDescription, createdAt, updatedAt sql.NullString
+		var requestedByUserID, approvedByUserID sql.NullInt64
 		var suppliersJSON []byte
 
 		err := rows.Scan(
 			&req.ID, &req.RequestID, &req.WorkOrderID, &req.Item.ID, &req.Quantity,
 			&warehouseID, &req.Status, &req.RequestedBy, &approvedBy,
+		&requestedByUserID, &approvedByUserID,
 			&approvedAt, &rejectionReason, &fulfilledAt, &notes,
 			&createdAt, &updatedAt,
 			&workOrderTitle,
@@ -180,8 +191,8 @@ func (h *InventoryHandler) ListStockRequests(w http.ResponseWriter, r *http.Requ
 
 			err = h.db.QueryRow(`
 				SELECT id, name, description, type, apikey, coordinates, field_ref,
-				       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-				       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+				       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+				       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 				FROM plots WHERE id = $1
 			`, id).Scan(
 				&warehouse.ID, &warehouse.Name, &plotDescription, &warehouse.Type,
@@ -208,6 +219,8 @@ func (h *InventoryHandler) ListStockRequests(w http.ResponseWriter, r *http.Requ
 			}
 		}
 
+		req.RequestedByID = nullableUserID(requestedByUserID)
+		req.ApprovedByID = nullableUserID(approvedByUserID)
 		if approvedBy.Valid {
 			req.ApprovedBy = &approvedBy.String
 		}
@@ -240,11 +253,7 @@ func (h *InventoryHandler) ListStockRequests(w http.ResponseWriter, r *http.Requ
 		// Calculate available stock if warehouse is specified
 		if req.WarehouseID != nil {
 			var availableStock sql.NullFloat64
-			err = h.db.QueryRow(`
-				SELECT COALESCE(SUM(quantity), 0)
-				FROM stock_lots
-				WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available'
-			`, req.Item.ID, req.WarehouseID).Scan(&availableStock)
+			err = h.db.QueryRow(availableStockQuery, req.Item.ID, req.WarehouseID).Scan(&availableStock)
 			if err == nil && availableStock.Valid {
 				req.AvailableStock = &availableStock.Float64
 			}
@@ -266,11 +275,14 @@ func (h *InventoryHandler) GetStockRequest(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Invalid stock request ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, "SELECT id FROM stock_requests WHERE work_order_id IN ("+visibleWorkOrdersSQL(2)+")", id, "Stock request not found") {
+		return
+	}
 
 	var req StockRequest
 	var item InventoryItem
 	var workOrderTitle sql.NullString
-	var warehouseID sql.NullInt64
+	var warehouseID, requestedByUserID, approvedByUserID sql.NullInt64
 	var approvedBy, approvedAt, rejectionReason, fulfilledAt, notes, itemDescription, createdAt, updatedAt sql.NullString
 	var suppliersJSON []byte
 
@@ -278,19 +290,21 @@ func (h *InventoryHandler) GetStockRequest(w http.ResponseWriter, r *http.Reques
 		SELECT 
 			sr.id, sr.request_id, sr.work_order_id, sr.item_id, sr.quantity, 
 			sr.warehouse_id, sr.status, sr.requested_by, sr.approved_by, 
+			sr.requested_by_user_id, sr.approved_by_user_id,
 			sr.approved_at, sr.rejection_reason, sr.fulfilled_at, sr.notes,
-			TO_CHAR(sr.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-			TO_CHAR(sr.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			TO_CHAR(sr.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+			TO_CHAR(sr.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			wo.title as work_order_title,
 			i.id as item_id_col, i.sku, i.name as item_name, i.category, i.unit,
 			i.reorder_point, i.status as item_status, i.avg_cost, i.description as item_description, i.suppliers
 		FROM stock_requests sr
 		JOIN work_orders wo ON sr.work_order_id = wo.id
 		JOIN inventory_items i ON sr.item_id = i.id
-		WHERE sr.id = $1
-	`, id).Scan(
+		WHERE sr.id = $1 AND sr.organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&req.ID, &req.RequestID, &req.WorkOrderID, &req.Item.ID, &req.Quantity,
 		&warehouseID, &req.Status, &req.RequestedBy, &approvedBy,
+		&requestedByUserID, &approvedByUserID,
 		&approvedAt, &rejectionReason, &fulfilledAt, &notes,
 		&createdAt, &updatedAt,
 		&workOrderTitle,
@@ -334,8 +348,8 @@ func (h *InventoryHandler) GetStockRequest(w http.ResponseWriter, r *http.Reques
 
 			err = h.db.QueryRow(`
 				SELECT id, name, description, type, apikey, coordinates, field_ref,
-				       TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-				       TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+				       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+				       TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
 				FROM plots WHERE id = $1
 			`, id).Scan(
 				&warehouse.ID, &warehouse.Name, &plotDescription, &warehouse.Type,
@@ -362,17 +376,15 @@ func (h *InventoryHandler) GetStockRequest(w http.ResponseWriter, r *http.Reques
 
 			// Calculate available stock
 			var availableStock sql.NullFloat64
-			err = h.db.QueryRow(`
-				SELECT COALESCE(SUM(quantity), 0)
-				FROM stock_lots
-				WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available'
-			`, req.Item.ID, req.WarehouseID).Scan(&availableStock)
+			err = h.db.QueryRow(availableStockQuery, req.Item.ID, req.WarehouseID).Scan(&availableStock)
 			if err == nil && availableStock.Valid {
 				req.AvailableStock = &availableStock.Float64
 			}
 		}
 	}
 
+	req.RequestedByID = nullableUserID(requestedByUserID)
+	req.ApprovedByID = nullableUserID(approvedByUserID)
 	if approvedBy.Valid {
 		req.ApprovedBy = &approvedBy.String
 	}
@@ -402,6 +414,18 @@ func (h *InventoryHandler) GetStockRequest(w http.ResponseWriter, r *http.Reques
 		req.UpdatedAt = updatedAt.String
 	}
 
+	reservations, err := h.getStockReservations(req.ID)
+	if err == nil && len(reservations) > 0 {
+		req.Reservations = reservations
+		reserved := 0.0
+		for _, res := range reservations {
+			if res.Status == "active" {
+				reserved += res.Quantity
+			}
+		}
+		req.ReservedQuantity = &reserved
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(req)
 }
@@ -414,22 +438,28 @@ func (h *InventoryHandler) CreateStockRequest(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if req.WorkOrderID == 0 || req.ItemID == 0 || req.Quantity <= 0 || req.RequestedBy == "" {
-		http.Error(w, "work_order_id, item_id, quantity, and requested_by are required", http.StatusBadRequest)
+	if req.WorkOrderID == 0 || req.ItemID == 0 || req.Quantity <= 0 {
+		http.Error(w, "work_order_id, item_id, and quantity are required", http.StatusBadRequest)
 		return
 	}
 
+	requester, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	orgID := organizationID(r)
+
 	// Verify work order exists
-	var workOrderExists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM work_orders WHERE id = $1)", req.WorkOrderID).Scan(&workOrderExists)
+	workOrderExists, err := inOrganization(h.db, "work_orders", req.WorkOrderID, orgID)
 	if err != nil || !workOrderExists {
 		http.Error(w, "Work order not found", http.StatusNotFound)
 		return
 	}
 
 	// Verify item exists
-	var itemExists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM inventory_items WHERE id = $1)", req.ItemID).Scan(&itemExists)
+	itemExists, err := inOrganization(h.db, "inventory_items", req.ItemID, orgID)
 	if err != nil || !itemExists {
 		http.Error(w, "Inventory item not found", http.StatusNotFound)
 		return
@@ -438,7 +468,7 @@ func (h *InventoryHandler) CreateStockRequest(w http.ResponseWriter, r *http.Req
 	// Verify warehouse if provided
 	if req.WarehouseID != nil && *req.WarehouseID > 0 {
 		var plotType string
-		err = h.db.QueryRow("SELECT type FROM plots WHERE id = $1", req.WarehouseID).Scan(&plotType)
+		err = h.db.QueryRow("SELECT type FROM plots WHERE id = $1 AND organization_id = $2", req.WarehouseID, orgID).Scan(&plotType)
 		if err == sql.ErrNoRows {
 			http.Error(w, "Warehouse not found", http.StatusNotFound)
 			return
@@ -455,14 +485,15 @@ func (h *InventoryHandler) CreateStockRequest(w http.ResponseWriter, r *http.Req
 	var approvedBy, approvedAt, rejectionReason, fulfilledAt, notes, createdAt, updatedAt sql.NullString
 	var warehouseID sql.NullInt64
 
+	stockReq.RequestedByID = &requester.ID
 	err = h.db.QueryRow(`
-		INSERT INTO stock_requests (request_id, work_order_id, item_id, quantity, warehouse_id, status, requested_by, notes)
-		VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7)
+		INSERT INTO stock_requests (request_id, work_order_id, item_id, quantity, warehouse_id, status, requested_by, requested_by_user_id, notes, organization_id)
+		VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7, $8, $9)
 		RETURNING id, request_id, work_order_id, item_id, quantity, warehouse_id, status, requested_by,
 		          approved_by, approved_at, rejection_reason, fulfilled_at, notes,
-		          TO_CHAR(created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
-		          TO_CHAR(updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
-	`, requestID, req.WorkOrderID, req.ItemID, req.Quantity, req.WarehouseID, req.RequestedBy, req.Notes).Scan(
+		          TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		          TO_CHAR(updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+	`, requestID, req.WorkOrderID, req.ItemID, req.Quantity, req.WarehouseID, requester.Name, requester.ID, req.Notes, orgID).Scan(
 		&stockReq.ID, &stockReq.RequestID, &stockReq.WorkOrderID, &stockReq.Item.ID, &stockReq.Quantity,
 		&warehouseID, &stockReq.Status, &stockReq.RequestedBy, &approvedBy,
 		&approvedAt, &rejectionReason, &fulfilledAt, &notes,
@@ -503,12 +534,14 @@ func (h *InventoryHandler) CreateStockRequest(w http.ResponseWriter, r *http.Req
 		stockReq.UpdatedAt = updatedAt.String
 	}
 
-	// Create notification for warehouse managers (async, hub not available here but notifications will still be created)
+	// Create notification for warehouse managers (async)
 	go func() {
-		// Get warehouse managers (Level 1, Level 2, warehouse role)
+		// Get warehouse managers (Level 1, Level 2, warehouse role) of this organization
 		rows, err := h.db.Query(`
-			SELECT id FROM users WHERE role IN ('Level 1', 'Level 2', 'warehouse') AND status = 'approved'
-		`)
+			SELECT om.user_id FROM organization_members om
+			JOIN users u ON u.id = om.user_id
+			WHERE om.organization_id = $1 AND om.role IN ('Level 1', 'Level 2', 'warehouse') AND u.status = 'approved'
+		`, orgID)
 		if err == nil {
 			defer rows.Close()
 			for rows.Next() {
@@ -516,7 +549,7 @@ func (h *InventoryHandler) CreateStockRequest(w http.ResponseWriter, r *http.Req
 				if err := rows.Scan(&userID); err == nil {
 					websocket.CreateNotification(
 						h.db,
-						nil, // hub not available in handler, but notification will still be created
+						h.hub,
 						userID,
 						"stock_request_new",
 						"Stock Request Baru",
@@ -533,7 +566,7 @@ func (h *InventoryHandler) CreateStockRequest(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(stockReq)
 }
 
-// Approve Stock Request
+// Approve Stock Request (reserves the requested quantity against specific lots)
 func (h *InventoryHandler) ApproveStockRequest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -543,72 +576,50 @@ func (h *InventoryHandler) ApproveStockRequest(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	var approveReq ApproveStockRequestRequest
-	if err := json.NewDecoder(r.Body).Decode(&approveReq); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if approveReq.ApprovedBy == "" {
-		http.Error(w, "approved_by is required", http.StatusBadRequest)
-		return
-	}
-
-	// Get stock request
-	var stockReq StockRequest
-	var quantity float64
-	var itemID, workOrderID int
-	var warehouseID sql.NullInt64
-	var status string
-
-	err = h.db.QueryRow(`
-		SELECT id, item_id, quantity, warehouse_id, status, work_order_id
-		FROM stock_requests WHERE id = $1
-	`, id).Scan(&stockReq.ID, &itemID, &quantity, &warehouseID, &status, &workOrderID)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, "Stock request not found", http.StatusNotFound)
-		return
-	}
+	approver, err := requestActor(h.db, r)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
-	if status != "pending" {
-		http.Error(w, "Only pending stock requests can be approved", http.StatusBadRequest)
+		writeActorError(w, err)
 		return
 	}
 
-	// Check stock availability if warehouse is specified
-	if warehouseID.Valid {
-		var availableStock float64
-		err = h.db.QueryRow(`
-			SELECT COALESCE(SUM(quantity), 0)
-			FROM stock_lots
-			WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available'
-		`, itemID, warehouseID.Int64).Scan(&availableStock)
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		var quantity float64
+		var itemID int
+		var warehouseID sql.NullInt64
+		var status string
 
+		err := tx.QueryRow(`
+			SELECT item_id, quantity, warehouse_id, status
+			FROM stock_requests WHERE id = $1 AND organization_id = $2
+			FOR UPDATE
+		`, id, organizationID(r)).Scan(&itemID, &quantity, &warehouseID, &status)
+		if err == sql.ErrNoRows {
+			return newStockError(http.StatusNotFound, "Stock request not found")
+		}
 		if err != nil {
-			http.Error(w, "Failed to check stock availability", http.StatusInternalServerError)
-			return
+			return err
 		}
 
-		if availableStock < quantity {
-			http.Error(w, fmt.Sprintf("Insufficient stock. Available: %.2f, Requested: %.2f", availableStock, quantity), http.StatusBadRequest)
-			return
+		if status != "pending" {
+			return newStockError(http.StatusBadRequest, "Only pending stock requests can be approved")
 		}
-	}
 
-	// Update stock request status
-	_, err = h.db.Exec(`
-		UPDATE stock_requests 
-		SET status = 'approved', approved_by = $1, approved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2
-	`, approveReq.ApprovedBy, id)
+		// Reserve stock if warehouse is specified
+		if warehouseID.Valid {
+			if err := reserveStockTx(tx, id, itemID, int(warehouseID.Int64), quantity); err != nil {
+				return err
+			}
+		}
 
+		_, err = tx.Exec(`
+			UPDATE stock_requests 
+			SET status = 'approved', approved_by = $1, approved_by_user_id = $2, approved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, approver.Name, approver.ID, id)
+		return err
+	})
 	if err != nil {
-		http.Error(w, "Failed to approve stock request", http.StatusInternalServerError)
+		writeStockTxError(w, err, "Failed to approve stock request")
 		return
 	}
 
@@ -616,7 +627,7 @@ func (h *InventoryHandler) ApproveStockRequest(w http.ResponseWriter, r *http.Re
 	h.GetStockRequest(w, r)
 }
 
-// Reject Stock Request
+// Reject Stock Request (pending or approved; releases any reservations)
 func (h *InventoryHandler) RejectStockRequest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -632,33 +643,20 @@ func (h *InventoryHandler) RejectStockRequest(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if rejectReq.RejectedBy == "" || rejectReq.RejectionReason == "" {
-		http.Error(w, "rejected_by and rejection_reason are required", http.StatusBadRequest)
+	if rejectReq.RejectionReason == "" {
+		http.Error(w, "rejection_reason is required", http.StatusBadRequest)
 		return
 	}
 
-	// Check if request exists and is pending
-	var status string
-	err = h.db.QueryRow("SELECT status FROM stock_requests WHERE id = $1", id).Scan(&status)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Stock request not found", http.StatusNotFound)
-		return
-	}
-	if status != "pending" {
-		http.Error(w, "Only pending stock requests can be rejected", http.StatusBadRequest)
+	rejecter, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
 		return
 	}
 
-	// Update stock request status
-	_, err = h.db.Exec(`
-		UPDATE stock_requests 
-		SET status = 'rejected', approved_by = $1, approved_at = CURRENT_TIMESTAMP, 
-		    rejection_reason = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3
-	`, rejectReq.RejectedBy, rejectReq.RejectionReason, id)
-
+	err = h.closeStockRequest(r, id, "rejected", rejecter, rejectReq.RejectionReason)
 	if err != nil {
-		http.Error(w, "Failed to reject stock request", http.StatusInternalServerError)
+		writeStockTxError(w, err, "Failed to reject stock request")
 		return
 	}
 
@@ -666,8 +664,8 @@ func (h *InventoryHandler) RejectStockRequest(w http.ResponseWriter, r *http.Req
 	h.GetStockRequest(w, r)
 }
 
-// Fulfill Stock Request (fulfill by removing stock and creating movement)
-func (h *InventoryHandler) FulfillStockRequest(w http.ResponseWriter, r *http.Request) {
+// Cancel Stock Request (pending or approved; releases any reservations)
+func (h *InventoryHandler) CancelStockRequest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
@@ -676,141 +674,239 @@ func (h *InventoryHandler) FulfillStockRequest(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Get stock request
-	var stockReq StockRequest
-	var quantity float64
-	var itemID, workOrderID int
-	var warehouseID sql.NullInt64
-	var status string
-
-	err = h.db.QueryRow(`
-		SELECT id, item_id, quantity, warehouse_id, status, work_order_id
-		FROM stock_requests WHERE id = $1
-	`, id).Scan(&stockReq.ID, &itemID, &quantity, &warehouseID, &status, &workOrderID)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, "Stock request not found", http.StatusNotFound)
+	var cancelReq CancelStockRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&cancelReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+
+	canceller, err := requestActor(h.db, r)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeActorError(w, err)
 		return
 	}
 
-	if status != "approved" {
-		http.Error(w, "Only approved stock requests can be fulfilled", http.StatusBadRequest)
-		return
+	reason := "Cancelled"
+	if cancelReq.Reason != nil && *cancelReq.Reason != "" {
+		reason = *cancelReq.Reason
 	}
 
-	if !warehouseID.Valid {
-		http.Error(w, "Warehouse must be specified to fulfill request", http.StatusBadRequest)
+	err = h.closeStockRequest(r, id, "cancelled", canceller, reason)
+	if err != nil {
+		writeStockTxError(w, err, "Failed to cancel stock request")
 		return
 	}
 
-	// Find available stock lots to fulfill the request
-	// Get stock lots for this item in this warehouse, ordered by FIFO (oldest first)
-	rows, err := h.db.Query(`
-		SELECT id, quantity, unit_cost
-		FROM stock_lots
-		WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available' AND quantity > 0
-		ORDER BY received_date ASC, created_at ASC
-	`, itemID, warehouseID.Int64)
+	// Fetch updated stock request
+	h.GetStockRequest(w, r)
+}
 
+// closeStockRequest moves a pending or approved request to rejected or
+// cancelled and releases its reservations in the same transaction
+func (h *InventoryHandler) closeStockRequest(r *http.Request, id int, newStatus string, closedBy actor, reason string) error {
+	return h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRow("SELECT status FROM stock_requests WHERE id = $1 AND organization_id = $2 FOR UPDATE", id, organizationID(r)).Scan(&status)
+		if err == sql.ErrNoRows {
+			return newStockError(http.StatusNotFound, "Stock request not found")
+		}
+		if err != nil {
+			return err
+		}
+		if status != "pending" && status != "approved" {
+			return newStockError(http.StatusBadRequest, fmt.Sprintf("Only pending or approved stock requests can be %s", newStatus))
+		}
+
+		_, err = tx.Exec(`
+			UPDATE stock_requests 
+			SET status = $1, approved_by = $2, approved_by_user_id = $3, approved_at = CURRENT_TIMESTAMP, 
+			    rejection_reason = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $5
+		`, newStatus, closedBy.Name, closedBy.ID, reason, id)
+		if err != nil {
+			return err
+		}
+
+		return releaseStockReservations(tx, id, fmt.Sprintf("Stock request %s", newStatus))
+	})
+}
+
+// Fulfill Stock Request (fulfill by removing stock and creating movement)
+func (h *InventoryHandler) FulfillStockRequest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Failed to query stock lots", http.StatusInternalServerError)
+		http.Error(w, "Invalid stock request ID", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var remainingQuantity = quantity
-	var lotsToUpdate []struct {
-		id        int
-		quantity  float64
-		unitCost  float64
-		removeQty float64
+	performedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
 	}
 
-	for rows.Next() && remainingQuantity > 0 {
-		var lotID int
-		var lotQuantity, unitCost float64
-		if err := rows.Scan(&lotID, &lotQuantity, &unitCost); err != nil {
-			continue
+	idempotency := newIdempotentRequest(r, "stock_requests.fulfill", nil)
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		_, found, err := idempotency.lookup(tx)
+		if err != nil || found {
+			return err
 		}
 
-		removeQty := remainingQuantity
-		if removeQty > lotQuantity {
-			removeQty = lotQuantity
+		// Lock the stock request so it can only be fulfilled once
+		var requestID, status string
+		var itemID int
+		var quantity float64
+		var warehouseID sql.NullInt64
+		err = tx.QueryRow(`
+			SELECT request_id, item_id, quantity, warehouse_id, status
+			FROM stock_requests WHERE id = $1 AND organization_id = $2
+			FOR UPDATE
+		`, id, organizationID(r)).Scan(&requestID, &itemID, &quantity, &warehouseID, &status)
+		if err == sql.ErrNoRows {
+			return newStockError(http.StatusNotFound, "Stock request not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		if status != "approved" {
+			return newStockError(http.StatusBadRequest, "Only approved stock requests can be fulfilled")
+		}
+		if !warehouseID.Valid {
+			return newStockError(http.StatusBadRequest, "Warehouse must be specified to fulfill request")
+		}
+
+		// Lock unexpired available lots for this item in this warehouse: lots
+		// reserved for this request first, then FIFO (oldest first)
+		rows, err := tx.Query(`
+			SELECT id, quantity, unit_cost
+			FROM stock_lots sl
+			WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available' AND quantity > 0
+			  AND (expiry_date IS NULL OR expiry_date > CURRENT_TIMESTAMP)
+			ORDER BY EXISTS(
+				SELECT 1 FROM stock_reservations r
+				WHERE r.lot_id = sl.id AND r.stock_request_id = $3
+				  AND r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP
+			) DESC, received_date ASC, created_at ASC
+			FOR UPDATE
+		`, itemID, warehouseID.Int64, id)
+		if err != nil {
+			return err
 		}
 
-		lotsToUpdate = append(lotsToUpdate, struct {
+		type lotDeduction struct {
 			id        int
 			quantity  float64
 			unitCost  float64
 			removeQty float64
-		}{lotID, lotQuantity, unitCost, removeQty})
+		}
 
-		remainingQuantity -= removeQty
-	}
+		var lots []lotDeduction
+		for rows.Next() {
+			var lot lotDeduction
+			if err := rows.Scan(&lot.id, &lot.quantity, &lot.unitCost); err != nil {
+				rows.Close()
+				return err
+			}
+			lots = append(lots, lot)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
 
-	if remainingQuantity > 0 {
-		http.Error(w, fmt.Sprintf("Insufficient stock to fulfill request. Need %.2f more units", remainingQuantity), http.StatusBadRequest)
-		return
-	}
+		// Stock held for other requests cannot be taken
+		remainingQuantity := quantity
+		var lotsToUpdate []lotDeduction
+		for _, lot := range lots {
+			if remainingQuantity <= 0 {
+				break
+			}
+			reservedByOthers, err := lotReservedQuantity(tx, lot.id, id)
+			if err != nil {
+				return err
+			}
+			usable := lot.quantity - reservedByOthers
+			if usable <= 0 {
+				continue
+			}
 
-	// Update stock lots and create movements
-	for _, lot := range lotsToUpdate {
-		newQuantity := lot.quantity - lot.removeQty
-		var newStatus string
-		if newQuantity <= 0 {
-			newStatus = "depleted"
-			newQuantity = 0
-		} else {
-			newStatus = "available"
+			lot.removeQty = remainingQuantity
+			if lot.removeQty > usable {
+				lot.removeQty = usable
+			}
+			lotsToUpdate = append(lotsToUpdate, lot)
+			remainingQuantity -= lot.removeQty
 		}
 
-		_, err = h.db.Exec(`
-			UPDATE stock_lots SET quantity = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
-		`, newQuantity, newStatus, lot.id)
-
-		if err != nil {
-			http.Error(w, "Failed to update stock lot", http.StatusInternalServerError)
-			return
+		if remainingQuantity > 0 {
+			return newStockError(http.StatusBadRequest, fmt.Sprintf("Insufficient stock to fulfill request. Need %.2f more units", remainingQuantity))
 		}
 
-		// Create stock movement
-		movementID := fmt.Sprintf("MOV-%d-%s", time.Now().Unix(), fmt.Sprintf("%04d", rand.Intn(10000)))
-		totalCost := lot.removeQty * lot.unitCost
-		stockRequestID := sql.NullInt64{Int64: int64(id), Valid: true}
+		// Update stock lots and create movements
+		notes := "Auto-fulfilled from approved stock request"
+		for _, lot := range lotsToUpdate {
+			newQuantity := lot.quantity - lot.removeQty
+			newStatus := "available"
+			if newQuantity <= 0 {
+				newStatus = "depleted"
+				newQuantity = 0
+			}
+
+			_, err = tx.Exec(`
+				UPDATE stock_lots SET quantity = $1, total_cost = $1 * unit_cost, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+			`, newQuantity, newStatus, lot.id)
+			if err != nil {
+				return err
+			}
 
-		_, err = h.db.Exec(`
-			INSERT INTO stock_movements (movement_id, item_id, lot_id, warehouse_id, type, quantity, unit_cost, total_cost, reason, reference, performed_by, notes, stock_request_id)
-			VALUES ($1, $2, $3, $4, 'out', $5, $6, $7, $8, $9, $10, $11, $12)
-		`, movementID, itemID, lot.id, warehouseID.Int64, lot.removeQty, lot.unitCost, totalCost,
-			fmt.Sprintf("Fulfill stock request %s", stockReq.RequestID),
-			fmt.Sprintf("Stock Request #%d", id),
-			"System",
-			fmt.Sprintf("Auto-fulfilled from approved stock request"),
-			stockRequestID)
+			_, err = insertStockMovement(tx, &stockMovementInput{
+				ItemID:         itemID,
+				LotID:          sql.NullInt64{Int64: int64(lot.id), Valid: true},
+				WarehouseID:    int(warehouseID.Int64),
+				Type:           "out",
+				Quantity:       lot.removeQty,
+				UnitCost:       lot.unitCost,
+				Reason:         fmt.Sprintf("Fulfill stock request %s", requestID),
+				Reference:      sql.NullString{String: fmt.Sprintf("Stock Request #%d", id), Valid: true},
+				PerformedBy:    performedBy,
+				Notes:          &notes,
+				StockRequestID: sql.NullInt64{Int64: int64(id), Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
 
+		_, err = tx.Exec(`
+			UPDATE stock_reservations
+			SET status = 'consumed', updated_at = CURRENT_TIMESTAMP
+			WHERE stock_request_id = $1 AND status = 'active'
+		`, id)
 		if err != nil {
-			http.Error(w, "Failed to create stock movement", http.StatusInternalServerError)
-			return
+			return err
 		}
-	}
 
-	// Mark stock request as fulfilled
-	_, err = h.db.Exec(`
-		UPDATE stock_requests 
-		SET status = 'fulfilled', fulfilled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1
-	`, id)
+		// Mark stock request as fulfilled
+		_, err = tx.Exec(`
+			UPDATE stock_requests 
+			SET status = 'fulfilled', fulfilled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, id)
+		if err != nil {
+			return err
+		}
 
+		return idempotency.save(tx, id)
+	})
 	if err != nil {
-		http.Error(w, "Failed to fulfill stock request", http.StatusInternalServerError)
+		writeStockTxError(w, err, "Failed to fulfill stock request")
 		return
 	}
 
 	// Fetch updated stock request
 	h.GetStockRequest(w, r)
 }
-
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// How long an approved stock request holds its reservation before the stock
+// is released back to the warehouse
+const stockReservationTTL = 72 * time.Hour
+
+// Available quantity of an item in a warehouse net of active reservations.
+// Takes item_id as $1 and warehouse_id as $2.
+const availableStockQuery = `
+	SELECT GREATEST(
+		COALESCE((
+			SELECT SUM(quantity) FROM stock_lots
+			WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available'
+			  AND (expiry_date IS NULL OR expiry_date > CURRENT_TIMESTAMP)
+		), 0) - COALESCE((
+			SELECT SUM(r.quantity) FROM stock_reservations r
+			JOIN stock_lots sl ON r.lot_id = sl.id
+			WHERE r.item_id = $1 AND r.warehouse_id = $2 AND sl.status = 'available'
+			  AND (sl.expiry_date IS NULL OR sl.expiry_date > CURRENT_TIMESTAMP)
+			  AND r.status = 'active' AND r.expires_at > CURRENT_TIMESTAMP
+		), 0),
+		0)
+`
+
+// StockReservation is a soft hold on part of a lot for an approved stock request
+type StockReservation struct {
+	ID            int     `json:"id"`
+	LotID         int     `json:"lot_id"`
+	LotCode       string  `json:"lot_code"`
+	Quantity      float64 `json:"quantity"`
+	Status        string  `json:"status"`
+	ExpiresAt     string  `json:"expires_at"`
+	ReleasedAt    *string `json:"released_at,omitempty"`
+	ReleaseReason *string `json:"release_reason,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+// sqlExecer is implemented by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// lotReservedQuantity returns the quantity of a lot held by active
+// reservations of stock requests other than exceptRequestID (0 for none).
+// Only pass a request that has been locked and checked to be approved and in
+// the caller's organization, never an id taken from the client.
+func lotReservedQuantity(tx *sql.Tx, lotID, exceptRequestID int) (float64, error) {
+	var reserved float64
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations
+		WHERE lot_id = $1 AND stock_request_id != $2
+		  AND status = 'active' AND expires_at > CURRENT_TIMESTAMP
+	`, lotID, exceptRequestID).Scan(&reserved)
+	return reserved, err
+}
+
+// reserveStockTx reserves quantity of an item in a warehouse for a stock
+// request, taking unreserved stock from the oldest unexpired lots first
+func reserveStockTx(tx *sql.Tx, requestID, itemID, warehouseID int, quantity float64) error {
+	rows, err := tx.Query(`
+		SELECT id, quantity FROM stock_lots
+		WHERE item_id = $1 AND warehouse_id = $2 AND status = 'available' AND quantity > 0
+		  AND (expiry_date IS NULL OR expiry_date > CURRENT_TIMESTAMP)
+		ORDER BY received_date ASC, created_at ASC
+		FOR UPDATE
+	`, itemID, warehouseID)
+	if err != nil {
+		return err
+	}
+
+	type lotQuantity struct {
+		id       int
+		quantity float64
+	}
+	var lots []lotQuantity
+	for rows.Next() {
+		var lot lotQuantity
+		if err := rows.Scan(&lot.id, &lot.quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(stockReservationTTL)
+	remaining := quantity
+	available := 0.0
+	for _, lot := range lots {
+		reserved, err := lotReservedQuantity(tx, lot.id, requestID)
+		if err != nil {
+			return err
+		}
+		free := lot.quantity - reserved
+		if free <= 0 {
+			continue
+		}
+		available += free
+		if remaining <= 0 {
+			continue
+		}
+
+		take := free
+		if take > remaining {
+			take = remaining
+		}
+		_, err = tx.Exec(`
+			INSERT INTO stock_reservations (stock_request_id, lot_id, item_id, warehouse_id, quantity, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, requestID, lot.id, itemID, warehouseID, take, expiresAt)
+		if err != nil {
+			return err
+		}
+		remaining -= take
+	}
+
+	if remaining > 0 {
+		return newStockError(http.StatusBadRequest, fmt.Sprintf("Insufficient stock. Available: %.2f, Requested: %.2f", available, quantity))
+	}
+	return nil
+}
+
+// releaseStockReservations releases the active reservations of a stock request
+func releaseStockReservations(db sqlExecer, requestID int, reason string) error {
+	_, err := db.Exec(`
+		UPDATE stock_reservations
+		SET status = 'released', released_at = CURRENT_TIMESTAMP, release_reason = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE stock_request_id = $2 AND status = 'active'
+	`, reason, requestID)
+	return err
+}
+
+// expireStockReservations marks reservations past their expiry as expired.
+// Availability queries already ignore them; this keeps the records accurate.
+func expireStockReservations(db sqlExecer) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE stock_reservations
+		SET status = 'expired', released_at = CURRENT_TIMESTAMP, release_reason = 'Reservation expired', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'active' AND expires_at <= CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// getStockReservations returns all reservations of a stock request
+func (h *InventoryHandler) getStockReservations(requestID int) ([]StockReservation, error) {
+	rows, err := h.db.Query(`
+		SELECT r.id, r.lot_id, sl.lot_id, r.quantity,
+		       CASE WHEN r.status = 'active' AND r.expires_at <= CURRENT_TIMESTAMP THEN 'expired' ELSE r.status END,
+		       TO_CHAR(r.expires_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       TO_CHAR(r.released_at, 'YYYY-MM-DD"T"HH24:MI:SS'),
+		       r.release_reason,
+		       TO_CHAR(r.created_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+		FROM stock_reservations r
+		JOIN stock_lots sl ON r.lot_id = sl.id
+		WHERE r.stock_request_id = $1
+		ORDER BY r.id ASC
+	`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []StockReservation{}
+	for rows.Next() {
+		var res StockReservation
+		var releasedAt, releaseReason sql.NullString
+		err := rows.Scan(&res.ID, &res.LotID, &res.LotCode, &res.Quantity, &res.Status,
+			&res.ExpiresAt, &releasedAt, &releaseReason, &res.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if releasedAt.Valid {
+			res.ReleasedAt = &releasedAt.String
+		}
+		if releaseReason.Valid {
+			res.ReleaseReason = &releaseReason.String
+		}
+		reservations = append(reservations, res)
+	}
+	return reservations, rows.Err()
+}
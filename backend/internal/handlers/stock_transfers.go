@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Stock Transfer types
+type StockTransfer struct {
+	ID                       int                 `json:"id"`
+	TransferID               string              `json:"transfer_id"`
+	SourceWarehouseID        int                 `json:"source_warehouse_id"`
+	SourceWarehouseName      string              `json:"source_warehouse_name"`
+	DestinationWarehouseID   int                 `json:"destination_warehouse_id"`
+	DestinationWarehouseName string              `json:"destination_warehouse_name"`
+	Status                   string              `json:"status"`
+	PerformedBy              string              `json:"performed_by"`
+	ReceivedBy               *string             `json:"received_by,omitempty"`
+	Notes                    *string             `json:"notes,omitempty"`
+	ShippedAt                string              `json:"shipped_at"`
+	ReceivedAt               *string             `json:"received_at,omitempty"`
+	Lines                    []StockTransferLine `json:"lines"`
+	CreatedAt                string              `json:"created_at"`
+	UpdatedAt                string              `json:"updated_at"`
+}
+
+type StockTransferLine struct {
+	ID               int     `json:"id"`
+	ItemID           int     `json:"item_id"`
+	ItemName         string  `json:"item_name"`
+	ItemSKU          string  `json:"item_sku"`
+	SourceLotID      int     `json:"source_lot_id"`
+	SourceLotCode    string  `json:"source_lot_code"`
+	DestinationLotID *int    `json:"destination_lot_id,omitempty"`
+	BatchNo          string  `json:"batch_no"`
+	Quantity         float64 `json:"quantity"`
+	UnitCost         float64 `json:"unit_cost"`
+}
+
+type CreateStockTransferRequest struct {
+	SourceWarehouseID      int `json:"source_warehouse_id"`
+	DestinationWarehouseID int `json:"destination_warehouse_id"`
+	Lines                  []struct {
+		LotID    int     `json:"lot_id"`
+		Quantity float64 `json:"quantity"`
+	} `json:"lines"`
+	// InTransit keeps the transfer open until it is received at the destination.
+	// When false the destination lots are created immediately.
+	InTransit   bool    `json:"in_transit"`
+	Notes       *string `json:"notes,omitempty"`
+}
+
+// List Stock Transfers
+func (h *InventoryHandler) ListStockTransfers(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	warehouseID := r.URL.Query().Get("warehouse_id")
+
+	orgID := organizationID(r)
+	query := `SELECT id FROM stock_transfers WHERE organization_id = $1`
+	args := []interface{}{orgID}
+	argIndex := 2
+
+	if status != "" && status != "all" {
+		query += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+	if warehouseID != "" && warehouseID != "all" {
+		query += fmt.Sprintf(" AND (source_warehouse_id = $%d OR destination_warehouse_id = $%d)", argIndex, argIndex)
+		id, _ := strconv.Atoi(warehouseID)
+		args = append(args, id)
+		argIndex++
+	}
+	query += " ORDER BY created_at DESC LIMIT 100"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get stock transfers", http.StatusInternalServerError)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	transfers := []StockTransfer{}
+	for _, id := range ids {
+		transfer, err := h.getStockTransfer(id, orgID)
+		if err != nil {
+			continue
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// Get Stock Transfer
+func (h *InventoryHandler) GetStockTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writeStockTransfer(w, id, organizationID(r), http.StatusOK)
+}
+
+func (h *InventoryHandler) writeStockTransfer(w http.ResponseWriter, id, orgID int, status int) {
+	transfer, err := h.getStockTransfer(id, orgID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Stock transfer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func (h *InventoryHandler) getStockTransfer(id, orgID int) (StockTransfer, error) {
+	var t StockTransfer
+	var receivedBy, notes, receivedAt sql.NullString
+
+	err := h.db.QueryRow(`
+		SELECT st.id, st.transfer_id, st.source_warehouse_id, src.name, st.destination_warehouse_id, dst.name,
+		       st.status, st.performed_by, st.received_by, st.notes,
+		       TO_CHAR(st.shipped_at, 'YYYY-MM-DD"T"HH24:MI:SS') as shipped_at,
+		       TO_CHAR(st.received_at, 'YYYY-MM-DD"T"HH24:MI:SS') as received_at,
+		       TO_CHAR(st.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at,
+		       TO_CHAR(st.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at
+		FROM stock_transfers st
+		JOIN plots src ON st.source_warehouse_id = src.id
+		JOIN plots dst ON st.destination_warehouse_id = dst.id
+		WHERE st.id = $1 AND st.organization_id = $2
+	`, id, orgID).Scan(
+		&t.ID, &t.TransferID, &t.SourceWarehouseID, &t.SourceWarehouseName,
+		&t.DestinationWarehouseID, &t.DestinationWarehouseName,
+		&t.Status, &t.PerformedBy, &receivedBy, &notes,
+		&t.ShippedAt, &receivedAt, &t.CreatedAt, &t.UpdatedAt,
+	)
+	if err != nil {
+		return t, err
+	}
+
+	if receivedBy.Valid {
+		t.ReceivedBy = &receivedBy.String
+	}
+	if notes.Valid {
+		t.Notes = &notes.String
+	}
+	if receivedAt.Valid {
+		t.ReceivedAt = &receivedAt.String
+	}
+
+	rows, err := h.db.Query(`
+		SELECT stl.id, stl.item_id, i.name, i.sku, stl.source_lot_id, sl.lot_id, stl.destination_lot_id,
+		       sl.batch_no, stl.quantity, stl.unit_cost
+		FROM stock_transfer_lines stl
+		JOIN inventory_items i ON stl.item_id = i.id
+		JOIN stock_lots sl ON stl.source_lot_id = sl.id
+		WHERE stl.transfer_id = $1
+		ORDER BY stl.id ASC
+	`, id)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	t.Lines = []StockTransferLine{}
+	for rows.Next() {
+		var line StockTransferLine
+		var destinationLotID sql.NullInt64
+		err := rows.Scan(&line.ID, &line.ItemID, &line.ItemName, &line.ItemSKU, &line.SourceLotID, &line.SourceLotCode,
+			&destinationLotID, &line.BatchNo, &line.Quantity, &line.UnitCost)
+		if err != nil {
+			continue
+		}
+		if destinationLotID.Valid {
+			id := int(destinationLotID.Int64)
+			line.DestinationLotID = &id
+		}
+		t.Lines = append(t.Lines, line)
+	}
+
+	return t, nil
+}
+
+// Create Stock Transfer (ship stock from one warehouse to another)
+func (h *InventoryHandler) CreateStockTransfer(w http.ResponseWriter, r *http.Request) {
+	var req CreateStockTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SourceWarehouseID == 0 || req.DestinationWarehouseID == 0 || len(req.Lines) == 0 {
+		http.Error(w, "source_warehouse_id, destination_warehouse_id, and lines are required", http.StatusBadRequest)
+		return
+	}
+	if req.SourceWarehouseID == req.DestinationWarehouseID {
+		http.Error(w, "Source and destination warehouse must be different", http.StatusBadRequest)
+		return
+	}
+
+	// Merge duplicate lots and lock them in id order to avoid deadlocks
+	quantities := map[int]float64{}
+	for _, line := range req.Lines {
+		if line.LotID == 0 || line.Quantity <= 0 {
+			http.Error(w, "Each line requires lot_id and a positive quantity", http.StatusBadRequest)
+			return
+		}
+		quantities[line.LotID] += line.Quantity
+	}
+	lotIDs := make([]int, 0, len(quantities))
+	for lotID := range quantities {
+		lotIDs = append(lotIDs, lotID)
+	}
+	sort.Ints(lotIDs)
+
+	performedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	orgID := organizationID(r)
+	idempotency := newIdempotentRequest(r, "stock_transfers.create", req)
+	var transferID int
+	replayed := false
+
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		existingID, found, err := idempotency.lookup(tx)
+		if err != nil {
+			return err
+		}
+		if found {
+			transferID, replayed = existingID, true
+			return nil
+		}
+
+		if err := checkWarehouse(tx, req.SourceWarehouseID, orgID); err != nil {
+			return err
+		}
+		if err := checkWarehouse(tx, req.DestinationWarehouseID, orgID); err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO stock_transfers (transfer_id, source_warehouse_id, destination_warehouse_id, status, performed_by, notes, organization_id)
+			VALUES ($1, $2, $3, 'in_transit', $4, $5, $6)
+			RETURNING id
+		`, generateID("TRF"), req.SourceWarehouseID, req.DestinationWarehouseID, performedBy.Name, req.Notes, orgID).Scan(&transferID)
+		if err != nil {
+			return err
+		}
+
+		for _, lotID := range lotIDs {
+			quantity := quantities[lotID]
+
+			var lotCode, status string
+			var itemID, warehouseID int
+			var lotQuantity, unitCost float64
+			err := tx.QueryRow(`
+				SELECT lot_id, item_id, warehouse_id, quantity, unit_cost, status
+				FROM stock_lots WHERE id = $1 AND organization_id = $2
+				FOR UPDATE
+			`, lotID, orgID).Scan(&lotCode, &itemID, &warehouseID, &lotQuantity, &unitCost, &status)
+			if err == sql.ErrNoRows {
+				return newStockError(http.StatusNotFound, fmt.Sprintf("Stock lot %d not found", lotID))
+			}
+			if err != nil {
+				return err
+			}
+
+			if warehouseID != req.SourceWarehouseID {
+				return newStockError(http.StatusBadRequest, fmt.Sprintf("Stock lot %s is not in the source warehouse", lotCode))
+			}
+			if status != "available" {
+				return newStockError(http.StatusBadRequest, fmt.Sprintf("Stock lot %s is not available", lotCode))
+			}
+			reserved, err := lotReservedQuantity(tx, lotID, 0)
+			if err != nil {
+				return err
+			}
+			if quantity > lotQuantity-reserved {
+				return newStockError(http.StatusBadRequest, fmt.Sprintf("Quantity to transfer exceeds available quantity of lot %s", lotCode))
+			}
+
+			newQuantity := lotQuantity - quantity
+			newStatus := status
+			if newQuantity <= 0 {
+				newStatus = "depleted"
+				newQuantity = 0
+			}
+			_, err = tx.Exec(`
+				UPDATE stock_lots SET quantity = $1, total_cost = $1 * unit_cost, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+			`, newQuantity, newStatus, lotID)
+			if err != nil {
+				return err
+			}
+
+			movement := &stockMovementInput{
+				ItemID:      itemID,
+				LotID:       sql.NullInt64{Int64: int64(lotID), Valid: true},
+				WarehouseID: req.SourceWarehouseID,
+				Type:        "transfer",
+				Quantity:    quantity,
+				UnitCost:    unitCost,
+				Reason:      "Transfer Out",
+				Reference:   sql.NullString{String: lotCode, Valid: true},
+				PerformedBy: performedBy,
+				Notes:       req.Notes,
+				TransferID:  sql.NullInt64{Int64: int64(transferID), Valid: true},
+				Direction:   sql.NullString{String: "out", Valid: true},
+			}
+			if _, err := insertStockMovement(tx, movement); err != nil {
+				return err
+			}
+
+			// The line carries the cost the stock left the source at, which
+			// is the cost it is received at in the destination
+			_, err = tx.Exec(`
+				INSERT INTO stock_transfer_lines (transfer_id, item_id, source_lot_id, quantity, unit_cost)
+				VALUES ($1, $2, $3, $4, $5)
+			`, transferID, itemID, lotID, quantity, movement.UnitCost)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !req.InTransit {
+			if err := receiveStockTransferTx(tx, transferID, orgID, performedBy); err != nil {
+				return err
+			}
+		}
+
+		return idempotency.save(tx, transferID)
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to create stock transfer")
+		return
+	}
+
+	status := http.StatusCreated
+	if replayed {
+		status = http.StatusOK
+	}
+	h.writeStockTransfer(w, transferID, orgID, status)
+}
+
+// Receive Stock Transfer (book in-transit stock into the destination warehouse)
+func (h *InventoryHandler) ReceiveStockTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return
+	}
+
+	receivedBy, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+
+	orgID := organizationID(r)
+	err = h.runStockTx(r.Context(), func(tx *sql.Tx) error {
+		return receiveStockTransferTx(tx, id, orgID, receivedBy)
+	})
+	if err != nil {
+		writeStockTxError(w, err, "Failed to receive stock transfer")
+		return
+	}
+
+	h.writeStockTransfer(w, id, orgID, http.StatusOK)
+}
+
+// receiveStockTransferTx creates a destination lot for every transfer line,
+// carrying over batch number, expiry, supplier, received date and unit cost,
+// and writes the matching inbound transfer movements.
+func receiveStockTransferTx(tx *sql.Tx, transferID, orgID int, receivedBy actor) error {
+	var transferCode, status string
+	var destinationWarehouseID int
+	err := tx.QueryRow(`
+		SELECT transfer_id, status, destination_warehouse_id FROM stock_transfers WHERE id = $1 AND organization_id = $2 FOR UPDATE
+	`, transferID, orgID).Scan(&transferCode, &status, &destinationWarehouseID)
+	if err == sql.ErrNoRows {
+		return newStockError(http.StatusNotFound, "Stock transfer not found")
+	}
+	if err != nil {
+		return err
+	}
+	if status != "in_transit" {
+		return newStockError(http.StatusBadRequest, "Only in-transit transfers can be received")
+	}
+
+	rows, err := tx.Query(`
+		SELECT stl.id, stl.item_id, stl.quantity, stl.unit_cost,
+		       sl.lot_id, sl.batch_no, sl.expiry_date, sl.supplier, sl.received_date
+		FROM stock_transfer_lines stl
+		JOIN stock_lots sl ON stl.source_lot_id = sl.id
+		WHERE stl.transfer_id = $1
+		ORDER BY stl.id ASC
+	`, transferID)
+	if err != nil {
+		return err
+	}
+
+	type transferLine struct {
+		id           int
+		itemID       int
+		quantity     float64
+		unitCost     float64
+		lotCode      string
+		batchNo      string
+		expiryDate   sql.NullTime
+		supplier     string
+		receivedDate sql.NullTime
+	}
+
+	var lines []transferLine
+	for rows.Next() {
+		var line transferLine
+		err := rows.Scan(&line.id, &line.itemID, &line.quantity, &line.unitCost,
+			&line.lotCode, &line.batchNo, &line.expiryDate, &line.supplier, &line.receivedDate)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		notes := fmt.Sprintf("Transferred from %s (%s)", line.lotCode, transferCode)
+
+		var destinationLotID int
+		err := tx.QueryRow(`
+			INSERT INTO stock_lots (lot_id, item_id, warehouse_id, batch_no, quantity, unit_cost, total_cost, expiry_date, supplier, notes, received_date, organization_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, CURRENT_TIMESTAMP), $12)
+			RETURNING id
+		`, generateID("LOT"), line.itemID, destinationWarehouseID, line.batchNo, line.quantity, line.unitCost,
+			line.quantity*line.unitCost, line.expiryDate, line.supplier, notes, line.receivedDate, orgID).Scan(&destinationLotID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE stock_transfer_lines SET destination_lot_id = $1 WHERE id = $2", destinationLotID, line.id)
+		if err != nil {
+			return err
+		}
+
+		_, err = insertStockMovement(tx, &stockMovementInput{
+			ItemID:      line.itemID,
+			LotID:       sql.NullInt64{Int64: int64(destinationLotID), Valid: true},
+			WarehouseID: destinationWarehouseID,
+			Type:        "transfer",
+			Quantity:    line.quantity,
+			UnitCost:    line.unitCost,
+			Reason:      "Transfer In",
+			Reference:   sql.NullString{String: line.lotCode, Valid: true},
+			PerformedBy: receivedBy,
+			TransferID:  sql.NullInt64{Int64: int64(transferID), Valid: true},
+			Direction:   sql.NullString{String: "in", Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE stock_transfers
+		SET status = 'received', received_by = $1, received_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, receivedBy.Name, transferID)
+	return err
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"agrione/backend/internal/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Number of times a stock transaction is retried after a serialization failure
+const stockTxMaxRetries = 5
+
+// IdempotencyKeyHeader lets clients safely retry stock-mutating requests
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKeyConstraint is the unique constraint a concurrent duplicate of
+// an idempotent request trips when it records its key
+const idempotencyKeyConstraint = "idempotency_keys_scope_key"
+
+// stockError is returned from inside a stock transaction to abort it with a
+// client-facing message and HTTP status.
+type stockError struct {
+	status  int
+	message string
+}
+
+func (e *stockError) Error() string {
+	return e.message
+}
+
+func newStockError(status int, message string) error {
+	return &stockError{status: status, message: message}
+}
+
+// writeStockTxError maps an error returned by runStockTx to an HTTP response
+func writeStockTxError(w http.ResponseWriter, err error, fallback string) {
+	var se *stockError
+	if errors.As(err, &se) {
+		http.Error(w, se.message, se.status)
+		return
+	}
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+// isSerializationFailure reports whether err is a Postgres serialization
+// failure or deadlock that can be resolved by retrying the transaction.
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+// isIdempotencyConflict reports whether err is a concurrent request with the
+// same idempotency key committing first. The retry then finds its key and
+// replays its response.
+func isIdempotencyConflict(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" && pqErr.Constraint == idempotencyKeyConstraint
+	}
+	return false
+}
+
+// runStockTx runs fn inside a serializable transaction, committing on success
+// and retrying on serialization failures and idempotency key conflicts. Every
+// stock-mutating path must go through here so that lot quantities, movements
+// and costs change together.
+func (h *InventoryHandler) runStockTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 0; attempt < stockTxMaxRetries; attempt++ {
+		err = h.runStockTxOnce(ctx, fn)
+		if err == nil || !(isSerializationFailure(err) || isIdempotencyConflict(err)) {
+			return err
+		}
+	}
+	return err
+}
+
+func (h *InventoryHandler) runStockTxOnce(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// idempotentRequest is a stock-mutating request sent with an Idempotency-Key.
+// A key belongs to the user who sent it in the organization it was sent in,
+// and is bound to the request it was first used with, so it never replays
+// somebody else's request.
+type idempotentRequest struct {
+	key            string
+	endpoint       string
+	organizationID int
+	userID         int
+	fingerprint    string
+}
+
+// newIdempotentRequest reads the key of r. The fingerprint covers the path
+// variables and the decoded payload, so formatting of the body does not matter.
+func newIdempotentRequest(r *http.Request, endpoint string, payload interface{}) idempotentRequest {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(int)
+	data, _ := json.Marshal(struct {
+		Vars    map[string]string `json:"vars"`
+		Payload interface{}       `json:"payload"`
+	}{mux.Vars(r), payload})
+	sum := sha256.Sum256(data)
+	return idempotentRequest{
+		key:            r.Header.Get(IdempotencyKeyHeader),
+		endpoint:       endpoint,
+		organizationID: organizationID(r),
+		userID:         userID,
+		fingerprint:    hex.EncodeToString(sum[:]),
+	}
+}
+
+// lookup returns the resource created by an earlier request with the same
+// key, and fails with 422 if that request was a different one. It runs
+// inside the stock transaction so a retried request sees keys committed by a
+// concurrent duplicate.
+func (k idempotentRequest) lookup(tx *sql.Tx) (int, bool, error) {
+	if k.key == "" {
+		return 0, false, nil
+	}
+
+	var resourceID int
+	var fingerprint string
+	err := tx.QueryRow(`
+		SELECT resource_id, request_hash FROM idempotency_keys
+		WHERE organization_id = $1 AND user_id = $2 AND idempotency_key = $3 AND endpoint = $4
+	`, k.organizationID, k.userID, k.key, k.endpoint).Scan(&resourceID, &fingerprint)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if fingerprint != k.fingerprint {
+		return 0, false, newStockError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	}
+	return resourceID, true, nil
+}
+
+// save records the key inside tx so that it only exists if the mutation it
+// protects was committed.
+func (k idempotentRequest) save(tx *sql.Tx, resourceID int) error {
+	if k.key == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO idempotency_keys (organization_id, user_id, idempotency_key, endpoint, request_hash, resource_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, k.organizationID, k.userID, k.key, k.endpoint, k.fingerprint, resourceID)
+	return err
+}
+
+// stockMovementInput holds the columns written for a single stock movement.
+// EffectiveDate back-dates the movement for costing; it defaults to now.
+type stockMovementInput struct {
+	ItemID         int
+	LotID          sql.NullInt64
+	WarehouseID    int
+	Type           string
+	Quantity       float64
+	UnitCost       float64
+	Reason         string
+	Reference      sql.NullString
+	PerformedBy    actor
+	Notes          *string
+	StockRequestID sql.NullInt64
+	TransferID     sql.NullInt64
+	StockCountID   sql.NullInt64
+	Direction      sql.NullString
+	EffectiveDate  sql.NullTime
+}
+
+// insertStockMovement writes a stock movement row inside tx and runs it
+// through the costing engine. The movement belongs to its item's
+// organization. Outbound movements are re-costed at the item's costing
+// method, so m.UnitCost holds the cost actually used on return.
+func insertStockMovement(tx *sql.Tx, m *stockMovementInput) (int, error) {
+	state, method, err := loadCostState(tx, m.ItemID, m.WarehouseID)
+	if err != nil {
+		return 0, err
+	}
+
+	inbound := isInboundMovement(m.Type, m.Direction)
+	if !inbound {
+		m.UnitCost = state.issue(method, m.Quantity, m.UnitCost)
+	}
+
+	var id int
+	var effectiveDate time.Time
+	err = tx.QueryRow(`
+		INSERT INTO stock_movements (movement_id, item_id, lot_id, warehouse_id, type, quantity, unit_cost, total_cost, reason, reference, performed_by, performed_by_user_id, notes, stock_request_id, transfer_id, stock_count_id, direction, effective_date, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, COALESCE($18, CURRENT_TIMESTAMP),
+		        (SELECT organization_id FROM inventory_items WHERE id = $2))
+		RETURNING id, effective_date
+	`, generateID("MOV"), m.ItemID, m.LotID, m.WarehouseID, m.Type, m.Quantity, m.UnitCost, m.Quantity*m.UnitCost,
+		m.Reason, m.Reference, m.PerformedBy.Name, m.PerformedBy.userID(), m.Notes, m.StockRequestID, m.TransferID, m.StockCountID, m.Direction,
+		m.EffectiveDate).Scan(&id, &effectiveDate)
+	if err != nil {
+		return 0, err
+	}
+
+	if inbound {
+		state.receive(&costLayer{
+			movementID: sql.NullInt64{Int64: int64(id), Valid: true},
+			layerDate:  effectiveDate,
+			quantity:   m.Quantity,
+			remaining:  m.Quantity,
+			unitCost:   m.UnitCost,
+		})
+	}
+
+	if err := saveCostState(tx, m.ItemID, m.WarehouseID, state); err != nil {
+		return 0, err
+	}
+	return id, recomputeAvgCost(tx, m.ItemID)
+}
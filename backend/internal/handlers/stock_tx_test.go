@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"agrione/backend/internal/database"
+	"agrione/backend/internal/middleware"
+
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+)
+
+// These tests run the stock handlers against a real Postgres, since the
+// guarantees they check come from its locks and serializable isolation. Point
+// DATABASE_URL at a disposable database; each test creates its own
+// organization in it and leaves the rows behind.
+
+// stockFixture is an organization with one user, one warehouse and one item
+type stockFixture struct {
+	t           *testing.T
+	db          *sql.DB
+	h           *InventoryHandler
+	orgID       int
+	userID      int
+	warehouseID int
+	itemID      int
+	workOrderID int
+}
+
+func newStockFixture(t *testing.T) *stockFixture {
+	t.Helper()
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &stockFixture{t: t, db: db, h: NewInventoryHandler(db, nil)}
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	f.queryRow(&f.orgID, "INSERT INTO organizations (name, slug) VALUES ($1, $1) RETURNING id", "stock-test-"+suffix)
+	f.queryRow(&f.userID, `
+		INSERT INTO users (email, username, first_name, last_name, password_hash, role, status)
+		VALUES ($1, $1, 'Stock', 'Tester', 'x', 'Level 2', 'approved') RETURNING id
+	`, "stock-test-"+suffix)
+	f.exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'Level 2')", f.orgID, f.userID)
+	f.queryRow(&f.warehouseID, `
+		INSERT INTO plots (name, type, apikey, coordinates, organization_id)
+		VALUES ('Warehouse', 'warehouse', $1, '[]', $2) RETURNING id
+	`, "stock-test-"+suffix, f.orgID)
+	f.queryRow(&f.itemID, `
+		INSERT INTO inventory_items (sku, name, category, unit, organization_id)
+		VALUES ('FERT-1', 'Fertilizer', 'fertilizer', 'kg', $1) RETURNING id
+	`, f.orgID)
+	f.queryRow(&f.workOrderID, `
+		INSERT INTO work_orders (title, category, activity, assignee, start_date, end_date, created_by, organization_id)
+		VALUES ('Pemupukan', 'maintenance', 'Pemupukan', 'Stock Tester', CURRENT_DATE, CURRENT_DATE, 'Stock Tester', $1)
+		RETURNING id
+	`, f.orgID)
+	return f
+}
+
+func (f *stockFixture) exec(query string, args ...interface{}) {
+	f.t.Helper()
+	if _, err := f.db.Exec(query, args...); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *stockFixture) queryRow(dest interface{}, query string, args ...interface{}) {
+	f.t.Helper()
+	if err := f.db.QueryRow(query, args...).Scan(dest); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// call runs handler as the fixture's user in its organization
+func (f *stockFixture) call(handler http.HandlerFunc, body interface{}, vars map[string]string, idempotencyKey string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", &buf)
+	if idempotencyKey != "" {
+		r.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+	ctx := context.WithValue(r.Context(), middleware.UserIDKey, f.userID)
+	ctx = context.WithValue(ctx, middleware.OrganizationIDKey, f.orgID)
+	r = mux.SetURLVars(r.WithContext(ctx), vars)
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// newMember adds another user to the fixture's organization and returns a
+// fixture that calls the handlers as that user
+func (f *stockFixture) newMember() *stockFixture {
+	f.t.Helper()
+	member := *f
+	email := fmt.Sprintf("stock-member-%d", time.Now().UnixNano())
+	member.queryRow(&member.userID, `
+		INSERT INTO users (email, username, first_name, last_name, password_hash, role, status)
+		VALUES ($1, $1, 'Stock', 'Member', 'x', 'Level 2', 'approved') RETURNING id
+	`, email)
+	member.exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'Level 2')", f.orgID, member.userID)
+	return &member
+}
+
+func (f *stockFixture) createLot(quantity float64) int {
+	f.t.Helper()
+	w := f.call(f.h.CreateStockLot, CreateStockLotRequest{
+		ItemID: f.itemID, WarehouseID: f.warehouseID, BatchNo: "B1",
+		Quantity: quantity, UnitCost: 1000, Supplier: "PT Pupuk",
+	}, nil, "")
+	if w.Code != http.StatusCreated {
+		f.t.Fatalf("create lot: %d %s", w.Code, w.Body.String())
+	}
+	var lot StockLot
+	if err := json.NewDecoder(w.Body).Decode(&lot); err != nil {
+		f.t.Fatal(err)
+	}
+	return lot.ID
+}
+
+// approvedRequest adds an approved stock request for quantity of the item
+func (f *stockFixture) approvedRequest(quantity float64) int {
+	f.t.Helper()
+	var id int
+	f.queryRow(&id, `
+		INSERT INTO stock_requests (request_id, work_order_id, item_id, quantity, warehouse_id, status, requested_by, organization_id)
+		VALUES ($1, $2, $3, $4, $5, 'approved', 'Stock Tester', $6) RETURNING id
+	`, generateID("SR"), f.workOrderID, f.itemID, quantity, f.warehouseID, f.orgID)
+	return id
+}
+
+// reservedRequest adds an approved stock request for quantity of the item and
+// reserves the stock for it
+func (f *stockFixture) reservedRequest(quantity float64) int {
+	f.t.Helper()
+	id := f.approvedRequest(quantity)
+	tx, err := f.db.Begin()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := reserveStockTx(tx, id, f.itemID, f.warehouseID, quantity); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		f.t.Fatal(err)
+	}
+	return id
+}
+
+func (f *stockFixture) lotQuantity(lotID int) float64 {
+	f.t.Helper()
+	var quantity float64
+	f.queryRow(&quantity, "SELECT quantity FROM stock_lots WHERE id = $1", lotID)
+	return quantity
+}
+
+func (f *stockFixture) issuedFromLot(lotID int) float64 {
+	f.t.Helper()
+	var quantity float64
+	f.queryRow(&quantity, "SELECT COALESCE(SUM(quantity), 0) FROM stock_movements WHERE lot_id = $1 AND type = 'out'", lotID)
+	return quantity
+}
+
+// parallel runs n calls at once and returns their responses. n stays within
+// stockTxMaxRetries so every call can win the lot eventually.
+func parallel(n int, call func(i int) *httptest.ResponseRecorder) []*httptest.ResponseRecorder {
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			responses[i] = call(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return responses
+}
+
+func TestConcurrentFulfillAndRemoveNeverOverdrawLot(t *testing.T) {
+	f := newStockFixture(t)
+	lotID := f.createLot(10)
+
+	// 3 requests of 4 and 2 removals of 3 ask for 18 out of 10
+	requests := []int{f.approvedRequest(4), f.approvedRequest(4), f.approvedRequest(4)}
+	responses := parallel(stockTxMaxRetries, func(i int) *httptest.ResponseRecorder {
+		if i < len(requests) {
+			return f.call(f.h.FulfillStockRequest, nil, map[string]string{"id": strconv.Itoa(requests[i])}, "")
+		}
+		return f.call(f.h.RemoveStock, RemoveStockRequest{LotID: lotID, Quantity: 3, Reason: "Rusak"}, nil, "")
+	})
+
+	for i, w := range responses {
+		if w.Code != http.StatusOK && w.Code != http.StatusBadRequest {
+			t.Errorf("call %d: unexpected status %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	remaining := f.lotQuantity(lotID)
+	if remaining < 0 {
+		t.Fatalf("lot quantity went negative: %v", remaining)
+	}
+	if issued := f.issuedFromLot(lotID); issued+remaining != 10 {
+		t.Errorf("issued %v with %v remaining, want a total of 10", issued, remaining)
+	}
+
+	for i, id := range requests {
+		var status string
+		var issued float64
+		f.queryRow(&status, "SELECT status FROM stock_requests WHERE id = $1", id)
+		f.queryRow(&issued, "SELECT COALESCE(SUM(quantity), 0) FROM stock_movements WHERE stock_request_id = $1", id)
+
+		fulfilled := responses[i].Code == http.StatusOK
+		if fulfilled != (status == "fulfilled") {
+			t.Errorf("request %d: responded %d but status is %s", id, responses[i].Code, status)
+		}
+		if fulfilled && issued != 4 {
+			t.Errorf("request %d: fulfilled with %v issued, want 4", id, issued)
+		}
+		if !fulfilled && issued != 0 {
+			t.Errorf("request %d: rejected with %v issued, want 0", id, issued)
+		}
+	}
+}
+
+func TestConcurrentFulfillOfOneRequestIssuesOnce(t *testing.T) {
+	f := newStockFixture(t)
+	lotID := f.createLot(10)
+	requestID := f.approvedRequest(2)
+
+	responses := parallel(stockTxMaxRetries, func(int) *httptest.ResponseRecorder {
+		return f.call(f.h.FulfillStockRequest, nil, map[string]string{"id": strconv.Itoa(requestID)}, "")
+	})
+
+	fulfilled := 0
+	for i, w := range responses {
+		switch w.Code {
+		case http.StatusOK:
+			fulfilled++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("call %d: unexpected status %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	if fulfilled != 1 {
+		t.Errorf("request fulfilled %d times, want 1", fulfilled)
+	}
+	if issued := f.issuedFromLot(lotID); issued != 2 {
+		t.Errorf("issued %v, want 2", issued)
+	}
+}
+
+func TestIdempotencyKeyReplaysResponse(t *testing.T) {
+	f := newStockFixture(t)
+	lotID := f.createLot(10)
+
+	// Concurrent duplicates of one removal commit once and all succeed
+	removal := RemoveStockRequest{LotID: lotID, Quantity: 3, Reason: "Rusak"}
+	responses := parallel(stockTxMaxRetries, func(int) *httptest.ResponseRecorder {
+		return f.call(f.h.RemoveStock, removal, nil, "remove-"+strconv.Itoa(lotID))
+	})
+	for i, w := range responses {
+		if w.Code != http.StatusOK || w.Body.String() != responses[0].Body.String() {
+			t.Errorf("call %d: got %d %s, want %d %s", i, w.Code, w.Body.String(), responses[0].Code, responses[0].Body.String())
+		}
+	}
+	if issued := f.issuedFromLot(lotID); issued != 3 {
+		t.Errorf("issued %v after duplicate removals, want 3", issued)
+	}
+
+	// A replayed fulfillment returns the original response without issuing again
+	requestID := f.approvedRequest(4)
+	vars := map[string]string{"id": strconv.Itoa(requestID)}
+	key := "fulfill-" + strconv.Itoa(requestID)
+	first := f.call(f.h.FulfillStockRequest, nil, vars, key)
+	if first.Code != http.StatusOK {
+		t.Fatalf("fulfill: %d %s", first.Code, first.Body.String())
+	}
+	replay := f.call(f.h.FulfillStockRequest, nil, vars, key)
+	if replay.Code != first.Code || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay got %d %s, want %d %s", replay.Code, replay.Body.String(), first.Code, first.Body.String())
+	}
+	if issued := f.issuedFromLot(lotID); issued != 7 {
+		t.Errorf("issued %v after replayed fulfillment, want 7", issued)
+	}
+}
+
+func TestIdempotencyKeyIsBoundToUserAndRequest(t *testing.T) {
+	f := newStockFixture(t)
+	lotID := f.createLot(10)
+	removal := RemoveStockRequest{LotID: lotID, Quantity: 1, Reason: "Rusak"}
+
+	if w := f.call(f.h.RemoveStock, removal, nil, "shared-key"); w.Code != http.StatusOK {
+		t.Fatalf("remove: %d %s", w.Code, w.Body.String())
+	}
+
+	// The same key with a different payload is refused rather than replayed
+	changed := removal
+	changed.Quantity = 2
+	if w := f.call(f.h.RemoveStock, changed, nil, "shared-key"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with a different payload: got %d %s, want %d", w.Code, w.Body.String(), http.StatusUnprocessableEntity)
+	}
+
+	// Another user's identical key is a new request of their own
+	if w := f.newMember().call(f.h.RemoveStock, removal, nil, "shared-key"); w.Code != http.StatusOK {
+		t.Fatalf("remove as another user: %d %s", w.Code, w.Body.String())
+	}
+	if issued := f.issuedFromLot(lotID); issued != 2 {
+		t.Errorf("issued %v, want 2", issued)
+	}
+}
+
+func TestIdempotencyKeyIsScopedToOrganization(t *testing.T) {
+	f := newStockFixture(t)
+	other := newStockFixture(t)
+
+	// The fixture's user also belongs to the other organization
+	other.exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'Level 2')", other.orgID, f.userID)
+	guest := *other
+	guest.userID = f.userID
+
+	lotID := f.createLot(10)
+	otherLotID := other.createLot(10)
+	if w := f.call(f.h.RemoveStock, RemoveStockRequest{LotID: lotID, Quantity: 1, Reason: "Rusak"}, nil, "org-key"); w.Code != http.StatusOK {
+		t.Fatalf("remove: %d %s", w.Code, w.Body.String())
+	}
+
+	// The same key in the other organization is neither replayed nor refused
+	if w := guest.call(other.h.RemoveStock, RemoveStockRequest{LotID: otherLotID, Quantity: 2, Reason: "Rusak"}, nil, "org-key"); w.Code != http.StatusOK {
+		t.Fatalf("remove in the other organization: %d %s", w.Code, w.Body.String())
+	}
+	if issued := other.issuedFromLot(otherLotID); issued != 2 {
+		t.Errorf("issued %v in the other organization, want 2", issued)
+	}
+	if issued := f.issuedFromLot(lotID); issued != 1 {
+		t.Errorf("issued %v, want 1", issued)
+	}
+}
+
+func TestRemoveStockHonoursEveryReservation(t *testing.T) {
+	f := newStockFixture(t)
+	lotID := f.createLot(10)
+	requestID := f.reservedRequest(8)
+
+	// Naming the request does not let a plain removal take its reserved stock
+	removal := RemoveStockRequest{LotID: lotID, Quantity: 5, Reason: "Rusak", StockRequestID: &requestID}
+	if w := f.call(f.h.RemoveStock, removal, nil, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("removal of reserved stock: got %d %s, want %d", w.Code, w.Body.String(), http.StatusBadRequest)
+	}
+
+	// Another organization's request cannot be linked at all
+	other := newStockFixture(t)
+	otherRequestID := other.approvedRequest(1)
+	removal = RemoveStockRequest{LotID: lotID, Quantity: 1, Reason: "Rusak", StockRequestID: &otherRequestID}
+	if w := f.call(f.h.RemoveStock, removal, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("removal linked to another organization's request: got %d %s, want %d", w.Code, w.Body.String(), http.StatusNotFound)
+	}
+
+	if issued := f.issuedFromLot(lotID); issued != 0 {
+		t.Errorf("issued %v, want 0", issued)
+	}
+	if w := f.call(f.h.FulfillStockRequest, nil, map[string]string{"id": strconv.Itoa(requestID)}, ""); w.Code != http.StatusOK {
+		t.Errorf("fulfill: %d %s", w.Code, w.Body.String())
+	}
+}
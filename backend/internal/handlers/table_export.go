@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Export formats accepted by the ?format= query parameter
+const (
+	exportFormatCSV  = "csv"
+	exportFormatXLSX = "xlsx"
+)
+
+// Rows are flushed to the client every exportFlushRows rows
+const exportFlushRows = 500
+
+// tableWriter streams a single table of rows to the client. Cells may be
+// string, float64, int or nil; numbers are written as numeric cells.
+type tableWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(cells []interface{}) error
+	Close() error
+}
+
+func isValidExportFormat(format string) bool {
+	return format == exportFormatCSV || format == exportFormatXLSX
+}
+
+// newTableWriter sets the download headers for filename (without extension)
+// and returns a writer for format
+func newTableWriter(w http.ResponseWriter, format, filename, sheetName string) (tableWriter, error) {
+	switch format {
+	case exportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		return &csvTableWriter{w: csv.NewWriter(w), flusher: flusherOf(w)}, nil
+	case exportFormatXLSX:
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, filename))
+		return newXLSXTableWriter(w, sheetName)
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+func flusherOf(w io.Writer) http.Flusher {
+	if f, ok := w.(http.Flusher); ok {
+		return f
+	}
+	return nil
+}
+
+func formatExportNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+type csvTableWriter struct {
+	w       *csv.Writer
+	flusher http.Flusher
+	rows    int
+}
+
+func (t *csvTableWriter) WriteHeader(columns []string) error {
+	return t.w.Write(columns)
+}
+
+func (t *csvTableWriter) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		switch v := cell.(type) {
+		case nil:
+		case float64:
+			record[i] = formatExportNumber(v)
+		case int:
+			record[i] = strconv.Itoa(v)
+		case string:
+			// Keep spreadsheet apps from evaluating user-entered text as a formula
+			if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+				v = "'" + v
+			}
+			record[i] = v
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	if err := t.w.Write(record); err != nil {
+		return err
+	}
+
+	t.rows++
+	if t.rows%exportFlushRows == 0 {
+		t.w.Flush()
+		if t.flusher != nil {
+			t.flusher.Flush()
+		}
+	}
+	return t.w.Error()
+}
+
+func (t *csvTableWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// xlsxTableWriter writes a single-sheet workbook. The package parts are
+// written up front and the sheet XML is streamed row by row into the zip.
+type xlsxTableWriter struct {
+	zip     *zip.Writer
+	sheet   io.Writer
+	flusher http.Flusher
+	row     int
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+	// Style 0 is the default, style 1 is the bold header
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+func newXLSXTableWriter(w io.Writer, sheetName string) (*xlsxTableWriter, error) {
+	var escapedName strings.Builder
+	xml.EscapeText(&escapedName, []byte(sheetName))
+
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, escapedName.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, xlsxSheetStart); err != nil {
+		return nil, err
+	}
+
+	return &xlsxTableWriter{zip: zw, sheet: sheet, flusher: flusherOf(w)}, nil
+}
+
+// xlsxColumnName converts a zero-based column index to A, B, ..., Z, AA, ...
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func (t *xlsxTableWriter) writeRow(cells []interface{}, style int) error {
+	t.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, t.row)
+	for i, cell := range cells {
+		ref := xlsxColumnName(i) + strconv.Itoa(t.row)
+		switch v := cell.(type) {
+		case nil:
+			continue
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, formatExportNumber(v))
+		case int:
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+		default:
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+			xml.EscapeText(&b, []byte(fmt.Sprint(v)))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	if _, err := io.WriteString(t.sheet, b.String()); err != nil {
+		return err
+	}
+	if t.row%exportFlushRows == 0 {
+		if err := t.zip.Flush(); err != nil {
+			return err
+		}
+		if t.flusher != nil {
+			t.flusher.Flush()
+		}
+	}
+	return nil
+}
+
+func (t *xlsxTableWriter) WriteHeader(columns []string) error {
+	cells := make([]interface{}, len(columns))
+	for i, column := range columns {
+		cells[i] = column
+	}
+	return t.writeRow(cells, 1)
+}
+
+func (t *xlsxTableWriter) WriteRow(cells []interface{}) error {
+	return t.writeRow(cells, 0)
+}
+
+func (t *xlsxTableWriter) Close() error {
+	if _, err := io.WriteString(t.sheet, xlsxSheetEnd); err != nil {
+		return err
+	}
+	return t.zip.Close()
+}
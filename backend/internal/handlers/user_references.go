@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"agrione/backend/internal/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// UserReferenceIssue is a row whose free-text person name could not be
+// matched to exactly one user when the users.id references were backfilled
+type UserReferenceIssue struct {
+	ID               int     `json:"id"`
+	TableName        string  `json:"table_name"`
+	ColumnName       string  `json:"column_name"`
+	RowID            int     `json:"row_id"`
+	Value            string  `json:"value"`
+	Reason           string  `json:"reason"`
+	CandidateUserIDs []int64 `json:"candidate_user_ids"`
+	ResolvedUserID   *int    `json:"resolved_user_id,omitempty"`
+	ResolvedBy       *int    `json:"resolved_by,omitempty"`
+	ResolvedAt       *string `json:"resolved_at,omitempty"`
+	CreatedAt        string  `json:"created_at"`
+}
+
+type ResolveUserReferenceRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// userReferenceColumns maps a free-text person column to the users.id column
+// that replaces it. Only these may be written by ResolveUserReferenceIssue.
+var userReferenceColumns = map[string]map[string]string{
+	"work_orders": {
+		"assignee":        "assignee_user_id",
+		"created_by":      "created_by_user_id",
+		"last_updated_by": "last_updated_by_user_id",
+	},
+	"field_reports": {
+		"submitted_by": "submitted_by_user_id",
+		"approved_by":  "approved_by_user_id",
+	},
+	"field_report_comments": {
+		"commented_by": "commented_by_user_id",
+	},
+	"stock_requests": {
+		"requested_by": "requested_by_user_id",
+		"approved_by":  "approved_by_user_id",
+	},
+	"stock_movements": {
+		"performed_by": "performed_by_user_id",
+	},
+}
+
+// userReferenceRowOrganizationSQL selects the organization of the row an
+// issue points at; comments belong to their report's organization
+const userReferenceRowOrganizationSQL = `
+	CASE i.table_name
+		WHEN 'work_orders' THEN (SELECT organization_id FROM work_orders WHERE id = i.row_id)
+		WHEN 'field_reports' THEN (SELECT organization_id FROM field_reports WHERE id = i.row_id)
+		WHEN 'field_report_comments' THEN (
+			SELECT fr.organization_id FROM field_report_comments c
+			JOIN field_reports fr ON fr.id = c.field_report_id
+			WHERE c.id = i.row_id)
+		WHEN 'stock_requests' THEN (SELECT organization_id FROM stock_requests WHERE id = i.row_id)
+		WHEN 'stock_movements' THEN (SELECT organization_id FROM stock_movements WHERE id = i.row_id)
+	END`
+
+// List User Reference Issues (status=open|resolved, table=<table_name>)
+func (h *UsersHandler) ListUserReferenceIssues(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT i.id, i.table_name, i.column_name, i.row_id, i.value, i.reason, i.candidate_user_ids,
+		       i.resolved_user_id, i.resolved_by,
+		       TO_CHAR(i.resolved_at, 'YYYY-MM-DD"T"HH24:MI:SS') as resolved_at,
+		       TO_CHAR(i.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+		FROM user_reference_issues i
+		WHERE (` + userReferenceRowOrganizationSQL + `) = $1
+	`
+	args := []interface{}{organizationID(r)}
+
+	switch r.URL.Query().Get("status") {
+	case "", "open":
+		query += " AND i.resolved_at IS NULL"
+	case "resolved":
+		query += " AND i.resolved_at IS NOT NULL"
+	case "all":
+	default:
+		http.Error(w, "status must be open, resolved or all", http.StatusBadRequest)
+		return
+	}
+
+	if table := r.URL.Query().Get("table"); table != "" {
+		query += " AND i.table_name = $2"
+		args = append(args, table)
+	}
+
+	query += " ORDER BY i.table_name, i.column_name, i.row_id"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to get user reference issues", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	issues := []UserReferenceIssue{}
+	for rows.Next() {
+		var issue UserReferenceIssue
+		var candidates pq.Int64Array
+		var resolvedUserID, resolvedBy sql.NullInt64
+		var resolvedAt, createdAt sql.NullString
+		if err := rows.Scan(&issue.ID, &issue.TableName, &issue.ColumnName, &issue.RowID, &issue.Value, &issue.Reason,
+			&candidates, &resolvedUserID, &resolvedBy, &resolvedAt, &createdAt); err != nil {
+			http.Error(w, "Failed to scan user reference issue", http.StatusInternalServerError)
+			return
+		}
+		issue.CandidateUserIDs = []int64(candidates)
+		if issue.CandidateUserIDs == nil {
+			issue.CandidateUserIDs = []int64{}
+		}
+		issue.ResolvedUserID = nullableUserID(resolvedUserID)
+		issue.ResolvedBy = nullableUserID(resolvedBy)
+		if resolvedAt.Valid {
+			issue.ResolvedAt = &resolvedAt.String
+		}
+		if createdAt.Valid {
+			issue.CreatedAt = createdAt.String
+		}
+		issues = append(issues, issue)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(issues)
+}
+
+// Resolve User Reference Issue (point the row at the chosen user)
+func (h *UsersHandler) ResolveUserReferenceIssue(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	issueID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid issue ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ResolveUserReferenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID <= 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	resolverID := r.Context().Value(middleware.UserIDKey).(int)
+
+	// The chosen user has to belong to the organization the row belongs to
+	role, err := organizationRole(h.db, req.UserID, organizationID(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if role == "" {
+		http.Error(w, "User not found", http.StatusBadRequest)
+		return
+	}
+
+	user, err := loadActor(h.db, req.UserID)
+	if err == errUnknownUser {
+		http.Error(w, "User not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var tableName, columnName string
+	var rowID int
+	err = tx.QueryRow(`
+		SELECT i.table_name, i.column_name, i.row_id FROM user_reference_issues i
+		WHERE i.id = $1 AND (`+userReferenceRowOrganizationSQL+`) = $2
+		FOR UPDATE
+	`, issueID, organizationID(r)).Scan(&tableName, &columnName, &rowID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Issue not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	idColumn, ok := userReferenceColumns[tableName][columnName]
+	if !ok {
+		http.Error(w, "Unsupported reference column", http.StatusBadRequest)
+		return
+	}
+
+	// Table and column names come from the whitelist above, never from input
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = $2", tableName, idColumn), user.ID, rowID)
+	if err != nil {
+		http.Error(w, "Failed to update reference", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_reference_issues
+		SET resolved_user_id = $1, resolved_by = $2, resolved_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, user.ID, resolverID, issueID)
+	if err != nil {
+		http.Error(w, "Failed to resolve issue", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Reference resolved",
+		"resolved_user_id": user.ID,
+	})
+}
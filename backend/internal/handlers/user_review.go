@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/mailer"
+	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+type PendingUser struct {
+	User
+	CreatedAt string `json:"created_at"`
+}
+
+type ApproveUserRequest struct {
+	Role   string `json:"role"`
+	Reason string `json:"reason"`
+}
+
+type RejectUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// validRoles are the values accepted for users.role
+var validRoles = map[string]bool{
+	"superadmin": true,
+	"Level 1":    true,
+	"Level 2":    true,
+	"Level 3":    true,
+	"Level 4":    true,
+	"warehouse":  true,
+	"user":       true,
+}
+
+// notifySignupPending tells every superadmin that a new account waits for
+// review. Signups do not belong to an organization yet, so the review queue
+// is not shown to organization admins.
+func notifySignupPending(logger *slog.Logger, db *sql.DB, hub *websocket.Hub, user User) {
+	adminIDs, err := websocket.GetSuperadminUserIDs(db)
+	if err != nil {
+		logger.Error("Failed to load superadmins for signup notification", "error", err)
+		return
+	}
+	for _, adminID := range adminIDs {
+		websocket.CreateNotification(
+			db,
+			hub,
+			adminID,
+			"signup_pending",
+			"Pendaftaran Baru Menunggu Persetujuan",
+			fmt.Sprintf("%s %s (%s) mendaftar dan menunggu persetujuan", user.FirstName, user.LastName, user.Email),
+			"/suadm",
+		)
+	}
+}
+
+// sendReviewEmail tells the applicant the outcome of their signup review
+func (h *UsersHandler) sendReviewEmail(ctx context.Context, user User, approved bool, reason string) {
+	var msg mailer.Message
+	msg.To = user.Email
+	if approved {
+		msg.Subject = "Your AgriOne account has been approved"
+		msg.Body = fmt.Sprintf("Hi %s,\n\nYour AgriOne account has been approved with the role %s. "+
+			"You can now log in at %s/login.\n", user.FirstName, user.Role, strings.TrimRight(h.cfg.FrontendURL, "/"))
+	} else {
+		msg.Subject = "Your AgriOne account request was not approved"
+		msg.Body = fmt.Sprintf("Hi %s,\n\nYour AgriOne account request was not approved.\n", user.FirstName)
+	}
+	if reason != "" {
+		msg.Body += fmt.Sprintf("\nNote from the reviewer:\n%s\n", reason)
+	}
+
+	logger := logging.FromContext(ctx)
+	h.tasks.Go(func() {
+		if err := h.mailer.Send(msg); err != nil {
+			logger.Error("Failed to send signup review email", "account_user_id", user.ID, "error", err)
+		}
+	})
+}
+
+// List Pending Users (signup review queue for superadmins, oldest first)
+func (h *UsersHandler) ListPendingUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+		SELECT id, email, username, first_name, last_name, role, status,
+		       TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at
+		FROM users
+		WHERE status = 'pending'
+		ORDER BY created_at ASC, id ASC
+	`)
+	if err != nil {
+		http.Error(w, "Failed to get pending users", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []PendingUser{}
+	for rows.Next() {
+		var u PendingUser
+		var createdAt sql.NullString
+		if err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.FirstName, &u.LastName, &u.Role, &u.Status, &createdAt); err != nil {
+			http.Error(w, "Failed to scan user", http.StatusInternalServerError)
+			return
+		}
+		if createdAt.Valid {
+			u.CreatedAt = createdAt.String
+		}
+		users = append(users, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// reviewPendingUser moves a pending user to approved or rejected inside tx and
+// records who decided and why. Returns false after writing an error response.
+func (h *UsersHandler) reviewPendingUser(w http.ResponseWriter, r *http.Request, tx *sql.Tx, status, role, reason string) (User, bool) {
+	var user User
+
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return user, false
+	}
+	reviewerID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var roleArg interface{}
+	if role != "" {
+		roleArg = role
+	}
+
+	err = tx.QueryRow(`
+		UPDATE users
+		SET status = $1, role = COALESCE($2, role), review_reason = $3, reviewed_by = $4,
+		    reviewed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5 AND status = 'pending'
+		RETURNING id, email, username, first_name, last_name, role, status
+	`, status, roleArg, sql.NullString{String: reason, Valid: reason != ""}, reviewerID, userID,
+	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err == nil && !exists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return user, false
+		}
+		http.Error(w, "User is not pending review", http.StatusConflict)
+		return user, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return user, false
+	}
+
+	return user, true
+}
+
+// Approve User (pending signup becomes approved with the given role)
+func (h *UsersHandler) ApproveUser(w http.ResponseWriter, r *http.Request) {
+	var req ApproveUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Role == "" {
+		http.Error(w, "role is required", http.StatusBadRequest)
+		return
+	}
+	if !validRoles[req.Role] {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == middleware.RoleSuperadmin && !isSuperadmin(r) {
+		http.Error(w, "Only a superadmin can grant the superadmin role", http.StatusForbidden)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := h.reviewPendingUser(w, r, tx, "approved", req.Role, req.Reason)
+	if !ok {
+		return
+	}
+
+	// Approved users join the reviewer's active organization with their role,
+	// in the same transaction so no approved user is left without one
+	if req.Role != middleware.RoleSuperadmin {
+		_, err := tx.Exec(`
+			INSERT INTO organization_members (organization_id, user_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = CURRENT_TIMESTAMP
+		`, organizationID(r), user.ID, req.Role)
+		if err != nil {
+			http.Error(w, "Failed to add user to organization", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	h.sendReviewEmail(r.Context(), user, true, req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// Reject User (pending signup is rejected; a reason is required)
+func (h *UsersHandler) RejectUser(w http.ResponseWriter, r *http.Request) {
+	var req RejectUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := h.reviewPendingUser(w, r, tx, "rejected", "", req.Reason)
+	if !ok {
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	h.sendReviewEmail(r.Context(), user, false, req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
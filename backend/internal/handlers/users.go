@@ -6,17 +6,25 @@ import (
 	"net/http"
 	"strconv"
 
+	"agrione/backend/internal/background"
+	"agrione/backend/internal/config"
+	"agrione/backend/internal/mailer"
 	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/websocket"
 
 	"github.com/gorilla/mux"
 )
 
 type UsersHandler struct {
-	db *sql.DB
+	db     *sql.DB
+	cfg    *config.Config
+	hub    *websocket.Hub
+	mailer mailer.Mailer
+	tasks  *background.Runner
 }
 
-func NewUsersHandler(db *sql.DB) *UsersHandler {
-	return &UsersHandler{db: db}
+func NewUsersHandler(db *sql.DB, cfg *config.Config, hub *websocket.Hub, mailer mailer.Mailer, tasks *background.Runner) *UsersHandler {
+	return &UsersHandler{db: db, cfg: cfg, hub: hub, mailer: mailer, tasks: tasks}
 }
 
 type UsersListResponse struct {
@@ -46,13 +54,16 @@ func (h *UsersHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	}
 	offset := (page - 1) * pageSize
 
+	// Users are listed as members of the active organization, with their role in it
+	orgID := organizationID(r)
+
 	// Get total count
 	var total int
 	var err error
 	if roleFilter != "" {
-		err = h.db.QueryRow("SELECT COUNT(*) FROM users WHERE role = $1", roleFilter).Scan(&total)
+		err = h.db.QueryRow("SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = $2", orgID, roleFilter).Scan(&total)
 	} else {
-		err = h.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&total)
+		err = h.db.QueryRow("SELECT COUNT(*) FROM organization_members WHERE organization_id = $1", orgID).Scan(&total)
 	}
 	if err != nil {
 		http.Error(w, "Failed to get user count", http.StatusInternalServerError)
@@ -63,13 +74,13 @@ func (h *UsersHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	var rows *sql.Rows
 	if roleFilter != "" {
 		rows, err = h.db.Query(
-			"SELECT id, email, username, first_name, last_name, role, status FROM users WHERE role = $1 ORDER BY id ASC LIMIT $2 OFFSET $3",
-			roleFilter, pageSize, offset,
+			"SELECT u.id, u.email, u.username, u.first_name, u.last_name, om.role, u.status FROM users u JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $1 WHERE om.role = $2 ORDER BY u.id ASC LIMIT $3 OFFSET $4",
+			orgID, roleFilter, pageSize, offset,
 		)
 	} else {
 		rows, err = h.db.Query(
-			"SELECT id, email, username, first_name, last_name, role, status FROM users ORDER BY id ASC LIMIT $1 OFFSET $2",
-			pageSize, offset,
+			"SELECT u.id, u.email, u.username, u.first_name, u.last_name, om.role, u.status FROM users u JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $1 ORDER BY u.id ASC LIMIT $2 OFFSET $3",
+			orgID, pageSize, offset,
 		)
 	}
 	if err != nil {
@@ -129,23 +140,13 @@ func (h *UsersHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate role
-	validRoles := map[string]bool{
-		"superadmin": true,
-		"Level 1":    true,
-		"Level 2":    true,
-		"Level 3":    true,
-		"Level 4":    true,
-		"warehouse":  true,
-		"user":       true,
-	}
 	if !validRoles[req.Role] {
 		http.Error(w, "Invalid role", http.StatusBadRequest)
 		return
 	}
 
-	// Check if user exists
-	var exists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+	// Check if user exists in the caller's organization
+	exists, err := managedUserExists(h.db, r, userID)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -155,20 +156,38 @@ func (h *UsersHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Superadmin is an account role and only a superadmin may grant or
+	// revoke it; every other role is held per organization
+	var accountRole string
+	if err := h.db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&accountRole); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if (req.Role == middleware.RoleSuperadmin || accountRole == middleware.RoleSuperadmin) && !isSuperadmin(r) {
+		http.Error(w, "Only a superadmin can change superadmin access", http.StatusForbidden)
+		return
+	}
+
 	// Update role
-	_, err = h.db.Exec("UPDATE users SET role = $1 WHERE id = $2", req.Role, userID)
+	if req.Role == middleware.RoleSuperadmin {
+		_, err = h.db.Exec("UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.Role, userID)
+	} else {
+		_, err = h.db.Exec(`
+			INSERT INTO organization_members (organization_id, user_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = CURRENT_TIMESTAMP
+		`, organizationID(r), userID, req.Role)
+		if err == nil && accountRole == middleware.RoleSuperadmin {
+			_, err = h.db.Exec("UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.Role, userID)
+		}
+	}
 	if err != nil {
 		http.Error(w, "Failed to update role", http.StatusInternalServerError)
 		return
 	}
 
 	// Get updated user
-	var user User
-	err = h.db.QueryRow(
-		"SELECT id, email, username, first_name, last_name, role, status FROM users WHERE id = $1",
-		userID,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status)
-
+	user, err := loadUser(h.db, userID, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to retrieve updated user", http.StatusInternalServerError)
 		return
@@ -211,9 +230,8 @@ func (h *UsersHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Check if user exists
-	var exists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+	// Check if user exists in the caller's organization
+	exists, err := managedUserExists(h.db, r, userID)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -230,13 +248,17 @@ func (h *UsersHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get updated user
-	var user User
-	err = h.db.QueryRow(
-		"SELECT id, email, username, first_name, last_name, role, status FROM users WHERE id = $1",
-		userID,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Role, &user.Status)
+	// A user that is no longer approved loses every session immediately
+	if req.Status != "approved" {
+		if _, err := revokeUserSessions(h.db, userID, "Account status changed to "+req.Status); err != nil {
+			http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+			return
+		}
+		h.hub.DisconnectUser(userID)
+	}
 
+	// Get updated user
+	user, err := loadUser(h.db, userID, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to retrieve updated user", http.StatusInternalServerError)
 		return
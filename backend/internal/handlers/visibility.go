@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"agrione/backend/internal/middleware"
+)
+
+// fieldScopedUser returns the caller's user ID when their role only sees the
+// fields assigned to them (fields.user_id)
+func fieldScopedUser(r *http.Request) (int, bool) {
+	role, _ := r.Context().Value(middleware.UserRoleKey).(string)
+	if !middleware.FieldScoped(role) {
+		return 0, false
+	}
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	return userID, ok
+}
+
+// assignedFieldsSQL selects the fields assigned to the user bound to $argPos
+func assignedFieldsSQL(argPos int) string {
+	return fmt.Sprintf("SELECT id FROM fields WHERE user_id = $%d", argPos)
+}
+
+// visiblePlotsSQL selects the plots of the fields assigned to the user bound
+// to $argPos
+func visiblePlotsSQL(argPos int) string {
+	return fmt.Sprintf("SELECT id FROM plots WHERE field_ref IN (%s)", assignedFieldsSQL(argPos))
+}
+
+// visibleWorkOrdersSQL selects the work orders under the fields assigned to
+// the user bound to $argPos, plus those assigned to the user directly
+func visibleWorkOrdersSQL(argPos int) string {
+	return fmt.Sprintf("SELECT id FROM work_orders WHERE field_id IN (%s) OR assignee_user_id = $%d", assignedFieldsSQL(argPos), argPos)
+}
+
+// visibleFieldReportsSQL selects the reports on visible work orders, plus the
+// user's own reports
+func visibleFieldReportsSQL(argPos int) string {
+	return fmt.Sprintf("SELECT id FROM field_reports WHERE work_order_id IN (%s) OR submitted_by_user_id = $%d", visibleWorkOrdersSQL(argPos), argPos)
+}
+
+// visibleTo reports whether the caller may see the row with the given ID.
+// visibleSQL selects the visible IDs of the user bound to $2. Roles that are
+// not field scoped see every row.
+func visibleTo(db *sql.DB, r *http.Request, visibleSQL string, id int) (bool, error) {
+	userID, ok := fieldScopedUser(r)
+	if !ok {
+		return true, nil
+	}
+	var visible bool
+	err := db.QueryRow("SELECT $1 IN ("+visibleSQL+")", id, userID).Scan(&visible)
+	return visible, err
+}
+
+// requireVisible answers 404 with notFound when the caller may not see the
+// row, the same as for a row that does not exist
+func requireVisible(w http.ResponseWriter, db *sql.DB, r *http.Request, visibleSQL string, id int, notFound string) bool {
+	visible, err := visibleTo(db, r, visibleSQL, id)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if !visible {
+		http.Error(w, notFound, http.StatusNotFound)
+		return false
+	}
+	return true
+}
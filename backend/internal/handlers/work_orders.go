@@ -4,13 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"agrione/backend/internal/logging"
 	"agrione/backend/internal/websocket"
 
 	"github.com/gorilla/mux"
@@ -39,6 +39,7 @@ type WorkOrder struct {
 	Status              string                `json:"status"`
 	Priority            string                `json:"priority"`
 	Assignee            string                `json:"assignee"`
+	AssigneeID          *int                  `json:"assignee_id,omitempty"`
 	FieldID             *int                  `json:"field_id,omitempty"`
 	FieldName           *string               `json:"field_name,omitempty"`
 	CultivationSeasonID *int                  `json:"cultivation_season_id,omitempty"`
@@ -51,7 +52,9 @@ type WorkOrder struct {
 	ActualHours         *int                  `json:"actual_hours,omitempty"`
 	Notes               *string               `json:"notes,omitempty"`
 	CreatedBy           string                `json:"created_by"`
+	CreatedByID         *int                  `json:"created_by_id,omitempty"`
 	LastUpdatedBy       *string               `json:"last_updated_by,omitempty"`
+	LastUpdatedByID     *int                  `json:"last_updated_by_id,omitempty"`
 	CompletedDate       *string               `json:"completed_date,omitempty"`
 	CreatedAt           string                `json:"created_at"`
 	UpdatedAt           string                `json:"updated_at"`
@@ -64,6 +67,7 @@ type CreateWorkOrderRequest struct {
 	Status              *string               `json:"status,omitempty"`
 	Priority            *string               `json:"priority,omitempty"`
 	Assignee            string                `json:"assignee"`
+	AssigneeID          *int                  `json:"assignee_id,omitempty"`
 	FieldID             *int                  `json:"field_id,omitempty"`
 	CultivationSeasonID *int                  `json:"cultivation_season_id,omitempty"`
 	StartDate           string                `json:"start_date"`
@@ -74,7 +78,6 @@ type CreateWorkOrderRequest struct {
 	MaterialRequirements []MaterialRequirement `json:"material_requirements,omitempty"`
 	ActualHours         *int                  `json:"actual_hours,omitempty"`
 	Notes               *string               `json:"notes,omitempty"`
-	CreatedBy           string                `json:"created_by"`
 }
 
 type UpdateWorkOrderRequest struct {
@@ -84,6 +87,7 @@ type UpdateWorkOrderRequest struct {
 	Status               *string                `json:"status,omitempty"`
 	Priority             *string                `json:"priority,omitempty"`
 	Assignee             *string                `json:"assignee,omitempty"`
+	AssigneeID           *int                   `json:"assignee_id,omitempty"`
 	FieldID              *int                   `json:"field_id,omitempty"`
 	StartDate            *string                `json:"start_date,omitempty"`
 	EndDate              *string                `json:"end_date,omitempty"`
@@ -93,7 +97,6 @@ type UpdateWorkOrderRequest struct {
 	MaterialRequirements *[]MaterialRequirement `json:"material_requirements,omitempty"`
 	ActualHours          *int                   `json:"actual_hours,omitempty"`
 	Notes                *string                `json:"notes,omitempty"`
-	LastUpdatedBy        *string                `json:"last_updated_by,omitempty"`
 }
 
 func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Request) {
@@ -104,6 +107,7 @@ func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Reques
 	fieldIDStr := r.URL.Query().Get("field_id")
 	fieldIDsStr := r.URL.Query().Get("field_ids") // Support for multiple field IDs (comma-separated)
 	assignee := r.URL.Query().Get("assignee")
+	assigneeID := r.URL.Query().Get("assignee_id")
 
 	// Build query
 	query := `
@@ -112,14 +116,15 @@ func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Reques
 			wo.assignee, wo.field_id, wo.start_date, wo.end_date, wo.progress,
 			wo.description, wo.requirements, wo.material_requirements, wo.actual_hours, wo.notes,
 			wo.created_by, wo.last_updated_by, wo.completed_date,
+			wo.assignee_user_id, wo.created_by_user_id, wo.last_updated_by_user_id,
 			wo.created_at, wo.updated_at,
 			f.name as field_name
 		FROM work_orders wo
 		LEFT JOIN fields f ON wo.field_id = f.id
-		WHERE 1=1
+		WHERE wo.organization_id = $1
 	`
-	args := []interface{}{}
-	argPos := 1
+	args := []interface{}{organizationID(r)}
+	argPos := 2
 
 	if status != "" && status != "all" {
 		query += " AND wo.status = $" + strconv.Itoa(argPos)
@@ -168,6 +173,14 @@ func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Reques
 		argPos++
 	}
 
+	if assigneeID != "" {
+		if id, err := strconv.Atoi(assigneeID); err == nil {
+			query += " AND wo.assignee_user_id = $" + strconv.Itoa(argPos)
+			args = append(args, id)
+			argPos++
+		}
+	}
+
 	if search != "" {
 		query += " AND (wo.title ILIKE $" + strconv.Itoa(argPos) + 
 			" OR wo.description ILIKE $" + strconv.Itoa(argPos) + 
@@ -178,6 +191,13 @@ func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Reques
 		argPos += 4
 	}
 
+	// Field workers only see work orders under their assigned fields
+	if userID, ok := fieldScopedUser(r); ok {
+		query += " AND wo.id IN (" + visibleWorkOrdersSQL(argPos) + ")"
+		args = append(args, userID)
+		argPos++
+	}
+
 	query += " ORDER BY wo.start_date ASC, wo.created_at DESC"
 
 	rows, err := h.db.Query(query, args...)
@@ -192,13 +212,14 @@ func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Reques
 		var wo WorkOrder
 		var requirementsJSON, materialRequirementsJSON []byte
 		var description, notes, lastUpdatedBy, completedDate, createdAt, updatedAt, fieldName sql.NullString
-		var fieldID, actualHours sql.NullInt64
+		var fieldID, actualHours, assigneeUserID, createdByUserID, lastUpdatedByUserID sql.NullInt64
 
 		err := rows.Scan(
 			&wo.ID, &wo.Title, &wo.Category, &wo.Activity, &wo.Status, &wo.Priority,
 			&wo.Assignee, &fieldID, &wo.StartDate, &wo.EndDate, &wo.Progress,
 			&description, &requirementsJSON, &materialRequirementsJSON, &actualHours, &notes,
 			&wo.CreatedBy, &lastUpdatedBy, &completedDate,
+		&assigneeUserID, &createdByUserID, &lastUpdatedByUserID,
 			&createdAt, &updatedAt, &fieldName,
 		)
 
@@ -223,6 +244,9 @@ func (h *WorkOrdersHandler) ListWorkOrders(w http.ResponseWriter, r *http.Reques
 		if lastUpdatedBy.Valid {
 			wo.LastUpdatedBy = &lastUpdatedBy.String
 		}
+		wo.AssigneeID = nullableUserID(assigneeUserID)
+		wo.CreatedByID = nullableUserID(createdByUserID)
+		wo.LastUpdatedByID = nullableUserID(lastUpdatedByUserID)
 		if completedDate.Valid {
 			wo.CompletedDate = &completedDate.String
 		}
@@ -268,11 +292,14 @@ func (h *WorkOrdersHandler) GetWorkOrder(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid work order ID", http.StatusBadRequest)
 		return
 	}
+	if !requireVisible(w, h.db, r, visibleWorkOrdersSQL(2), id, "Work order not found") {
+		return
+	}
 
 	var wo WorkOrder
 	var requirementsJSON, materialRequirementsJSON []byte
 	var description, notes, lastUpdatedBy, completedDate, createdAt, updatedAt, fieldName sql.NullString
-	var fieldID, actualHours sql.NullInt64
+	var fieldID, actualHours, assigneeUserID, createdByUserID, lastUpdatedByUserID sql.NullInt64
 
 	err = h.db.QueryRow(`
 		SELECT 
@@ -280,17 +307,19 @@ func (h *WorkOrdersHandler) GetWorkOrder(w http.ResponseWriter, r *http.Request)
 			wo.assignee, wo.field_id, wo.start_date, wo.end_date, wo.progress,
 			wo.description, wo.requirements, wo.material_requirements, wo.actual_hours, wo.notes,
 			wo.created_by, wo.last_updated_by, wo.completed_date,
-			TO_CHAR(wo.created_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
-			TO_CHAR(wo.updated_at AT TIME ZONE 'Asia/Jakarta', 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
+			wo.assignee_user_id, wo.created_by_user_id, wo.last_updated_by_user_id,
+			TO_CHAR(wo.created_at, 'YYYY-MM-DD"T"HH24:MI:SS') as created_at, 
+			TO_CHAR(wo.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS') as updated_at,
 			f.name as field_name
 		FROM work_orders wo
 		LEFT JOIN fields f ON wo.field_id = f.id
-		WHERE wo.id = $1
-	`, id).Scan(
+		WHERE wo.id = $1 AND wo.organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&wo.ID, &wo.Title, &wo.Category, &wo.Activity, &wo.Status, &wo.Priority,
 		&wo.Assignee, &fieldID, &wo.StartDate, &wo.EndDate, &wo.Progress,
 		&description, &requirementsJSON, &materialRequirementsJSON, &actualHours, &notes,
 		&wo.CreatedBy, &lastUpdatedBy, &completedDate,
+		&assigneeUserID, &createdByUserID, &lastUpdatedByUserID,
 		&createdAt, &updatedAt, &fieldName,
 	)
 
@@ -319,6 +348,9 @@ func (h *WorkOrdersHandler) GetWorkOrder(w http.ResponseWriter, r *http.Request)
 	if lastUpdatedBy.Valid {
 		wo.LastUpdatedBy = &lastUpdatedBy.String
 	}
+	wo.AssigneeID = nullableUserID(assigneeUserID)
+	wo.CreatedByID = nullableUserID(createdByUserID)
+	wo.LastUpdatedByID = nullableUserID(lastUpdatedByUserID)
 	if completedDate.Valid {
 		wo.CompletedDate = &completedDate.String
 	}
@@ -359,11 +391,25 @@ func (h *WorkOrdersHandler) CreateWorkOrder(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Validate required fields
-	if req.Title == "" || req.Category == "" || req.Activity == "" || req.Assignee == "" || req.CreatedBy == "" {
+	if req.Title == "" || req.Category == "" || req.Activity == "" || (req.Assignee == "" && req.AssigneeID == nil) {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
+	creator, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+	orgID := organizationID(r)
+	assignee, ok := h.resolveAssignee(w, orgID, req.AssigneeID, req.Assignee)
+	if !ok {
+		return
+	}
+	if req.FieldID != nil && !h.fieldInOrganization(w, *req.FieldID, orgID) {
+		return
+	}
+
 	// Parse dates
 	startDate, err := time.Parse("2006-01-02", req.StartDate)
 	if err != nil {
@@ -408,12 +454,14 @@ func (h *WorkOrdersHandler) CreateWorkOrder(w http.ResponseWriter, r *http.Reque
 		INSERT INTO work_orders (
 			title, category, activity, status, priority, assignee, field_id,
 			start_date, end_date, progress, description, requirements, material_requirements,
-			actual_hours, notes, created_by, last_updated_by
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			actual_hours, notes, created_by, last_updated_by,
+			assignee_user_id, created_by_user_id, last_updated_by_user_id, organization_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 		RETURNING id
-	`, req.Title, req.Category, req.Activity, status, priority, req.Assignee, req.FieldID,
+	`, req.Title, req.Category, req.Activity, status, priority, assignee.Name, req.FieldID,
 		startDate, endDate, progress, req.Description, string(requirementsJSON), string(materialRequirementsJSON),
-		req.ActualHours, req.Notes, req.CreatedBy, req.CreatedBy).Scan(&woID)
+		req.ActualHours, req.Notes, creator.Name, creator.Name,
+		assignee.ID, creator.ID, creator.ID, orgID).Scan(&woID)
 
 	if err != nil {
 		http.Error(w, "Failed to create work order", http.StatusInternalServerError)
@@ -422,19 +470,30 @@ func (h *WorkOrdersHandler) CreateWorkOrder(w http.ResponseWriter, r *http.Reque
 
 	// Auto-create stock requests for material requirements
 	if len(req.MaterialRequirements) > 0 {
+		logger := logging.FromContext(r.Context())
 		go func() {
 			for _, matReq := range req.MaterialRequirements {
 				if matReq.ItemID > 0 && matReq.Quantity > 0 {
 					requestID := fmt.Sprintf("REQ-%d-%s", time.Now().Unix(), fmt.Sprintf("%04d", rand.Intn(10000)))
 					
-					_, err := h.db.Exec(`
-						INSERT INTO stock_requests (request_id, work_order_id, item_id, quantity, warehouse_id, status, requested_by, notes)
-						VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7)
-					`, requestID, woID, matReq.ItemID, matReq.Quantity, matReq.WarehouseID, req.CreatedBy, 
-						fmt.Sprintf("Auto-generated from work order: %s", req.Title))
+					// Item and warehouse must belong to the work order's organization
+					result, err := h.db.Exec(`
+						INSERT INTO stock_requests (request_id, work_order_id, item_id, quantity, warehouse_id, status, requested_by, requested_by_user_id, notes, organization_id)
+						SELECT $1, $2, $3, $4, $5, 'pending', $6, $7, $8, $9
+						WHERE EXISTS(SELECT 1 FROM inventory_items WHERE id = $3 AND organization_id = $9)
+						  AND EXISTS(SELECT 1 FROM plots WHERE id = $5 AND organization_id = $9)
+					`, requestID, woID, matReq.ItemID, matReq.Quantity, matReq.WarehouseID, creator.Name, creator.ID, 
+						fmt.Sprintf("Auto-generated from work order: %s", req.Title), orgID)
+					if err == nil {
+						if n, _ := result.RowsAffected(); n == 0 {
+							logger.Warn("Skipped stock request for work order: item or warehouse not in organization",
+								"work_order_id", woID, "item_id", matReq.ItemID, "warehouse_id", matReq.WarehouseID, "organization_id", orgID)
+							continue
+						}
+					}
 					
 					if err != nil {
-						log.Printf("Failed to create stock request for work order %d: %v", woID, err)
+						logger.Error("Failed to create stock request for work order", "work_order_id", woID, "error", err)
 					}
 				}
 			}
@@ -443,24 +502,63 @@ func (h *WorkOrdersHandler) CreateWorkOrder(w http.ResponseWriter, r *http.Reque
 
 	// Create notification for the assignee
 	go func() {
-		assigneeUserID, err := websocket.GetUserIDFromSubmittedBy(h.db, req.Assignee)
-		if err == nil && assigneeUserID > 0 {
-			websocket.CreateNotification(
-				h.db,
-				h.hub,
-				assigneeUserID,
-				"work_order_new",
-				"Work Order Baru",
-				fmt.Sprintf("Work order '%s' telah ditugaskan kepada Anda", req.Title),
-				fmt.Sprintf("/lapangan/work-orders/%d", woID),
-			)
-		}
+		websocket.CreateNotification(
+			h.db,
+			h.hub,
+			assignee.ID,
+			"work_order_new",
+			"Work Order Baru",
+			fmt.Sprintf("Work order '%s' telah ditugaskan kepada Anda", req.Title),
+			fmt.Sprintf("/lapangan/work-orders/%d", woID),
+		)
 	}()
 
 	// Fetch created work order
 	h.GetWorkOrderByID(w, r, woID)
 }
 
+// resolveAssignee looks up the user a work order is assigned to, who must
+// have access to the organization. Returns false after writing an error
+// response.
+func (h *WorkOrdersHandler) resolveAssignee(w http.ResponseWriter, orgID int, userID *int, name string) (actor, bool) {
+	assignee, err := resolveUser(h.db, userID, name)
+	if err == nil {
+		var role string
+		role, err = organizationRole(h.db, assignee.ID, orgID)
+		if err == nil && role == "" {
+			err = errUnknownUser
+		}
+	}
+	if err == errUnknownUser {
+		http.Error(w, "Assignee not found", http.StatusBadRequest)
+		return assignee, false
+	}
+	if err == errAmbiguousUser {
+		http.Error(w, "Assignee name matches more than one user, send assignee_id instead", http.StatusBadRequest)
+		return assignee, false
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return assignee, false
+	}
+	return assignee, true
+}
+
+// fieldInOrganization checks a work order's field. Returns false after
+// writing an error response.
+func (h *WorkOrdersHandler) fieldInOrganization(w http.ResponseWriter, fieldID, orgID int) bool {
+	ok, err := inOrganization(h.db, "fields", fieldID, orgID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		http.Error(w, "Field not found", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
 func (h *WorkOrdersHandler) UpdateWorkOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -511,12 +609,26 @@ func (h *WorkOrdersHandler) UpdateWorkOrder(w http.ResponseWriter, r *http.Reque
 		args = append(args, *req.Priority)
 		argPos++
 	}
-	if req.Assignee != nil {
+	if req.Assignee != nil || req.AssigneeID != nil {
+		name := ""
+		if req.Assignee != nil {
+			name = *req.Assignee
+		}
+		assignee, ok := h.resolveAssignee(w, organizationID(r), req.AssigneeID, name)
+		if !ok {
+			return
+		}
 		updates = append(updates, "assignee = $"+strconv.Itoa(argPos))
-		args = append(args, *req.Assignee)
+		args = append(args, assignee.Name)
+		argPos++
+		updates = append(updates, "assignee_user_id = $"+strconv.Itoa(argPos))
+		args = append(args, assignee.ID)
 		argPos++
 	}
 	if req.FieldID != nil {
+		if !h.fieldInOrganization(w, *req.FieldID, organizationID(r)) {
+			return
+		}
 		updates = append(updates, "field_id = $"+strconv.Itoa(argPos))
 		args = append(args, *req.FieldID)
 		argPos++
@@ -555,7 +667,7 @@ func (h *WorkOrdersHandler) UpdateWorkOrder(w http.ResponseWriter, r *http.Reque
 		} else if progress > 0 {
 			// Check if status should be in-progress
 			var currentStatus string
-			h.db.QueryRow("SELECT status FROM work_orders WHERE id = $1", id).Scan(&currentStatus)
+			h.db.QueryRow("SELECT status FROM work_orders WHERE id = $1 AND organization_id = $2", id, organizationID(r)).Scan(&currentStatus)
 			if currentStatus == "pending" {
 				updates = append(updates, "status = 'in-progress'")
 			}
@@ -588,28 +700,39 @@ func (h *WorkOrdersHandler) UpdateWorkOrder(w http.ResponseWriter, r *http.Reque
 		args = append(args, *req.Notes)
 		argPos++
 	}
-	if req.LastUpdatedBy != nil {
-		updates = append(updates, "last_updated_by = $"+strconv.Itoa(argPos))
-		args = append(args, *req.LastUpdatedBy)
-		argPos++
-	}
 
 	if len(updates) == 0 {
 		http.Error(w, "No fields to update", http.StatusBadRequest)
 		return
 	}
 
+	editor, err := requestActor(h.db, r)
+	if err != nil {
+		writeActorError(w, err)
+		return
+	}
+	updates = append(updates, "last_updated_by = $"+strconv.Itoa(argPos))
+	args = append(args, editor.Name)
+	argPos++
+	updates = append(updates, "last_updated_by_user_id = $"+strconv.Itoa(argPos))
+	args = append(args, editor.ID)
+	argPos++
+
 	updates = append(updates, "updated_at = CURRENT_TIMESTAMP")
-	updates = append(updates, "id = $"+strconv.Itoa(argPos))
-	args = append(args, id)
+	updates = append(updates, "id = $"+strconv.Itoa(argPos)+" AND organization_id = $"+strconv.Itoa(argPos+1))
+	args = append(args, id, organizationID(r))
 
 	query := "UPDATE work_orders SET " + strings.Join(updates[:len(updates)-1], ", ") + " WHERE " + updates[len(updates)-1]
 
-	_, err = h.db.Exec(query, args...)
+	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to update work order", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Work order not found", http.StatusNotFound)
+		return
+	}
 
 	// Return updated work order
 	h.GetWorkOrderByID(w, r, id)
@@ -624,11 +747,15 @@ func (h *WorkOrdersHandler) DeleteWorkOrder(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	_, err = h.db.Exec("DELETE FROM work_orders WHERE id = $1", id)
+	result, err := h.db.Exec("DELETE FROM work_orders WHERE id = $1 AND organization_id = $2", id, organizationID(r))
 	if err != nil {
 		http.Error(w, "Failed to delete work order", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Work order not found", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
@@ -639,7 +766,7 @@ func (h *WorkOrdersHandler) GetWorkOrderByID(w http.ResponseWriter, r *http.Requ
 	var wo WorkOrder
 	var requirementsJSON []byte
 	var description, notes, lastUpdatedBy, completedDate, createdAt, updatedAt, fieldName sql.NullString
-	var fieldID, actualHours sql.NullInt64
+	var fieldID, actualHours, assigneeUserID, createdByUserID, lastUpdatedByUserID sql.NullInt64
 
 	err := h.db.QueryRow(`
 		SELECT 
@@ -647,19 +774,25 @@ func (h *WorkOrdersHandler) GetWorkOrderByID(w http.ResponseWriter, r *http.Requ
 			wo.assignee, wo.field_id, wo.start_date, wo.end_date, wo.progress,
 			wo.description, wo.requirements, wo.actual_hours, wo.notes,
 			wo.created_by, wo.last_updated_by, wo.completed_date,
+			wo.assignee_user_id, wo.created_by_user_id, wo.last_updated_by_user_id,
 			wo.created_at, wo.updated_at,
 			f.name as field_name
 		FROM work_orders wo
 		LEFT JOIN fields f ON wo.field_id = f.id
-		WHERE wo.id = $1
-	`, id).Scan(
+		WHERE wo.id = $1 AND wo.organization_id = $2
+	`, id, organizationID(r)).Scan(
 		&wo.ID, &wo.Title, &wo.Category, &wo.Activity, &wo.Status, &wo.Priority,
 		&wo.Assignee, &fieldID, &wo.StartDate, &wo.EndDate, &wo.Progress,
 		&description, &requirementsJSON, &actualHours, &notes,
 		&wo.CreatedBy, &lastUpdatedBy, &completedDate,
+		&assigneeUserID, &createdByUserID, &lastUpdatedByUserID,
 		&createdAt, &updatedAt, &fieldName,
 	)
 
+	if err == sql.ErrNoRows {
+		http.Error(w, "Work order not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to retrieve work order", http.StatusInternalServerError)
 		return
@@ -681,6 +814,9 @@ func (h *WorkOrdersHandler) GetWorkOrderByID(w http.ResponseWriter, r *http.Requ
 	if lastUpdatedBy.Valid {
 		wo.LastUpdatedBy = &lastUpdatedBy.String
 	}
+	wo.AssigneeID = nullableUserID(assigneeUserID)
+	wo.CreatedByID = nullableUserID(createdByUserID)
+	wo.LastUpdatedByID = nullableUserID(lastUpdatedByUserID)
 	if completedDate.Valid {
 		wo.CompletedDate = &completedDate.String
 	}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// level is shared by every logger built here, so SetLevel takes effect at once
+var level slog.LevelVar
+
+// base is the process logger; requests log through FromContext instead
+var base = slog.Default()
+
+// New builds the JSON logger, makes it the slog and standard log default and
+// sets the initial level, one of debug, info, warn or error
+func New(w io.Writer, initialLevel string) (*slog.Logger, error) {
+	if err := SetLevel(initialLevel); err != nil {
+		return nil, err
+	}
+
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       &level,
+		ReplaceAttr: redactAttr,
+	})
+	base = slog.New(handler)
+	// Also routes the standard log package through base, at info
+	slog.SetDefault(base)
+	return base, nil
+}
+
+// Level returns the current level name
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// SetLevel changes the level of every logger at runtime
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level %q, use debug, info, warn or error", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// ValidLevel reports whether name is a level SetLevel accepts
+func ValidLevel(name string) bool {
+	var l slog.Level
+	return l.UnmarshalText([]byte(name)) == nil
+}
+
+type loggerKey struct{}
+
+// FromContext returns the request's logger, which adds the request ID, route
+// and user ID to every line, or the process logger outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return base
+}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is read from incoming requests and echoed in responses
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits propagated IDs to something safe to log and echo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestInfo is shared by the request's logger and the access log line, so
+// the user ID set after authentication shows up in both
+type requestInfo struct {
+	id     string
+	route  string
+	userID atomic.Int64
+}
+
+type requestInfoKey struct{}
+
+// SetUserID attaches the authenticated user to the request's log lines
+func SetUserID(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userID.Store(int64(userID))
+	}
+}
+
+// RequestID returns the request's ID, or "" outside a request
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// Middleware assigns or propagates X-Request-ID, injects a request logger
+// into the context and writes one access log line per request. Install it
+// with Router.Use so the route template is known.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &requestInfo{id: id, route: "unknown"}
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				info.route = tmpl
+			}
+		}
+		logger := slog.New(&requestHandler{Handler: base.Handler(), info: info})
+
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		ctx = WithLogger(ctx, logger)
+
+		start := time.Now()
+		rec := &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		lvl := slog.LevelInfo
+		if rec.Status >= 500 {
+			lvl = slog.LevelError
+		}
+		logger.LogAttrs(ctx, lvl, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status),
+			slog.Int64("bytes", rec.Bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestHandler adds the request's attributes to every record
+type requestHandler struct {
+	slog.Handler
+	info *requestInfo
+}
+
+func (h *requestHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.String("request_id", h.info.id), slog.String("route", h.info.route))
+	if userID := h.info.userID.Load(); userID != 0 {
+		r.AddAttrs(slog.Int64("user_id", userID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithAttrs(attrs), info: h.info}
+}
+
+func (h *requestHandler) WithGroup(name string) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithGroup(name), info: h.info}
+}
+
+// StatusRecorder captures the status code and body size of a response and
+// still lets WebSocket upgrades hijack the connection
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int64
+	wroteHeader bool
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += int64(n)
+	return n, err
+}
+
+func (r *StatusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	r.Status = http.StatusSwitchingProtocols
+	r.wroteHeader = true
+	return h.Hijack()
+}
+
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// redacted replaces values that must never reach the logs
+const redacted = "[redacted]"
+
+// sensitiveKeys are matched against attribute keys, lower-cased, as substrings
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"authorization",
+	"cookie",
+	"api_key",
+	"recovery_code",
+	"provisioning_uri",
+	"selfie",
+	"camera_image",
+}
+
+// maxValueLength caps string values; anything longer is almost always an
+// encoded image or file rather than something worth reading in a log
+const maxValueLength = 2048
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	if a.Value.Kind() == slog.KindString {
+		value := a.Value.String()
+		if strings.HasPrefix(value, "data:") && strings.Contains(value, ";base64,") {
+			return slog.String(a.Key, redacted)
+		}
+		if len(value) > maxValueLength {
+			return slog.String(a.Key, value[:maxValueLength]+"...[truncated]")
+		}
+	}
+	return a
+}
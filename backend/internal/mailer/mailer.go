@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agrione/backend/internal/config"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected by MAIL_DRIVER: "smtp", or "log" (the
+// default) which writes messages to the log or to MAIL_LOG_FILE.
+func New(cfg *config.Config) Mailer {
+	switch cfg.MailDriver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     strconv.Itoa(cfg.SMTPPort),
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	default:
+		return &LogMailer{Path: cfg.MailLogFile}
+	}
+}
+
+// SMTPMailer sends mail through an SMTP server using PLAIN auth when a
+// username is set
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.Host == "" {
+		return fmt.Errorf("smtp mailer: SMTP_HOST is not set")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	body := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{msg.To}, []byte(body))
+}
+
+// LogMailer writes messages to a file, or to the application log when Path
+// is empty. Meant for local development.
+type LogMailer struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	entry := fmt.Sprintf("=== %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+
+	if m.Path == "" {
+		slog.Info("Mail (log driver)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry)
+	return err
+}
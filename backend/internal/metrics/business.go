@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// businessGauge is a per-organization count queried at scrape time. The query
+// returns (organization_id, count) rows.
+type businessGauge struct {
+	desc  *prometheus.Desc
+	query string
+}
+
+// businessCollector reads the business gauges from the database on every
+// scrape, so they are never stale and cost nothing between scrapes
+type businessCollector struct {
+	db     *sql.DB
+	gauges []businessGauge
+}
+
+func newBusinessCollector(db *sql.DB) *businessCollector {
+	gauge := func(name, help, query string) businessGauge {
+		return businessGauge{
+			desc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{"organization_id"}, nil),
+			query: query,
+		}
+	}
+
+	return &businessCollector{
+		db: db,
+		gauges: []businessGauge{
+			gauge("pending_field_reports", "Field reports waiting for review.", `
+				SELECT organization_id, COUNT(*) FROM field_reports
+				WHERE status = 'pending'
+				GROUP BY organization_id
+			`),
+			gauge("pending_stock_requests", "Stock requests waiting for approval.", `
+				SELECT organization_id, COUNT(*) FROM stock_requests
+				WHERE status = 'pending'
+				GROUP BY organization_id
+			`),
+			// Same definition as the inventory dashboard's low stock count
+			gauge("low_stock_items", "Active inventory items at or below their reorder point.", `
+				SELECT organization_id, COUNT(*) FROM (
+					SELECT i.organization_id
+					FROM inventory_items i
+					LEFT JOIN stock_lots sl ON i.id = sl.item_id AND sl.status = 'available'
+					WHERE i.status = 'active'
+					GROUP BY i.id, i.organization_id, i.reorder_point
+					HAVING COALESCE(SUM(sl.quantity), 0) <= i.reorder_point
+				) low
+				GROUP BY organization_id
+			`),
+		},
+	}
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, g := range c.gauges {
+		ch <- g.desc
+	}
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, g := range c.gauges {
+		if err := c.collect(ctx, g, ch); err != nil {
+			// Leave the gauge out rather than fail the whole scrape
+			slog.Error("Failed to collect business gauge", "gauge", g.desc.String(), "error", err)
+		}
+	}
+}
+
+func (c *businessCollector) collect(ctx context.Context, g businessGauge, ch chan<- prometheus.Metric) error {
+	rows, err := c.db.QueryContext(ctx, g.query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orgID int
+		var count float64
+		if err := rows.Scan(&orgID, &count); err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, count, strconv.Itoa(orgID))
+	}
+	return rows.Err()
+}
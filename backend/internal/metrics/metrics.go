@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"agrione/backend/internal/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "agrione"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, mux route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, mux route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// NotificationFailures counts notifications that could not be stored
+	// ("store") or pushed to a connected client ("deliver")
+	NotificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_failures_total",
+		Help:      "Notifications that failed to be stored or delivered.",
+	}, []string{"stage"})
+
+	// WebSocketDropped counts messages dropped because a client's send buffer
+	// was full, by the hub path that dropped them ("send_to_user", "broadcast")
+	WebSocketDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_dropped_messages_total",
+		Help:      "WebSocket messages dropped because the client could not keep up.",
+	}, []string{"path"})
+)
+
+// Middleware records request count and latency. It must be installed with
+// Router.Use so that the matched route's path template is known; requests
+// that match no route never reach it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		start := time.Now()
+		rec := &logging.StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(rec.Status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterDB exports the connection pool statistics of db and the business
+// gauges read from it
+func RegisterDB(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	prometheus.MustRegister(newBusinessCollector(db))
+}
+
+// RegisterHub exports the number of connected WebSocket clients and of
+// distinct users they belong to, as reported by stats at scrape time
+func RegisterHub(stats func() (clients, users int)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_clients",
+		Help:      "Connected WebSocket clients.",
+	}, func() float64 {
+		clients, _ := stats()
+		return float64(clients)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_users",
+		Help:      "Distinct users with at least one connected WebSocket client.",
+	}, func() float64 {
+		_, users := stats()
+		return float64(users)
+	})
+}
+
+// Handler serves the metrics. When token is set, scrapers must send it as a
+// bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.Handler()
+	if token == "" {
+		return handler
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
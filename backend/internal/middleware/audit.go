@@ -0,0 +1,370 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"agrione/backend/internal/logging"
+
+	"github.com/gorilla/mux"
+)
+
+// auditLockClass is the first advisory lock key held while appending to an
+// organization's audit chain; the second key is the organization ID
+const auditLockClass = 0x61756474
+
+// auditMaxBody is the largest response body recorded as an entry's after state
+const auditMaxBody = 64 << 10
+
+// AuditEntity describes how to snapshot the row a route acts on. Snapshot is
+// run with the entity ID and the active organization ID and returns one JSON
+// value, or no row when the entity does not exist in the organization.
+type AuditEntity struct {
+	Type     string
+	Snapshot string
+}
+
+// AuditEntities maps the collection part of a route template (up to its
+// first path variable) to the entity the route acts on
+var AuditEntities = map[string]AuditEntity{
+	"/api/fields":                         orgTableEntity("fields"),
+	"/api/plots":                          orgTableEntity("plots"),
+	"/api/plant-types":                    orgTableEntity("plant_types"),
+	"/api/work-orders":                    orgTableEntity("work_orders"),
+	"/api/cultivation-seasons":            orgTableEntity("cultivation_seasons"),
+	"/api/field-reports":                  orgTableEntity("field_reports", "media"),
+	"/api/attendance":                     orgTableEntity("attendance", "selfie_image", "back_camera_image"),
+	"/api/inventory/items":                orgTableEntity("inventory_items"),
+	"/api/inventory/stock-lots":           orgTableEntity("stock_lots"),
+	"/api/inventory/stock-requests":       orgTableEntity("stock_requests"),
+	"/api/inventory/transfers":            orgTableEntity("stock_transfers"),
+	"/api/inventory/counts":               orgTableEntity("stock_counts"),
+	"/api/inventory/suppliers":            orgTableEntity("suppliers"),
+	"/api/inventory/purchase-orders":      orgTableEntity("purchase_orders"),
+	"/api/inventory/purchase-suggestions": orgTableEntity("purchase_suggestions"),
+	"/api/users":                          memberEntity,
+	"/api/organizations/members":          memberEntity,
+	"/api/service-accounts": {
+		Type: "service_accounts",
+		Snapshot: `
+			SELECT json_build_object(
+				'id', u.id, 'name', u.first_name, 'username', u.username, 'status', u.status,
+				'keys', (SELECT COALESCE(json_agg(json_build_object(
+					'id', k.id, 'name', k.name, 'prefix', k.prefix, 'scopes', k.scopes,
+					'expires_at', k.expires_at, 'revoked_at', k.revoked_at
+				) ORDER BY k.id), '[]'::json) FROM api_keys k WHERE k.user_id = u.id)
+			)
+			FROM users u
+			JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $2
+			WHERE u.id = $1 AND u.account_type = 'service'
+		`,
+	},
+}
+
+// memberEntity snapshots a user as a member of the organization, leaving out
+// credentials and other account secrets
+var memberEntity = AuditEntity{
+	Type: "users",
+	Snapshot: `
+		SELECT json_build_object(
+			'id', u.id, 'email', u.email, 'username', u.username,
+			'first_name', u.first_name, 'last_name', u.last_name,
+			'role', om.role, 'status', u.status
+		)
+		FROM users u
+		JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $2
+		WHERE u.id = $1
+	`,
+}
+
+// orgTableEntity snapshots a whole row of an organization's table. The
+// hashed columns hold base64 photos and other uploads, which would bloat the
+// audit log, so only their SHA-256 is recorded; that still shows whether
+// they changed.
+func orgTableEntity(table string, hashed ...string) AuditEntity {
+	row := "row_to_json(t)"
+	if len(hashed) > 0 {
+		pairs := make([]string, 0, len(hashed))
+		for _, column := range hashed {
+			pairs = append(pairs, fmt.Sprintf("'%s', 'sha256:' || encode(sha256(convert_to(t.%s::text, 'UTF8')), 'hex')", column, column))
+		}
+		row = "to_jsonb(t) || jsonb_build_object(" + strings.Join(pairs, ", ") + ")"
+	}
+	return AuditEntity{
+		Type:     table,
+		Snapshot: "SELECT " + row + " FROM " + table + " t WHERE t.id = $1 AND t.organization_id = $2",
+	}
+}
+
+// auditRedactedKeys are never recorded from response bodies
+var auditRedactedKeys = map[string]bool{
+	"token":            true,
+	"refresh_token":    true,
+	"key":              true,
+	"secret":           true,
+	"provisioning_uri": true,
+	"recovery_codes":   true,
+	"password":         true,
+	"csrf_token":       true,
+}
+
+// AuditRecord is one audit log entry. Entries of an organization form a hash
+// chain: each Hash covers the entry's fields and the PrevHash of the entry
+// before it, so editing or removing an entry breaks every later hash.
+type AuditRecord struct {
+	OrganizationID *int
+	ActorUserID    *int
+	APIKeyID       *int
+	Action         string
+	EntityType     string
+	EntityID       *string
+	Before         json.RawMessage
+	After          json.RawMessage
+	IPAddress      string
+	UserAgent      string
+	StatusCode     int
+	CreatedAt      time.Time
+	PrevHash       string
+}
+
+// Hash returns the SHA-256 hex digest chaining the record to PrevHash
+func (a AuditRecord) Hash() string {
+	data, _ := json.Marshal(struct {
+		PrevHash       string          `json:"prev_hash"`
+		OrganizationID *int            `json:"organization_id"`
+		ActorUserID    *int            `json:"actor_user_id"`
+		APIKeyID       *int            `json:"api_key_id"`
+		Action         string          `json:"action"`
+		EntityType     string          `json:"entity_type"`
+		EntityID       *string         `json:"entity_id"`
+		Before         json.RawMessage `json:"before"`
+		After          json.RawMessage `json:"after"`
+		IPAddress      string          `json:"ip_address"`
+		UserAgent      string          `json:"user_agent"`
+		StatusCode     int             `json:"status_code"`
+		CreatedAt      string          `json:"created_at"`
+	}{
+		a.PrevHash, a.OrganizationID, a.ActorUserID, a.APIKeyID, a.Action, a.EntityType, a.EntityID,
+		a.Before, a.After, a.IPAddress, a.UserAgent, a.StatusCode, a.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAudit adds a record to the end of its organization's chain
+func AppendAudit(db *sql.DB, record AuditRecord) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	orgKey := 0
+	if record.OrganizationID != nil {
+		orgKey = *record.OrganizationID
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, $2)", auditLockClass, orgKey); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		SELECT hash FROM audit_log WHERE organization_id IS NOT DISTINCT FROM $1 ORDER BY id DESC LIMIT 1
+	`, record.OrganizationID).Scan(&record.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	record.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	_, err = tx.Exec(`
+		INSERT INTO audit_log (organization_id, actor_user_id, api_key_id, action, entity_type, entity_id,
+		                       before_data, after_data, ip_address, user_agent, status_code, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, record.OrganizationID, record.ActorUserID, record.APIKeyID, record.Action, record.EntityType, record.EntityID,
+		nullableJSON(record.Before), nullableJSON(record.After), record.IPAddress, record.UserAgent, record.StatusCode,
+		record.CreatedAt, record.PrevHash, record.Hash())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func nullableJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+// auditResponseWriter keeps the status and the start of the body written
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.body.Len() <= auditMaxBody {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// AuditMiddleware records every POST, PUT, PATCH and DELETE request in the
+// audit log once the handler has run, including requests that were refused.
+// It must run after AuthMiddleware, which identifies the actor.
+func AuditMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			pathTemplate := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					pathTemplate = tmpl
+				}
+			}
+			collection, _, _ := strings.Cut(pathTemplate, "/{")
+			entity, known := AuditEntities[collection]
+			if !known {
+				entity = AuditEntity{Type: auditEntityType(collection)}
+			}
+
+			record := AuditRecord{
+				Action:     r.Method + " " + pathTemplate,
+				EntityType: entity.Type,
+				IPAddress:  ClientIP(r),
+				UserAgent:  r.UserAgent(),
+			}
+			if userID, ok := r.Context().Value(UserIDKey).(int); ok {
+				record.ActorUserID = &userID
+			}
+			if keyID, ok := r.Context().Value(APIKeyIDKey).(int); ok {
+				record.APIKeyID = &keyID
+			}
+			orgID, _ := r.Context().Value(OrganizationIDKey).(int)
+			if orgID != 0 {
+				record.OrganizationID = &orgID
+			}
+
+			vars := mux.Vars(r)
+			entityID := vars["id"]
+			if entityID == "" {
+				entityID = vars["userId"]
+			}
+			if entityID != "" && entity.Snapshot != "" {
+				record.Before = auditSnapshot(r.Context(), db, entity.Snapshot, entityID, orgID)
+			}
+
+			rec := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			record.StatusCode = rec.status
+
+			response := auditResponseBody(rec.body.Bytes())
+			if entityID == "" && rec.status < 400 {
+				entityID = auditResponseID(response)
+			}
+			if entityID != "" {
+				record.EntityID = &entityID
+			}
+			if entityID != "" && entity.Snapshot != "" && rec.status < 400 {
+				record.After = auditSnapshot(r.Context(), db, entity.Snapshot, entityID, orgID)
+			} else if entity.Snapshot == "" || entityID == "" {
+				record.After = response
+			}
+
+			if err := AppendAudit(db, record); err != nil {
+				logging.FromContext(r.Context()).Error("Failed to write audit log", "action", record.Action, "error", err)
+			}
+		})
+	}
+}
+
+// auditEntityType names the entity of a route with no AuditEntities entry
+// after its path, e.g. "/api/inventory/stock-lots/remove" is
+// "inventory_stock_lots_remove"
+func auditEntityType(collection string) string {
+	return strings.NewReplacer("/", "_", "-", "_").Replace(strings.TrimPrefix(collection, "/api/"))
+}
+
+func auditSnapshot(ctx context.Context, db *sql.DB, query, id string, orgID int) json.RawMessage {
+	var data []byte
+	if err := db.QueryRow(query, id, orgID).Scan(&data); err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("Failed to snapshot audit entity", "entity_id", id, "error", err)
+		}
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
+// auditResponseBody returns a JSON response body with secrets redacted, or
+// nil when the body is not JSON or too large to record
+func auditResponseBody(body []byte) json.RawMessage {
+	if len(body) == 0 || len(body) > auditMaxBody {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+	data, err := json.Marshal(redactAudit(value))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func redactAudit(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if auditRedactedKeys[key] {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redactAudit(inner)
+			}
+		}
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactAudit(inner)
+		}
+	}
+	return value
+}
+
+// auditResponseID returns the "id" of a created entity from its response
+func auditResponseID(body json.RawMessage) string {
+	var created struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &created) != nil || len(created.ID) == 0 {
+		return ""
+	}
+	var id string
+	if json.Unmarshal(created.ID, &id) == nil {
+		return id
+	}
+	var number json.Number
+	if json.Unmarshal(created.ID, &number) == nil {
+		return number.String()
+	}
+	return ""
+}
@@ -2,21 +2,221 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
 
 	"agrione/backend/internal/config"
+	"agrione/backend/internal/logging"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "userID"
 
-func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+// SessionIDKey holds the auth session the access token was issued for
+const SessionIDKey contextKey = "sessionID"
+
+// OrganizationIDKey holds the active organization carried in the access token
+// (0 when the user belongs to none)
+const OrganizationIDKey contextKey = "organizationID"
+
+// APIKeyIDKey and APIKeyScopesKey are set for requests made with an API key
+const (
+	APIKeyIDKey     contextKey = "apiKeyID"
+	APIKeyScopesKey contextKey = "apiKeyScopes"
+)
+
+// AccessTokenType is the "typ" claim of access tokens
+const AccessTokenType = "access"
+
+// APIKeyPrefix starts every API key, so that keys are told apart from JWTs
+// and are easy to spot in leaked text. A key is APIKeyPrefix, the public
+// key prefix stored in api_keys.prefix, an underscore and the secret.
+const APIKeyPrefix = "agk_"
+
+// APIKeyHeader may carry an API key instead of the Authorization header
+const APIKeyHeader = "X-API-Key"
+
+// AccessClaims is the identity carried by a validated access token
+type AccessClaims struct {
+	UserID         int
+	SessionID      string
+	OrganizationID int
+}
+
+// APIKeyClaims is the identity carried by a validated API key
+type APIKeyClaims struct {
+	KeyID          int
+	UserID         int // the service account
+	OrganizationID int
+	Scopes         []string
+}
+
+var (
+	ErrInvalidToken   = errors.New("invalid or expired token")
+	ErrTokenRevoked   = errors.New("token has been revoked")
+	ErrAPIKeyInactive = errors.New("API key has been revoked or has expired")
+)
+
+// HashAPIKey returns the SHA-256 hex digest stored instead of the raw key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateAPIKey looks a key up by its prefix, compares its hash and checks
+// that neither the key nor its service account has been revoked or expired.
+// The key acts in the organization it was created in, and only while its
+// service account is still a member there. Last use is recorded at most once
+// a minute.
+func ValidateAPIKey(db *sql.DB, key string) (APIKeyClaims, error) {
+	var result APIKeyClaims
+
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !strings.HasPrefix(key, APIKeyPrefix) || !ok || prefix == "" {
+		return result, ErrInvalidToken
+	}
+
+	var keyHash string
+	var scopes pq.StringArray
+	var active bool
+	err := db.QueryRow(`
+		SELECT k.id, k.key_hash, k.user_id, k.scopes, k.organization_id,
+		       k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP) AND u.status = 'approved'
+		       AND om.user_id IS NOT NULL
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		LEFT JOIN organization_members om ON om.user_id = k.user_id AND om.organization_id = k.organization_id
+		WHERE k.prefix = $1
+	`, prefix).Scan(&result.KeyID, &keyHash, &result.UserID, &scopes, &result.OrganizationID, &active)
+	if err == sql.ErrNoRows {
+		return result, ErrInvalidToken
+	}
+	if err != nil {
+		return result, err
+	}
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(HashAPIKey(key))) != 1 {
+		return result, ErrInvalidToken
+	}
+	if !active {
+		return result, ErrAPIKeyInactive
+	}
+
+	_, err = db.Exec(`
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`, result.KeyID)
+	if err != nil {
+		return result, err
+	}
+
+	result.Scopes = []string(scopes)
+	return result, nil
+}
+
+// RequestAPIKey returns the API key a request carries, if any, either in
+// APIKeyHeader or as an Authorization bearer token
+func RequestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && strings.HasPrefix(token, APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// ValidateAccessToken verifies an access token's signature, expiry and type
+// and checks its session against the revocation list (revoked or expired
+// rows in auth_sessions). A token is also rejected once its session has
+// switched to another organization.
+func ValidateAccessToken(cfg *config.Config, db *sql.DB, tokenString string) (AccessClaims, error) {
+	var result AccessClaims
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(cfg.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return result, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return result, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID == 0 {
+		return result, ErrInvalidToken
+	}
+	// Tokens issued before sessions existed carry no session and are rejected
+	sessionID, _ := claims["sid"].(string)
+	tokenType, _ := claims["typ"].(string)
+	if sessionID == "" || tokenType != AccessTokenType {
+		return result, ErrInvalidToken
+	}
+	organizationID, _ := claims["org_id"].(float64)
+
+	var active bool
+	err = db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM auth_sessions
+			WHERE session_id = $1 AND user_id = $2
+			  AND COALESCE(organization_id, 0) = $3
+			  AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		)
+	`, sessionID, int(userID), int(organizationID)).Scan(&active)
+	if err != nil {
+		return result, err
+	}
+	if !active {
+		return result, ErrTokenRevoked
+	}
+
+	result.UserID = int(userID)
+	result.SessionID = sessionID
+	result.OrganizationID = int(organizationID)
+	return result, nil
+}
+
+func AuthMiddleware(cfg *config.Config, db *sql.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := RequestAPIKey(r); apiKey != "" {
+				key, err := ValidateAPIKey(db, apiKey)
+				if err == ErrAPIKeyInactive {
+					http.Error(w, "API key has been revoked or has expired", http.StatusUnauthorized)
+					return
+				}
+				if err == ErrInvalidToken {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					http.Error(w, "Database error", http.StatusInternalServerError)
+					return
+				}
+
+				logging.SetUserID(r.Context(), key.UserID)
+				ctx := context.WithValue(r.Context(), UserIDKey, key.UserID)
+				ctx = context.WithValue(ctx, OrganizationIDKey, key.OrganizationID)
+				ctx = context.WithValue(ctx, APIKeyIDKey, key.KeyID)
+				ctx = context.WithValue(ctx, APIKeyScopesKey, key.Scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
 				http.Error(w, "Authorization header required", http.StatusUnauthorized)
@@ -29,38 +229,25 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 				return
 			}
 
-			tokenString := parts[1]
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
-				}
-				return []byte(cfg.JWTSecret), nil
-			})
-
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			claims, err := ValidateAccessToken(cfg, db, parts[1])
+			if err == ErrTokenRevoked {
+				http.Error(w, "Session has been revoked", http.StatusUnauthorized)
 				return
 			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			if err == ErrInvalidToken {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 				return
 			}
-
-			userID, ok := claims["user_id"].(float64)
-			if !ok {
-				http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, int(userID))
+			logging.SetUserID(r.Context(), claims.UserID)
+			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, OrganizationIDKey, claims.OrganizationID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
-
-
-
-
-
@@ -0,0 +1,547 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles stored in users.role
+const (
+	RoleSuperadmin = "superadmin"
+	RoleLevel1     = "Level 1"
+	RoleLevel2     = "Level 2"
+	RoleLevel3     = "Level 3"
+	RoleLevel4     = "Level 4"
+	RoleWarehouse  = "warehouse"
+	RoleUser       = "user"
+	// RoleService is the member role of service accounts; what they may do
+	// comes from the scopes of the API key they call with
+	RoleService = "service"
+)
+
+const UserRoleKey contextKey = "userRole"
+
+// Permission is a named capability that a role may hold
+type Permission string
+
+const (
+	PermUsersRead             Permission = "users:read"
+	PermUsersManage           Permission = "users:manage"
+	PermFieldsWrite           Permission = "fields:write"
+	PermFieldsDelete          Permission = "fields:delete"
+	PermPlotsWrite            Permission = "plots:write"
+	PermPlantTypesWrite       Permission = "plant_types:write"
+	PermWorkOrdersWrite       Permission = "work_orders:write"
+	PermSeasonsWrite          Permission = "cultivation_seasons:write"
+	PermFieldReportsWrite     Permission = "field_reports:write"
+	PermFieldReportsReview    Permission = "field_reports:review"
+	PermInventoryWrite        Permission = "inventory:write"
+	PermInventoryExport       Permission = "inventory:export"
+	PermStockRequestsCreate   Permission = "stock_requests:create"
+	PermStockRequestsApprove  Permission = "stock_requests:approve"
+	PermStockRequestsFulfill  Permission = "stock_requests:fulfill"
+	PermStockCountsApprove    Permission = "stock_counts:approve"
+	PermAttendanceWrite       Permission = "attendance:write"
+	PermAttendanceReview      Permission = "attendance:review"
+	PermOrganizationsManage   Permission = "organizations:manage"
+	PermServiceAccountsManage Permission = "service_accounts:manage"
+	PermAuditRead             Permission = "audit:read"
+	// PermSignupsReview covers the review of signups, which belong to no
+	// organization yet; no role holds it, so only a superadmin may use it
+	PermSignupsReview Permission = "signups:review"
+	// PermSystemManage covers server settings; no role holds it, so only a
+	// superadmin may use it
+	PermSystemManage Permission = "system:manage"
+	// PermAuthenticated marks routes open to every authenticated, approved
+	// member, such as their own profile and notifications
+	PermAuthenticated Permission = "authenticated"
+
+	// Read permissions are only checked for API keys; every user role may read
+	PermFieldsRead       Permission = "fields:read"
+	PermPlotsRead        Permission = "plots:read"
+	PermPlantTypesRead   Permission = "plant_types:read"
+	PermWorkOrdersRead   Permission = "work_orders:read"
+	PermSeasonsRead      Permission = "cultivation_seasons:read"
+	PermFieldReportsRead Permission = "field_reports:read"
+	PermInventoryRead    Permission = "inventory:read"
+	PermAttendanceRead   Permission = "attendance:read"
+)
+
+// RolePermissions is the permission matrix for every role except superadmin,
+// which is always allowed.
+var RolePermissions = map[string][]Permission{
+	RoleLevel1: {
+		PermUsersRead, PermUsersManage, PermServiceAccountsManage, PermAuditRead,
+		PermFieldsWrite, PermFieldsDelete, PermPlotsWrite, PermPlantTypesWrite,
+		PermWorkOrdersWrite, PermSeasonsWrite,
+		PermFieldReportsWrite, PermFieldReportsReview,
+		PermInventoryWrite, PermStockRequestsCreate, PermStockRequestsApprove, PermStockRequestsFulfill,
+		PermStockCountsApprove, PermInventoryExport,
+		PermAttendanceWrite, PermAttendanceReview,
+	},
+	RoleLevel2: {
+		PermUsersRead,
+		PermFieldsWrite, PermPlotsWrite, PermPlantTypesWrite,
+		PermWorkOrdersWrite, PermSeasonsWrite,
+		PermFieldReportsWrite, PermFieldReportsReview,
+		PermInventoryWrite, PermStockRequestsCreate, PermStockRequestsApprove, PermStockRequestsFulfill,
+		PermStockCountsApprove, PermInventoryExport,
+		PermAttendanceWrite, PermAttendanceReview,
+	},
+	RoleLevel3: {
+		PermFieldReportsWrite,
+		PermAttendanceWrite,
+	},
+	RoleLevel4: {
+		PermFieldReportsWrite,
+		PermAttendanceWrite,
+	},
+	RoleWarehouse: {
+		PermInventoryWrite, PermStockRequestsCreate, PermStockRequestsFulfill, PermInventoryExport,
+		PermAttendanceWrite,
+	},
+	RoleUser: {},
+}
+
+// MFARequiredRoles are the roles that must enrol in two-factor
+// authentication before they can use the API
+var MFARequiredRoles = map[string]bool{
+	RoleLevel1: true,
+	RoleLevel2: true,
+}
+
+// MFAEnrollmentRoutes stay reachable for users whose role requires
+// two-factor authentication but who have not enrolled yet
+var MFAEnrollmentRoutes = map[string]bool{
+	"GET /api/profile":          true,
+	"GET /api/mfa":              true,
+	"POST /api/mfa/enroll":      true,
+	"POST /api/mfa/verify":      true,
+	"GET /api/sessions":         true,
+	"POST /api/logout":          true,
+	"POST /api/logout/all":      true,
+	"PUT /api/profile/password": true,
+}
+
+// OrganizationOptionalRoutes are reachable without an active organization,
+// so that a user who belongs to none can still see their account
+var OrganizationOptionalRoutes = map[string]bool{
+	"GET /api/profile":                 true,
+	"GET /api/mfa":                     true,
+	"POST /api/mfa/enroll":             true,
+	"POST /api/mfa/verify":             true,
+	"POST /api/mfa/recovery-codes":     true,
+	"POST /api/mfa/disable":            true,
+	"GET /api/sessions":                true,
+	"POST /api/logout":                 true,
+	"POST /api/logout/all":             true,
+	"PUT /api/profile/password":        true,
+	"GET /api/organizations":           true,
+	"POST /api/organizations/switch":   true,
+	"GET /api/notifications":           true,
+	"PUT /api/notifications/{id}/read": true,
+	"PUT /api/notifications/read-all":  true,
+}
+
+// MFARequired reports whether role must use two-factor authentication
+func MFARequired(role string) bool {
+	return MFARequiredRoles[role]
+}
+
+// FieldScopedRoles only see the fields assigned to them and the work
+// orders, reports, seasons and stock requests under those fields. Every
+// other role keeps the organization-wide view.
+var FieldScopedRoles = map[string]bool{
+	RoleLevel3: true,
+	RoleLevel4: true,
+}
+
+// FieldScoped reports whether role is restricted to its assigned fields
+func FieldScoped(role string) bool {
+	return FieldScopedRoles[role]
+}
+
+// RoutePermissions maps "METHOD /path/template" (as registered on the mux
+// router) to the permission it requires. Every route behind
+// AuthorizationMiddleware must be listed; routes that are not are refused.
+var RoutePermissions = map[string]Permission{
+	"GET /api/profile":                 PermAuthenticated,
+	"PUT /api/profile/password":        PermAuthenticated,
+	"GET /api/sessions":                PermAuthenticated,
+	"POST /api/logout":                 PermAuthenticated,
+	"POST /api/logout/all":             PermAuthenticated,
+	"GET /api/mfa":                     PermAuthenticated,
+	"POST /api/mfa/enroll":             PermAuthenticated,
+	"POST /api/mfa/verify":             PermAuthenticated,
+	"POST /api/mfa/recovery-codes":     PermAuthenticated,
+	"POST /api/mfa/disable":            PermAuthenticated,
+	"GET /api/organizations":           PermAuthenticated,
+	"POST /api/organizations/switch":   PermAuthenticated,
+	"GET /api/notifications":           PermAuthenticated,
+	"PUT /api/notifications/{id}/read": PermAuthenticated,
+	"PUT /api/notifications/read-all":  PermAuthenticated,
+
+	"GET /api/users":                 PermUsersRead,
+	"PUT /api/users/{id}/role":       PermUsersManage,
+	"PUT /api/users/{id}/status":     PermUsersManage,
+	"GET /api/users/pending":         PermSignupsReview,
+	"POST /api/users/{id}/approve":   PermSignupsReview,
+	"POST /api/users/{id}/reject":    PermSignupsReview,
+	"POST /api/users/{id}/unlock":    PermUsersManage,
+	"POST /api/users/{id}/mfa/reset": PermUsersManage,
+	"GET /api/login-attempts":        PermUsersManage,
+
+	"POST /api/organizations":                    PermOrganizationsManage,
+	"GET /api/organizations/members":             PermUsersRead,
+	"PUT /api/organizations/members/{userId}":    PermUsersManage,
+	"DELETE /api/organizations/members/{userId}": PermUsersManage,
+
+	"GET /api/service-accounts":                           PermServiceAccountsManage,
+	"POST /api/service-accounts":                          PermServiceAccountsManage,
+	"POST /api/service-accounts/{id}/keys":                PermServiceAccountsManage,
+	"POST /api/service-accounts/{id}/keys/{keyId}/revoke": PermServiceAccountsManage,
+
+	"GET /api/audit":        PermAuditRead,
+	"GET /api/audit/verify": PermAuditRead,
+
+	"GET /api/admin/log-level": PermSystemManage,
+	"PUT /api/admin/log-level": PermSystemManage,
+
+	"GET /api/user-reference-issues":               PermUsersManage,
+	"POST /api/user-reference-issues/{id}/resolve": PermUsersManage,
+
+	"GET /api/fields":               PermAuthenticated,
+	"GET /api/fields/{id}":          PermAuthenticated,
+	"POST /api/fields":              PermFieldsWrite,
+	"POST /api/fields/import-kmz":   PermFieldsWrite,
+	"POST /api/fields/batch-create": PermFieldsWrite,
+	"PUT /api/fields/{id}":          PermFieldsWrite,
+	"PUT /api/fields/{id}/assign":   PermFieldsWrite,
+	"DELETE /api/fields/{id}":       PermFieldsDelete,
+
+	"GET /api/plots":         PermAuthenticated,
+	"GET /api/plots/{id}":    PermAuthenticated,
+	"POST /api/plots":        PermPlotsWrite,
+	"PUT /api/plots/{id}":    PermPlotsWrite,
+	"DELETE /api/plots/{id}": PermPlotsWrite,
+
+	"GET /api/plant-types":         PermAuthenticated,
+	"GET /api/plant-types/{id}":    PermAuthenticated,
+	"POST /api/plant-types":        PermPlantTypesWrite,
+	"PUT /api/plant-types/{id}":    PermPlantTypesWrite,
+	"DELETE /api/plant-types/{id}": PermPlantTypesWrite,
+
+	"GET /api/work-orders":         PermAuthenticated,
+	"GET /api/work-orders/{id}":    PermAuthenticated,
+	"POST /api/work-orders":        PermWorkOrdersWrite,
+	"PUT /api/work-orders/{id}":    PermWorkOrdersWrite,
+	"DELETE /api/work-orders/{id}": PermWorkOrdersWrite,
+
+	"GET /api/cultivation-seasons":         PermAuthenticated,
+	"GET /api/cultivation-seasons/{id}":    PermAuthenticated,
+	"POST /api/cultivation-seasons":        PermSeasonsWrite,
+	"PUT /api/cultivation-seasons/{id}":    PermSeasonsWrite,
+	"DELETE /api/cultivation-seasons/{id}": PermSeasonsWrite,
+
+	"GET /api/field-reports":                PermAuthenticated,
+	"GET /api/field-reports/{id}":           PermAuthenticated,
+	"POST /api/field-reports":               PermFieldReportsWrite,
+	"PUT /api/field-reports/{id}":           PermFieldReportsWrite,
+	"POST /api/field-reports/{id}/comments": PermFieldReportsWrite,
+	"DELETE /api/field-reports/{id}":        PermFieldReportsReview,
+	"POST /api/field-reports/{id}/approve":  PermFieldReportsReview,
+	"POST /api/field-reports/{id}/reject":   PermFieldReportsReview,
+
+	"GET /api/inventory/stats":                              PermAuthenticated,
+	"GET /api/inventory/items":                              PermAuthenticated,
+	"GET /api/inventory/items/{id}":                         PermAuthenticated,
+	"GET /api/inventory/items/{id}/costs":                   PermAuthenticated,
+	"GET /api/inventory/stock-lots":                         PermAuthenticated,
+	"GET /api/inventory/warehouses":                         PermAuthenticated,
+	"GET /api/inventory/stock-movements":                    PermAuthenticated,
+	"GET /api/inventory/expiring":                           PermAuthenticated,
+	"GET /api/inventory/replenishment":                      PermAuthenticated,
+	"GET /api/inventory/purchase-suggestions":               PermAuthenticated,
+	"GET /api/inventory/suppliers":                          PermAuthenticated,
+	"GET /api/inventory/suppliers/{id}":                     PermAuthenticated,
+	"GET /api/inventory/purchase-orders":                    PermAuthenticated,
+	"GET /api/inventory/purchase-orders/{id}":               PermAuthenticated,
+	"GET /api/inventory/stock-requests":                     PermAuthenticated,
+	"GET /api/inventory/stock-requests/{id}":                PermAuthenticated,
+	"GET /api/inventory/transfers":                          PermAuthenticated,
+	"GET /api/inventory/transfers/{id}":                     PermAuthenticated,
+	"GET /api/inventory/counts":                             PermAuthenticated,
+	"GET /api/inventory/counts/{id}":                        PermAuthenticated,
+	"POST /api/inventory/items":                             PermInventoryWrite,
+	"POST /api/inventory/items/{id}/revalue":                PermInventoryWrite,
+	"POST /api/inventory/replenishment/run":                 PermInventoryWrite,
+	"POST /api/inventory/purchase-suggestions/{id}/dismiss": PermInventoryWrite,
+	"GET /api/inventory/exports/valuation":                  PermInventoryExport,
+	"GET /api/inventory/exports/ledger":                     PermInventoryExport,
+	"POST /api/inventory/suppliers":                         PermInventoryWrite,
+	"PUT /api/inventory/suppliers/{id}":                     PermInventoryWrite,
+	"POST /api/inventory/purchase-orders":                   PermInventoryWrite,
+	"POST /api/inventory/purchase-orders/{id}/submit":       PermInventoryWrite,
+	"POST /api/inventory/purchase-orders/{id}/cancel":       PermInventoryWrite,
+	"POST /api/inventory/purchase-orders/{id}/receive":      PermInventoryWrite,
+	"PUT /api/inventory/items/{id}":                         PermInventoryWrite,
+	"DELETE /api/inventory/items/{id}":                      PermInventoryWrite,
+	"POST /api/inventory/stock-lots":                        PermInventoryWrite,
+	"POST /api/inventory/stock-lots/remove":                 PermInventoryWrite,
+	"POST /api/inventory/stock-requests":                    PermStockRequestsCreate,
+	"POST /api/inventory/stock-requests/{id}/approve":       PermStockRequestsApprove,
+	"POST /api/inventory/stock-requests/{id}/reject":        PermStockRequestsApprove,
+	"POST /api/inventory/stock-requests/{id}/cancel":        PermStockRequestsCreate,
+	"POST /api/inventory/stock-requests/{id}/fulfill":       PermStockRequestsFulfill,
+	"POST /api/inventory/transfers":                         PermInventoryWrite,
+	"POST /api/inventory/transfers/{id}/receive":            PermInventoryWrite,
+	"POST /api/inventory/counts":                            PermInventoryWrite,
+	"PUT /api/inventory/counts/{id}/lines":                  PermInventoryWrite,
+	"POST /api/inventory/counts/{id}/submit":                PermInventoryWrite,
+	"POST /api/inventory/counts/{id}/approve":               PermStockCountsApprove,
+	"POST /api/inventory/counts/{id}/reject":                PermStockCountsApprove,
+
+	"GET /api/attendance":       PermAuthenticated,
+	"GET /api/attendance/today": PermAuthenticated,
+	"GET /api/attendance/{id}":  PermAuthenticated,
+	"POST /api/attendance":      PermAttendanceWrite,
+	"GET /api/attendance/all":   PermAttendanceReview,
+	"GET /api/attendance/stats": PermAttendanceReview,
+}
+
+// ReadScopes is the scope an API key needs for the GET routes that
+// RoutePermissions opens to every member, keyed by the first path segment
+// after /api/
+var ReadScopes = map[string]Permission{
+	"fields":              PermFieldsRead,
+	"plots":               PermPlotsRead,
+	"plant-types":         PermPlantTypesRead,
+	"work-orders":         PermWorkOrdersRead,
+	"cultivation-seasons": PermSeasonsRead,
+	"field-reports":       PermFieldReportsRead,
+	"inventory":           PermInventoryRead,
+	"attendance":          PermAttendanceRead,
+}
+
+// APIKeyScopes are the scopes that may be granted to an API key. Account,
+// organization and service account management stay with human users.
+var APIKeyScopes = map[Permission]bool{
+	PermUsersRead:            true,
+	PermFieldsRead:           true,
+	PermFieldsWrite:          true,
+	PermFieldsDelete:         true,
+	PermPlotsRead:            true,
+	PermPlotsWrite:           true,
+	PermPlantTypesRead:       true,
+	PermPlantTypesWrite:      true,
+	PermWorkOrdersRead:       true,
+	PermWorkOrdersWrite:      true,
+	PermSeasonsRead:          true,
+	PermSeasonsWrite:         true,
+	PermFieldReportsRead:     true,
+	PermFieldReportsWrite:    true,
+	PermFieldReportsReview:   true,
+	PermInventoryRead:        true,
+	PermInventoryWrite:       true,
+	PermInventoryExport:      true,
+	PermStockRequestsCreate:  true,
+	PermStockRequestsApprove: true,
+	PermStockRequestsFulfill: true,
+	PermStockCountsApprove:   true,
+	PermAttendanceRead:       true,
+	PermAttendanceWrite:      true,
+	PermAttendanceReview:     true,
+}
+
+// RequiredScope returns the scope an API key needs to call a route, and
+// false if API keys may not call it at all
+func RequiredScope(method, pathTemplate string) (Permission, bool) {
+	perm, ok := RequiredPermission(method, pathTemplate)
+	if !ok {
+		return "", false
+	}
+	if perm != PermAuthenticated {
+		return perm, APIKeyScopes[perm]
+	}
+	if method != http.MethodGet {
+		return "", false
+	}
+	segment := strings.SplitN(strings.TrimPrefix(pathTemplate, "/api/"), "/", 2)[0]
+	perm, ok = ReadScopes[segment]
+	return perm, ok
+}
+
+func hasScope(scopes []string, scope Permission) bool {
+	for _, s := range scopes {
+		if Permission(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether role holds perm in the permission matrix
+func HasPermission(role string, perm Permission) bool {
+	if role == RoleSuperadmin || perm == PermAuthenticated {
+		return true
+	}
+	for _, p := range RolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredPermission returns the permission declared for a method and route
+// template, and false if the route has none.
+func RequiredPermission(method, pathTemplate string) (Permission, bool) {
+	perm, ok := RoutePermissions[method+" "+pathTemplate]
+	return perm, ok
+}
+
+// IsAllowed reports whether role may call the given method and route template
+func IsAllowed(role, method, pathTemplate string) bool {
+	perm, ok := RequiredPermission(method, pathTemplate)
+	return ok && HasPermission(role, perm)
+}
+
+// ForbiddenResponse is the JSON body returned when authorization fails
+type ForbiddenResponse struct {
+	Error              string     `json:"error"`
+	Message            string     `json:"message"`
+	Role               string     `json:"role,omitempty"`
+	RequiredPermission Permission `json:"required_permission,omitempty"`
+}
+
+func writeForbidden(w http.ResponseWriter, resp ForbiddenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AuthorizationMiddleware loads the caller's role in the active organization
+// and enforces RoutePermissions. It must run after AuthMiddleware so that
+// UserIDKey and OrganizationIDKey are present. A superadmin holds that role in
+// every organization; everyone else uses their organization_members role.
+// Requests made with an API key are checked against the key's scopes instead.
+func AuthorizationMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, ok := r.Context().Value(UserIDKey).(int)
+			if !ok {
+				http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+				return
+			}
+
+			organizationID, _ := r.Context().Value(OrganizationIDKey).(int)
+
+			var role, status string
+			var mfaEnabled bool
+			err := db.QueryRow(`
+				SELECT CASE WHEN u.role = $3 THEN u.role ELSE COALESCE(om.role, '') END, u.status,
+				       EXISTS(SELECT 1 FROM user_mfa WHERE user_id = u.id AND enabled_at IS NOT NULL)
+				FROM users u
+				LEFT JOIN organization_members om ON om.user_id = u.id AND om.organization_id = $2
+				WHERE u.id = $1
+			`, userID, organizationID, RoleSuperadmin).Scan(&role, &status, &mfaEnabled)
+			if err == sql.ErrNoRows {
+				http.Error(w, "User not found", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			if status != "approved" {
+				writeForbidden(w, ForbiddenResponse{
+					Error:   "account_inactive",
+					Message: "Your account is not approved",
+					Role:    role,
+				})
+				return
+			}
+
+			pathTemplate := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					pathTemplate = tmpl
+				}
+			}
+
+			if scopes, ok := r.Context().Value(APIKeyScopesKey).([]string); ok {
+				if organizationID == 0 || role == "" {
+					writeForbidden(w, ForbiddenResponse{
+						Error:   "organization_required",
+						Message: "The service account is not a member of an organization",
+					})
+					return
+				}
+				scope, allowed := RequiredScope(r.Method, pathTemplate)
+				if !allowed || !hasScope(scopes, scope) {
+					writeForbidden(w, ForbiddenResponse{
+						Error:              "forbidden",
+						Message:            "This API key is not allowed to perform this action",
+						Role:               role,
+						RequiredPermission: scope,
+					})
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserRoleKey, role)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			if (organizationID == 0 || role == "") && !OrganizationOptionalRoutes[r.Method+" "+pathTemplate] {
+				writeForbidden(w, ForbiddenResponse{
+					Error:   "organization_required",
+					Message: "You are not a member of an organization",
+				})
+				return
+			}
+
+			if MFARequired(role) && !mfaEnabled && !MFAEnrollmentRoutes[r.Method+" "+pathTemplate] {
+				writeForbidden(w, ForbiddenResponse{
+					Error:   "mfa_enrollment_required",
+					Message: "Your role requires two-factor authentication. Please enable it to continue.",
+					Role:    role,
+				})
+				return
+			}
+
+			perm, ok := RequiredPermission(r.Method, pathTemplate)
+			if !ok {
+				writeForbidden(w, ForbiddenResponse{
+					Error:   "forbidden",
+					Message: "This action has no declared permission",
+					Role:    role,
+				})
+				return
+			}
+			if !HasPermission(role, perm) {
+				writeForbidden(w, ForbiddenResponse{
+					Error:              "forbidden",
+					Message:            "Your role is not allowed to perform this action",
+					Role:               role,
+					RequiredPermission: perm,
+				})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserRoleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import "testing"
+
+var allRoles = []string{
+	RoleSuperadmin, RoleLevel1, RoleLevel2, RoleLevel3, RoleLevel4,
+	RoleWarehouse, RoleUser, RoleService,
+}
+
+// rolesWith is the permission matrix spelled out per permission, so that a
+// change to RolePermissions has to be made here as well
+var rolesWith = map[Permission][]string{
+	PermUsersRead:             {RoleLevel1, RoleLevel2},
+	PermUsersManage:           {RoleLevel1},
+	PermFieldsWrite:           {RoleLevel1, RoleLevel2},
+	PermFieldsDelete:          {RoleLevel1},
+	PermPlotsWrite:            {RoleLevel1, RoleLevel2},
+	PermPlantTypesWrite:       {RoleLevel1, RoleLevel2},
+	PermWorkOrdersWrite:       {RoleLevel1, RoleLevel2},
+	PermSeasonsWrite:          {RoleLevel1, RoleLevel2},
+	PermFieldReportsWrite:     {RoleLevel1, RoleLevel2, RoleLevel3, RoleLevel4},
+	PermFieldReportsReview:    {RoleLevel1, RoleLevel2},
+	PermInventoryWrite:        {RoleLevel1, RoleLevel2, RoleWarehouse},
+	PermInventoryExport:       {RoleLevel1, RoleLevel2, RoleWarehouse},
+	PermStockRequestsCreate:   {RoleLevel1, RoleLevel2, RoleWarehouse},
+	PermStockRequestsApprove:  {RoleLevel1, RoleLevel2},
+	PermStockRequestsFulfill:  {RoleLevel1, RoleLevel2, RoleWarehouse},
+	PermStockCountsApprove:    {RoleLevel1, RoleLevel2},
+	PermAttendanceWrite:       {RoleLevel1, RoleLevel2, RoleLevel3, RoleLevel4, RoleWarehouse},
+	PermAttendanceReview:      {RoleLevel1, RoleLevel2},
+	PermOrganizationsManage:   {},
+	PermServiceAccountsManage: {RoleLevel1},
+	PermAuditRead:             {RoleLevel1},
+	PermSignupsReview:         {},
+	PermSystemManage:          {},
+	PermAuthenticated:         allRoles,
+
+	// Read scopes are for API keys only
+	PermFieldsRead:       {},
+	PermPlotsRead:        {},
+	PermPlantTypesRead:   {},
+	PermWorkOrdersRead:   {},
+	PermSeasonsRead:      {},
+	PermFieldReportsRead: {},
+	PermInventoryRead:    {},
+	PermAttendanceRead:   {},
+}
+
+func TestHasPermission(t *testing.T) {
+	for perm, roles := range rolesWith {
+		holders := map[string]bool{RoleSuperadmin: true}
+		for _, role := range roles {
+			holders[role] = true
+		}
+		for _, role := range allRoles {
+			if got := HasPermission(role, perm); got != holders[role] {
+				t.Errorf("HasPermission(%q, %q) = %v, want %v", role, perm, got, holders[role])
+			}
+		}
+	}
+}
+
+func TestRolePermissionsAreKnown(t *testing.T) {
+	for role, perms := range RolePermissions {
+		for _, perm := range perms {
+			if _, ok := rolesWith[perm]; !ok {
+				t.Errorf("role %q holds %q, which is missing from the test matrix", role, perm)
+			}
+		}
+	}
+	for route, perm := range RoutePermissions {
+		if _, ok := rolesWith[perm]; !ok {
+			t.Errorf("route %q requires %q, which is missing from the test matrix", route, perm)
+		}
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+	tests := []struct {
+		role, method, path string
+		want               bool
+	}{
+		{RoleLevel4, "GET", "/api/fields", true},
+		{RoleUser, "GET", "/api/profile", true},
+		{RoleLevel4, "POST", "/api/fields", false},
+		{RoleLevel2, "POST", "/api/fields", true},
+		{RoleLevel2, "DELETE", "/api/fields/{id}", false},
+		{RoleLevel1, "DELETE", "/api/fields/{id}", true},
+		{RoleWarehouse, "POST", "/api/inventory/stock-requests/{id}/fulfill", true},
+		{RoleWarehouse, "POST", "/api/inventory/stock-requests/{id}/approve", false},
+		{RoleLevel1, "PUT", "/api/admin/log-level", false},
+		{RoleSuperadmin, "PUT", "/api/admin/log-level", true},
+		{RoleLevel1, "POST", "/api/users/{id}/approve", false},
+		{RoleSuperadmin, "POST", "/api/users/{id}/approve", true},
+		// Routes without a declared permission are refused, even to a superadmin
+		{RoleSuperadmin, "GET", "/api/undeclared", false},
+	}
+	for _, tt := range tests {
+		if got := IsAllowed(tt.role, tt.method, tt.path); got != tt.want {
+			t.Errorf("IsAllowed(%q, %q, %q) = %v, want %v", tt.role, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		scope        Permission
+		allowed      bool
+	}{
+		{"GET", "/api/fields/{id}", PermFieldsRead, true},
+		{"GET", "/api/inventory/stock-lots", PermInventoryRead, true},
+		{"POST", "/api/inventory/stock-lots", PermInventoryWrite, true},
+		{"GET", "/api/users", PermUsersRead, true},
+		{"GET", "/api/profile", "", false},
+		{"POST", "/api/logout", "", false},
+		{"POST", "/api/service-accounts", PermServiceAccountsManage, false},
+		{"GET", "/api/undeclared", "", false},
+	}
+	for _, tt := range tests {
+		scope, allowed := RequiredScope(tt.method, tt.path)
+		if scope != tt.scope || allowed != tt.allowed {
+			t.Errorf("RequiredScope(%q, %q) = %q, %v, want %q, %v", tt.method, tt.path, scope, allowed, tt.scope, tt.allowed)
+		}
+	}
+}
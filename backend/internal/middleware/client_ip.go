@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"agrione/backend/internal/config"
+)
+
+const ClientIPKey contextKey = "clientIP"
+
+// ClientIPMiddleware resolves the caller's address once per request. The
+// X-Real-IP and X-Forwarded-For headers are only believed when the connection
+// comes from one of the configured TRUSTED_PROXIES; from anywhere else they
+// could be forged to dodge the login, MFA and password reset throttles.
+func ClientIPMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, cfg.TrustedProxyNets)
+			ctx := context.WithValue(r.Context(), ClientIPKey, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the caller's address as resolved by ClientIPMiddleware,
+// or the connection's address when the middleware did not run
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote := remoteIP(r)
+	if !isTrusted(net.ParseIP(remote), trusted) {
+		return remote
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	// Each proxy appends the address it received the request from, so the
+	// client is the last address that is not one of our own proxies
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !isTrusted(ip, trusted) || i == 0 {
+				return ip.String()
+			}
+		}
+	}
+	return remote
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var trusted []*net.IPNet
+	for _, cidr := range []string{"127.0.0.1/32", "172.16.0.0/12"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		trusted = append(trusted, network)
+	}
+
+	tests := []struct {
+		name, remote, realIP, forwarded, want string
+	}{
+		{"direct", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"forged headers from an untrusted peer", "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"real IP from a trusted proxy", "172.18.0.1:5000", "203.0.113.7", "", "203.0.113.7"},
+		{"forwarded chain from a trusted proxy", "127.0.0.1:5000", "", "198.51.100.1, 203.0.113.7, 172.18.0.5", "203.0.113.7"},
+		{"only trusted hops", "127.0.0.1:5000", "", "172.18.0.9, 172.18.0.5", "172.18.0.9"},
+		{"malformed header from a trusted proxy", "127.0.0.1:5000", "not-an-ip", "", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := clientIP(r, trusted); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAtRFC6238(t *testing.T) {
+	// Appendix B lists 8-digit codes; 6-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := CodeAt(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CodeAt at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	for offset := int64(-2); offset <= 2; offset++ {
+		code, err := CodeAt(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, 1, 0)
+		want := offset >= -1 && offset <= 1
+		if ok != want {
+			t.Errorf("code %+d steps away: accepted %v, want %v", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code %+d steps away: matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateRejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := CodeAt(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, code, now, 1, 0)
+	if !ok {
+		t.Fatal("first use of the code was rejected")
+	}
+	// The step is stored as last_used_step, which blocks the same code
+	// and any earlier one within the window
+	if _, ok := Validate(rfcSecret, code, now, 1, step); ok {
+		t.Error("replayed code was accepted")
+	}
+	earlier, err := CodeAt(rfcSecret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(rfcSecret, earlier, now, 1, step); ok {
+		t.Error("code older than the last used step was accepted")
+	}
+	later, err := CodeAt(rfcSecret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(rfcSecret, later, now, 1, step); !ok {
+		t.Error("code newer than the last used step was rejected")
+	}
+}
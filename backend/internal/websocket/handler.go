@@ -1,14 +1,15 @@
 package websocket
 
 import (
+	"context"
 	"database/sql"
-	"log"
 	"net/http"
 
 	"agrione/backend/internal/config"
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/metrics"
 	"agrione/backend/internal/middleware"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 )
 
@@ -20,7 +21,7 @@ var upgrader = websocket.Upgrader{
 }
 
 // HandleWebSocket handles WebSocket connections
-func HandleWebSocket(hub *Hub, cfg *config.Config) http.HandlerFunc {
+func HandleWebSocket(hub *Hub, cfg *config.Config, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var userID int
 		var ok bool
@@ -32,7 +33,7 @@ func HandleWebSocket(hub *Hub, cfg *config.Config) http.HandlerFunc {
 		if !ok {
 			tokenParam := r.URL.Query().Get("token")
 			if tokenParam != "" {
-				userID, ok = parseTokenForUserID(tokenParam, cfg)
+				userID, ok = parseTokenForUserID(r.Context(), tokenParam, cfg, db)
 			}
 		}
 		
@@ -41,22 +42,23 @@ func HandleWebSocket(hub *Hub, cfg *config.Config) http.HandlerFunc {
 			authHeader := r.Header.Get("Authorization")
 			if authHeader != "" && len(authHeader) > 7 && authHeader[:7] == "Bearer " {
 				tokenString := authHeader[7:]
-				userID, ok = parseTokenForUserID(tokenString, cfg)
+				userID, ok = parseTokenForUserID(r.Context(), tokenString, cfg, db)
 			}
 		}
 		
 		if !ok || userID == 0 {
-			log.Printf("WebSocket authentication failed: no valid token found")
+			logging.FromContext(r.Context()).Warn("WebSocket authentication failed: no valid token found")
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		log.Printf("WebSocket connection authenticated for userID: %d", userID)
+		logging.SetUserID(r.Context(), userID)
+		logging.FromContext(r.Context()).Debug("WebSocket connection authenticated")
 
 		// Upgrade connection to WebSocket
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Printf("WebSocket upgrade error: %v", err)
+			logging.FromContext(r.Context()).Warn("WebSocket upgrade failed", "error", err)
 			return
 		}
 
@@ -69,7 +71,9 @@ func HandleWebSocket(hub *Hub, cfg *config.Config) http.HandlerFunc {
 		}
 
 		// Register client
-		hub.register <- client
+		if !hub.add(client) {
+			return
+		}
 
 		// Start goroutines
 		go client.writePump()
@@ -77,49 +81,23 @@ func HandleWebSocket(hub *Hub, cfg *config.Config) http.HandlerFunc {
 	}
 }
 
-// parseTokenForUserID parses JWT token and returns user ID
-func parseTokenForUserID(tokenString string, cfg *config.Config) (int, bool) {
+// parseTokenForUserID validates an access token (including the session
+// revocation check) and returns its user ID
+func parseTokenForUserID(ctx context.Context, tokenString string, cfg *config.Config, db *sql.DB) (int, bool) {
+	logger := logging.FromContext(ctx)
 	if tokenString == "" {
-		log.Printf("WebSocket: Empty token string")
+		logger.Debug("WebSocket token is empty")
 		return 0, false
 	}
-	
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(cfg.JWTSecret), nil
-	})
-	
+
+	claims, err := middleware.ValidateAccessToken(cfg, db, tokenString)
 	if err != nil {
-		log.Printf("WebSocket: JWT parse error: %v", err)
+		logger.Debug("WebSocket token rejected", "error", err)
 		return 0, false
 	}
-	
-	if !token.Valid {
-		log.Printf("WebSocket: JWT token is invalid")
-		return 0, false
-	}
-	
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		log.Printf("WebSocket: JWT claims type assertion failed")
-		return 0, false
-	}
-	
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		log.Printf("WebSocket: JWT user_id not found or wrong type")
-		return 0, false
-	}
-	
-	userID := int(userIDFloat)
-	if userID == 0 {
-		log.Printf("WebSocket: JWT user_id is 0")
-		return 0, false
-	}
-	
-	log.Printf("WebSocket: Successfully parsed token for userID: %d", userID)
+	userID := claims.UserID
+
+	logger.Debug("WebSocket token accepted", "token_user_id", userID)
 	return userID, true
 }
 
@@ -133,6 +111,7 @@ func CreateNotification(db *sql.DB, hub *Hub, userID int, notificationType, titl
 		RETURNING id
 	`, userID, notificationType, title, message, link).Scan(&notificationID)
 	if err != nil {
+		metrics.NotificationFailures.WithLabelValues("store").Inc()
 		return err
 	}
 
@@ -163,6 +142,7 @@ func CreateNotification(db *sql.DB, hub *Hub, userID int, notificationType, titl
 		&notification.CreatedAt,
 	)
 	if err != nil {
+		metrics.NotificationFailures.WithLabelValues("store").Inc()
 		return err
 	}
 
@@ -172,27 +152,41 @@ func CreateNotification(db *sql.DB, hub *Hub, userID int, notificationType, titl
 		Data: notification,
 	}
 
-	return hub.SendToUser(userID, messageData)
+	if err := hub.SendToUser(userID, messageData); err != nil {
+		metrics.NotificationFailures.WithLabelValues("deliver").Inc()
+		return err
+	}
+	return nil
 }
 
-// GetUserIDFromSubmittedBy gets user ID from submitted_by name
-func GetUserIDFromSubmittedBy(db *sql.DB, submittedBy string) (int, error) {
-	var userID int
-	// Try to match by full name (first_name + ' ' + last_name)
-	err := db.QueryRow(`
-		SELECT id FROM users 
-		WHERE first_name || ' ' || last_name = $1
-		LIMIT 1
-	`, submittedBy).Scan(&userID)
-	return userID, err
+// GetSuperadminUserIDs gets the user IDs of every approved superadmin
+func GetSuperadminUserIDs(db *sql.DB) ([]int, error) {
+	rows, err := db.Query("SELECT id FROM users WHERE role = 'superadmin' AND status = 'approved'")
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
 }
 
-// GetUserIDsByRole gets all user IDs with a specific role
+// GetUserIDsByRole gets all user IDs holding a specific role in any organization
 func GetUserIDsByRole(db *sql.DB, role string) ([]int, error) {
-	rows, err := db.Query("SELECT id FROM users WHERE role = $1", role)
+	rows, err := db.Query("SELECT DISTINCT user_id FROM organization_members WHERE role = $1", role)
 	if err != nil {
 		return nil, err
 	}
+	return scanUserIDs(rows)
+}
+
+// GetOrganizationUserIDsByRole gets the user IDs holding a role in one organization
+func GetOrganizationUserIDsByRole(db *sql.DB, organizationID int, role string) ([]int, error) {
+	rows, err := db.Query("SELECT user_id FROM organization_members WHERE organization_id = $1 AND role = $2", organizationID, role)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
+}
+
+func scanUserIDs(rows *sql.Rows) ([]int, error) {
 	defer rows.Close()
 
 	var userIDs []int
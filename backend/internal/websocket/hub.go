@@ -2,8 +2,11 @@ package websocket
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"sync"
+	"time"
+
+	"agrione/backend/internal/metrics"
 
 	"github.com/gorilla/websocket"
 )
@@ -24,6 +27,11 @@ type Hub struct {
 
 	// Mutex for thread-safe access
 	mu sync.RWMutex
+
+	// done is closed by Stop; stopped is closed once Run has closed every client
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
 // Client is a middleman between the websocket connection and the hub
@@ -53,13 +61,21 @@ func NewHub() *Hub {
 		broadcast:  make(chan []byte, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
 	}
 }
 
-// Run starts the hub
+// Run starts the hub; it returns after Stop
 func (h *Hub) Run() {
+	defer close(h.stopped)
+
 	for {
 		select {
+		case <-h.done:
+			h.closeAll()
+			return
+
 		case client := <-h.register:
 			h.mu.Lock()
 			if h.clients[client.userID] == nil {
@@ -67,7 +83,7 @@ func (h *Hub) Run() {
 			}
 			h.clients[client.userID][client] = true
 			h.mu.Unlock()
-			log.Printf("Client registered: userID=%d, total clients for user=%d", client.userID, len(h.clients[client.userID]))
+			slog.Debug("WebSocket client registered", "user_id", client.userID, "user_clients", len(h.clients[client.userID]))
 
 		case client := <-h.unregister:
 			h.mu.Lock()
@@ -81,7 +97,7 @@ func (h *Hub) Run() {
 				}
 			}
 			h.mu.Unlock()
-			log.Printf("Client unregistered: userID=%d", client.userID)
+			slog.Debug("WebSocket client unregistered", "user_id", client.userID)
 
 		case message := <-h.broadcast:
 			// Broadcast to all clients (not used for targeted notifications)
@@ -91,6 +107,7 @@ func (h *Hub) Run() {
 					select {
 					case client.send <- message:
 					default:
+						metrics.WebSocketDropped.WithLabelValues("broadcast").Inc()
 						close(client.send)
 						delete(h.clients[userID], client)
 					}
@@ -101,8 +118,60 @@ func (h *Hub) Run() {
 	}
 }
 
+// Stop sends a going-away close frame to every client, disconnects them and
+// waits for Run to return. Clients connecting afterwards are turned away.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+	<-h.stopped
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
+	count := 0
+	for userID, clients := range h.clients {
+		for client := range clients {
+			client.conn.WriteControl(websocket.CloseMessage, closeMessage, deadline)
+			close(client.send)
+			client.conn.Close()
+			count++
+		}
+		delete(h.clients, userID)
+	}
+	slog.Info("WebSocket hub stopped", "closed_clients", count)
+}
+
+// add registers a new client, or closes it if the hub has stopped
+func (h *Hub) add(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		client.conn.Close()
+		return false
+	}
+}
+
+// Stats returns the number of connected clients and of distinct users
+func (h *Hub) Stats() (clients, users int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userClients := range h.clients {
+		clients += len(userClients)
+	}
+	return clients, len(h.clients)
+}
+
 // SendToUser sends a message to a specific user
 func (h *Hub) SendToUser(userID int, message interface{}) error {
+	if h == nil {
+		return nil // No hub (e.g. background jobs), notification is still stored
+	}
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -120,6 +189,7 @@ func (h *Hub) SendToUser(userID int, message interface{}) error {
 		select {
 		case client.send <- messageBytes:
 		default:
+			metrics.WebSocketDropped.WithLabelValues("send_to_user").Inc()
 			close(client.send)
 			delete(h.clients[userID], client)
 		}
@@ -128,10 +198,28 @@ func (h *Hub) SendToUser(userID int, message interface{}) error {
 	return nil
 }
 
+// DisconnectUser closes every websocket connection of a user, e.g. after
+// their sessions are revoked. The read pumps then unregister the clients.
+func (h *Hub) DisconnectUser(userID int) {
+	if h == nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients[userID] {
+		client.conn.Close()
+	}
+}
+
 // readPump pumps messages from the websocket connection to the hub
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		c.conn.Close()
 	}()
 
@@ -139,7 +227,7 @@ func (c *Client) readPump() {
 		_, _, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				slog.Warn("WebSocket read failed", "user_id", c.userID, "error", err)
 			}
 			break
 		}
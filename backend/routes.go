@@ -0,0 +1,290 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"agrione/backend/internal/background"
+	"agrione/backend/internal/config"
+	"agrione/backend/internal/handlers"
+	"agrione/backend/internal/logging"
+	"agrione/backend/internal/mailer"
+	"agrione/backend/internal/metrics"
+	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/websocket"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+)
+
+// newRouter registers every HTTP route. Each route behind the authorization
+// middleware needs an entry in middleware.RoutePermissions; routes_test.go
+// checks that none is missing.
+func newRouter(cfg *config.Config, db *sql.DB, hub *websocket.Hub, inventoryHandler *handlers.InventoryHandler, tasks *background.Runner) *mux.Router {
+	// Initialize handlers
+	mail := mailer.New(cfg)
+	authHandler := handlers.NewAuthHandler(db, cfg, hub, mail, tasks)
+	testHandler := handlers.NewTestHandler(db)
+	usersHandler := handlers.NewUsersHandler(db, cfg, hub, mail, tasks)
+	organizationsHandler := handlers.NewOrganizationsHandler(db)
+	serviceAccountsHandler := handlers.NewServiceAccountsHandler(db, cfg)
+	auditHandler := handlers.NewAuditHandler(db)
+	fieldsHandler := handlers.NewFieldsHandler(db)
+	plotsHandler := handlers.NewPlotsHandler(db)
+	plantTypesHandler := handlers.NewPlantTypesHandler(db)
+	workOrdersHandler := handlers.NewWorkOrdersHandler(db, hub)
+	fieldReportsHandler := handlers.NewFieldReportsHandler(db, hub)
+	attendanceHandler := handlers.NewAttendanceHandler(db, cfg)
+	notificationsHandler := handlers.NewNotificationsHandler(db, hub)
+	cultivationSeasonsHandler := handlers.NewCultivationSeasonsHandler(db)
+
+	r := mux.NewRouter()
+
+	// Apply CORS middleware first
+	r.Use(middleware.CORSMiddleware(cfg))
+	r.Use(middleware.ClientIPMiddleware(cfg))
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
+
+	// Prometheus scrape endpoint, outside /api
+	r.Handle("/metrics", metrics.Handler(cfg.MetricsToken)).Methods("GET")
+
+	// API routes
+	api := r.PathPrefix("/api").Subrouter()
+	
+	// Handle OPTIONS for all API routes (must be before CSRF)
+	api.PathPrefix("").Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	
+	// Public routes (no CSRF for GET)
+	api.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
+	api.HandleFunc("/user", testHandler.TestConnection).Methods("GET")
+
+	// Setup CSRF protection (only validates POST/PUT/DELETE, GET is exempt)
+	// Support IP addresses in trusted origins
+	trustedOrigins := []string{}
+	if cfg.CORSOrigin != "" && cfg.CORSOrigin != "*" {
+		trustedOrigins = []string{cfg.CORSOrigin}
+	}
+	// If CORS_ORIGIN is "*" or empty, CSRF will be more permissive
+	// This allows IP-based access without strict origin checking
+	
+	csrfMiddleware := csrf.Protect(
+		[]byte(cfg.CSRFSecret),
+		csrf.Secure(cfg.CSRFSecure), // CSRF_SECURE=false allows HTTP (IP-based access without HTTPS)
+		csrf.Path("/"),
+		csrf.TrustedOrigins(trustedOrigins),
+		csrf.ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Log for debugging
+			logging.FromContext(r.Context()).Warn("CSRF validation failed", "origin", r.Header.Get("Origin"), "expected_origin", cfg.CORSOrigin)
+			http.Error(w, "CSRF token validation failed", http.StatusForbidden)
+		})),
+	)
+
+	// CSRF endpoint needs CSRF middleware to set cookie, but GET is exempt
+	apiWithCSRFForCookie := api.PathPrefix("").Subrouter()
+	apiWithCSRFForCookie.Use(csrfMiddleware)
+	apiWithCSRFForCookie.HandleFunc("/csrf", handlers.GetCSRFToken).Methods("GET")
+
+	// CSRF middleware that skips OPTIONS requests
+	csrfSkipOptions := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// API keys are sent explicitly by integrations, never attached by a
+			// browser, so requests carrying one cannot be forged cross-site
+			if middleware.RequestAPIKey(r) != "" {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			csrfMiddleware(next).ServeHTTP(w, r)
+		})
+	}
+
+	// POST routes with CSRF protection
+	apiWithCSRF := api.PathPrefix("").Subrouter()
+	apiWithCSRF.Use(csrfSkipOptions)
+	apiWithCSRF.HandleFunc("/signup", authHandler.Signup).Methods("POST")
+	apiWithCSRF.HandleFunc("/login", authHandler.Login).Methods("POST")
+	apiWithCSRF.HandleFunc("/login/mfa", authHandler.LoginMFA).Methods("POST")
+	apiWithCSRF.HandleFunc("/token/refresh", authHandler.RefreshToken).Methods("POST")
+	apiWithCSRF.HandleFunc("/password/forgot", authHandler.ForgotPassword).Methods("POST")
+	apiWithCSRF.HandleFunc("/password/reset", authHandler.ResetPassword).Methods("POST")
+
+	// Role-based authorization (see middleware.RoutePermissions)
+	authz := middleware.AuthorizationMiddleware(db)
+
+	// Audit log of every POST, PUT and DELETE, recorded before authorization
+	// so that refused calls are kept too
+	audit := middleware.AuditMiddleware(db)
+
+	// Protected routes
+	protected := api.PathPrefix("").Subrouter()
+	protected.Use(middleware.AuthMiddleware(cfg, db))
+	protected.Use(authz)
+	protected.HandleFunc("/profile", authHandler.Profile).Methods("GET")
+	protected.HandleFunc("/sessions", authHandler.ListSessions).Methods("GET")
+	protected.HandleFunc("/mfa", authHandler.GetMFAStatus).Methods("GET")
+	protected.HandleFunc("/organizations", organizationsHandler.ListOrganizations).Methods("GET")
+	protected.HandleFunc("/organizations/members", organizationsHandler.ListMembers).Methods("GET")
+	protected.HandleFunc("/service-accounts", serviceAccountsHandler.ListServiceAccounts).Methods("GET")
+	protected.HandleFunc("/audit", auditHandler.ListAuditLog).Methods("GET")
+	protected.HandleFunc("/audit/verify", auditHandler.VerifyAuditLog).Methods("GET")
+	protected.HandleFunc("/admin/log-level", handlers.GetLogLevel).Methods("GET")
+	protected.HandleFunc("/users", usersHandler.ListUsers).Methods("GET")
+	protected.HandleFunc("/users/pending", usersHandler.ListPendingUsers).Methods("GET")
+	protected.HandleFunc("/login-attempts", usersHandler.ListLoginAttempts).Methods("GET")
+	protected.HandleFunc("/user-reference-issues", usersHandler.ListUserReferenceIssues).Methods("GET")
+	protected.HandleFunc("/fields", fieldsHandler.ListFields).Methods("GET")
+	protected.HandleFunc("/fields/{id}", fieldsHandler.GetField).Methods("GET")
+	protected.HandleFunc("/plots", plotsHandler.ListPlots).Methods("GET")
+	protected.HandleFunc("/plots/{id}", plotsHandler.GetPlot).Methods("GET")
+	protected.HandleFunc("/plant-types", plantTypesHandler.ListPlantTypes).Methods("GET")
+	protected.HandleFunc("/plant-types/{id}", plantTypesHandler.GetPlantType).Methods("GET")
+	protected.HandleFunc("/work-orders", workOrdersHandler.ListWorkOrders).Methods("GET")
+	protected.HandleFunc("/work-orders/{id}", workOrdersHandler.GetWorkOrder).Methods("GET")
+	protected.HandleFunc("/cultivation-seasons", cultivationSeasonsHandler.ListCultivationSeasons).Methods("GET")
+	protected.HandleFunc("/cultivation-seasons/{id}", cultivationSeasonsHandler.GetCultivationSeason).Methods("GET")
+	
+	// Inventory routes (GET)
+	protected.HandleFunc("/inventory/stats", inventoryHandler.GetInventoryStats).Methods("GET")
+	protected.HandleFunc("/inventory/items", inventoryHandler.ListInventoryItems).Methods("GET")
+	protected.HandleFunc("/inventory/items/{id}", inventoryHandler.GetInventoryItem).Methods("GET")
+	protected.HandleFunc("/inventory/items/{id}/costs", inventoryHandler.GetInventoryItemCosts).Methods("GET")
+	protected.HandleFunc("/inventory/stock-lots", inventoryHandler.ListStockLots).Methods("GET")
+	protected.HandleFunc("/inventory/warehouses", inventoryHandler.ListWarehouses).Methods("GET")
+	protected.HandleFunc("/inventory/stock-movements", inventoryHandler.ListStockMovements).Methods("GET")
+	protected.HandleFunc("/inventory/expiring", inventoryHandler.GetExpiringStock).Methods("GET")
+	protected.HandleFunc("/inventory/replenishment", inventoryHandler.GetReplenishment).Methods("GET")
+	protected.HandleFunc("/inventory/purchase-suggestions", inventoryHandler.ListPurchaseSuggestions).Methods("GET")
+	protected.HandleFunc("/inventory/exports/valuation", inventoryHandler.ExportStockValuation).Methods("GET")
+	protected.HandleFunc("/inventory/exports/ledger", inventoryHandler.ExportStockLedger).Methods("GET")
+	protected.HandleFunc("/inventory/suppliers", inventoryHandler.ListSuppliers).Methods("GET")
+	protected.HandleFunc("/inventory/suppliers/{id}", inventoryHandler.GetSupplier).Methods("GET")
+	protected.HandleFunc("/inventory/purchase-orders", inventoryHandler.ListPurchaseOrders).Methods("GET")
+	protected.HandleFunc("/inventory/purchase-orders/{id}", inventoryHandler.GetPurchaseOrder).Methods("GET")
+	protected.HandleFunc("/inventory/stock-requests", inventoryHandler.ListStockRequests).Methods("GET")
+	protected.HandleFunc("/inventory/stock-requests/{id}", inventoryHandler.GetStockRequest).Methods("GET")
+	protected.HandleFunc("/inventory/transfers", inventoryHandler.ListStockTransfers).Methods("GET")
+	protected.HandleFunc("/inventory/transfers/{id}", inventoryHandler.GetStockTransfer).Methods("GET")
+	protected.HandleFunc("/inventory/counts", inventoryHandler.ListStockCounts).Methods("GET")
+	protected.HandleFunc("/inventory/counts/{id}", inventoryHandler.GetStockCount).Methods("GET")
+	
+	// Protected POST routes (require both auth and CSRF)
+	protectedPost := api.PathPrefix("").Subrouter()
+	protectedPost.Use(csrfSkipOptions)
+	protectedPost.Use(middleware.AuthMiddleware(cfg, db))
+	protectedPost.Use(audit)
+	protectedPost.Use(authz)
+	protectedPost.HandleFunc("/logout", authHandler.Logout).Methods("POST")
+	protectedPost.HandleFunc("/logout/all", authHandler.LogoutAll).Methods("POST")
+	protectedPost.HandleFunc("/organizations", organizationsHandler.CreateOrganization).Methods("POST")
+	protectedPost.HandleFunc("/organizations/switch", authHandler.SwitchOrganization).Methods("POST")
+	protectedPost.HandleFunc("/service-accounts", serviceAccountsHandler.CreateServiceAccount).Methods("POST")
+	protectedPost.HandleFunc("/service-accounts/{id}/keys", serviceAccountsHandler.CreateAPIKey).Methods("POST")
+	protectedPost.HandleFunc("/service-accounts/{id}/keys/{keyId}/revoke", serviceAccountsHandler.RevokeAPIKey).Methods("POST")
+	protectedPost.HandleFunc("/users/{id}/approve", usersHandler.ApproveUser).Methods("POST")
+	protectedPost.HandleFunc("/users/{id}/reject", usersHandler.RejectUser).Methods("POST")
+	protectedPost.HandleFunc("/users/{id}/unlock", usersHandler.UnlockUser).Methods("POST")
+	protectedPost.HandleFunc("/users/{id}/mfa/reset", usersHandler.ResetUserMFA).Methods("POST")
+	protectedPost.HandleFunc("/user-reference-issues/{id}/resolve", usersHandler.ResolveUserReferenceIssue).Methods("POST")
+	protectedPost.HandleFunc("/mfa/enroll", authHandler.EnrollMFA).Methods("POST")
+	protectedPost.HandleFunc("/mfa/verify", authHandler.VerifyMFA).Methods("POST")
+	protectedPost.HandleFunc("/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes).Methods("POST")
+	protectedPost.HandleFunc("/mfa/disable", authHandler.DisableMFA).Methods("POST")
+	protectedPost.HandleFunc("/fields", fieldsHandler.CreateField).Methods("POST")
+	protectedPost.HandleFunc("/fields/import-kmz", fieldsHandler.ImportKMZ).Methods("POST")
+	protectedPost.HandleFunc("/fields/batch-create", fieldsHandler.BatchCreateFields).Methods("POST")
+	protectedPost.HandleFunc("/plots", plotsHandler.CreatePlot).Methods("POST")
+	protectedPost.HandleFunc("/plant-types", plantTypesHandler.CreatePlantType).Methods("POST")
+	protectedPost.HandleFunc("/work-orders", workOrdersHandler.CreateWorkOrder).Methods("POST")
+	protectedPost.HandleFunc("/cultivation-seasons", cultivationSeasonsHandler.CreateCultivationSeason).Methods("POST")
+	protectedPost.HandleFunc("/inventory/items", inventoryHandler.CreateInventoryItem).Methods("POST")
+	protectedPost.HandleFunc("/inventory/items/{id}/revalue", inventoryHandler.RevalueInventoryItem).Methods("POST")
+	protectedPost.HandleFunc("/inventory/replenishment/run", inventoryHandler.RunReplenishment).Methods("POST")
+	protectedPost.HandleFunc("/inventory/purchase-suggestions/{id}/dismiss", inventoryHandler.DismissPurchaseSuggestion).Methods("POST")
+	protectedPost.HandleFunc("/inventory/suppliers", inventoryHandler.CreateSupplier).Methods("POST")
+	protectedPost.HandleFunc("/inventory/purchase-orders", inventoryHandler.CreatePurchaseOrder).Methods("POST")
+	protectedPost.HandleFunc("/inventory/purchase-orders/{id}/submit", inventoryHandler.SubmitPurchaseOrder).Methods("POST")
+	protectedPost.HandleFunc("/inventory/purchase-orders/{id}/cancel", inventoryHandler.CancelPurchaseOrder).Methods("POST")
+	protectedPost.HandleFunc("/inventory/purchase-orders/{id}/receive", inventoryHandler.ReceivePurchaseOrder).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-lots", inventoryHandler.CreateStockLot).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-lots/remove", inventoryHandler.RemoveStock).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-requests", inventoryHandler.CreateStockRequest).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-requests/{id}/approve", inventoryHandler.ApproveStockRequest).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-requests/{id}/reject", inventoryHandler.RejectStockRequest).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-requests/{id}/cancel", inventoryHandler.CancelStockRequest).Methods("POST")
+	protectedPost.HandleFunc("/inventory/stock-requests/{id}/fulfill", inventoryHandler.FulfillStockRequest).Methods("POST")
+	protectedPost.HandleFunc("/inventory/transfers", inventoryHandler.CreateStockTransfer).Methods("POST")
+	protectedPost.HandleFunc("/inventory/transfers/{id}/receive", inventoryHandler.ReceiveStockTransfer).Methods("POST")
+	protectedPost.HandleFunc("/inventory/counts", inventoryHandler.CreateStockCount).Methods("POST")
+	protectedPost.HandleFunc("/inventory/counts/{id}/submit", inventoryHandler.SubmitStockCount).Methods("POST")
+	protectedPost.HandleFunc("/inventory/counts/{id}/approve", inventoryHandler.ApproveStockCount).Methods("POST")
+	protectedPost.HandleFunc("/inventory/counts/{id}/reject", inventoryHandler.RejectStockCount).Methods("POST")
+	
+	// Protected PUT routes (require both auth and CSRF)
+	protectedPut := api.PathPrefix("").Subrouter()
+	protectedPut.Use(csrfSkipOptions)
+	protectedPut.Use(middleware.AuthMiddleware(cfg, db))
+	protectedPut.Use(audit)
+	protectedPut.Use(authz)
+	protectedPut.HandleFunc("/profile/password", authHandler.ChangePassword).Methods("PUT")
+	protectedPut.HandleFunc("/users/{id}/role", usersHandler.UpdateUserRole).Methods("PUT")
+	protectedPut.HandleFunc("/users/{id}/status", usersHandler.UpdateUserStatus).Methods("PUT")
+	protectedPut.HandleFunc("/organizations/members/{userId}", organizationsHandler.PutMember).Methods("PUT")
+	protectedPut.HandleFunc("/fields/{id}", fieldsHandler.UpdateField).Methods("PUT")
+	protectedPut.HandleFunc("/fields/{id}/assign", fieldsHandler.AssignFieldToUser).Methods("PUT")
+	protectedPut.HandleFunc("/plots/{id}", plotsHandler.UpdatePlot).Methods("PUT")
+	protectedPut.HandleFunc("/plant-types/{id}", plantTypesHandler.UpdatePlantType).Methods("PUT")
+	protectedPut.HandleFunc("/work-orders/{id}", workOrdersHandler.UpdateWorkOrder).Methods("PUT")
+	protectedPut.HandleFunc("/cultivation-seasons/{id}", cultivationSeasonsHandler.UpdateCultivationSeason).Methods("PUT")
+	protectedPut.HandleFunc("/inventory/items/{id}", inventoryHandler.UpdateInventoryItem).Methods("PUT")
+	protectedPut.HandleFunc("/inventory/counts/{id}/lines", inventoryHandler.RecordStockCount).Methods("PUT")
+	protectedPut.HandleFunc("/inventory/suppliers/{id}", inventoryHandler.UpdateSupplier).Methods("PUT")
+	
+	// Protected DELETE routes (require both auth and CSRF)
+	protectedDelete := api.PathPrefix("").Subrouter()
+	protectedDelete.Use(csrfSkipOptions)
+	protectedDelete.Use(middleware.AuthMiddleware(cfg, db))
+	protectedDelete.Use(audit)
+	protectedDelete.Use(authz)
+	protectedDelete.HandleFunc("/organizations/members/{userId}", organizationsHandler.RemoveMember).Methods("DELETE")
+	protectedDelete.HandleFunc("/fields/{id}", fieldsHandler.DeleteField).Methods("DELETE")
+	protectedDelete.HandleFunc("/plots/{id}", plotsHandler.DeletePlot).Methods("DELETE")
+	protectedDelete.HandleFunc("/plant-types/{id}", plantTypesHandler.DeletePlantType).Methods("DELETE")
+	protectedDelete.HandleFunc("/work-orders/{id}", workOrdersHandler.DeleteWorkOrder).Methods("DELETE")
+	protectedDelete.HandleFunc("/cultivation-seasons/{id}", cultivationSeasonsHandler.DeleteCultivationSeason).Methods("DELETE")
+	protectedDelete.HandleFunc("/inventory/items/{id}", inventoryHandler.DeleteInventoryItem).Methods("DELETE")
+
+	// Field Reports routes
+	protected.HandleFunc("/field-reports", fieldReportsHandler.ListFieldReports).Methods("GET")
+	protected.HandleFunc("/field-reports/{id}", fieldReportsHandler.GetFieldReport).Methods("GET")
+	protectedPost.HandleFunc("/field-reports", fieldReportsHandler.CreateFieldReport).Methods("POST")
+	protectedPut.HandleFunc("/field-reports/{id}", fieldReportsHandler.UpdateFieldReport).Methods("PUT")
+	protectedDelete.HandleFunc("/field-reports/{id}", fieldReportsHandler.DeleteFieldReport).Methods("DELETE")
+	protectedPost.HandleFunc("/field-reports/{id}/comments", fieldReportsHandler.AddComment).Methods("POST")
+	protectedPost.HandleFunc("/field-reports/{id}/approve", fieldReportsHandler.ApproveFieldReport).Methods("POST")
+	protectedPost.HandleFunc("/field-reports/{id}/reject", fieldReportsHandler.RejectFieldReport).Methods("POST")
+	
+	// Attendance routes
+	protected.HandleFunc("/attendance/today", attendanceHandler.GetTodayAttendance).Methods("GET")
+	protected.HandleFunc("/attendance/stats", attendanceHandler.GetAttendanceStats).Methods("GET")
+	protected.HandleFunc("/attendance/all", attendanceHandler.ListAllAttendances).Methods("GET")
+	protected.HandleFunc("/attendance", attendanceHandler.ListAttendance).Methods("GET")
+	protected.HandleFunc("/attendance/{id}", attendanceHandler.GetAttendance).Methods("GET")
+	protectedPost.HandleFunc("/attendance", attendanceHandler.CreateAttendance).Methods("POST")
+	
+	// Notifications routes
+	protected.HandleFunc("/notifications", notificationsHandler.GetNotifications).Methods("GET")
+	protectedPut.HandleFunc("/notifications/{id}/read", notificationsHandler.MarkAsRead).Methods("PUT")
+	protectedPut.HandleFunc("/notifications/read-all", notificationsHandler.MarkAllAsRead).Methods("PUT")
+	protectedPut.HandleFunc("/admin/log-level", handlers.SetLogLevel).Methods("PUT")
+	
+	// WebSocket route (handles authentication internally via query param or header)
+	// Not using protected router because WebSocket needs to handle auth differently
+	api.HandleFunc("/ws", websocket.HandleWebSocket(hub, cfg, db)).Methods("GET")
+
+	return r
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"agrione/backend/internal/background"
+	"agrione/backend/internal/config"
+	"agrione/backend/internal/handlers"
+	"agrione/backend/internal/middleware"
+	"agrione/backend/internal/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+// publicRoutes are the /api routes registered outside AuthorizationMiddleware
+var publicRoutes = map[string]bool{
+	"GET /api/health":           true,
+	"GET /api/user":             true,
+	"GET /api/csrf":             true,
+	"POST /api/signup":          true,
+	"POST /api/login":           true,
+	"POST /api/login/mfa":       true,
+	"POST /api/token/refresh":   true,
+	"POST /api/password/forgot": true,
+	"POST /api/password/reset":  true,
+	// Authenticates the socket itself and serves no data on its own
+	"GET /api/ws": true,
+}
+
+func registeredRoutes(t *testing.T) map[string]bool {
+	r := newRouter(&config.Config{}, nil, websocket.NewHub(), handlers.NewInventoryHandler(nil, nil), background.NewRunner())
+
+	routes := map[string]bool{}
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(tmpl, "/api/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method != "OPTIONS" {
+				routes[method+" "+tmpl] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+func TestEveryRouteDeclaresPermission(t *testing.T) {
+	routes := registeredRoutes(t)
+	for route := range routes {
+		method, tmpl, _ := strings.Cut(route, " ")
+		if _, ok := middleware.RequiredPermission(method, tmpl); !ok && !publicRoutes[route] {
+			t.Errorf("%s has no entry in middleware.RoutePermissions", route)
+		}
+	}
+	for route := range middleware.RoutePermissions {
+		if !routes[route] {
+			t.Errorf("middleware.RoutePermissions lists %s, which is not registered", route)
+		}
+	}
+	for route := range publicRoutes {
+		if !routes[route] {
+			t.Errorf("publicRoutes lists %s, which is not registered", route)
+		}
+	}
+}
@@ -59,15 +59,20 @@ if [ -d ".git" ]; then
 fi
 
 # Setup .env file with VPS IP
+# A new install gets random secrets; the backend refuses to start in production
+# with the defaults. POSTGRES_PASSWORD only takes effect when the database
+# volume is first created, so an existing install rotates it with
+# ./fix-password.sh, which changes it in Postgres and in .env together.
 if [ ! -f .env ]; then
     echo -e "${GREEN}📝 Creating .env file...${NC}"
-    cat > .env << 'ENVEOF'
+    cat > .env << ENVEOF
 POSTGRES_USER=agrione
-POSTGRES_PASSWORD=agrione123
+POSTGRES_PASSWORD=$(openssl rand -hex 32)
 POSTGRES_DB=agrione_db
-JWT_SECRET=your-super-secret-jwt-key-change-in-production
-CSRF_SECRET=your-csrf-secret-key-change-in-production
+JWT_SECRET=$(openssl rand -hex 32)
+CSRF_SECRET=$(openssl rand -hex 32)
 ENVEOF
+    chmod 600 .env
     echo "CORS_ORIGIN=http://$VPS_IP:3000" >> .env
     echo "NEXT_PUBLIC_API_URL=http://$VPS_IP:8000" >> .env
 else
@@ -94,20 +99,22 @@ else
     fi
 fi
 
+if grep -qE "^(POSTGRES_PASSWORD=agrione123|JWT_SECRET=your-super-secret|CSRF_SECRET=your-csrf-secret)" .env; then
+    echo -e "${YELLOW}⚠️  .env still has a default secret; the backend will not start in production.${NC}"
+    echo -e "${YELLOW}   Set JWT_SECRET and CSRF_SECRET to \$(openssl rand -hex 32) and run ./fix-password.sh for POSTGRES_PASSWORD.${NC}"
+fi
+
 echo -e "${GREEN}✅ Environment configured:${NC}"
 echo -e "   CORS_ORIGIN=http://$VPS_IP:3000"
 echo -e "   NEXT_PUBLIC_API_URL=http://$VPS_IP:8000"
 
-# Stop existing containers
-echo -e "${YELLOW}🛑 Stopping existing containers...${NC}"
-docker compose down || true
-
-# Build and start containers
+# Build before stopping anything so the old containers keep serving meanwhile
 echo -e "${GREEN}🔨 Building containers...${NC}"
 docker compose build --no-cache
 
+# Recreate containers; the backend drains in-flight requests on SIGTERM
 echo -e "${GREEN}🚀 Starting containers...${NC}"
-docker compose up -d
+docker compose up -d --remove-orphans
 
 # Wait for services to be ready
 echo -e "${YELLOW}⏳ Waiting for services to start...${NC}"
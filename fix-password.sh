@@ -1,20 +1,34 @@
 #!/bin/bash
-# Script to fix PostgreSQL password authentication
+# Rotate the PostgreSQL password of an existing install.
+#
+# POSTGRES_PASSWORD in .env is only read when the database volume is first
+# created, so changing it there alone locks the backend out. This script sets
+# a new random password in Postgres, writes it to .env and recreates the
+# backend so it connects with it.
+#
+# Usage (from the project directory): ./fix-password.sh
 
-docker exec agrione_postgres psql -U agrione -d agrione_db <<EOF
--- Reset password
-ALTER USER agrione WITH PASSWORD 'agrione123';
+set -e
 
--- Verify user exists
-SELECT usename, usecreatedb, usesuper FROM pg_user WHERE usename = 'agrione';
+if [ ! -f .env ]; then
+    echo "❌ .env not found; run this from the project directory"
+    exit 1
+fi
 
--- Reload configuration
-SELECT pg_reload_conf();
-EOF
+DB_USER=$(grep "^POSTGRES_USER=" .env | cut -d'=' -f2)
+DB_USER=${DB_USER:-agrione}
+NEW_PASSWORD=$(openssl rand -hex 32)
 
-echo "Password reset completed. Try connecting again with:"
-echo "  Username: agrione"
-echo "  Password: agrione123"
-echo "  Database: agrione_db"
+docker exec -i agrione_postgres psql -v ON_ERROR_STOP=1 -U "$DB_USER" -d postgres \
+    -c "ALTER USER \"$DB_USER\" WITH PASSWORD '$NEW_PASSWORD';"
 
+if grep -q "^POSTGRES_PASSWORD=" .env; then
+    sed -i "s|^POSTGRES_PASSWORD=.*|POSTGRES_PASSWORD=$NEW_PASSWORD|" .env
+else
+    echo "POSTGRES_PASSWORD=$NEW_PASSWORD" >> .env
+fi
+chmod 600 .env
 
+docker compose up -d --no-deps --force-recreate backend
+
+echo "✅ Database password rotated for user $DB_USER; the new value is in .env"
@@ -6,7 +6,7 @@ import Link from 'next/link'
 import { useForm } from 'react-hook-form'
 import { zodResolver } from '@hookform/resolvers/zod'
 import { z } from 'zod'
-import { authAPI } from '@/lib/api'
+import { authAPI, AuthResponse } from '@/lib/api'
 import { checkDevAuth, getDevRedirectPath, isDevModeActive, getDevUser } from '@/lib/devAuth'
 
 const loginSchema = z.object({
@@ -21,6 +21,10 @@ export default function LoginPage() {
   const searchParams = useSearchParams()
   const [error, setError] = useState<string>('')
   const [isLoading, setIsLoading] = useState(false)
+  // Set after the password step when the account uses two-factor authentication
+  const [mfaToken, setMfaToken] = useState<string>('')
+  const [mfaCode, setMfaCode] = useState<string>('')
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false)
 
   // Check for dev mode bypass
   useEffect(() => {
@@ -63,25 +67,11 @@ export default function LoginPage() {
 
     try {
       const response = await authAPI.login(data)
-      // Store token in localStorage
-      if (response.token) {
-        localStorage.setItem('token', response.token)
-        // Also set cookie for compatibility
-        document.cookie = `token=${response.token}; path=/; max-age=${7 * 24 * 60 * 60}; SameSite=Lax`
-      }
-      
-      // Redirect based on role
-      const role = response.user.role
-      if (role === 'superadmin') {
-        router.push('/suadm')
-      } else if (role === 'Level 1' || role === 'Level 2') {
-        router.push('/dashboard')
-      } else if (role === 'Level 3' || role === 'Level 4') {
-        router.push('/lapangan')
-      } else {
-        // Default redirect for other roles
-        router.push('/dashboard')
+      if (response.mfa_required && response.mfa_token) {
+        setMfaToken(response.mfa_token)
+        return
       }
+      completeLogin(response)
     } catch (err: any) {
       setError(err.response?.data?.error || err.response?.data || 'Login failed. Please try again.')
     } finally {
@@ -89,6 +79,122 @@ export default function LoginPage() {
     }
   }
 
+  const onSubmitMFA = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setIsLoading(true)
+    setError('')
+
+    try {
+      const response = useRecoveryCode
+        ? await authAPI.loginMFA(mfaToken, '', mfaCode)
+        : await authAPI.loginMFA(mfaToken, mfaCode)
+      completeLogin(response)
+    } catch (err: any) {
+      if (err.response?.status === 401 && err.response?.data?.includes?.('expired')) {
+        setMfaToken('')
+      }
+      setError(err.response?.data?.error || err.response?.data || 'Verification failed. Please try again.')
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
+  const completeLogin = (response: AuthResponse) => {
+    // Store token in localStorage
+    if (response.token) {
+      localStorage.setItem('token', response.token)
+      if (response.refresh_token) {
+        localStorage.setItem('refresh_token', response.refresh_token)
+      }
+      // Also set cookie for compatibility
+      document.cookie = `token=${response.token}; path=/; max-age=${7 * 24 * 60 * 60}; SameSite=Lax`
+    }
+
+    if (response.mfa_enrollment_required) {
+      router.push('/mfa-setup')
+      return
+    }
+
+    // Redirect based on role
+    const role = response.user.role
+    if (role === 'superadmin') {
+      router.push('/suadm')
+    } else if (role === 'Level 1' || role === 'Level 2') {
+      router.push('/dashboard')
+    } else if (role === 'Level 3' || role === 'Level 4') {
+      router.push('/lapangan')
+    } else {
+      // Default redirect for other roles
+      router.push('/dashboard')
+    }
+  }
+
+  if (mfaToken) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 py-12 px-4 sm:px-6 lg:px-8">
+        <div className="max-w-md w-full space-y-8">
+          <div>
+            <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-900">
+              Two-factor authentication
+            </h2>
+            <p className="mt-2 text-center text-sm text-gray-600">
+              {useRecoveryCode
+                ? 'Enter one of your recovery codes.'
+                : 'Enter the 6-digit code from your authenticator app.'}
+            </p>
+          </div>
+          <form className="mt-8 space-y-6" onSubmit={onSubmitMFA}>
+            {error && (
+              <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded">
+                {error}
+              </div>
+            )}
+            <input
+              value={mfaCode}
+              onChange={(e) => setMfaCode(e.target.value)}
+              type="text"
+              inputMode={useRecoveryCode ? 'text' : 'numeric'}
+              autoComplete="one-time-code"
+              autoFocus
+              className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 sm:text-sm"
+              placeholder={useRecoveryCode ? 'xxxxx-xxxxx' : '123456'}
+            />
+            <div className="flex justify-between">
+              <button
+                type="button"
+                onClick={() => {
+                  setUseRecoveryCode(!useRecoveryCode)
+                  setMfaCode('')
+                }}
+                className="text-sm font-medium text-indigo-600 hover:text-indigo-500"
+              >
+                {useRecoveryCode ? 'Use authenticator code' : 'Use a recovery code'}
+              </button>
+              <button
+                type="button"
+                onClick={() => {
+                  setMfaToken('')
+                  setMfaCode('')
+                  setError('')
+                }}
+                className="text-sm font-medium text-gray-600 hover:text-gray-500"
+              >
+                Back to sign in
+              </button>
+            </div>
+            <button
+              type="submit"
+              disabled={isLoading || !mfaCode}
+              className="group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              {isLoading ? 'Verifying...' : 'Verify'}
+            </button>
+          </form>
+        </div>
+      </div>
+    )
+  }
+
   return (
     <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 py-12 px-4 sm:px-6 lg:px-8">
       <div className="max-w-md w-full space-y-8">
@@ -142,6 +248,12 @@ export default function LoginPage() {
             </div>
           </div>
 
+          <div className="flex justify-end">
+            <Link href="/forgot-password" className="text-sm font-medium text-indigo-600 hover:text-indigo-500">
+              Forgot your password?
+            </Link>
+          </div>
+
           <div>
             <button
               type="submit"
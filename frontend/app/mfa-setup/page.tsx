@@ -0,0 +1,161 @@
+'use client'
+
+import { useEffect, useState } from 'react'
+import { useRouter } from 'next/navigation'
+import { authAPI, mfaAPI, MFAEnrollResponse, MFAStatus } from '@/lib/api'
+
+export default function MFASetupPage() {
+  const router = useRouter()
+  const [status, setStatus] = useState<MFAStatus | null>(null)
+  const [enrollment, setEnrollment] = useState<MFAEnrollResponse | null>(null)
+  const [code, setCode] = useState<string>('')
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([])
+  const [error, setError] = useState<string>('')
+  const [isLoading, setIsLoading] = useState(false)
+
+  useEffect(() => {
+    if (!localStorage.getItem('token')) {
+      router.push('/login')
+      return
+    }
+    mfaAPI
+      .getStatus()
+      .then(setStatus)
+      .catch((err: any) => setError(err.response?.data?.error || err.response?.data || 'Failed to load status'))
+  }, [router])
+
+  const startEnrollment = async () => {
+    setIsLoading(true)
+    setError('')
+    try {
+      setEnrollment(await mfaAPI.enroll())
+    } catch (err: any) {
+      setError(err.response?.data?.error || err.response?.data || 'Failed to start setup')
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
+  const verify = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setIsLoading(true)
+    setError('')
+    try {
+      const response = await mfaAPI.verify(code)
+      setRecoveryCodes(response.recovery_codes)
+      setEnrollment(null)
+      setStatus(await mfaAPI.getStatus())
+    } catch (err: any) {
+      setError(err.response?.data?.error || err.response?.data || 'Verification failed')
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
+  const goToApp = async () => {
+    const user = await authAPI.getProfile()
+    if (user.role === 'superadmin') {
+      router.push('/suadm')
+    } else if (user.role === 'Level 3' || user.role === 'Level 4') {
+      router.push('/lapangan')
+    } else {
+      router.push('/dashboard')
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-6 bg-white p-6 rounded-lg shadow">
+        <h2 className="text-center text-2xl font-extrabold text-gray-900">
+          Two-factor authentication
+        </h2>
+
+        {error && (
+          <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded">
+            {error}
+          </div>
+        )}
+
+        {recoveryCodes.length > 0 && (
+          <div className="space-y-3">
+            <p className="text-sm text-gray-700">
+              Two-factor authentication is enabled. Save these recovery codes somewhere safe. Each code can be used once
+              if you lose access to your authenticator app. They will not be shown again.
+            </p>
+            <ul className="grid grid-cols-2 gap-2 font-mono text-sm bg-gray-50 p-3 rounded">
+              {recoveryCodes.map((c) => (
+                <li key={c}>{c}</li>
+              ))}
+            </ul>
+            <button
+              onClick={goToApp}
+              className="w-full py-2 px-4 text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700"
+            >
+              Continue
+            </button>
+          </div>
+        )}
+
+        {recoveryCodes.length === 0 && status?.enabled && (
+          <div className="space-y-3">
+            <p className="text-sm text-gray-700">
+              Two-factor authentication is enabled. {status.recovery_codes_remaining} recovery codes remaining.
+            </p>
+            <button
+              onClick={goToApp}
+              className="w-full py-2 px-4 text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700"
+            >
+              Continue
+            </button>
+          </div>
+        )}
+
+        {recoveryCodes.length === 0 && status && !status.enabled && !enrollment && (
+          <div className="space-y-3">
+            <p className="text-sm text-gray-700">
+              {status.required
+                ? 'Your role requires two-factor authentication. Set it up to continue using AgriOne.'
+                : 'Protect your account with a code from an authenticator app.'}
+            </p>
+            <button
+              onClick={startEnrollment}
+              disabled={isLoading}
+              className="w-full py-2 px-4 text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 disabled:opacity-50"
+            >
+              {isLoading ? 'Preparing...' : 'Set up authenticator app'}
+            </button>
+          </div>
+        )}
+
+        {enrollment && (
+          <form className="space-y-3" onSubmit={verify}>
+            <p className="text-sm text-gray-700">
+              Add AgriOne to your authenticator app by opening the link below on your phone, or enter the secret
+              manually. Then type the 6-digit code it shows.
+            </p>
+            <a href={enrollment.provisioning_uri} className="block text-sm text-indigo-600 break-all">
+              {enrollment.provisioning_uri}
+            </a>
+            <p className="font-mono text-sm bg-gray-50 p-3 rounded break-all">{enrollment.secret}</p>
+            <input
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              type="text"
+              inputMode="numeric"
+              autoComplete="one-time-code"
+              className="appearance-none rounded-md block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 sm:text-sm"
+              placeholder="123456"
+            />
+            <button
+              type="submit"
+              disabled={isLoading || !code}
+              className="w-full py-2 px-4 text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 disabled:opacity-50"
+            >
+              {isLoading ? 'Verifying...' : 'Verify and enable'}
+            </button>
+          </form>
+        )}
+      </div>
+    </div>
+  )
+}
@@ -20,6 +20,7 @@ export default function SuperAdminPage() {
   const [editingStatus, setEditingStatus] = useState<User | null>(null)
   const [selectedStatus, setSelectedStatus] = useState<string>('')
   const [statusNotes, setStatusNotes] = useState<string>('')
+  const [approveRole, setApproveRole] = useState<string>('')
 
   const roles = ['superadmin', 'Level 1', 'Level 2', 'Level 3', 'Level 4', 'user']
 
@@ -63,6 +64,7 @@ export default function SuperAdminPage() {
     setEditingStatus(user)
     setSelectedStatus(user.status || 'pending')
     setStatusNotes('')
+    setApproveRole(user.role)
   }
 
   const handleUpdateRole = async () => {
@@ -90,7 +92,14 @@ export default function SuperAdminPage() {
 
     setUpdating(true)
     try {
-      await usersAPI.updateUserStatus(editingStatus.id, selectedStatus, statusNotes || undefined)
+      // Pending signups go through the review actions so the applicant is emailed
+      if (editingStatus.status === 'pending' && selectedStatus === 'approved') {
+        await usersAPI.approveUser(editingStatus.id, approveRole, statusNotes || undefined)
+      } else if (editingStatus.status === 'pending' && selectedStatus === 'rejected') {
+        await usersAPI.rejectUser(editingStatus.id, statusNotes)
+      } else {
+        await usersAPI.updateUserStatus(editingStatus.id, selectedStatus, statusNotes || undefined)
+      }
       await loadUsers()
       setEditingStatus(null)
       setSelectedStatus('')
@@ -183,6 +192,24 @@ export default function SuperAdminPage() {
                       <option value="rejected">Perlu perbaikan</option>
                     </select>
                   </div>
+                  {editingStatus.status === 'pending' && selectedStatus === 'approved' && (
+                    <div className="mb-4">
+                      <label className="block text-sm font-medium text-gray-700 mb-2">
+                        Assign Role
+                      </label>
+                      <select
+                        value={approveRole}
+                        onChange={(e) => setApproveRole(e.target.value)}
+                        className="w-full px-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-purple-500 focus:border-transparent"
+                      >
+                        {roles.map((role) => (
+                          <option key={role} value={role}>
+                            {role}
+                          </option>
+                        ))}
+                      </select>
+                    </div>
+                  )}
                   {selectedStatus === 'rejected' && (
                     <div className="mb-6">
                       <label className="block text-sm font-medium text-gray-700 mb-2">
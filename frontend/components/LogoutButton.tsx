@@ -10,10 +10,12 @@ export default function LogoutButton() {
     try {
       await authAPI.logout()
       localStorage.removeItem('token')
+      localStorage.removeItem('refresh_token')
       router.push('/login')
     } catch (error) {
       // Even if API call fails, clear local storage and redirect
       localStorage.removeItem('token')
+      localStorage.removeItem('refresh_token')
       router.push('/login')
     }
   }
@@ -58,17 +58,65 @@ if (typeof window !== 'undefined') {
     return config
   })
 
+  // Access tokens are short-lived: on 401 exchange the refresh token once
+  // and retry. Concurrent requests share the same refresh call because the
+  // server rotates the refresh token on every use.
+  let refreshPromise: Promise<string | null> | null = null
+  const refreshAccessToken = (): Promise<string | null> => {
+    const refreshToken = localStorage.getItem('refresh_token')
+    if (!refreshToken) {
+      return Promise.resolve(null)
+    }
+    if (!refreshPromise) {
+      refreshPromise = api
+        .post<AuthResponse>('/token/refresh', { refresh_token: refreshToken })
+        .then((response) => {
+          if (!response.data.token) {
+            return null
+          }
+          localStorage.setItem('token', response.data.token)
+          if (response.data.refresh_token) {
+            localStorage.setItem('refresh_token', response.data.refresh_token)
+          }
+          return response.data.token
+        })
+        .catch(() => null)
+        .finally(() => {
+          refreshPromise = null
+        })
+    }
+    return refreshPromise
+  }
+
   api.interceptors.response.use(
     (response) => response,
     async (error) => {
+      const originalRequest = error.config
       if (error.response?.status === 401) {
+        const isAuthCall = ['/login', '/login/mfa', '/token/refresh'].includes(originalRequest?.url || '')
+        if (originalRequest && !originalRequest._retry && !isAuthCall) {
+          originalRequest._retry = true
+          const token = await refreshAccessToken()
+          if (token) {
+            originalRequest.headers.Authorization = `Bearer ${token}`
+            return api(originalRequest)
+          }
+        }
+
         // Check if dev mode is active, if so don't redirect
         const { isDevModeActive } = await import('./devAuth')
-        if (!isDevModeActive()) {
+        if (!isDevModeActive() && !isAuthCall) {
           localStorage.removeItem('token')
+          localStorage.removeItem('refresh_token')
           window.location.href = '/login'
         }
       }
+      // Roles that require two-factor authentication must enrol first
+      if (error.response?.status === 403 && error.response?.data?.error === 'mfa_enrollment_required') {
+        if (window.location.pathname !== '/mfa-setup') {
+          window.location.href = '/mfa-setup'
+        }
+      }
       return Promise.reject(error)
     }
   )
@@ -90,6 +138,11 @@ export interface LoginData {
 export interface AuthResponse {
   message: string
   token?: string
+  refresh_token?: string
+  expires_in?: number
+  mfa_required?: boolean
+  mfa_token?: string
+  mfa_enrollment_required?: boolean
   user: {
     id: number
     email: string
@@ -101,6 +154,15 @@ export interface AuthResponse {
   }
 }
 
+export interface Organization {
+  id: number
+  name: string
+  slug: string
+  role?: string
+  active?: boolean
+  created_at?: string
+}
+
 export interface User {
   id: number
   email: string
@@ -109,6 +171,7 @@ export interface User {
   last_name: string
   role: string
   status?: string
+  organization?: Organization
 }
 
 export interface UsersListResponse {
@@ -128,9 +191,35 @@ export const authAPI = {
     const response = await api.post<AuthResponse>('/login', data)
     return response.data
   },
+  loginMFA: async (mfaToken: string, code: string, recoveryCode?: string): Promise<AuthResponse> => {
+    const response = await api.post<AuthResponse>('/login/mfa', {
+      mfa_token: mfaToken,
+      code: recoveryCode ? '' : code,
+      recovery_code: recoveryCode || '',
+    })
+    return response.data
+  },
   logout: async (): Promise<void> => {
     await api.post('/logout')
   },
+  logoutAll: async (): Promise<void> => {
+    await api.post('/logout/all')
+  },
+  forgotPassword: async (email: string): Promise<AuthResponse> => {
+    const response = await api.post<AuthResponse>('/password/forgot', { email })
+    return response.data
+  },
+  resetPassword: async (token: string, newPassword: string): Promise<AuthResponse> => {
+    const response = await api.post<AuthResponse>('/password/reset', { token, new_password: newPassword })
+    return response.data
+  },
+  changePassword: async (currentPassword: string, newPassword: string): Promise<AuthResponse> => {
+    const response = await api.put<AuthResponse>('/profile/password', {
+      current_password: currentPassword,
+      new_password: newPassword,
+    })
+    return response.data
+  },
   getProfile: async (): Promise<User> => {
     // Check for dev mode bypass
     if (typeof window !== 'undefined') {
@@ -148,6 +237,159 @@ export const authAPI = {
   },
 }
 
+export const organizationsAPI = {
+  list: async (): Promise<Organization[]> => {
+    const response = await api.get<Organization[]>('/organizations')
+    return response.data
+  },
+  // Switching issues a new access token for the same session
+  switch: async (organizationId: number): Promise<AuthResponse> => {
+    const response = await api.post<AuthResponse>('/organizations/switch', { organization_id: organizationId })
+    if (response.data.token) {
+      localStorage.setItem('token', response.data.token)
+    }
+    return response.data
+  },
+}
+
+export interface APIKey {
+  id: number
+  name: string
+  prefix: string
+  scopes: string[]
+  expires_at?: string
+  last_used_at?: string
+  created_by?: number
+  created_at: string
+  revoked_at?: string
+}
+
+export interface ServiceAccount {
+  id: number
+  name: string
+  username: string
+  created_at: string
+  keys: APIKey[]
+}
+
+export const serviceAccountsAPI = {
+  list: async (): Promise<ServiceAccount[]> => {
+    const response = await api.get<ServiceAccount[]>('/service-accounts')
+    return response.data
+  },
+  create: async (name: string): Promise<ServiceAccount> => {
+    const response = await api.post<ServiceAccount>('/service-accounts', { name })
+    return response.data
+  },
+  // The returned key is shown once and cannot be retrieved again
+  createKey: async (id: number, data: { name: string; scopes: string[]; expires_at?: string }): Promise<APIKey & { key: string }> => {
+    const response = await api.post<APIKey & { key: string }>(`/service-accounts/${id}/keys`, data)
+    return response.data
+  },
+  revokeKey: async (id: number, keyId: number): Promise<void> => {
+    await api.post(`/service-accounts/${id}/keys/${keyId}/revoke`)
+  },
+}
+
+export interface AuditEntry {
+  id: number
+  actor_user_id?: number
+  actor_name?: string
+  api_key_id?: number
+  action: string
+  entity_type: string
+  entity_id?: string
+  before: unknown
+  after: unknown
+  ip_address: string
+  user_agent: string
+  status_code: number
+  created_at: string
+  hash: string
+}
+
+export interface AuditListResponse {
+  entries: AuditEntry[]
+  total: number
+  page: number
+  page_size: number
+  total_pages: number
+}
+
+export const auditAPI = {
+  list: async (params?: {
+    actor_user_id?: number
+    action?: string
+    entity_type?: string
+    entity_id?: string
+    from?: string
+    to?: string
+    page?: number
+    page_size?: number
+  }): Promise<AuditListResponse> => {
+    const response = await api.get<AuditListResponse>('/audit', { params })
+    return response.data
+  },
+  verify: async (): Promise<{ valid: boolean; checked: number; broken_at_id?: number; last_hash?: string }> => {
+    const response = await api.get('/audit/verify')
+    return response.data
+  },
+}
+
+export type LogLevel = 'debug' | 'info' | 'warn' | 'error'
+
+// Superadmin only; the level resets to LOG_LEVEL when the server restarts
+export const logLevelAPI = {
+  get: async (): Promise<{ level: LogLevel }> => {
+    const response = await api.get('/admin/log-level')
+    return response.data
+  },
+  set: async (level: LogLevel): Promise<{ level: LogLevel }> => {
+    const response = await api.put('/admin/log-level', { level })
+    return response.data
+  },
+}
+
+export interface MFAStatus {
+  enabled: boolean
+  required: boolean
+  enrollment_pending: boolean
+  enabled_at?: string
+  recovery_codes_remaining: number
+}
+
+export interface MFAEnrollResponse {
+  secret: string
+  provisioning_uri: string
+}
+
+export interface MFARecoveryCodesResponse {
+  message: string
+  recovery_codes: string[]
+}
+
+export const mfaAPI = {
+  getStatus: async (): Promise<MFAStatus> => {
+    const response = await api.get<MFAStatus>('/mfa')
+    return response.data
+  },
+  enroll: async (): Promise<MFAEnrollResponse> => {
+    const response = await api.post<MFAEnrollResponse>('/mfa/enroll')
+    return response.data
+  },
+  verify: async (code: string): Promise<MFARecoveryCodesResponse> => {
+    const response = await api.post<MFARecoveryCodesResponse>('/mfa/verify', { code })
+    return response.data
+  },
+  regenerateRecoveryCodes: async (code: string): Promise<MFARecoveryCodesResponse> => {
+    const response = await api.post<MFARecoveryCodesResponse>('/mfa/recovery-codes', { code })
+    return response.data
+  },
+  disable: async (password: string, code: string): Promise<void> => {
+    await api.post('/mfa/disable', { password, code })
+  },
+}
+
 export interface Field {
   id: number
   name: string
@@ -196,6 +438,7 @@ export interface WorkOrder {
   status: 'pending' | 'in-progress' | 'completed' | 'overdue' | 'cancelled'
   priority: 'low' | 'medium' | 'high'
   assignee: string
+  assignee_id?: number
   field_id?: number
   field_name?: string
   cultivation_season_id?: number
@@ -208,7 +451,9 @@ export interface WorkOrder {
   actual_hours?: number
   notes?: string
   created_by: string
+  created_by_id?: number
   last_updated_by?: string
+  last_updated_by_id?: number
   completed_date?: string
   created_at?: string
   updated_at?: string
@@ -227,6 +472,18 @@ export const usersAPI = {
     const response = await api.put<User>(`/users/${userId}/status`, { status, notes })
     return response.data
   },
+  listPendingUsers: async (): Promise<(User & { created_at: string })[]> => {
+    const response = await api.get<(User & { created_at: string })[]>('/users/pending')
+    return Array.isArray(response.data) ? response.data : []
+  },
+  approveUser: async (userId: number, role: string, reason?: string): Promise<User> => {
+    const response = await api.post<User>(`/users/${userId}/approve`, { role, reason })
+    return response.data
+  },
+  rejectUser: async (userId: number, reason: string): Promise<User> => {
+    const response = await api.post<User>(`/users/${userId}/reject`, { reason })
+    return response.data
+  },
 }
 
 export const fieldsAPI = {
@@ -329,6 +586,7 @@ export const workOrdersAPI = {
     field_id?: number
     field_ids?: number[] // Support for multiple field IDs (comma-separated)
     assignee?: string
+    assignee_id?: number
   }): Promise<WorkOrder[]> => {
     const queryParams = new URLSearchParams()
     if (params?.status) queryParams.append('status', params.status)
@@ -341,6 +599,7 @@ export const workOrdersAPI = {
       queryParams.append('field_id', params.field_id.toString())
     }
     if (params?.assignee) queryParams.append('assignee', params.assignee)
+    if (params?.assignee_id) queryParams.append('assignee_id', params.assignee_id.toString())
     
     const url = `/work-orders${queryParams.toString() ? '?' + queryParams.toString() : ''}`
     const response = await api.get<WorkOrder[]>(url)
@@ -426,6 +685,7 @@ export interface FieldReport {
   coordinates: { latitude: number; longitude: number }
   notes?: string
   submitted_by: string
+  submitted_by_id?: number
   work_order_id?: number
   progress?: number
   media: Array<{
@@ -437,6 +697,7 @@ export interface FieldReport {
   }>
   status: 'pending' | 'approved' | 'rejected'
   approved_by?: string
+  approved_by_id?: number
   approved_at?: string
   rejection_reason?: string
   harvest_quantity?: number // For Panen activity (in ton/kg)
@@ -451,6 +712,7 @@ export interface FieldReportComment {
   field_report_id: number
   comment: string
   commented_by: string
+  commented_by_id?: number
   created_at: string
   updated_at: string
 }
@@ -3,7 +3,7 @@ import type { NextRequest } from 'next/server'
 
 export function middleware(request: NextRequest) {
   // Allow public routes
-  const publicPaths = ['/login', '/signup', '/']
+  const publicPaths = ['/login', '/signup', '/forgot-password', '/reset-password', '/']
   const isPublicPath = publicPaths.some(path => request.nextUrl.pathname === path)
 
   if (isPublicPath) {